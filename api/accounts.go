@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/storage"
+)
+
+// maxAccountBodySize limits the body of account and ledger entry requests
+const maxAccountBodySize = 64 << 10
+
+// AccountHandler handles the loyalty account endpoints
+type AccountHandler struct {
+	store storage.ReceiptStorage
+}
+
+// NewAccountHandler creates a handler managing the loyalty accounts in store
+func NewAccountHandler(store storage.ReceiptStorage) *AccountHandler {
+	return &AccountHandler{store: store}
+}
+
+// decodeBody decodes a size-limited JSON body into v, writing the error
+// response and returning false when it cannot be decoded. An empty body
+// leaves v unchanged.
+func decodeBody(c *gin.Context, v any) bool {
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxAccountBodySize)
+	if err := json.NewDecoder(body).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			abortWithError(c, http.StatusRequestEntityTooLarge, rperrors.ErrRequestTooLarge)
+			return false
+		}
+		abortWithError(c, http.StatusBadRequest, rperrors.ErrInvalidJSON)
+		return false
+	}
+	return true
+}
+
+// CreateAccount handles the POST /accounts endpoint
+func (h *AccountHandler) CreateAccount(c *gin.Context) {
+	var req models.AccountRequest
+	if !decodeBody(c, &req) {
+		return
+	}
+
+	account, err := h.store.CreateAccount(c.Request.Context(), req.Name)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, account)
+}
+
+// GetBalance handles the GET /accounts/{id}/balance endpoint
+func (h *AccountHandler) GetBalance(c *gin.Context) {
+	account, err := h.store.GetAccount(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, models.BalanceResponse{AccountID: account.ID, Points: account.Balance})
+}
+
+// GetHistory handles the GET /accounts/{id}/history endpoint
+func (h *AccountHandler) GetHistory(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	postings, err := h.store.AccountHistory(ctx, id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	// The balance is the sum of the postings
+	response := models.HistoryResponse{AccountID: id, Entries: postings}
+	for _, posting := range postings {
+		response.Points += posting.Amount(id)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// PostEntry handles the POST /accounts/{id}/entries endpoint, posting an
+// adjustment, redemption or expiry
+func (h *AccountHandler) PostEntry(c *gin.Context) {
+	var req models.EntryRequest
+	if !decodeBody(c, &req) {
+		return
+	}
+
+	posting, err := h.store.PostEntry(c.Request.Context(), c.Param("id"), req)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, posting)
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/storage"
+)
+
+func setupAccountRouter(store storage.ReceiptStorage) *gin.Engine {
+	handler := NewAccountHandler(store)
+
+	router := gin.New()
+	router.POST("/accounts", handler.CreateAccount)
+	router.GET("/accounts/:id/balance", handler.GetBalance)
+	router.GET("/accounts/:id/history", handler.GetHistory)
+	router.POST("/accounts/:id/entries", handler.PostEntry)
+	return router
+}
+
+func TestAccountEndpoints(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	router := setupAccountRouter(store)
+
+	w := serve(router, http.MethodPost, "/accounts", `{"name":"Jane"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var account models.Account
+	if err := json.Unmarshal(w.Body.Bytes(), &account); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if account.ID == "" || account.Name != "Jane" {
+		t.Fatalf("Expected a new account named Jane, got %+v", account)
+	}
+
+	// Accounts earn the points of their receipts
+	receipt := models.Receipt{Retailer: "Target", AccountID: account.ID, Total: 35.35}
+	if _, err := store.SaveReceipt(context.Background(), receipt, models.PointsBreakdown{Total: 28}); err != nil {
+		t.Fatalf("Failed to save receipt: %v", err)
+	}
+
+	w = serve(router, http.MethodPost, "/accounts/"+account.ID+"/entries", `{"kind":"redeem","points":20}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	w = serve(router, http.MethodGet, "/accounts/"+account.ID+"/balance", "")
+	var balance models.BalanceResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &balance); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if w.Code != http.StatusOK || balance.AccountID != account.ID || balance.Points != 8 {
+		t.Errorf("Expected a balance of 8 points, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = serve(router, http.MethodGet, "/accounts/"+account.ID+"/history", "")
+	var history models.HistoryResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &history); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if w.Code != http.StatusOK || history.Points != 8 || len(history.Entries) != 2 ||
+		history.Entries[0].Kind != models.LedgerEarn || history.Entries[1].Kind != models.LedgerRedeem {
+		t.Errorf("Expected an earn and a redeem entry, got %d: %s", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		code   rperrors.ErrorCode
+	}{
+		{"Redeem more than the balance", http.MethodPost, "/accounts/" + account.ID + "/entries", `{"kind":"redeem","points":9}`, http.StatusBadRequest, rperrors.ErrInvalidLedgerEntry},
+		{"Unknown kind", http.MethodPost, "/accounts/" + account.ID + "/entries", `{"kind":"gift","points":9}`, http.StatusBadRequest, rperrors.ErrInvalidLedgerEntry},
+		{"Invalid JSON", http.MethodPost, "/accounts/" + account.ID + "/entries", `{`, http.StatusBadRequest, rperrors.ErrInvalidJSON},
+		{"Unknown account balance", http.MethodGet, "/accounts/non-existent-id/balance", "", http.StatusNotFound, rperrors.ErrAccountNotFound},
+		{"Unknown account history", http.MethodGet, "/accounts/non-existent-id/history", "", http.StatusNotFound, rperrors.ErrAccountNotFound},
+		{"Unknown account entry", http.MethodPost, "/accounts/non-existent-id/entries", `{"kind":"adjust","points":1}`, http.StatusNotFound, rperrors.ErrAccountNotFound},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := serve(router, tc.method, tc.path, tc.body)
+			if w.Code != tc.status {
+				t.Fatalf("Expected status %d, got %d: %s", tc.status, w.Code, w.Body.String())
+			}
+			var apiErr rperrors.APIError
+			if err := json.Unmarshal(w.Body.Bytes(), &apiErr); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if apiErr.Code != tc.code {
+				t.Errorf("Expected error code %s, got %s", tc.code, apiErr.Code)
+			}
+		})
+	}
+
+	// Accounts may be opened without a name
+	if w := serve(router, http.MethodPost, "/accounts", ""); w.Code != http.StatusCreated {
+		t.Errorf("Expected status %d for an empty body, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+}
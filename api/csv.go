@@ -0,0 +1,160 @@
+package api
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/marcelorm/receipt-processor/csvio"
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/storage"
+)
+
+// CSVContentType is the media type of imported and exported receipts
+const CSVContentType = "text/csv"
+
+// DefaultMaxImportSize is the largest CSV import accepted when no limit is
+// configured
+const DefaultMaxImportSize = 1 << 20
+
+// exportPageSize is the number of receipts read from storage at a time
+// while exporting
+const exportPageSize = 500
+
+// ImportResult is the outcome of a CSV import
+type ImportResult struct {
+	Imported int               `json:"imported"` // Receipts scored and stored
+	Failed   int               `json:"failed"`   // Receipts rejected
+	Receipts []ImportedReceipt `json:"receipts"` // One entry per receipt key, in order of first appearance
+}
+
+// ImportedReceipt is the outcome of one receipt in a CSV import
+type ImportedReceipt struct {
+	Key    string           `json:"key"`              // Receipt key shared by the receipt's rows
+	Rows   []int            `json:"rows"`             // Rows the receipt was read from, counting the header as row 1
+	ID     string           `json:"id,omitempty"`     // Receipt ID when the receipt was stored
+	Errors []csvio.RowError `json:"errors,omitempty"` // Why the receipt was rejected
+}
+
+// WithMaxImportSize limits the size of a CSV import
+func WithMaxImportSize(n int64) HandlerOption {
+	return func(h *ReceiptHandler) {
+		h.maxImportSize = n
+	}
+}
+
+// ImportReceipts handles the POST /receipts/import endpoint. The body is CSV
+// in the long format read by csvio, with column headers optionally mapped by
+// columns[field]=header query parameters. Every valid receipt is scored and
+// stored, and the response lists the outcome of each receipt with the rows
+// and columns of any problems.
+func (h *ReceiptHandler) ImportReceipts(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	mediaType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if err != nil || mediaType != CSVContentType {
+		writeError(c, http.StatusUnsupportedMediaType, rperrors.ErrInvalidRequest,
+			"Content-Type must be "+CSVContentType)
+		return
+	}
+	mapping := csvio.Mapping(c.QueryMap("columns"))
+	if err := mapping.Validate(); err != nil {
+		writeError(c, http.StatusBadRequest, rperrors.ErrInvalidRequest, "Invalid column mapping: "+err.Error())
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, h.maxImportSize)
+	groups, err := csvio.Read(body, mapping)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			abortWithError(c, http.StatusRequestEntityTooLarge, rperrors.ErrRequestTooLarge)
+			return
+		}
+		writeError(c, http.StatusBadRequest, rperrors.ErrInvalidCSV, "Invalid CSV: "+err.Error())
+		return
+	}
+
+	result := ImportResult{Receipts: make([]ImportedReceipt, 0, len(groups))}
+	for _, group := range groups {
+		imported := ImportedReceipt{Key: group.Key, Rows: group.Rows, Errors: group.Errors}
+		if len(group.Errors) > 0 {
+			h.metrics.ObserveValidationFailure(string(group.Errors[0].Code))
+		} else {
+			id, _, err := h.processor.Process(ctx, group.Receipt)
+			if rperrors.IsCode(err, rperrors.ErrContextCancelled) {
+				handleProcessError(c, err)
+				return
+			}
+			if err != nil {
+				apiErr := h.lineError(ctx, err)
+				imported.Errors = []csvio.RowError{{Row: group.Rows[0], Code: apiErr.Code, Message: apiErr.Message}}
+			}
+			imported.ID = id
+		}
+
+		if len(imported.Errors) > 0 {
+			result.Failed++
+		} else {
+			result.Imported++
+		}
+		result.Receipts = append(result.Receipts, imported)
+	}
+
+	h.logger.InfoContext(ctx, "Receipt import completed", "imported", result.Imported, "failed", result.Failed)
+	c.JSON(http.StatusOK, result)
+}
+
+// ExportReceipts handles the GET /receipts/export.csv endpoint, streaming
+// every stored receipt, or those of the retailer query parameter, as CSV
+// with one row per item along with its points and rule hits
+func (h *ReceiptHandler) ExportReceipts(c *gin.Context) {
+	ctx := c.Request.Context()
+	filter := storage.Filter{Retailer: c.Query("retailer"), Limit: exportPageSize}
+
+	// Read the first page before responding, so storage errors can still be
+	// reported with a status code
+	records, err := h.store.ListReceipts(ctx, filter)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Header("Content-Type", CSVContentType+"; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="receipts.csv"`)
+	c.Status(http.StatusOK)
+
+	writer := csvio.NewWriter(c.Writer)
+	if err := writer.WriteHeader(); err != nil {
+		h.logger.WarnContext(ctx, "Failed to write receipt export", "error", err)
+		return
+	}
+	exported := 0
+	for {
+		for _, record := range records {
+			if err := writer.Write(record); err != nil {
+				h.logger.WarnContext(ctx, "Failed to write receipt export", "error", err)
+				return
+			}
+		}
+		exported += len(records)
+		if err := writer.Flush(); err != nil {
+			h.logger.WarnContext(ctx, "Failed to write receipt export", "error", err)
+			return
+		}
+		if len(records) < filter.Limit {
+			break
+		}
+
+		filter.Offset += len(records)
+		if records, err = h.store.ListReceipts(ctx, filter); err != nil {
+			// The status has been sent, so the export ends early
+			h.logger.ErrorContext(ctx, "Receipt export stopped", "exported", exported, "error", err)
+			c.Set(errorCodeKey, rperrors.GetCode(err))
+			return
+		}
+	}
+
+	h.logger.InfoContext(ctx, "Receipt export completed", "exported", exported)
+}
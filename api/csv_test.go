@@ -0,0 +1,182 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/marcelorm/receipt-processor/csvio"
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/storage"
+)
+
+func setupCSVRouter(store storage.ReceiptStorage, opts ...HandlerOption) *gin.Engine {
+	handler := NewReceiptHandler(store, opts...)
+
+	router := gin.New()
+	router.POST("/receipts/import", handler.ImportReceipts)
+	router.GET("/receipts/export.csv", handler.ExportReceipts)
+	router.GET("/receipts/:id/points", handler.GetPoints)
+	return router
+}
+
+// importCSV posts body to the import endpoint of router
+func importCSV(router http.Handler, query, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/receipts/import"+query, strings.NewReader(body))
+	req.Header.Set("Content-Type", CSVContentType)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestImportReceipts(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	router := setupCSVRouter(store)
+
+	body := "Receipt,Store,purchaseDate,purchaseTime,total,shortDescription,price\n" +
+		"1,Target,2022-01-01,13:01,35.35,Mountain Dew 12PK,6.49\n" +
+		"1,,,,,Emils Cheese Pizza,12.25\n" +
+		"2,Walgreens,2022-01-02,08:13,2.65,Pepsi - 12-oz,abc\n" +
+		"1,,,,,Knorr Creamy Chicken,1.26\n" +
+		"1,,,,,Doritos Nacho Cheese,3.35\n" +
+		"1,,,,,   Klarbrunn 12-PK 12 FL OZ  ,12.00\n"
+	resp := importCSV(router, "?columns[retailer]=Store&columns[receipt]=Receipt", body)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, resp.Code, resp.Body.String())
+	}
+
+	var result ImportResult
+	if err := json.Unmarshal(resp.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if result.Imported != 1 || result.Failed != 1 || len(result.Receipts) != 2 {
+		t.Fatalf("Expected one imported and one failed receipt, got %s", resp.Body.String())
+	}
+
+	target := result.Receipts[0]
+	if target.Key != "1" || fmt.Sprint(target.Rows) != "[2 3 5 6 7]" || target.ID == "" {
+		t.Errorf("Expected receipt 1 from rows 2, 3, 5, 6 and 7 to be stored, got %+v", target)
+	}
+	points := httptest.NewRecorder()
+	router.ServeHTTP(points, httptest.NewRequest(http.MethodGet, "/receipts/"+target.ID+"/points", nil))
+	if !strings.Contains(points.Body.String(), `"points":28`) {
+		t.Errorf("Expected the Target receipt to be worth 28 points, got %s", points.Body.String())
+	}
+
+	walgreens := result.Receipts[1]
+	if walgreens.ID != "" || len(walgreens.Errors) != 1 {
+		t.Fatalf("Expected receipt 2 to be rejected with one error, got %+v", walgreens)
+	}
+	if err := walgreens.Errors[0]; err.Row != 4 || err.Column != "price" || err.Code != rperrors.ErrInvalidItemPrice {
+		t.Errorf("Expected an invalid price on row 4, got %+v", err)
+	}
+
+	if count, _ := store.Count(context.Background()); count != 1 {
+		t.Errorf("Expected 1 stored receipt, got %d", count)
+	}
+}
+
+func TestImportReceiptsErrors(t *testing.T) {
+	router := setupCSVRouter(storage.NewMemoryStorage(), WithMaxImportSize(256))
+	header := "receipt,retailer,purchaseDate,purchaseTime,total,shortDescription,price\n"
+
+	tests := []struct {
+		name        string
+		contentType string
+		query       string
+		body        string
+		status      int
+		code        rperrors.ErrorCode
+	}{
+		{"Wrong content type", "application/json", "", header, http.StatusUnsupportedMediaType, rperrors.ErrInvalidRequest},
+		{"Unknown mapped field", CSVContentType, "?columns[store]=Store", header, http.StatusBadRequest, rperrors.ErrInvalidRequest},
+		{"Missing column", CSVContentType, "", "receipt,retailer\n", http.StatusBadRequest, rperrors.ErrInvalidCSV},
+		{"Malformed CSV", CSVContentType, "", header + "1,\"Target\n", http.StatusBadRequest, rperrors.ErrInvalidCSV},
+		{"Too large", CSVContentType, "", header + strings.Repeat("1,Target,2022-01-01,13:01,1.00,Gum,1.00\n", 10), http.StatusRequestEntityTooLarge, rperrors.ErrRequestTooLarge},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/receipts/import"+tc.query, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			if resp.Code != tc.status {
+				t.Errorf("Expected status code %d, got %d", tc.status, resp.Code)
+			}
+			var apiErr rperrors.APIError
+			if err := json.Unmarshal(resp.Body.Bytes(), &apiErr); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if apiErr.Code != tc.code {
+				t.Errorf("Expected error code %s, got %s", tc.code, apiErr.Code)
+			}
+		})
+	}
+}
+
+func TestExportReceipts(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	router := setupCSVRouter(store)
+
+	// Export more receipts than fit in one page of storage reads
+	var body strings.Builder
+	body.WriteString("receipt,retailer,purchaseDate,purchaseTime,total,shortDescription,price\n")
+	for i := 0; i < exportPageSize+1; i++ {
+		retailer := "Target"
+		if i%2 == 1 {
+			retailer = "Walgreens"
+		}
+		fmt.Fprintf(&body, "%d,%s,2022-01-01,13:01,2.00,Gum,1.00\n%d,,,,,Mints,1.00\n", i, retailer, i)
+	}
+	if resp := importCSV(router, "", body.String()); resp.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, resp.Code, resp.Body.String())
+	}
+
+	tests := []struct {
+		name string
+		path string
+		rows int
+	}{
+		{"All receipts", "/receipts/export.csv", 2 * (exportPageSize + 1)},
+		{"One retailer", "/receipts/export.csv?retailer=walgreens", exportPageSize},
+		{"No receipts", "/receipts/export.csv?retailer=Costco", 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			if resp.Code != http.StatusOK {
+				t.Fatalf("Expected status code %d, got %d", http.StatusOK, resp.Code)
+			}
+			if got := resp.Header().Get("Content-Type"); !strings.HasPrefix(got, CSVContentType) {
+				t.Errorf("Expected Content-Type %s, got %s", CSVContentType, got)
+			}
+
+			records, err := csv.NewReader(resp.Body).ReadAll()
+			if err != nil {
+				t.Fatalf("Failed to parse export: %v", err)
+			}
+			if len(records) != tc.rows+1 {
+				t.Fatalf("Expected a header and %d rows, got %d rows", tc.rows, len(records))
+			}
+			if tc.rows == 0 {
+				return
+			}
+			column := func(name string) string { return records[1][slices.Index(records[0], name)] }
+			points, rules := column(csvio.ColumnPoints), column(csvio.ColumnRules)
+			if points == "" || !strings.Contains(rules, "RoundDollarRule:50") {
+				t.Errorf("Expected points and rule hits in the export, got %v", records[1])
+			}
+		})
+	}
+}
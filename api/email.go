@@ -0,0 +1,75 @@
+package api
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/marcelorm/receipt-processor/email"
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/models"
+)
+
+// EmailContentType is the media type of receipts sent as email messages
+const EmailContentType = "message/rfc822"
+
+// EmailReceiptResponse is returned when processing a receipt sent by email
+type EmailReceiptResponse struct {
+	models.ReceiptResponse
+	Template   string  `json:"template,omitempty"` // Retailer template used, empty when the text parser was used
+	Confidence float64 `json:"confidence"`         // How sure the extraction is of the receipt, from 0 to 1
+}
+
+// WithEmailExtractor extracts emailed receipts with the given extractor, for
+// example to add retailer templates
+func WithEmailExtractor(extractor *email.Extractor) HandlerOption {
+	return func(h *ReceiptHandler) {
+		h.extractor = extractor
+	}
+}
+
+// ProcessEmail handles the POST /receipts/email endpoint. The body is a raw
+// RFC 822 message, such as a forwarded e-receipt saved as .eml, whose text
+// and HTML bodies are read with the template of the retailer that sent it.
+// The extracted receipt is validated, scored and stored like a JSON receipt.
+func (h *ReceiptHandler) ProcessEmail(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	mediaType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if err != nil || mediaType != EmailContentType {
+		writeError(c, http.StatusUnsupportedMediaType, rperrors.ErrInvalidRequest,
+			"Content-Type must be "+EmailContentType)
+		return
+	}
+
+	msg, err := email.ReadMessage(http.MaxBytesReader(c.Writer, c.Request.Body, h.maxImportSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			abortWithError(c, http.StatusRequestEntityTooLarge, rperrors.ErrRequestTooLarge)
+			return
+		}
+		writeError(c, http.StatusBadRequest, rperrors.ErrInvalidEmail, "Invalid email: "+err.Error())
+		return
+	}
+
+	result := h.extractor.Extract(msg)
+	if !result.Complete() {
+		h.logger.WarnContext(ctx, "Unparsable emailed receipt", "missing", result.Missing, "template", result.Template)
+		writeError(c, http.StatusBadRequest, rperrors.ErrUnparsableReceipt,
+			"Unable to find "+strings.Join(result.Missing, ", ")+" in email")
+		return
+	}
+	id, _, err := h.processor.Process(ctx, result.Receipt)
+	if err != nil {
+		handleProcessError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, EmailReceiptResponse{
+		ReceiptResponse: models.ReceiptResponse{ID: id},
+		Template:        result.Template,
+		Confidence:      result.Confidence,
+	})
+}
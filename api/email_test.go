@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/storage"
+)
+
+func setupEmailRouter(opts ...HandlerOption) *gin.Engine {
+	handler := NewReceiptHandler(storage.NewMemoryStorage(), opts...)
+
+	router := gin.New()
+	router.POST("/receipts/email", handler.ProcessEmail)
+	router.GET("/receipts/:id/points", handler.GetPoints)
+	return router
+}
+
+// postEmail posts body to the email endpoint of router
+func postEmail(router http.Handler, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/receipts/email", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestProcessEmail(t *testing.T) {
+	router := setupEmailRouter()
+
+	tests := []struct {
+		fixture  string
+		template string
+		points   string
+	}{
+		{"target.eml", "Target", `"points":28`},
+		{"generic.eml", "", `"points":109`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.fixture, func(t *testing.T) {
+			body, err := os.ReadFile("../email/testdata/" + tc.fixture)
+			if err != nil {
+				t.Fatalf("Failed to read fixture: %v", err)
+			}
+			resp := postEmail(router, EmailContentType, string(body))
+			if resp.Code != http.StatusOK {
+				t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, resp.Code, resp.Body.String())
+			}
+
+			var result EmailReceiptResponse
+			if err := json.Unmarshal(resp.Body.Bytes(), &result); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if result.ID == "" || result.Template != tc.template {
+				t.Errorf("Expected a receipt ID and template %q, got %+v", tc.template, result)
+			}
+
+			points := httptest.NewRecorder()
+			router.ServeHTTP(points, httptest.NewRequest(http.MethodGet, "/receipts/"+result.ID+"/points", nil))
+			if !strings.Contains(points.Body.String(), tc.points) {
+				t.Errorf("Expected %s, got %s", tc.points, points.Body.String())
+			}
+		})
+	}
+}
+
+func TestProcessEmailErrors(t *testing.T) {
+	router := setupEmailRouter(WithMaxImportSize(256))
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		code        rperrors.ErrorCode
+	}{
+		{"Wrong content type", "text/plain", "From: a@example.com\n\nhi", http.StatusUnsupportedMediaType, rperrors.ErrInvalidRequest},
+		{"Not a message", EmailContentType, "hello", http.StatusBadRequest, rperrors.ErrInvalidEmail},
+		{"No receipt", EmailContentType, "From: Shop <a@example.com>\n\nThanks for your order!", http.StatusBadRequest, rperrors.ErrUnparsableReceipt},
+		{"Too large", EmailContentType, "From: a@example.com\n\n" + strings.Repeat("Gum  1.00\n", 30), http.StatusRequestEntityTooLarge, rperrors.ErrRequestTooLarge},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := postEmail(router, tc.contentType, tc.body)
+			if resp.Code != tc.status {
+				t.Errorf("Expected status code %d, got %d", tc.status, resp.Code)
+			}
+			var apiErr rperrors.APIError
+			if err := json.Unmarshal(resp.Body.Bytes(), &apiErr); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if apiErr.Code != tc.code {
+				t.Errorf("Expected error code %s, got %s", tc.code, apiErr.Code)
+			}
+		})
+	}
+}
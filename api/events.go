@@ -0,0 +1,133 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/events"
+)
+
+// DefaultHeartbeat is how often an idle event stream sends a comment to keep
+// the connection open
+const DefaultHeartbeat = 15 * time.Second
+
+// retryInterval is the reconnection delay suggested to event stream clients
+const retryInterval = 3 * time.Second
+
+// EventStreamHandler serves scoring activity as Server-Sent Events
+type EventStreamHandler struct {
+	bus       *events.Bus
+	heartbeat time.Duration
+	logger    *slog.Logger
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewEventStreamHandler creates a handler streaming the events published on
+// bus, sending a heartbeat on idle streams every heartbeat
+func NewEventStreamHandler(bus *events.Bus, heartbeat time.Duration, logger *slog.Logger) *EventStreamHandler {
+	return &EventStreamHandler{
+		bus:       bus,
+		heartbeat: heartbeat,
+		logger:    logger,
+		done:      make(chan struct{}),
+	}
+}
+
+// Close ends every open stream, so that a graceful shutdown does not wait
+// for clients to disconnect
+func (h *EventStreamHandler) Close() {
+	h.closeOnce.Do(func() {
+		close(h.done)
+	})
+}
+
+// StreamEvents handles the GET /events endpoint. Events can be filtered by
+// retailer and by the tenant the receipts were submitted for, and a client
+// reconnecting with the Last-Event-ID header first receives the buffered
+// events it missed.
+func (h *EventStreamHandler) StreamEvents(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	filter := events.Filter{Retailer: c.Query("retailer"), Tenant: c.Query("tenant")}
+
+	var lastID uint64
+	if header := c.GetHeader("Last-Event-ID"); header != "" {
+		id, err := strconv.ParseUint(header, 10, 64)
+		if err != nil {
+			writeError(c, http.StatusBadRequest, rperrors.ErrInvalidRequest, "Last-Event-ID must be an event ID")
+			return
+		}
+		lastID = id
+	}
+
+	sub, err := h.bus.Subscribe(filter, lastID)
+	if err != nil {
+		if errors.Is(err, events.ErrTooManySubscribers) {
+			c.Header("Retry-After", strconv.Itoa(int(retryInterval.Seconds())))
+			abortWithError(c, http.StatusServiceUnavailable, rperrors.ErrTooManySubscribers)
+			return
+		}
+		handleError(c, rperrors.Wrap(rperrors.ErrInternal, err, "unable to subscribe to events"))
+		return
+	}
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// Stop proxies such as nginx from buffering the stream
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", retryInterval.Milliseconds())
+	c.Writer.Flush()
+
+	h.logger.InfoContext(ctx, "Event stream opened", "retailer", filter.Retailer, "tenant", filter.Tenant, "last_event_id", lastID)
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.done:
+			return
+		case event, ok := <-sub.Events():
+			if !ok {
+				// Disconnected for falling behind; the client resumes with
+				// the last event it received
+				h.logger.WarnContext(ctx, "Event stream closed for a slow client")
+				return
+			}
+			if err := writeEvent(c.Writer, event); err != nil {
+				h.logger.WarnContext(ctx, "Failed to write event", "error", err)
+				return
+			}
+			heartbeat.Reset(h.heartbeat)
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
+
+// writeEvent writes event in the Server-Sent Events format
+func writeEvent(w http.ResponseWriter, event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/events"
+)
+
+// sseMessage is a single message read from an event stream
+type sseMessage struct {
+	id, event, data, comment string
+}
+
+// readMessage reads the next message from an event stream, skipping the
+// retry field
+func readMessage(t *testing.T, r *bufio.Reader) sseMessage {
+	t.Helper()
+	var msg sseMessage
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read event stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			if msg != (sseMessage{}) {
+				return msg
+			}
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			msg.id = value
+		case "event":
+			msg.event = value
+		case "data":
+			msg.data = value
+		case "":
+			msg.comment = value
+		}
+	}
+}
+
+// openStream starts an event stream request and returns its body reader
+func openStream(t *testing.T, url, lastEventID string) (*http.Response, *bufio.Reader) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp, bufio.NewReader(resp.Body)
+}
+
+func setupEventServer(t *testing.T, bus *events.Bus, heartbeat time.Duration) *httptest.Server {
+	handler := NewEventStreamHandler(bus, heartbeat, slog.Default())
+	router := gin.New()
+	router.GET("/events", handler.StreamEvents)
+	server := httptest.NewServer(router)
+	t.Cleanup(func() {
+		handler.Close()
+		server.Close()
+	})
+	return server
+}
+
+func TestStreamEvents(t *testing.T) {
+	bus := events.NewBus()
+	server := setupEventServer(t, bus, time.Hour)
+
+	resp, stream := openStream(t, server.URL+"/events?retailer=target", "")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	waitForSubscribers(t, bus, 1)
+	bus.Publish(events.Event{Type: events.TypeReceiptProcessed, ReceiptID: "r1", Retailer: "Walmart"})
+	bus.Publish(events.Event{Type: events.TypeReceiptProcessed, ReceiptID: "r2", Retailer: "Target", Points: 6})
+
+	msg := readMessage(t, stream)
+	if msg.event != events.TypeReceiptProcessed || msg.id == "" {
+		t.Errorf("Expected a %s event with an ID, got %+v", events.TypeReceiptProcessed, msg)
+	}
+	var event events.Event
+	if err := json.Unmarshal([]byte(msg.data), &event); err != nil {
+		t.Fatalf("Failed to decode event data: %v", err)
+	}
+	if event.ReceiptID != "r2" || event.Points != 6 {
+		t.Errorf("Expected only the Target receipt r2, got %+v", event)
+	}
+
+	// Reconnecting with the last event ID replays what was missed
+	resp.Body.Close()
+	waitForSubscribers(t, bus, 0)
+	bus.Publish(events.Event{Type: events.TypeReceiptProcessed, ReceiptID: "r3", Retailer: "Target"})
+
+	_, stream = openStream(t, server.URL+"/events?retailer=target", msg.id)
+	resumed := readMessage(t, stream)
+	if err := json.Unmarshal([]byte(resumed.data), &event); err != nil {
+		t.Fatalf("Failed to decode event data: %v", err)
+	}
+	if event.ReceiptID != "r3" {
+		t.Errorf("Expected the missed receipt r3, got %+v", event)
+	}
+}
+
+func TestStreamEventsTenant(t *testing.T) {
+	bus := events.NewBus()
+	server := setupEventServer(t, bus, time.Hour)
+
+	_, stream := openStream(t, server.URL+"/events?tenant=acme", "")
+	waitForSubscribers(t, bus, 1)
+	bus.Publish(events.Event{Type: events.TypeReceiptProcessed, ReceiptID: "r1", Retailer: "Target"})
+	bus.Publish(events.Event{Type: events.TypeReceiptProcessed, ReceiptID: "r2", Retailer: "Target", Tenant: "globex"})
+	bus.Publish(events.Event{Type: events.TypeReceiptProcessed, ReceiptID: "r3", Retailer: "Target", Tenant: "acme"})
+
+	var event events.Event
+	if err := json.Unmarshal([]byte(readMessage(t, stream).data), &event); err != nil {
+		t.Fatalf("Failed to decode event data: %v", err)
+	}
+	if event.ReceiptID != "r3" || event.Tenant != "acme" {
+		t.Errorf("Expected only the acme receipt r3, got %+v", event)
+	}
+}
+
+func TestStreamEventsHeartbeat(t *testing.T) {
+	bus := events.NewBus()
+	server := setupEventServer(t, bus, 10*time.Millisecond)
+
+	_, stream := openStream(t, server.URL+"/events", "")
+	if msg := readMessage(t, stream); msg.comment != "heartbeat" {
+		t.Errorf("Expected a heartbeat comment, got %+v", msg)
+	}
+}
+
+func TestStreamEventsErrors(t *testing.T) {
+	bus := events.NewBus(events.WithMaxSubscribers(1))
+	server := setupEventServer(t, bus, time.Hour)
+
+	// Occupy the only subscriber slot
+	openStream(t, server.URL+"/events", "")
+	waitForSubscribers(t, bus, 1)
+
+	tests := []struct {
+		name        string
+		query       string
+		lastEventID string
+		status      int
+		code        rperrors.ErrorCode
+	}{
+		{"Invalid Last-Event-ID", "", "abc", http.StatusBadRequest, rperrors.ErrInvalidRequest},
+		{"Too many subscribers", "", "", http.StatusServiceUnavailable, rperrors.ErrTooManySubscribers},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, _ := openStream(t, server.URL+"/events"+tc.query, tc.lastEventID)
+			if resp.StatusCode != tc.status {
+				t.Errorf("Expected status %d, got %d", tc.status, resp.StatusCode)
+			}
+			var apiErr rperrors.APIError
+			if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil {
+				t.Fatalf("Failed to decode error: %v", err)
+			}
+			if apiErr.Code != tc.code {
+				t.Errorf("Expected error code %s, got %s", tc.code, apiErr.Code)
+			}
+		})
+	}
+}
+
+// waitForSubscribers waits until bus has n subscribers
+func waitForSubscribers(t *testing.T, bus *events.Bus, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for bus.Subscribers() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d subscribers, got %d", n, bus.Subscribers())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
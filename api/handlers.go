@@ -5,22 +5,94 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/marcelorm/receipt-processor/email"
 	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/metrics"
 	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/parser"
+	"github.com/marcelorm/receipt-processor/requestid"
 	"github.com/marcelorm/receipt-processor/services"
+	"github.com/marcelorm/receipt-processor/services/rules"
 	"github.com/marcelorm/receipt-processor/storage"
 )
 
+// Gin context keys describing a failed request to the metrics middleware
+const (
+	errorCodeKey = "error_code" // Error code of a failed request
+	countedKey   = "counted"    // Set when the processor already counted the rejection
+)
+
 // ReceiptHandler handles receipt-related HTTP endpoints
 type ReceiptHandler struct {
-	store storage.ReceiptStorage
+	store      storage.ReceiptStorage
+	calculator *services.Calculator
+	processor  *services.Processor
+	metrics    *metrics.Metrics
+	logger     *slog.Logger
+	extractor  *email.Extractor
+
+	maxLineSize   int64 // Largest receipt accepted on a line of a stream
+	maxImportSize int64 // Largest CSV import or email accepted
+}
+
+// HandlerOption configures optional dependencies of a ReceiptHandler
+type HandlerOption func(*ReceiptHandler)
+
+// WithMetrics records scoring metrics for every processed receipt
+func WithMetrics(m *metrics.Metrics) HandlerOption {
+	return func(h *ReceiptHandler) {
+		h.metrics = m
+	}
+}
+
+// WithCalculator scores receipts with the given calculator instead of the default rules
+func WithCalculator(calculator *services.Calculator) HandlerOption {
+	return func(h *ReceiptHandler) {
+		h.calculator = calculator
+	}
+}
+
+// WithLogger logs through the given logger instead of the default logger
+func WithLogger(logger *slog.Logger) HandlerOption {
+	return func(h *ReceiptHandler) {
+		h.logger = logger
+	}
 }
 
 // NewReceiptHandler creates a new receipt handler
-func NewReceiptHandler(store storage.ReceiptStorage) *ReceiptHandler {
-	return &ReceiptHandler{
-		store: store,
+func NewReceiptHandler(store storage.ReceiptStorage, opts ...HandlerOption) *ReceiptHandler {
+	h := &ReceiptHandler{
+		store:         store,
+		logger:        slog.Default(),
+		maxLineSize:   DefaultMaxLineSize,
+		maxImportSize: DefaultMaxImportSize,
 	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.calculator == nil {
+		h.calculator = services.NewCalculator(rules.GetAllRules(), h.logger)
+	}
+	h.processor = services.NewProcessor(h.calculator, h.store, h.metrics, h.logger)
+	if h.extractor == nil {
+		h.extractor = email.NewExtractor()
+	}
+	return h
+}
+
+// writeError writes an APIError response and records its code on the context
+func writeError(c *gin.Context, status int, code rperrors.ErrorCode, message string) {
+	c.Set(errorCodeKey, code)
+	c.AbortWithStatusJSON(status, rperrors.APIError{
+		Code:      code,
+		Message:   message,
+		RequestID: requestid.FromContext(c.Request.Context()),
+	})
+}
+
+// abortWithError writes an APIError response using the standard message for code
+func abortWithError(c *gin.Context, status int, code rperrors.ErrorCode) {
+	writeError(c, status, code, rperrors.Error(code))
 }
 
 // handleError standardizes error response handling across endpoints
@@ -40,13 +112,19 @@ func handleError(c *gin.Context, err error) {
 			rperrors.ErrInvalidRetailer,
 			rperrors.ErrInvalidPurchaseDate,
 			rperrors.ErrInvalidPurchaseTime,
+			rperrors.ErrInvalidTimeZone,
+			rperrors.ErrInvalidRefund,
+			rperrors.ErrInvalidCurrency,
+			rperrors.ErrInvalidAccount,
+			rperrors.ErrInvalidLedgerEntry,
 			rperrors.ErrInvalidTotal,
 			rperrors.ErrMissingItems,
 			rperrors.ErrInvalidItemData,
 			rperrors.ErrInvalidItemDescription,
-			rperrors.ErrInvalidItemPrice:
+			rperrors.ErrInvalidItemPrice,
+			rperrors.ErrInvalidWebhook:
 			status = http.StatusBadRequest
-		case rperrors.ErrReceiptNotFound:
+		case rperrors.ErrReceiptNotFound, rperrors.ErrWebhookNotFound, rperrors.ErrAccountNotFound:
 			status = http.StatusNotFound
 		case rperrors.ErrContextCancelled:
 			status = http.StatusRequestTimeout
@@ -55,19 +133,20 @@ func handleError(c *gin.Context, err error) {
 		}
 
 		// Return error response with code and message
-		c.JSON(status, rperrors.APIError{
-			Code:    appErr.Code,
-			Message: appErr.Message,
-		})
+		writeError(c, status, appErr.Code, appErr.Message)
 		return
 	}
 
 	// Handle generic errors (should be avoided in production)
 	slog.ErrorContext(ctx, "Unexpected non-application error", "error", err)
-	c.JSON(http.StatusInternalServerError, rperrors.APIError{
-		Code:    rperrors.ErrInternal,
-		Message: "An unexpected error occurred",
-	})
+	writeError(c, http.StatusInternalServerError, rperrors.ErrInternal, "An unexpected error occurred")
+}
+
+// handleProcessError responds with an error returned by the processor, which
+// has already counted rejected receipts
+func handleProcessError(c *gin.Context, err error) {
+	c.Set(countedKey, true)
+	handleError(c, err)
 }
 
 // ProcessReceipt handles the POST /receipts/process endpoint
@@ -85,36 +164,22 @@ func (h *ReceiptHandler) ProcessReceipt(c *gin.Context) {
 		return
 	}
 
-	// Calculate points for the receipt
-	points, err := services.CalculatePoints(ctx, receipt)
+	id, _, err := h.processor.Process(ctx, receipt)
 	if err != nil {
-		if rperrors.IsCode(err, rperrors.ErrContextCancelled) {
-			handleError(c, err)
-		} else {
-			handleError(c, rperrors.Wrap(rperrors.ErrCalculationFailed, err,
-				"error calculating points for receipt"))
-		}
+		handleProcessError(c, err)
 		return
 	}
 
-	// Store the points and get an ID
-	id, err := h.store.SaveReceipt(ctx, points)
-	if err != nil {
-		if rperrors.IsCode(err, rperrors.ErrContextCancelled) {
-			handleError(c, err)
-		} else {
-			handleError(c, rperrors.Wrap(rperrors.ErrStorageFailure, err,
-				"unable to save receipt points"))
-		}
+	// Return the ID, along with how a text receipt was parsed
+	if result, ok := c.Get(parseResultKey); ok {
+		parsed := result.(parser.Result)
+		c.JSON(http.StatusOK, ParsedReceiptResponse{
+			ReceiptResponse: models.ReceiptResponse{ID: id},
+			Confidence:      parsed.Confidence,
+			Unparsed:        parsed.Unparsed,
+		})
 		return
 	}
-
-	slog.InfoContext(ctx, "Receipt processed successfully",
-		"id", id,
-		"points", points,
-		"retailer", receipt.Retailer)
-
-	// Return the ID
 	c.JSON(http.StatusOK, models.ReceiptResponse{ID: id})
 }
 
@@ -132,7 +197,7 @@ func (h *ReceiptHandler) GetPoints(c *gin.Context) {
 		return
 	}
 
-	slog.InfoContext(ctx, "Getting points for receipt", "id", id)
+	h.logger.InfoContext(ctx, "Getting points for receipt", "id", id)
 
 	// Look up the points for the ID
 	points, err := h.store.GetPoints(ctx, id)
@@ -146,8 +211,31 @@ func (h *ReceiptHandler) GetPoints(c *gin.Context) {
 		return
 	}
 
-	slog.InfoContext(ctx, "Points retrieved successfully", "id", id, "points", points)
+	h.logger.InfoContext(ctx, "Points retrieved successfully", "id", id, "points", points)
 
 	// Return the points
 	c.JSON(http.StatusOK, models.PointsResponse{Points: points})
 }
+
+// GetLedger handles the GET /receipts/{id}/ledger endpoint
+func (h *ReceiptHandler) GetLedger(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	entries, err := h.store.Ledger(ctx, id)
+	if err != nil {
+		if rperrors.IsCode(err, rperrors.ErrReceiptNotFound) {
+			handleError(c, err)
+			return
+		}
+		handleError(c, rperrors.Wrap(rperrors.ErrInternal, err, "error retrieving ledger for ID "+id))
+		return
+	}
+
+	// The points held are the sum of the entries
+	response := models.LedgerResponse{Entries: entries}
+	for _, entry := range entries {
+		response.Points += entry.Points
+	}
+	c.JSON(http.StatusOK, response)
+}
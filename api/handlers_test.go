@@ -1,17 +1,33 @@
 package api
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/metrics"
 	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/requestid"
+	"github.com/marcelorm/receipt-processor/services"
+	"github.com/marcelorm/receipt-processor/services/rules"
 	"github.com/marcelorm/receipt-processor/storage"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func init() {
@@ -224,3 +240,431 @@ func TestGetPoints(t *testing.T) {
 		})
 	}
 }
+
+func TestMetrics(t *testing.T) {
+	m := metrics.New()
+	store := m.InstrumentStorage(context.Background(), storage.NewMemoryStorage())
+	calculator := services.NewCalculator(rules.GetAllRules(), nil, services.WithReconciliation(0.01, services.ReconcileReject))
+	handler := NewReceiptHandler(store, WithMetrics(m), WithCalculator(calculator))
+
+	router := gin.New()
+	router.Use(MetricsMiddleware(m))
+	router.Use(JSONValidationMiddleware(1024 * 1024))
+	router.POST("/receipts/process", handler.ProcessReceipt)
+	router.POST("/receipts/stream", handler.StreamReceipts)
+	router.POST("/receipts/import", handler.ImportReceipts)
+	router.POST("/receipts/email", handler.ProcessEmail)
+	router.GET("/metrics", gin.WrapH(m.Handler()))
+
+	requests := []map[string]any{
+		{
+			"retailer":     "Target",
+			"purchaseDate": "2022-01-01",
+			"purchaseTime": "13:01",
+			"items": []map[string]any{
+				{"shortDescription": "Mountain Dew 12PK", "price": "6.49"},
+			},
+			"total": "6.49",
+		},
+		{
+			"retailer":     "", // Missing retailer
+			"purchaseDate": "2022-01-01",
+			"purchaseTime": "13:01",
+			"items": []map[string]any{
+				{"shortDescription": "Item", "price": "5.00"},
+			},
+			"total": "5.00",
+		},
+	}
+	for _, receipt := range requests {
+		reqBody, _ := json.Marshal(receipt)
+		req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBuffer(reqBody))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// A total that does not add up is rejected once by each endpoint
+	unreconciled := `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01",` +
+		`"items":[{"shortDescription":"Gum","price":"1.00"}],"total":"100.00"}`
+	req, _ := http.NewRequest("POST", "/receipts/process", strings.NewReader(unreconciled))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	req, _ = http.NewRequest("POST", "/receipts/stream", strings.NewReader(unreconciled+"\n"))
+	req.Header.Set("Content-Type", NDJSONContentType)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	// So is a receipt for an unknown loyalty account
+	unknownAccount := `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","accountId":"non-existent-id",` +
+		`"items":[{"shortDescription":"Gum","price":"1.00"}],"total":"1.00"}`
+	req, _ = http.NewRequest("POST", "/receipts/process", strings.NewReader(unknownAccount))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	req, _ = http.NewRequest("POST", "/receipts/stream", strings.NewReader(unknownAccount+"\n"))
+	req.Header.Set("Content-Type", NDJSONContentType)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	// Files and emails that cannot be read are counted once
+	req, _ = http.NewRequest("POST", "/receipts/import", strings.NewReader("receipt,retailer\n"))
+	req.Header.Set("Content-Type", CSVContentType)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	req, _ = http.NewRequest("POST", "/receipts/email", strings.NewReader("not an email"))
+	req.Header.Set("Content-Type", "message/rfc822")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	// Scrape the endpoint like Prometheus would
+	req, _ = http.NewRequest("GET", "/metrics", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, resp.Code)
+	}
+
+	body := resp.Body.String()
+	expected := []string{
+		`receipt_processor_http_requests_total{method="POST",route="/receipts/process",status="200"} 1`,
+		`receipt_processor_http_requests_total{method="POST",route="/receipts/process",status="400"} 3`,
+		`receipt_processor_validation_failures_total{code="RP0102"} 1`,
+		`receipt_processor_validation_failures_total{code="RP0105"} 2`,
+		`receipt_processor_validation_failures_total{code="RP0114"} 2`,
+		`receipt_processor_validation_failures_total{code="RP0007"} 1`,
+		`receipt_processor_validation_failures_total{code="RP0009"} 1`,
+		`receipt_processor_receipts_processed_total 1`,
+		`receipt_processor_rule_hits_total{rule="RetailerNameRule"} 1`,
+		`receipt_processor_storage_receipts 1`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line) {
+			t.Errorf("Expected metrics to contain %q", line)
+		}
+	}
+}
+
+func TestTracingPropagation(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	router := gin.New()
+	router.Use(TracingMiddleware())
+	router.Use(JSONValidationMiddleware(1024 * 1024))
+	handler := NewReceiptHandler(storage.NewMemoryStorage())
+	router.POST("/receipts/process", handler.ProcessReceipt)
+
+	receipt := map[string]any{
+		"retailer":     "Target",
+		"purchaseDate": "2022-01-01",
+		"purchaseTime": "13:01",
+		"items": []map[string]any{
+			{"shortDescription": "Mountain Dew 12PK", "price": "6.49"},
+		},
+		"total": "6.49",
+	}
+	reqBody, _ := json.Marshal(receipt)
+	req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, resp.Code, resp.Body.String())
+	}
+
+	names := map[string]bool{}
+	for _, span := range exporter.GetSpans() {
+		names[span.Name] = true
+		if span.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("Expected span %s to continue the propagated trace, got %s",
+				span.Name, span.SpanContext.TraceID())
+		}
+	}
+	for _, name := range []string{"POST /receipts/process", "JSONValidationMiddleware", "CalculatePoints"} {
+		if !names[name] {
+			t.Errorf("Expected a %q span, got %v", name, names)
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	router := gin.New()
+	router.Use(RequestIDMiddleware())
+	router.Use(JSONValidationMiddleware(1024 * 1024))
+	handler := NewReceiptHandler(storage.NewMemoryStorage())
+	router.GET("/receipts/:id/points", handler.GetPoints)
+
+	t.Run("Client supplied ID is echoed", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/receipts/nonexistent-id/points", nil)
+		req.Header.Set(requestid.Header, "client-req-1")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		if got := resp.Header().Get(requestid.Header); got != "client-req-1" {
+			t.Errorf("Expected response header client-req-1, got %q", got)
+		}
+
+		var apiErr rperrors.APIError
+		if err := json.Unmarshal(resp.Body.Bytes(), &apiErr); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if apiErr.RequestID != "client-req-1" {
+			t.Errorf("Expected error body request ID client-req-1, got %q", apiErr.RequestID)
+		}
+		if apiErr.Code != rperrors.ErrReceiptNotFound {
+			t.Errorf("Expected code %s, got %s", rperrors.ErrReceiptNotFound, apiErr.Code)
+		}
+	})
+
+	t.Run("Missing or invalid ID is generated", func(t *testing.T) {
+		for _, header := range []string{"", "has spaces in it"} {
+			req, _ := http.NewRequest("GET", "/receipts/nonexistent-id/points", nil)
+			if header != "" {
+				req.Header.Set(requestid.Header, header)
+			}
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			got := resp.Header().Get(requestid.Header)
+			if got == "" || got == header {
+				t.Errorf("Expected a generated request ID, got %q", got)
+			}
+
+			var apiErr rperrors.APIError
+			if err := json.Unmarshal(resp.Body.Bytes(), &apiErr); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if apiErr.RequestID != got {
+				t.Errorf("Expected error body request ID %q, got %q", got, apiErr.RequestID)
+			}
+		}
+	})
+}
+
+func TestIdempotency(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	router := gin.New()
+	router.Use(IdempotencyMiddleware(NewIdempotencyCache(time.Hour), 1024*1024))
+	router.Use(JSONValidationMiddleware(1024 * 1024))
+	handler := NewReceiptHandler(store)
+	router.POST("/receipts/process", handler.ProcessReceipt)
+
+	receipt := `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01",` +
+		`"items":[{"shortDescription":"Pepsi - 12-oz","price":"1.25"}],"total":"1.25"}`
+
+	process := func(key string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/receipts/process", strings.NewReader(receipt))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	first := process("key-1")
+	retry := process("key-1")
+	if first.Code != http.StatusOK || retry.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d and %d", http.StatusOK, first.Code, retry.Code)
+	}
+	if first.Body.String() != retry.Body.String() {
+		t.Errorf("Expected retry to replay %s, got %s", first.Body.String(), retry.Body.String())
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("Expected retry to be marked as replayed")
+	}
+
+	other := process("key-2")
+	unkeyed := process("")
+	if other.Body.String() == first.Body.String() || unkeyed.Body.String() == first.Body.String() {
+		t.Error("Expected requests with other or no keys to be processed separately")
+	}
+
+	count, _ := store.Count(context.Background())
+	if count != 3 {
+		t.Errorf("Expected 3 stored receipts, got %d", count)
+	}
+
+	if resp := process(strings.Repeat("k", 256)); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an oversized key, got %d", http.StatusBadRequest, resp.Code)
+	}
+
+	// A key reused with another body is rejected rather than replayed
+	req, _ := http.NewRequest("POST", "/receipts/process", strings.NewReader(strings.Replace(receipt, "Target", "Walmart", 1)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IdempotencyKeyHeader, "key-1")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status code %d for a reused key, got %d", http.StatusUnprocessableEntity, resp.Code)
+	}
+	if count, _ := store.Count(context.Background()); count != 3 {
+		t.Errorf("Expected 3 stored receipts, got %d", count)
+	}
+}
+
+func TestIdempotencyRetriesFailedRequestOnce(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	release := make(chan struct{})
+	router := gin.New()
+	router.Use(IdempotencyMiddleware(NewIdempotencyCache(time.Hour), 1024))
+	router.POST("/receipts/process", func(c *gin.Context) {
+		mu.Lock()
+		calls++
+		call := calls
+		mu.Unlock()
+		if call == 1 {
+			// The original request fails once the retries are waiting for it
+			<-release
+			c.Status(http.StatusServiceUnavailable)
+			return
+		}
+		c.String(http.StatusOK, "processed")
+	})
+
+	send := func() *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/receipts/process", strings.NewReader("{}"))
+		req.Header.Set(IdempotencyKeyHeader, "key-1")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	original := make(chan *httptest.ResponseRecorder)
+	go func() { original <- send() }()
+	for {
+		mu.Lock()
+		started := calls == 1
+		mu.Unlock()
+		if started {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	var wg sync.WaitGroup
+	retries := make([]*httptest.ResponseRecorder, 5)
+	for i := range retries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			retries[i] = send()
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if resp := <-original; resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected the original request to fail with %d, got %d", http.StatusServiceUnavailable, resp.Code)
+	}
+	for i, resp := range retries {
+		if resp.Code != http.StatusOK || resp.Body.String() != "processed" {
+			t.Errorf("Expected retry %d to succeed, got %d %s", i, resp.Code, resp.Body.String())
+		}
+	}
+	if calls != 2 {
+		t.Errorf("Expected the request to be retried once, got %d calls", calls)
+	}
+}
+
+func TestStreamReceipts(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	router := gin.New()
+	handler := NewReceiptHandler(store, WithMaxLineSize(512))
+	router.POST("/receipts/stream", handler.StreamReceipts)
+
+	receipt := `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01",` +
+		`"items":[{"shortDescription":"Pepsi - 12-oz","price":"1.25"}],"total":"1.25"}`
+	invalid := `{"retailer":"","purchaseDate":"2022-01-01","purchaseTime":"13:01",` +
+		`"items":[{"shortDescription":"Pepsi - 12-oz","price":"1.25"}],"total":"1.25"}`
+	body := strings.Join([]string{
+		receipt,
+		"not json",
+		"",
+		invalid,
+		`{"retailer":"` + strings.Repeat("x", 1024) + `"}`,
+		receipt, // No trailing newline
+	}, "\n")
+
+	req, _ := http.NewRequest("POST", "/receipts/stream", strings.NewReader(body))
+	req.Header.Set("Content-Type", NDJSONContentType)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, resp.Code)
+	}
+	if got := resp.Header().Get("Content-Type"); got != NDJSONContentType {
+		t.Errorf("Expected Content-Type %s, got %s", NDJSONContentType, got)
+	}
+
+	expected := []struct {
+		line int
+		code rperrors.ErrorCode
+	}{
+		{1, ""},
+		{2, rperrors.ErrInvalidJSON},
+		{4, rperrors.ErrInvalidRetailer},
+		{5, rperrors.ErrRequestTooLarge},
+		{6, ""},
+	}
+	lines := strings.Split(strings.TrimSpace(resp.Body.String()), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d results, got %d: %s", len(expected), len(lines), resp.Body.String())
+	}
+	for i, line := range lines {
+		var result StreamResult
+		if err := json.Unmarshal([]byte(line), &result); err != nil {
+			t.Fatalf("Failed to unmarshal result %q: %v", line, err)
+		}
+		if result.Line != expected[i].line {
+			t.Errorf("Expected line %d, got %d", expected[i].line, result.Line)
+		}
+		if expected[i].code == "" {
+			if result.ID == "" || result.Error != nil {
+				t.Errorf("Expected line %d to be processed, got %s", result.Line, line)
+			}
+		} else if result.Error == nil || result.Error.Code != expected[i].code {
+			t.Errorf("Expected line %d to fail with %s, got %s", result.Line, expected[i].code, line)
+		}
+	}
+
+	count, _ := store.Count(context.Background())
+	if count != 2 {
+		t.Errorf("Expected 2 stored receipts, got %d", count)
+	}
+
+	t.Run("Wrong content type", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/receipts/stream", strings.NewReader(receipt))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		if resp.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("Expected status code %d, got %d", http.StatusUnsupportedMediaType, resp.Code)
+		}
+	})
+}
+
+func TestReadLine(t *testing.T) {
+	// A small buffer forces long lines to be read in several chunks
+	r := bufio.NewReaderSize(strings.NewReader("short\n"+strings.Repeat("a", 40)+"\n"+strings.Repeat("b", 20)+"\nlast"), 16)
+
+	tests := []struct {
+		line string
+		err  error
+	}{
+		{"short", nil},
+		{"", errLineTooLong},
+		{strings.Repeat("b", 20), nil},
+		{"last", io.EOF},
+		{"", io.EOF},
+	}
+	for _, tc := range tests {
+		line, err := readLine(r, 32)
+		if string(line) != tc.line || !errors.Is(err, tc.err) {
+			t.Errorf("Expected %q and %v, got %q and %v", tc.line, tc.err, line, err)
+		}
+	}
+}
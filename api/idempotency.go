@@ -0,0 +1,190 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+)
+
+// IdempotencyKeyHeader is the header clients set to make a POST safe to retry
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength bounds the length of an accepted idempotency key
+const maxIdempotencyKeyLength = 255
+
+// IdempotencyCache remembers the responses to requests made with an
+// idempotency key so that retries replay the original response
+type IdempotencyCache struct {
+	ttl       time.Duration
+	mu        sync.Mutex
+	entries   map[string]*idempotentResponse
+	lastSweep time.Time
+}
+
+// idempotentResponse is a recorded response. done is closed once the
+// original request has completed.
+type idempotentResponse struct {
+	bodyHash [sha256.Size]byte // Hash of the request body the key was first used with
+	done     chan struct{}
+	status   int
+	header   http.Header
+	body     []byte
+	expires  time.Time
+}
+
+// NewIdempotencyCache creates a cache that remembers responses for ttl
+func NewIdempotencyCache(ttl time.Duration) *IdempotencyCache {
+	return &IdempotencyCache{
+		ttl:     ttl,
+		entries: make(map[string]*idempotentResponse),
+	}
+}
+
+// begin returns the entry for key and whether the caller owns it and must
+// complete it. A new entry records the hash of the request body. Expired
+// entries are evicted.
+func (ic *IdempotencyCache) begin(key string, bodyHash [sha256.Size]byte) (*idempotentResponse, bool) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(ic.lastSweep) > time.Minute {
+		for k, e := range ic.entries {
+			if !e.expires.IsZero() && now.After(e.expires) {
+				delete(ic.entries, k)
+			}
+		}
+		ic.lastSweep = now
+	}
+
+	if e, ok := ic.entries[key]; ok && (e.expires.IsZero() || now.Before(e.expires)) {
+		return e, false
+	}
+	e := &idempotentResponse{bodyHash: bodyHash, done: make(chan struct{})}
+	ic.entries[key] = e
+	return e, true
+}
+
+// complete records the response for key, or forgets key when the response
+// should not be replayed
+func (ic *IdempotencyCache) complete(key string, e *idempotentResponse, keep bool) {
+	ic.mu.Lock()
+	if keep {
+		e.expires = time.Now().Add(ic.ttl)
+	} else if ic.entries[key] == e {
+		delete(ic.entries, key)
+	}
+	ic.mu.Unlock()
+	close(e.done)
+}
+
+// recordingWriter copies the response body as it is written
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// Write writes b to the response and the recording
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// WriteString writes s to the response and the recording
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware replays the original response to a POST retried with
+// the same Idempotency-Key, so that retries never process a receipt twice.
+// A retry arriving while the original is in flight waits for its response,
+// and a key reused with a different body is rejected with 422. Server errors
+// and timeouts are not remembered, so the request can be retried; when
+// several retries are waiting, one of them is processed and the others wait
+// for its response. Bodies larger than bodyLimit are passed on without
+// idempotency, to be rejected by the handler.
+func IdempotencyMiddleware(cache *IdempotencyCache, bodyLimit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if c.Request.Method != http.MethodPost || key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			writeError(c, http.StatusBadRequest, rperrors.ErrInvalidRequest, "Idempotency key is too long")
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, bodyLimit+1))
+		c.Request.Body = readCloser{io.MultiReader(bytes.NewReader(body), c.Request.Body), c.Request.Body}
+		if err != nil || int64(len(body)) > bodyLimit {
+			c.Next()
+			return
+		}
+		bodyHash := sha256.Sum256(body)
+
+		key = c.Request.URL.Path + " " + key
+		for {
+			entry, owner := cache.begin(key, bodyHash)
+			if owner {
+				processIdempotent(c, cache, key, entry)
+				return
+			}
+			if entry.bodyHash != bodyHash {
+				writeError(c, http.StatusUnprocessableEntity, rperrors.ErrInvalidRequest,
+					"Idempotency key was already used with a different request body")
+				return
+			}
+
+			select {
+			case <-entry.done:
+			case <-c.Request.Context().Done():
+				abortWithError(c, http.StatusRequestTimeout, rperrors.ErrContextCancelled)
+				return
+			}
+			if !entry.expires.IsZero() {
+				replayIdempotent(c, entry)
+				return
+			}
+			// The original request failed and was forgotten. The first retry
+			// to get here processes the request; the others wait for it.
+		}
+	}
+}
+
+// processIdempotent handles the request as the owner of entry and records the response
+func processIdempotent(c *gin.Context, cache *IdempotencyCache, key string, entry *idempotentResponse) {
+	writer := &recordingWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+
+	c.Next()
+
+	entry.status = writer.Status()
+	entry.header = http.Header{"Content-Type": writer.Header().Values("Content-Type")}
+	entry.body = writer.body.Bytes()
+	retryable := entry.status >= http.StatusInternalServerError || entry.status == http.StatusRequestTimeout
+	cache.complete(key, entry, !retryable)
+}
+
+// replayIdempotent writes the recorded response of entry
+func replayIdempotent(c *gin.Context, entry *idempotentResponse) {
+	for name, values := range entry.header {
+		c.Writer.Header()[name] = values
+	}
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(entry.status, entry.header.Get("Content-Type"), entry.body)
+	c.Abort()
+}
+
+// readCloser reads from a reader while closing the original request body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
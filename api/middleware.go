@@ -2,55 +2,42 @@ package api
 
 import (
 	"log/slog"
+	"mime"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/metrics"
 	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/requestid"
+	"github.com/marcelorm/receipt-processor/services"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// tracer creates the spans recorded by the HTTP layer
+var tracer = otel.Tracer("github.com/marcelorm/receipt-processor/api")
+
 // JSONValidationMiddleware pre-validates JSON requests before they reach your handlers
 // This can fail fast on malformed requests and save processing time
 func JSONValidationMiddleware(maxBodySize int64) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if c.Request.ContentLength > maxBodySize {
-			c.JSON(http.StatusRequestEntityTooLarge, rperrors.APIError{
-				Code:    rperrors.ErrRequestTooLarge,
-				Message: rperrors.Error(rperrors.ErrRequestTooLarge),
-			})
-			c.Abort()
+			abortWithError(c, http.StatusRequestEntityTooLarge, rperrors.ErrRequestTooLarge)
 			return
 		}
 		// Only validate for POST /receipts/process
 		if c.Request.Method == http.MethodPost && c.FullPath() == "/receipts/process" {
-			var receipt models.Receipt
-			if err := c.ShouldBindJSON(&receipt); err != nil {
-				slog.Error("Invalid JSON in request", "error", err)
-				c.JSON(http.StatusBadRequest, rperrors.APIError{
-					Code:    rperrors.ErrInvalidJSON,
-					Message: rperrors.Error(rperrors.ErrInvalidJSON),
-				})
-				c.Abort()
-				return
+			bind := bindReceipt
+			if mediaType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type")); err == nil && mediaType == TextContentType {
+				bind = bindTextReceipt(maxBodySize)
 			}
-			if err := receipt.Validate(); err != nil {
-				slog.Error("Invalid receipt data", "error", err)
-				code := rperrors.ErrInvalidReceiptData
-				switch {
-				case err.Error() == "retailer is required":
-					code = rperrors.ErrInvalidRetailer
-				case err.Error() == "at least one item is required":
-					code = rperrors.ErrMissingItems
-				case err.Error() == "invalid date format":
-					code = rperrors.ErrInvalidPurchaseDate
-				case err.Error() == "invalid time format":
-					code = rperrors.ErrInvalidPurchaseTime
-				}
-				c.JSON(http.StatusBadRequest, rperrors.APIError{
-					Code:    code,
-					Message: rperrors.Error(code),
-				})
-				c.Abort()
+			receipt, ok := bind(c)
+			if !ok {
 				return
 			}
 			c.Set("receipt", receipt)
@@ -59,51 +46,134 @@ func JSONValidationMiddleware(maxBodySize int64) gin.HandlerFunc {
 	}
 }
 
-func SetupRouter(maxBodySize int64) *gin.Engine {
-	r := gin.New()
-
-	// Apply middleware at router group level
-	v1 := r.Group("/receipts")
-	v1.Use(JSONValidationMiddleware(maxBodySize))
-
-	// Process endpoint
-	v1.POST("/process", func(c *gin.Context) {
-		var receipt models.Receipt
-		if err := c.ShouldBindJSON(&receipt); err != nil {
-			slog.Error("Invalid JSON in request", "error", err)
-			c.JSON(http.StatusBadRequest, rperrors.APIError{
-				Code:    rperrors.ErrInvalidJSON,
-				Message: rperrors.Error(rperrors.ErrInvalidJSON),
-			})
-			c.Abort()
-			return
+// bindReceipt decodes and validates the receipt in the request body, aborting
+// the request with the matching error code when it is invalid
+func bindReceipt(c *gin.Context) (models.Receipt, bool) {
+	ctx, span := tracer.Start(c.Request.Context(), "JSONValidationMiddleware")
+	defer span.End()
+
+	var receipt models.Receipt
+	if err := c.ShouldBindJSON(&receipt); err != nil {
+		slog.ErrorContext(ctx, "Invalid JSON in request", "error", err)
+		span.SetStatus(codes.Error, "invalid JSON")
+		abortWithError(c, http.StatusBadRequest, rperrors.ErrInvalidJSON)
+		return receipt, false
+	}
+	if err := services.ValidateReceipt(receipt); err != nil {
+		slog.ErrorContext(ctx, "Invalid receipt data", "error", err)
+		span.SetStatus(codes.Error, "invalid receipt data")
+		abortWithError(c, http.StatusBadRequest, rperrors.GetCode(err))
+		return receipt, false
+	}
+	return receipt, true
+}
+
+// LoggerMiddleware logs information about incoming requests
+func LoggerMiddleware(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Start timer
+		start := time.Now()
+		path := c.Request.URL.Path
+		method := c.Request.Method
+
+		// Process request
+		c.Next()
+
+		// Log the request details
+		latency := time.Since(start)
+		statusCode := c.Writer.Status()
+
+		// Log at appropriate level based on status code
+		requestLogger := logger.With(
+			"method", method,
+			"path", path,
+			"status", statusCode,
+			"latency", latency.String(),
+			"client_ip", c.ClientIP(),
+		)
+
+		ctx := c.Request.Context()
+		switch {
+		case statusCode >= 500:
+			requestLogger.ErrorContext(ctx, "Server error")
+		case statusCode >= 400:
+			requestLogger.WarnContext(ctx, "Client error")
+		default:
+			requestLogger.InfoContext(ctx, "Request processed")
 		}
+	}
+}
 
-		// Validate the receipt schema
-		if err := receipt.Validate(); err != nil {
-			slog.Error("Invalid receipt data", "error", err)
+// RequestIDMiddleware accepts the client's X-Request-ID or generates a new one,
+// stores it in the request context and echoes it in the response headers
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
 
-			// Determine specific validation error code
-			code := rperrors.ErrInvalidReceiptData
+		c.Request = c.Request.WithContext(requestid.NewContext(c.Request.Context(), id))
+		c.Header(requestid.Header, id)
 
-			switch {
-			case err.Error() == "retailer is required":
-				code = rperrors.ErrInvalidRetailer
-			case err.Error() == "at least one item is required":
-				code = rperrors.ErrMissingItems
-			}
+		c.Next()
+	}
+}
 
-			c.JSON(http.StatusBadRequest, rperrors.APIError{
-				Code:    code,
-				Message: rperrors.Error(code),
-			})
-			c.Abort()
-			return
+// TracingMiddleware starts a server span for every request, continuing any
+// trace propagated by the client in the W3C traceparent header
+func TracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		ctx, span := tracer.Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Request.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", c.Request.URL.Path),
+			))
+		if id := requestid.FromContext(ctx); id != "" {
+			span.SetAttributes(attribute.String("request.id", id))
+		}
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
 		}
+	}
+}
+
+// MetricsMiddleware records request counts and latency by route and status,
+// along with the error code of every rejected request
+func MetricsMiddleware(m *metrics.Metrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
 
-		// Continue processing
 		c.Next()
-	})
 
-	return r
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := c.Writer.Status()
+		m.ObserveRequest(route, c.Request.Method, status, time.Since(start))
+
+		if _, counted := c.Get(countedKey); !counted && (status == http.StatusBadRequest || status == http.StatusRequestEntityTooLarge) {
+			if code, ok := c.Get(errorCodeKey); ok {
+				m.ObserveValidationFailure(string(code.(rperrors.ErrorCode)))
+			}
+		}
+	}
 }
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/requestid"
+)
+
+// NDJSONContentType is the media type of streamed receipts and results
+const NDJSONContentType = "application/x-ndjson"
+
+// DefaultMaxLineSize is the largest receipt accepted on a single line of a
+// stream when no limit is configured
+const DefaultMaxLineSize = 1 << 20
+
+// errLineTooLong is returned by readLine when a line exceeds the limit
+var errLineTooLong = errors.New("line too long")
+
+// StreamResult is the outcome of a single line of a streamed upload
+type StreamResult struct {
+	Line  int                `json:"line"`            // 1-based line number in the request body
+	ID    string             `json:"id,omitempty"`    // Receipt ID when the line was processed
+	Error *rperrors.APIError `json:"error,omitempty"` // Why the line was rejected
+}
+
+// WithMaxLineSize limits the size of a single receipt in a streamed upload
+func WithMaxLineSize(n int64) HandlerOption {
+	return func(h *ReceiptHandler) {
+		h.maxLineSize = n
+	}
+}
+
+// StreamReceipts handles the POST /receipts/stream endpoint. The body holds
+// one receipt per line, and each line is scored and stored as it is read,
+// with one result per line streamed back in order. Lines are processed one
+// at a time, so a slow client or store slows reading of the body rather than
+// buffering it, and the stream stops when the client disconnects.
+func (h *ReceiptHandler) StreamReceipts(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	mediaType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if err != nil || mediaType != NDJSONContentType {
+		writeError(c, http.StatusUnsupportedMediaType, rperrors.ErrInvalidRequest,
+			"Content-Type must be "+NDJSONContentType)
+		return
+	}
+
+	// Results are written while the body is still being read
+	if err := http.NewResponseController(c.Writer).EnableFullDuplex(); err != nil {
+		h.logger.DebugContext(ctx, "Full duplex streaming is not supported", "error", err)
+	}
+
+	c.Header("Content-Type", NDJSONContentType)
+	c.Status(http.StatusOK)
+
+	reader := bufio.NewReader(c.Request.Body)
+	encoder := json.NewEncoder(c.Writer)
+	processed, failed := 0, 0
+
+	for line := 1; ; line++ {
+		data, err := readLine(reader, h.maxLineSize)
+		if err == io.EOF && len(data) == 0 {
+			break
+		}
+		if ctx.Err() != nil {
+			h.logger.WarnContext(ctx, "Receipt stream cancelled", "line", line, "error", ctx.Err())
+			break
+		}
+
+		result := StreamResult{Line: line}
+		switch {
+		case errors.Is(err, errLineTooLong):
+			result.Error = h.lineError(ctx, rperrors.New(rperrors.ErrRequestTooLarge, "receipt line too long"))
+		case err != nil && err != io.EOF:
+			h.logger.WarnContext(ctx, "Failed to read receipt stream", "line", line, "error", err)
+			c.Set(errorCodeKey, rperrors.ErrInvalidRequest)
+			return
+		case len(bytes.TrimSpace(data)) == 0:
+			// Blank lines are skipped without a result
+			continue
+		default:
+			id, err := h.processLine(ctx, data)
+			if err != nil {
+				if rperrors.IsCode(err, rperrors.ErrContextCancelled) {
+					h.logger.WarnContext(ctx, "Receipt stream cancelled", "line", line, "error", err)
+					return
+				}
+				result.Error = h.lineError(ctx, err)
+			}
+			result.ID = id
+		}
+
+		if result.Error != nil {
+			failed++
+		} else {
+			processed++
+		}
+		if err := encoder.Encode(result); err != nil {
+			h.logger.WarnContext(ctx, "Failed to write stream result", "line", line, "error", err)
+			return
+		}
+		c.Writer.Flush()
+	}
+
+	h.logger.InfoContext(ctx, "Receipt stream completed", "processed", processed, "failed", failed)
+}
+
+// processLine decodes, validates, scores and stores the receipt on one line
+func (h *ReceiptHandler) processLine(ctx context.Context, data []byte) (string, error) {
+	var receipt models.Receipt
+	if err := json.Unmarshal(data, &receipt); err != nil {
+		h.metrics.ObserveValidationFailure(string(rperrors.ErrInvalidJSON))
+		return "", rperrors.Wrap(rperrors.ErrInvalidJSON, err, "invalid receipt JSON")
+	}
+	id, _, err := h.processor.Process(ctx, receipt)
+	return id, err
+}
+
+// lineError logs err and converts it into the error reported for a line
+func (h *ReceiptHandler) lineError(ctx context.Context, err error) *rperrors.APIError {
+	appErr, ok := err.(*rperrors.AppError)
+	if !ok {
+		h.logger.ErrorContext(ctx, "Unexpected non-application error", "error", err)
+		appErr = rperrors.Wrap(rperrors.ErrInternal, err, "unexpected error")
+	} else {
+		appErr.Log(ctx)
+	}
+	return &rperrors.APIError{
+		Code:      appErr.Code,
+		Message:   appErr.Message,
+		RequestID: requestid.FromContext(ctx),
+	}
+}
+
+// readLine reads the next line without its terminator. Lines longer than
+// max are consumed and reported with errLineTooLong. At the end of the body
+// it returns any final unterminated line along with io.EOF.
+func readLine(r *bufio.Reader, max int64) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		size := len(line) + len(bytes.TrimSuffix(chunk, []byte("\n")))
+		if int64(size) > max {
+			// Skip the rest of the line
+			for errors.Is(err, bufio.ErrBufferFull) {
+				_, err = r.ReadSlice('\n')
+			}
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+			return nil, errLineTooLong
+		}
+		line = append(line, chunk...)
+
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case err != nil:
+			return line, err
+		default:
+			return bytes.TrimSuffix(line, []byte("\n")), nil
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/parser"
+	"github.com/marcelorm/receipt-processor/services"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// TextContentType is the media type of receipts sent as printed text
+const TextContentType = "text/plain"
+
+// parseResultKey is the context key of the parser result of a text receipt
+const parseResultKey = "parseResult"
+
+// ParsedReceiptResponse is returned when processing a receipt sent as text
+type ParsedReceiptResponse struct {
+	models.ReceiptResponse
+	Confidence float64       `json:"confidence"`         // How sure the parser is of the receipt, from 0 to 1
+	Unparsed   []parser.Line `json:"unparsed,omitempty"` // Lines the parser did not understand
+}
+
+// bindTextReceipt returns a binder that parses the printed receipt in the
+// request body and validates it like a JSON receipt, aborting the request
+// when a field cannot be found or is invalid
+func bindTextReceipt(maxBodySize int64) func(c *gin.Context) (models.Receipt, bool) {
+	return func(c *gin.Context) (models.Receipt, bool) {
+		ctx, span := tracer.Start(c.Request.Context(), "TextReceiptParser")
+		defer span.End()
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBodySize))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				abortWithError(c, http.StatusRequestEntityTooLarge, rperrors.ErrRequestTooLarge)
+				return models.Receipt{}, false
+			}
+			abortWithError(c, http.StatusBadRequest, rperrors.ErrInvalidRequest)
+			return models.Receipt{}, false
+		}
+
+		result := parser.Parse(string(body))
+		span.SetAttributes(attribute.Float64("receipt.parse_confidence", result.Confidence))
+		if !result.Complete() {
+			slog.WarnContext(ctx, "Unparsable receipt text", "missing", result.Missing, "confidence", result.Confidence)
+			span.SetStatus(codes.Error, "unparsable receipt text")
+			writeError(c, http.StatusBadRequest, rperrors.ErrUnparsableReceipt,
+				"Unable to find "+strings.Join(result.Missing, ", ")+" in receipt text")
+			return result.Receipt, false
+		}
+		if err := services.ValidateReceipt(result.Receipt); err != nil {
+			slog.ErrorContext(ctx, "Invalid receipt data", "error", err)
+			span.SetStatus(codes.Error, "invalid receipt data")
+			abortWithError(c, http.StatusBadRequest, rperrors.GetCode(err))
+			return result.Receipt, false
+		}
+
+		c.Set(parseResultKey, result)
+		return result.Receipt, true
+	}
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/storage"
+)
+
+// targetText is the Target example receipt as printed text
+const targetText = `TARGET
+Store #1234
+01/01/2022 1:01 PM
+Mountain Dew 12PK          6.49
+Emils Cheese Pizza        12.25
+Knorr Creamy Chicken       1.26
+Doritos Nacho Cheese       3.35
+   Klarbrunn 12-PK 12 FL OZ  12.00
+TOTAL                     35.35
+`
+
+func setupTextRouter(maxBodySize int64) *gin.Engine {
+	router := gin.New()
+	router.Use(JSONValidationMiddleware(maxBodySize))
+
+	handler := NewReceiptHandler(storage.NewMemoryStorage())
+	router.POST("/receipts/process", handler.ProcessReceipt)
+	router.GET("/receipts/:id/points", handler.GetPoints)
+	return router
+}
+
+func TestProcessTextReceipt(t *testing.T) {
+	router := setupTextRouter(1 << 20)
+
+	req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(targetText))
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, resp.Code, resp.Body.String())
+	}
+
+	var parsed ParsedReceiptResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &parsed); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if parsed.ID == "" {
+		t.Fatal("Expected a receipt ID")
+	}
+	if parsed.Confidence < 0.9 {
+		t.Errorf("Expected a confidence of at least 0.9, got %v", parsed.Confidence)
+	}
+	if len(parsed.Unparsed) != 1 || parsed.Unparsed[0].Number != 2 || parsed.Unparsed[0].Text != "Store #1234" {
+		t.Errorf("Expected line 2 to be unparsed, got %+v", parsed.Unparsed)
+	}
+
+	// The description of the last item keeps its surrounding spaces trimmed,
+	// so the parsed receipt scores like the JSON example
+	points := httptest.NewRecorder()
+	router.ServeHTTP(points, httptest.NewRequest(http.MethodGet, "/receipts/"+parsed.ID+"/points", nil))
+	if !strings.Contains(points.Body.String(), `"points":28`) {
+		t.Errorf("Expected the Target receipt to be worth 28 points, got %s", points.Body.String())
+	}
+}
+
+func TestProcessTextReceiptErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		status  int
+		code    rperrors.ErrorCode
+		message string
+	}{
+		{
+			name:    "Missing fields",
+			body:    "QUICK STOP\nCoffee  2.00\n",
+			status:  http.StatusBadRequest,
+			code:    rperrors.ErrUnparsableReceipt,
+			message: "Unable to find purchaseDate, purchaseTime, total in receipt text",
+		},
+		{
+			name:    "Too large",
+			body:    targetText + strings.Repeat("Gum  1.00\n", 100),
+			status:  http.StatusRequestEntityTooLarge,
+			code:    rperrors.ErrRequestTooLarge,
+			message: rperrors.Error(rperrors.ErrRequestTooLarge),
+		},
+	}
+
+	router := setupTextRouter(512)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", TextContentType)
+			// Leave the length unknown so the limit applies while reading
+			req.ContentLength = -1
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			if resp.Code != tc.status {
+				t.Errorf("Expected status code %d, got %d", tc.status, resp.Code)
+			}
+			var apiErr rperrors.APIError
+			if err := json.Unmarshal(resp.Body.Bytes(), &apiErr); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if apiErr.Code != tc.code || apiErr.Message != tc.message {
+				t.Errorf("Expected error %s %q, got %s %q", tc.code, tc.message, apiErr.Code, apiErr.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/webhooks"
+)
+
+// maxWebhookBodySize limits the body of subscription requests
+const maxWebhookBodySize = 64 << 10
+
+// CreateWebhookRequest is the body of POST /webhooks
+type CreateWebhookRequest struct {
+	URL    string               `json:"url"`
+	Events []webhooks.EventType `json:"events"`
+	Secret string               `json:"secret,omitempty"` // Generated when empty
+}
+
+// WebhookResponse describes a subscription without its secret
+type WebhookResponse struct {
+	ID        string               `json:"id"`
+	URL       string               `json:"url"`
+	Events    []webhooks.EventType `json:"events"`
+	CreatedAt time.Time            `json:"createdAt"`
+}
+
+// CreateWebhookResponse describes a new subscription. The secret is only
+// ever returned here.
+type CreateWebhookResponse struct {
+	WebhookResponse
+	Secret string `json:"secret"`
+}
+
+// newWebhookResponse converts a subscription into its response
+func newWebhookResponse(sub webhooks.Subscription) WebhookResponse {
+	return WebhookResponse{
+		ID:        sub.ID,
+		URL:       sub.URL,
+		Events:    sub.Events,
+		CreatedAt: sub.CreatedAt,
+	}
+}
+
+// WebhookHandler handles the webhook subscription endpoints
+type WebhookHandler struct {
+	dispatcher *webhooks.Dispatcher
+}
+
+// NewWebhookHandler creates a handler managing the subscriptions of dispatcher
+func NewWebhookHandler(dispatcher *webhooks.Dispatcher) *WebhookHandler {
+	return &WebhookHandler{dispatcher: dispatcher}
+}
+
+// CreateWebhook handles the POST /webhooks endpoint
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	var req CreateWebhookRequest
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBodySize)
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			abortWithError(c, http.StatusRequestEntityTooLarge, rperrors.ErrRequestTooLarge)
+			return
+		}
+		writeError(c, http.StatusBadRequest, rperrors.ErrInvalidJSON, "Invalid webhook subscription JSON")
+		return
+	}
+
+	sub, err := h.dispatcher.Registry().Create(req.URL, req.Events, req.Secret)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, CreateWebhookResponse{
+		WebhookResponse: newWebhookResponse(sub),
+		Secret:          sub.Secret,
+	})
+}
+
+// ListWebhooks handles the GET /webhooks endpoint
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	subs := h.dispatcher.Registry().List()
+	responses := make([]WebhookResponse, len(subs))
+	for i, sub := range subs {
+		responses[i] = newWebhookResponse(sub)
+	}
+	c.JSON(http.StatusOK, responses)
+}
+
+// GetWebhook handles the GET /webhooks/{id} endpoint
+func (h *WebhookHandler) GetWebhook(c *gin.Context) {
+	sub, err := h.dispatcher.Registry().Get(c.Param("id"))
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newWebhookResponse(sub))
+}
+
+// DeleteWebhook handles the DELETE /webhooks/{id} endpoint. Pending
+// deliveries to the subscription are cancelled.
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	if err := h.dispatcher.Registry().Delete(c.Param("id")); err != nil {
+		handleError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListDeliveries handles the GET /webhooks/{id}/deliveries endpoint,
+// returning the most recent deliveries to a subscription, newest first
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := h.dispatcher.Registry().Get(id); err != nil {
+		handleError(c, err)
+		return
+	}
+	deliveries := h.dispatcher.Deliveries(id)
+	if deliveries == nil {
+		deliveries = []webhooks.Delivery{}
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// ListDeadLetters handles the GET /webhooks/dead-letters endpoint, returning
+// the deliveries that failed every attempt, newest first
+func (h *WebhookHandler) ListDeadLetters(c *gin.Context) {
+	c.JSON(http.StatusOK, h.dispatcher.DeadLetters())
+}
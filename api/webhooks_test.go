@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/webhooks"
+)
+
+func setupWebhookRouter() *gin.Engine {
+	dispatcher := webhooks.NewDispatcher(webhooks.NewMemoryOutbox(), webhooks.NewRegistry(webhooks.AllowPrivateURLs()))
+	handler := NewWebhookHandler(dispatcher)
+
+	router := gin.New()
+	router.POST("/webhooks", handler.CreateWebhook)
+	router.GET("/webhooks", handler.ListWebhooks)
+	router.GET("/webhooks/dead-letters", handler.ListDeadLetters)
+	router.GET("/webhooks/:id", handler.GetWebhook)
+	router.DELETE("/webhooks/:id", handler.DeleteWebhook)
+	router.GET("/webhooks/:id/deliveries", handler.ListDeliveries)
+	return router
+}
+
+// serve sends a request to router and returns the recorded response
+func serve(router http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestWebhookEndpoints(t *testing.T) {
+	router := setupWebhookRouter()
+
+	w := serve(router, http.MethodPost, "/webhooks", `{"url":"https://example.com/hooks","events":["receipt.processed"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var created CreateWebhookResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if created.ID == "" || created.Secret == "" {
+		t.Fatalf("Expected an ID and a secret, got %+v", created)
+	}
+
+	// The secret is only returned on creation
+	for _, path := range []string{"/webhooks", "/webhooks/" + created.ID} {
+		w = serve(router, http.MethodGet, path, "")
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status %d for %s, got %d", http.StatusOK, path, w.Code)
+		}
+		if strings.Contains(w.Body.String(), created.Secret) || !strings.Contains(w.Body.String(), created.ID) {
+			t.Errorf("Expected %s to describe the subscription without its secret, got %s", path, w.Body.String())
+		}
+	}
+
+	for _, path := range []string{"/webhooks/" + created.ID + "/deliveries", "/webhooks/dead-letters"} {
+		w = serve(router, http.MethodGet, path, "")
+		if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "[]" {
+			t.Errorf("Expected an empty list for %s, got %d %s", path, w.Code, w.Body.String())
+		}
+	}
+
+	w = serve(router, http.MethodDelete, "/webhooks/"+created.ID, "")
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+	w = serve(router, http.MethodGet, "/webhooks/"+created.ID, "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d after deletion, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestWebhookErrors(t *testing.T) {
+	router := setupWebhookRouter()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		code   rperrors.ErrorCode
+	}{
+		{"Invalid JSON", http.MethodPost, "/webhooks", `{"url":`, http.StatusBadRequest, rperrors.ErrInvalidJSON},
+		{"Invalid URL", http.MethodPost, "/webhooks", `{"url":"example.com","events":["receipt.processed"]}`, http.StatusBadRequest, rperrors.ErrInvalidWebhook},
+		{"Unknown event", http.MethodPost, "/webhooks", `{"url":"https://example.com","events":["receipt.created"]}`, http.StatusBadRequest, rperrors.ErrInvalidWebhook},
+		{"Unknown subscription", http.MethodGet, "/webhooks/unknown", "", http.StatusNotFound, rperrors.ErrWebhookNotFound},
+		{"Deliveries of unknown subscription", http.MethodGet, "/webhooks/unknown/deliveries", "", http.StatusNotFound, rperrors.ErrWebhookNotFound},
+		{"Delete unknown subscription", http.MethodDelete, "/webhooks/unknown", "", http.StatusNotFound, rperrors.ErrWebhookNotFound},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := serve(router, tc.method, tc.path, tc.body)
+			if w.Code != tc.status {
+				t.Errorf("Expected status %d, got %d", tc.status, w.Code)
+			}
+			var apiErr rperrors.APIError
+			if err := json.Unmarshal(w.Body.Bytes(), &apiErr); err != nil {
+				t.Fatalf("Failed to decode error: %v", err)
+			}
+			if apiErr.Code != tc.code {
+				t.Errorf("Expected error code %s, got %s", tc.code, apiErr.Code)
+			}
+		})
+	}
+}
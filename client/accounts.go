@@ -0,0 +1,63 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/models"
+)
+
+// CreateAccount opens a loyalty account with the given name. Like receipt
+// submissions it carries an idempotency key, so a retry opens one account.
+func (c *Client) CreateAccount(ctx context.Context, name string) (models.Account, error) {
+	var resp models.Account
+	body, err := json.Marshal(models.AccountRequest{Name: name})
+	if err != nil {
+		return resp, rperrors.Wrap(rperrors.ErrInvalidRequest, err, "unable to encode account")
+	}
+	err = c.doJSON(ctx, http.MethodPost, "/accounts", idempotent(ctx, nil), body, &resp)
+	return resp, err
+}
+
+// AccountBalance returns the points held by the loyalty account with the
+// given ID
+func (c *Client) AccountBalance(ctx context.Context, id string) (int, error) {
+	if id == "" {
+		return 0, rperrors.New(rperrors.ErrInvalidRequest, "account ID is required")
+	}
+	var resp models.BalanceResponse
+	if err := c.doJSON(ctx, http.MethodGet, "/accounts/"+url.PathEscape(id)+"/balance", nil, nil, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Points, nil
+}
+
+// AccountHistory returns the ledger postings of the loyalty account with the
+// given ID, oldest first, along with its balance
+func (c *Client) AccountHistory(ctx context.Context, id string) (models.HistoryResponse, error) {
+	var resp models.HistoryResponse
+	if id == "" {
+		return resp, rperrors.New(rperrors.ErrInvalidRequest, "account ID is required")
+	}
+	err := c.doJSON(ctx, http.MethodGet, "/accounts/"+url.PathEscape(id)+"/history", nil, nil, &resp)
+	return resp, err
+}
+
+// PostEntry posts an adjustment, redemption or expiry to the loyalty account
+// with the given ID. It carries an idempotency key, so a retried redemption
+// takes the points once.
+func (c *Client) PostEntry(ctx context.Context, id string, entry models.EntryRequest) (models.Posting, error) {
+	var resp models.Posting
+	if id == "" {
+		return resp, rperrors.New(rperrors.ErrInvalidRequest, "account ID is required")
+	}
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return resp, rperrors.Wrap(rperrors.ErrInvalidRequest, err, "unable to encode ledger entry")
+	}
+	err = c.doJSON(ctx, http.MethodPost, "/accounts/"+url.PathEscape(id)+"/entries", idempotent(ctx, nil), body, &resp)
+	return resp, err
+}
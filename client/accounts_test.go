@@ -0,0 +1,58 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/models"
+)
+
+func TestAccounts(t *testing.T) {
+	c := setupClient(t, nil)
+	ctx := context.Background()
+
+	account, err := c.CreateAccount(ctx, "Jane")
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	if account.ID == "" || account.Name != "Jane" {
+		t.Fatalf("Expected an account named Jane, got %+v", account)
+	}
+
+	receipt := targetReceipt
+	receipt.AccountID = account.ID
+	if _, err := c.ProcessReceipt(ctx, receipt); err != nil {
+		t.Fatalf("Failed to process receipt: %v", err)
+	}
+	posting, err := c.PostEntry(ctx, account.ID, models.EntryRequest{Kind: models.LedgerRedeem, Points: 10})
+	if err != nil {
+		t.Fatalf("Failed to redeem points: %v", err)
+	}
+	if posting.Debit != account.ID || posting.Credit != models.AccountRedeemed || posting.Points != 10 {
+		t.Errorf("Expected 10 points moved to %s, got %+v", models.AccountRedeemed, posting)
+	}
+
+	balance, err := c.AccountBalance(ctx, account.ID)
+	if err != nil || balance != 18 {
+		t.Errorf("Expected a balance of 18, got %d (%v)", balance, err)
+	}
+	history, err := c.AccountHistory(ctx, account.ID)
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	if history.Points != 18 || len(history.Entries) != 2 || history.Entries[0].Kind != models.LedgerEarn {
+		t.Errorf("Expected an earn and a redemption leaving 18 points, got %+v", history)
+	}
+	if issued, err := c.AccountBalance(ctx, models.AccountIssued); err != nil || issued != -28 {
+		t.Errorf("Expected %s to have issued 28 points, got %d (%v)", models.AccountIssued, issued, err)
+	}
+
+	_, err = c.PostEntry(ctx, account.ID, models.EntryRequest{Kind: models.LedgerRedeem, Points: 100})
+	if !rperrors.IsCode(err, rperrors.ErrInvalidLedgerEntry) {
+		t.Errorf("Expected error code %s, got %v", rperrors.ErrInvalidLedgerEntry, err)
+	}
+	if _, err := c.AccountBalance(ctx, "non-existent-id"); !rperrors.IsCode(err, rperrors.ErrAccountNotFound) {
+		t.Errorf("Expected error code %s, got %v", rperrors.ErrAccountNotFound, err)
+	}
+}
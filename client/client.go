@@ -0,0 +1,366 @@
+// Package client is a Go client for the receipt processor API.
+//
+// Failed calls return a *errors.AppError carrying the API error code, so
+// they can be inspected with errors.IsCode and errors.GetCode.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/marcelorm/receipt-processor/api"
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/health"
+	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/requestid"
+)
+
+// DefaultUserAgent is the User-Agent header sent when none is configured
+const DefaultUserAgent = "receipt-processor-client"
+
+// maxErrorBodySize bounds how much of an error response is read
+const maxErrorBodySize = 64 * 1024
+
+// ErrNotReady is returned by Ready when the service reports it is not ready
+var ErrNotReady = errors.New("service not ready")
+
+// Client calls the receipt processor API
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	retry      RetryPolicy
+	timeout    time.Duration
+	userAgent  string
+}
+
+// ResponseError describes the HTTP response an API error was decoded from.
+// It is the underlying error of the *errors.AppError returned for a failed call.
+type ResponseError struct {
+	StatusCode int
+	RequestID  string
+}
+
+// Error implements the error interface
+func (e *ResponseError) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("HTTP %d (request ID %s)", e.StatusCode, e.RequestID)
+	}
+	return fmt.Sprintf("HTTP %d", e.StatusCode)
+}
+
+// idempotencyKey is the context key holding a caller-supplied idempotency key
+type idempotencyKey struct{}
+
+// WithIdempotencyKey returns a context that makes ProcessReceipt and the
+// other calls that submit receipts or ledger entries send key instead of
+// generating one, so a call can be safely repeated across restarts
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// New creates a client for the API served at baseURL, e.g. http://localhost:8080
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base URL %q: scheme must be http or https", baseURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	c := &Client{
+		baseURL:    u,
+		httpClient: &http.Client{},
+		retry:      DefaultRetryPolicy,
+		userAgent:  DefaultUserAgent,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.retry.MaxAttempts < 1 {
+		c.retry.MaxAttempts = 1
+	}
+	return c, nil
+}
+
+// ProcessReceipt submits a receipt for scoring and returns its ID. Every call
+// carries an idempotency key, so retries never score the receipt twice.
+func (c *Client) ProcessReceipt(ctx context.Context, receipt models.Receipt) (string, error) {
+	body, err := json.Marshal(receipt)
+	if err != nil {
+		return "", rperrors.Wrap(rperrors.ErrInvalidReceiptData, err, "unable to encode receipt")
+	}
+
+	var resp models.ReceiptResponse
+	if err := c.doJSON(ctx, http.MethodPost, "/receipts/process", idempotent(ctx, nil), body, &resp); err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// idempotent adds the context's idempotency key to header, or a new key when
+// it has none, so that every attempt of a call carries the same key
+func idempotent(ctx context.Context, header http.Header) http.Header {
+	key, _ := ctx.Value(idempotencyKey{}).(string)
+	if key == "" {
+		key = uuid.NewString()
+	}
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set(api.IdempotencyKeyHeader, key)
+	return header
+}
+
+// GetPoints returns the points awarded to the receipt with the given ID
+func (c *Client) GetPoints(ctx context.Context, id string) (int, error) {
+	if id == "" {
+		return 0, rperrors.New(rperrors.ErrInvalidRequest, "receipt ID is required")
+	}
+
+	var resp models.PointsResponse
+	if err := c.doJSON(ctx, http.MethodGet, "/receipts/"+url.PathEscape(id)+"/points", nil, nil, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Points, nil
+}
+
+// GetLedger returns the points ledger of the receipt with the given ID: its
+// earned points and any clawed back by refunds, with the points still held
+func (c *Client) GetLedger(ctx context.Context, id string) (models.LedgerResponse, error) {
+	if id == "" {
+		return models.LedgerResponse{}, rperrors.New(rperrors.ErrInvalidRequest, "receipt ID is required")
+	}
+
+	var resp models.LedgerResponse
+	if err := c.doJSON(ctx, http.MethodGet, "/receipts/"+url.PathEscape(id)+"/ledger", nil, nil, &resp); err != nil {
+		return models.LedgerResponse{}, err
+	}
+	return resp, nil
+}
+
+// Live reports whether the service process is up
+func (c *Client) Live(ctx context.Context) error {
+	var report health.Report
+	return c.doJSON(ctx, http.MethodGet, "/livez", nil, nil, &report)
+}
+
+// Ready returns the service's readiness report. It returns ErrNotReady along
+// with the report when a check failed or the service is shutting down.
+func (c *Client) Ready(ctx context.Context) (health.Report, error) {
+	var report health.Report
+	resp, err := c.do(ctx, http.MethodGet, "/readyz", nil, nil, func(status int) bool {
+		return status == http.StatusOK || status == http.StatusServiceUnavailable
+	})
+	if err != nil {
+		return report, err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return report, rperrors.Wrap(rperrors.ErrInternal, err, "unable to decode readiness report")
+	}
+	if resp.StatusCode == http.StatusServiceUnavailable {
+		return report, ErrNotReady
+	}
+	return report, nil
+}
+
+// Metrics returns the service's metrics in the Prometheus text format
+func (c *Client) Metrics(ctx context.Context) (string, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/metrics", nil, nil, successful)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	text, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", rperrors.Wrap(rperrors.ErrInternal, err, "unable to read metrics")
+	}
+	return string(text), nil
+}
+
+// doJSON makes a request, retrying on failure, and decodes the JSON response
+// into out. The response body is discarded when out is nil.
+func (c *Client) doJSON(ctx context.Context, method, path string, header http.Header, body []byte, out any) error {
+	resp, err := c.do(ctx, method, path, header, body, successful)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return rperrors.Wrap(rperrors.ErrInternal, err, fmt.Sprintf("unable to decode response to %s %s", method, path))
+	}
+	return nil
+}
+
+// successful accepts 2xx responses
+func successful(status int) bool {
+	return status >= 200 && status < 300
+}
+
+// do makes a request, retrying according to the retry policy, until a
+// response with a status accepted by ok arrives. Other responses are decoded
+// into errors.
+func (c *Client) do(ctx context.Context, method, path string, header http.Header, body []byte, ok func(int) bool) (*http.Response, error) {
+	cancel := context.CancelFunc(func() {})
+	if c.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+	}
+
+	// Reuse the caller's request ID, or one ID for every attempt, so that
+	// retries can be correlated in the server logs
+	id := requestid.FromContext(ctx)
+	if id == "" {
+		id = requestid.New()
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < c.retry.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			if err := c.wait(ctx, attempt); err != nil {
+				err = contextError(ctx, method, path)
+				cancel()
+				return nil, err
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, c.baseURL.String()+path, bytes.NewReader(body))
+		if err != nil {
+			cancel()
+			return nil, rperrors.Wrap(rperrors.ErrInvalidRequest, err, "unable to create request")
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		if body != nil && req.Header.Get("Content-Type") == "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if req.Header.Get("Accept") == "" {
+			req.Header.Set("Accept", "application/json")
+		}
+		req.Header.Set("User-Agent", c.userAgent)
+		req.Header.Set(requestid.Header, id)
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				err = contextError(ctx, method, path)
+				cancel()
+				return nil, err
+			}
+			lastErr = rperrors.Wrap(rperrors.ErrInternal, err, fmt.Sprintf("%s %s failed", method, path))
+			continue
+		}
+
+		if ok(resp.StatusCode) {
+			// Release the timeout once the caller has read the response
+			resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+			return resp, nil
+		}
+
+		lastErr = decodeError(resp)
+		resp.Body.Close()
+		if !retryableStatus(resp.StatusCode) && !c.retryableCode(rperrors.GetCode(lastErr)) {
+			break
+		}
+	}
+	cancel()
+	return nil, lastErr
+}
+
+// cancelOnClose cancels a call's context when its response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body and cancels the context
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// wait sleeps for a random duration up to the exponential backoff for attempt
+func (c *Client) wait(ctx context.Context, attempt int) error {
+	backoff := c.retry.InitialBackoff << (attempt - 1)
+	if backoff <= 0 || backoff > c.retry.MaxBackoff {
+		backoff = c.retry.MaxBackoff
+	}
+
+	var delay time.Duration
+	if backoff > 0 {
+		delay = rand.N(backoff) + 1
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// retryableCode reports whether an API error with code should be retried
+func (c *Client) retryableCode(code rperrors.ErrorCode) bool {
+	return code != "" && slices.Contains(c.retry.RetryableCodes, code)
+}
+
+// retryableStatus reports whether a response status is always worth retrying
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// decodeError converts an error response into an *errors.AppError
+func decodeError(resp *http.Response) error {
+	respErr := &ResponseError{
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get(requestid.Header),
+	}
+
+	var apiErr rperrors.APIError
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if err := json.Unmarshal(data, &apiErr); err != nil || apiErr.Code == "" {
+		return rperrors.Wrap(rperrors.ErrInternal, respErr, "unexpected response: "+respErr.Error())
+	}
+	if apiErr.RequestID != "" {
+		respErr.RequestID = apiErr.RequestID
+	}
+
+	return &rperrors.AppError{
+		Code:    apiErr.Code,
+		Message: apiErr.Message,
+		Detail:  respErr.Error(),
+		Err:     respErr,
+	}
+}
+
+// contextError reports that ctx was cancelled or timed out during a call
+func contextError(ctx context.Context, method, path string) error {
+	return rperrors.Wrap(rperrors.ErrContextCancelled, ctx.Err(), fmt.Sprintf("%s %s cancelled or timed out", method, path))
+}
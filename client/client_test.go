@@ -0,0 +1,396 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/marcelorm/receipt-processor/api"
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/server"
+	"github.com/marcelorm/receipt-processor/storage"
+)
+
+func init() {
+	// Configure minimal logging for tests
+	handler := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError, // Only log errors during tests
+	})
+	slog.SetDefault(slog.New(handler))
+
+	// Set Gin to test mode
+	gin.SetMode(gin.TestMode)
+}
+
+// targetReceipt is the Target example receipt, worth 28 points
+var targetReceipt = models.Receipt{
+	Retailer:     "Target",
+	PurchaseDate: models.MustParseDate("2022-01-01"),
+	PurchaseTime: models.MustParseTime("13:01"),
+	Items: []models.Item{
+		{ShortDescription: "Mountain Dew 12PK", Price: 6.49},
+		{ShortDescription: "Emils Cheese Pizza", Price: 12.25},
+		{ShortDescription: "Knorr Creamy Chicken", Price: 1.26},
+		{ShortDescription: "Doritos Nacho Cheese", Price: 3.35},
+		{ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: 12.00},
+	},
+	Total: 35.35,
+}
+
+// fastRetries retries quickly so tests don't wait on backoff
+var fastRetries = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     5 * time.Millisecond,
+	RetryableCodes: DefaultRetryPolicy.RetryableCodes,
+}
+
+// attempts records the requests that reached the test server
+type attempts struct {
+	mu   sync.Mutex
+	reqs []*http.Request
+}
+
+// middleware records every request before passing it on
+func (a *attempts) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.mu.Lock()
+		a.reqs = append(a.reqs, r)
+		a.mu.Unlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// count returns the number of recorded requests
+func (a *attempts) count() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.reqs)
+}
+
+// header returns the values of a header across the recorded requests
+func (a *attempts) header(name string) []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	values := make([]string, len(a.reqs))
+	for i, r := range a.reqs {
+		values[i] = r.Header.Get(name)
+	}
+	return values
+}
+
+// failFirst fails the first n requests with status and an APIError with code
+func failFirst(n int, status int, code rperrors.ErrorCode) func(http.Handler) http.Handler {
+	var mu sync.Mutex
+	failed := 0
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			fail := failed < n
+			failed++
+			mu.Unlock()
+			if fail {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(status)
+				w.Write([]byte(`{"code":"` + string(code) + `","message":"injected failure"}`))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// setupClient starts the real server with opts and returns a client for it
+func setupClient(t *testing.T, clientOpts []Option, opts ...server.Option) *Client {
+	t.Helper()
+
+	srv, err := server.New(opts...)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+
+	c, err := New(ts.URL, clientOpts...)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	return c
+}
+
+func TestProcessAndGetPoints(t *testing.T) {
+	c := setupClient(t, nil)
+	ctx := context.Background()
+
+	id, err := c.ProcessReceipt(ctx, targetReceipt)
+	if err != nil {
+		t.Fatalf("Failed to process receipt: %v", err)
+	}
+	if id == "" {
+		t.Fatal("Expected a receipt ID, got empty string")
+	}
+
+	points, err := c.GetPoints(ctx, id)
+	if err != nil {
+		t.Fatalf("Failed to get points: %v", err)
+	}
+	if points != 28 {
+		t.Errorf("Expected 28 points, got %d", points)
+	}
+}
+
+func TestGetLedger(t *testing.T) {
+	c := setupClient(t, nil)
+	ctx := context.Background()
+
+	id, err := c.ProcessReceipt(ctx, targetReceipt)
+	if err != nil {
+		t.Fatalf("Failed to process receipt: %v", err)
+	}
+	refund := targetReceipt
+	refund.RefundOf = id
+	refund.Items = []models.Item{{ShortDescription: "Mountain Dew 12PK", Price: -6.49}}
+	refund.Total = -6.49
+	if _, err := c.ProcessReceipt(ctx, refund); err != nil {
+		t.Fatalf("Failed to process refund: %v", err)
+	}
+
+	ledger, err := c.GetLedger(ctx, id)
+	if err != nil {
+		t.Fatalf("Failed to get ledger: %v", err)
+	}
+	if len(ledger.Entries) != 2 || ledger.Entries[0].Kind != models.LedgerEarn || ledger.Entries[1].Kind != models.LedgerClawback {
+		t.Fatalf("Expected an earn and a clawback entry, got %+v", ledger.Entries)
+	}
+	if expected := 28 + ledger.Entries[1].Points; ledger.Points != expected || expected >= 28 {
+		t.Errorf("Expected fewer than 28 points held after the refund, got %d", ledger.Points)
+	}
+
+	if _, err := c.GetLedger(ctx, "nonexistent-id"); !rperrors.IsCode(err, rperrors.ErrReceiptNotFound) {
+		t.Errorf("Expected error code %s, got %v", rperrors.ErrReceiptNotFound, err)
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	var seen attempts
+	c := setupClient(t, []Option{WithRetryPolicy(fastRetries)}, server.WithMiddleware(seen.middleware))
+	ctx := context.Background()
+
+	t.Run("Not found", func(t *testing.T) {
+		_, err := c.GetPoints(ctx, "nonexistent-id")
+		if !rperrors.IsCode(err, rperrors.ErrReceiptNotFound) {
+			t.Fatalf("Expected error code %s, got %v", rperrors.ErrReceiptNotFound, err)
+		}
+
+		var respErr *ResponseError
+		if !errors.As(err, &respErr) {
+			t.Fatalf("Expected a ResponseError, got %T", err)
+		}
+		if respErr.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected status code %d, got %d", http.StatusNotFound, respErr.StatusCode)
+		}
+		if respErr.RequestID == "" {
+			t.Error("Expected the server's request ID on the error")
+		}
+	})
+
+	t.Run("Validation errors are not retried", func(t *testing.T) {
+		before := seen.count()
+		receipt := targetReceipt
+		receipt.Retailer = ""
+
+		_, err := c.ProcessReceipt(ctx, receipt)
+		if code := rperrors.GetCode(err); code != rperrors.ErrInvalidRetailer {
+			t.Errorf("Expected error code %s, got %s", rperrors.ErrInvalidRetailer, code)
+		}
+		if got := seen.count() - before; got != 1 {
+			t.Errorf("Expected 1 attempt, got %d", got)
+		}
+	})
+}
+
+func TestRetries(t *testing.T) {
+	t.Run("Retryable failures are retried with the same keys", func(t *testing.T) {
+		var seen attempts
+		store := storage.NewMemoryStorage()
+		c := setupClient(t, []Option{WithRetryPolicy(fastRetries)},
+			server.WithStorage(store),
+			server.WithMiddleware(seen.middleware, failFirst(2, http.StatusServiceUnavailable, rperrors.ErrStorageFailure)))
+
+		id, err := c.ProcessReceipt(context.Background(), targetReceipt)
+		if err != nil {
+			t.Fatalf("Failed to process receipt: %v", err)
+		}
+		if id == "" {
+			t.Error("Expected a receipt ID, got empty string")
+		}
+		if seen.count() != 3 {
+			t.Errorf("Expected 3 attempts, got %d", seen.count())
+		}
+
+		for _, name := range []string{api.IdempotencyKeyHeader, "X-Request-ID"} {
+			values := seen.header(name)
+			if values[0] == "" || values[1] != values[0] || values[2] != values[0] {
+				t.Errorf("Expected every attempt to send the same %s, got %v", name, values)
+			}
+		}
+	})
+
+	t.Run("Lost responses are replayed, not reprocessed", func(t *testing.T) {
+		store := storage.NewMemoryStorage()
+		// Process the first attempt but lose its response
+		var lost sync.Once
+		loseFirst := func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				dropped := false
+				lost.Do(func() {
+					next.ServeHTTP(httptest.NewRecorder(), r)
+					w.WriteHeader(http.StatusBadGateway)
+					dropped = true
+				})
+				if !dropped {
+					next.ServeHTTP(w, r)
+				}
+			})
+		}
+		c := setupClient(t, []Option{WithRetryPolicy(fastRetries)},
+			server.WithStorage(store), server.WithMiddleware(loseFirst))
+
+		if _, err := c.ProcessReceipt(context.Background(), targetReceipt); err != nil {
+			t.Fatalf("Failed to process receipt: %v", err)
+		}
+		count, _ := store.Count(context.Background())
+		if count != 1 {
+			t.Errorf("Expected the receipt to be stored once, got %d", count)
+		}
+	})
+
+	t.Run("Last error is returned once attempts are exhausted", func(t *testing.T) {
+		var seen attempts
+		c := setupClient(t, []Option{WithRetryPolicy(fastRetries)},
+			server.WithMiddleware(seen.middleware, failFirst(10, http.StatusInternalServerError, rperrors.ErrStorageFailure)))
+
+		_, err := c.ProcessReceipt(context.Background(), targetReceipt)
+		if !rperrors.IsCode(err, rperrors.ErrStorageFailure) {
+			t.Errorf("Expected error code %s, got %v", rperrors.ErrStorageFailure, err)
+		}
+		if seen.count() != fastRetries.MaxAttempts {
+			t.Errorf("Expected %d attempts, got %d", fastRetries.MaxAttempts, seen.count())
+		}
+	})
+
+	t.Run("Retries can be disabled", func(t *testing.T) {
+		var seen attempts
+		c := setupClient(t, []Option{WithRetryPolicy(NoRetries)},
+			server.WithMiddleware(seen.middleware, failFirst(1, http.StatusServiceUnavailable, rperrors.ErrStorageFailure)))
+
+		if _, err := c.ProcessReceipt(context.Background(), targetReceipt); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if seen.count() != 1 {
+			t.Errorf("Expected 1 attempt, got %d", seen.count())
+		}
+	})
+}
+
+func TestDeadlines(t *testing.T) {
+	slow := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	t.Run("Client timeout", func(t *testing.T) {
+		c := setupClient(t, []Option{WithTimeout(20 * time.Millisecond)}, server.WithMiddleware(slow))
+
+		_, err := c.GetPoints(context.Background(), "some-id")
+		if !rperrors.IsCode(err, rperrors.ErrContextCancelled) {
+			t.Errorf("Expected error code %s, got %v", rperrors.ErrContextCancelled, err)
+		}
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected error to wrap context.DeadlineExceeded, got %v", err)
+		}
+	})
+
+	t.Run("Caller deadline", func(t *testing.T) {
+		c := setupClient(t, nil, server.WithMiddleware(slow))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err := c.ProcessReceipt(ctx, targetReceipt)
+		if !rperrors.IsCode(err, rperrors.ErrContextCancelled) {
+			t.Errorf("Expected error code %s, got %v", rperrors.ErrContextCancelled, err)
+		}
+	})
+}
+
+func TestHealthAndMetrics(t *testing.T) {
+	c := setupClient(t, nil)
+	ctx := context.Background()
+
+	if err := c.Live(ctx); err != nil {
+		t.Errorf("Expected service to be live, got %v", err)
+	}
+
+	report, err := c.Ready(ctx)
+	if err != nil {
+		t.Fatalf("Expected service to be ready, got %v", err)
+	}
+	if _, ok := report.Checks["storage"]; !ok {
+		t.Errorf("Expected a storage check in the report, got %v", report.Checks)
+	}
+
+	text, err := c.Metrics(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get metrics: %v", err)
+	}
+	if !strings.Contains(text, "receipt_processor_http_requests_total") {
+		t.Error("Expected metrics to include receipt_processor_http_requests_total")
+	}
+}
+
+func TestNotReady(t *testing.T) {
+	srv, err := server.New()
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	srv.Health().Register("queue", 0, func(context.Context) error {
+		return errors.New("queue saturated")
+	})
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c, err := New(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	report, err := c.Ready(context.Background())
+	if !errors.Is(err, ErrNotReady) {
+		t.Fatalf("Expected ErrNotReady, got %v", err)
+	}
+	if report.Checks["queue"].Error != "queue saturated" {
+		t.Errorf("Expected the failing check in the report, got %v", report.Checks)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, baseURL := range []string{"", "localhost:8080", "ftp://example.com", "://bad"} {
+		if _, err := New(baseURL); err == nil {
+			t.Errorf("Expected error for base URL %q, got nil", baseURL)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/marcelorm/receipt-processor/api"
+	"github.com/marcelorm/receipt-processor/csvio"
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+)
+
+// ImportReceipts uploads receipts as CSV in the long format read by csvio,
+// with column headers mapped by mapping, which may be nil. Rejected receipts
+// are reported in the result rather than failing the call. Like
+// ProcessReceipt, every call carries an idempotency key, so retries never
+// import the file twice.
+func (c *Client) ImportReceipts(ctx context.Context, csv io.Reader, mapping csvio.Mapping) (api.ImportResult, error) {
+	var result api.ImportResult
+	body, err := io.ReadAll(csv)
+	if err != nil {
+		return result, rperrors.Wrap(rperrors.ErrInvalidCSV, err, "unable to read CSV")
+	}
+
+	path := "/receipts/import"
+	if len(mapping) > 0 {
+		query := url.Values{}
+		for field, header := range mapping {
+			query.Set("columns["+field+"]", header)
+		}
+		path += "?" + query.Encode()
+	}
+
+	header := idempotent(ctx, http.Header{"Content-Type": {api.CSVContentType}})
+	if err := c.doJSON(ctx, http.MethodPost, path, header, body, &result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// ExportReceipts writes every stored receipt, or those of retailer when it
+// is not empty, to w as CSV with one row per item
+func (c *Client) ExportReceipts(ctx context.Context, retailer string, w io.Writer) error {
+	path := "/receipts/export.csv"
+	if retailer != "" {
+		path += "?" + url.Values{"retailer": {retailer}}.Encode()
+	}
+
+	header := http.Header{"Accept": {api.CSVContentType}}
+	resp, err := c.do(ctx, http.MethodGet, path, header, nil, successful)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		if ctx.Err() != nil {
+			return contextError(ctx, http.MethodGet, path)
+		}
+		return rperrors.Wrap(rperrors.ErrInternal, err, "unable to read export")
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"strings"
+	"testing"
+
+	"github.com/marcelorm/receipt-processor/csvio"
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+)
+
+func TestImportExportReceipts(t *testing.T) {
+	c := setupClient(t, nil)
+	ctx := context.Background()
+
+	body := "Receipt,Store,purchaseDate,purchaseTime,total,shortDescription,price\n" +
+		"1,Target,2022-01-01,13:01,35.35,Mountain Dew 12PK,6.49\n" +
+		"1,,,,,Emils Cheese Pizza,12.25\n" +
+		"1,,,,,Knorr Creamy Chicken,1.26\n" +
+		"1,,,,,Doritos Nacho Cheese,3.35\n" +
+		"1,,,,,   Klarbrunn 12-PK 12 FL OZ  ,12.00\n" +
+		"2,Walgreens,2022-01-02,08:13,2.65,Pepsi - 12-oz,abc\n"
+	result, err := c.ImportReceipts(ctx, strings.NewReader(body), csvio.Mapping{"receipt": "Receipt", "retailer": "Store"})
+	if err != nil {
+		t.Fatalf("Failed to import receipts: %v", err)
+	}
+	if result.Imported != 1 || result.Failed != 1 || len(result.Receipts) != 2 {
+		t.Fatalf("Expected one imported and one failed receipt, got %+v", result)
+	}
+	if points, _ := c.GetPoints(ctx, result.Receipts[0].ID); points != 28 {
+		t.Errorf("Expected the imported receipt to be worth 28 points, got %d", points)
+	}
+	if errs := result.Receipts[1].Errors; len(errs) != 1 || errs[0].Code != rperrors.ErrInvalidItemPrice {
+		t.Errorf("Expected receipt 2 to be rejected for its price, got %+v", errs)
+	}
+
+	var exported bytes.Buffer
+	if err := c.ExportReceipts(ctx, "Target", &exported); err != nil {
+		t.Fatalf("Failed to export receipts: %v", err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(exported.Bytes())).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse export: %v", err)
+	}
+	// A header and one row per item
+	if len(records) != 6 {
+		t.Errorf("Expected 6 exported rows, got %d", len(records))
+	}
+
+	// The export can be imported again without a mapping
+	result, err = c.ImportReceipts(ctx, &exported, nil)
+	if err != nil {
+		t.Fatalf("Failed to import the export: %v", err)
+	}
+	if result.Imported != 1 || result.Failed != 0 {
+		t.Errorf("Expected the exported receipt to be imported, got %+v", result)
+	}
+
+	_, err = c.ImportReceipts(ctx, strings.NewReader(body), csvio.Mapping{"store": "Store"})
+	if !rperrors.IsCode(err, rperrors.ErrInvalidRequest) {
+		t.Errorf("Expected %s for an unknown mapped field, got %v", rperrors.ErrInvalidRequest, err)
+	}
+}
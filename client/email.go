@@ -0,0 +1,28 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/marcelorm/receipt-processor/api"
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+)
+
+// ProcessEmail submits a raw RFC 822 message, such as a forwarded e-receipt
+// saved as .eml, for scoring and returns the ID of the receipt read from it
+// along with the template used and the confidence of the extraction. Like
+// ProcessReceipt, every call carries an idempotency key.
+func (c *Client) ProcessEmail(ctx context.Context, message io.Reader) (api.EmailReceiptResponse, error) {
+	var resp api.EmailReceiptResponse
+	body, err := io.ReadAll(message)
+	if err != nil {
+		return resp, rperrors.Wrap(rperrors.ErrInvalidEmail, err, "unable to read email")
+	}
+
+	header := idempotent(ctx, http.Header{"Content-Type": {api.EmailContentType}})
+	if err := c.doJSON(ctx, http.MethodPost, "/receipts/email", header, body, &resp); err != nil {
+		return resp, err
+	}
+	return resp, nil
+}
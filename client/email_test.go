@@ -0,0 +1,37 @@
+package client
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+)
+
+func TestProcessEmail(t *testing.T) {
+	c := setupClient(t, nil)
+	ctx := context.Background()
+
+	message, err := os.Open("../email/testdata/target.eml")
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer message.Close()
+
+	resp, err := c.ProcessEmail(ctx, message)
+	if err != nil {
+		t.Fatalf("Failed to process email: %v", err)
+	}
+	if resp.Template != "Target" || resp.Confidence <= 0 {
+		t.Errorf("Expected the Target template with a confidence, got %+v", resp)
+	}
+	if points, _ := c.GetPoints(ctx, resp.ID); points != 28 {
+		t.Errorf("Expected the emailed receipt to be worth 28 points, got %d", points)
+	}
+
+	_, err = c.ProcessEmail(ctx, strings.NewReader("From: Shop <a@example.com>\n\nThanks for your order!"))
+	if !rperrors.IsCode(err, rperrors.ErrUnparsableReceipt) {
+		t.Errorf("Expected %s for an email without a receipt, got %v", rperrors.ErrUnparsableReceipt, err)
+	}
+}
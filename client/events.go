@@ -0,0 +1,84 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/events"
+)
+
+// StreamEvents follows the live scoring events matching filter and calls fn
+// with each one as it arrives. A non-zero lastEventID first replays the
+// buffered events after it. The call returns nil when the server ends the
+// stream, so the caller can resume from the ID of the last event it
+// received; it returns the error from fn, or a cancellation error once ctx
+// is done. The client timeout, if any, bounds the whole stream.
+func (c *Client) StreamEvents(ctx context.Context, filter events.Filter, lastEventID uint64, fn func(events.Event) error) error {
+	query := url.Values{}
+	if filter.Retailer != "" {
+		query.Set("retailer", filter.Retailer)
+	}
+	if filter.Tenant != "" {
+		query.Set("tenant", filter.Tenant)
+	}
+	path := "/events"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	header := http.Header{}
+	if lastEventID != 0 {
+		header.Set("Last-Event-ID", strconv.FormatUint(lastEventID, 10))
+	}
+
+	resp, err := c.do(ctx, http.MethodGet, path, header, nil, successful)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Messages are blocks of field lines ended by a blank line; comments
+	// such as heartbeats and the retry field are skipped
+	var id, data string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" {
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "id":
+				id = value
+			case "data":
+				data = value
+			}
+			continue
+		}
+		if data == "" {
+			continue
+		}
+
+		var event events.Event
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return rperrors.Wrap(rperrors.ErrInternal, err, "unable to decode event")
+		}
+		event.ID, _ = strconv.ParseUint(id, 10, 64)
+		id, data = "", ""
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return contextError(ctx, http.MethodGet, "/events")
+	}
+	if err := scanner.Err(); err != nil {
+		return rperrors.Wrap(rperrors.ErrInternal, err, "unable to read event stream")
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/events"
+)
+
+func TestStreamEvents(t *testing.T) {
+	c := setupClient(t, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Process receipts once the stream is open, from another goroutine
+	ids := make(chan string, 2)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		for _, tenant := range []string{"globex", "acme"} {
+			receipt := targetReceipt
+			receipt.Tenant = tenant
+			id, err := c.ProcessReceipt(ctx, receipt)
+			if err != nil {
+				t.Errorf("Failed to process receipt: %v", err)
+			}
+			ids <- id
+		}
+	}()
+
+	stop := errors.New("stop")
+	var received []events.Event
+	err := c.StreamEvents(ctx, events.Filter{Retailer: "target", Tenant: "acme"}, 0, func(event events.Event) error {
+		received = append(received, event)
+		return stop
+	})
+	if !errors.Is(err, stop) {
+		t.Fatalf("Expected the callback error, got %v", err)
+	}
+	<-ids
+	acme := <-ids
+	if len(received) != 1 || received[0].ReceiptID != acme || received[0].Points != 28 || received[0].ID == 0 {
+		t.Fatalf("Expected the acme receipt %s worth 28 points with an event ID, got %+v", acme, received)
+	}
+
+	// Resuming after the last acme event replays nothing, so the stream
+	// runs until the context is done
+	short, cancelShort := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancelShort()
+	err = c.StreamEvents(short, events.Filter{Tenant: "acme"}, received[0].ID, func(event events.Event) error {
+		return errors.New("unexpected event")
+	})
+	if !rperrors.IsCode(err, rperrors.ErrContextCancelled) {
+		t.Errorf("Expected error code %s, got %v", rperrors.ErrContextCancelled, err)
+	}
+}
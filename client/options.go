@@ -0,0 +1,66 @@
+package client
+
+import (
+	"net/http"
+	"time"
+
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+)
+
+// RetryPolicy controls how failed requests are retried. Requests are retried
+// on transport errors, on 429, 502, 503 and 504 responses, and on API errors
+// with one of the retryable codes.
+type RetryPolicy struct {
+	MaxAttempts    int                  // Total attempts per call; 1 disables retries
+	InitialBackoff time.Duration        // Upper bound of the delay before the first retry
+	MaxBackoff     time.Duration        // Upper bound of the delay before any retry
+	RetryableCodes []rperrors.ErrorCode // API error codes worth retrying
+}
+
+// DefaultRetryPolicy makes up to four attempts with jittered exponential
+// backoff between 100ms and 2s
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+	RetryableCodes: []rperrors.ErrorCode{
+		rperrors.ErrInternal,
+		rperrors.ErrContextCancelled,
+		rperrors.ErrStorageFailure,
+	},
+}
+
+// NoRetries makes a single attempt per call
+var NoRetries = RetryPolicy{MaxAttempts: 1}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sends requests through httpClient instead of a new http.Client
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRetryPolicy retries failed requests according to policy instead of DefaultRetryPolicy
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// WithTimeout bounds every call, including its retries, when the caller's
+// context has no earlier deadline
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
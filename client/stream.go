@@ -0,0 +1,53 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/marcelorm/receipt-processor/api"
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/models"
+)
+
+// StreamReceipts uploads receipts as one NDJSON stream and calls fn with the
+// result of each receipt as it arrives, in order. A rejected receipt is
+// reported in its result rather than failing the call; an error returned by
+// fn stops reading the results and is returned.
+func (c *Client) StreamReceipts(ctx context.Context, receipts []models.Receipt, fn func(api.StreamResult) error) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, receipt := range receipts {
+		if err := encoder.Encode(receipt); err != nil {
+			return rperrors.Wrap(rperrors.ErrInvalidReceiptData, err, "unable to encode receipt")
+		}
+	}
+
+	header := http.Header{"Content-Type": {api.NDJSONContentType}}
+	resp, err := c.do(ctx, http.MethodPost, "/receipts/stream", header, body.Bytes(), successful)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var result api.StreamResult
+		err := decoder.Decode(&result)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return contextError(ctx, http.MethodPost, "/receipts/stream")
+			}
+			return rperrors.Wrap(rperrors.ErrInternal, err, "unable to decode stream result")
+		}
+		if err := fn(result); err != nil {
+			return err
+		}
+	}
+}
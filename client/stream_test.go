@@ -0,0 +1,58 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/marcelorm/receipt-processor/api"
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/models"
+)
+
+func TestStreamReceipts(t *testing.T) {
+	c := setupClient(t, nil)
+	ctx := context.Background()
+
+	invalid := targetReceipt
+	invalid.Retailer = ""
+
+	var results []api.StreamResult
+	err := c.StreamReceipts(ctx, []models.Receipt{targetReceipt, invalid, targetReceipt}, func(result api.StreamResult) error {
+		results = append(results, result)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	for i, result := range results {
+		if result.Line != i+1 {
+			t.Errorf("Expected line %d, got %d", i+1, result.Line)
+		}
+	}
+	if results[1].Error == nil || results[1].Error.Code != rperrors.ErrInvalidRetailer {
+		t.Errorf("Expected line 2 to be rejected with %s, got %+v", rperrors.ErrInvalidRetailer, results[1].Error)
+	}
+
+	points, err := c.GetPoints(ctx, results[0].ID)
+	if err != nil {
+		t.Fatalf("Failed to get points: %v", err)
+	}
+	if points != 28 {
+		t.Errorf("Expected 28 points, got %d", points)
+	}
+
+	// An error from the callback stops the stream
+	stop := errors.New("stop")
+	calls := 0
+	err = c.StreamReceipts(ctx, []models.Receipt{targetReceipt, targetReceipt}, func(api.StreamResult) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("Expected the callback error after 1 call, got %v after %d", err, calls)
+	}
+}
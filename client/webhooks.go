@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/marcelorm/receipt-processor/api"
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/webhooks"
+)
+
+// CreateWebhook subscribes a URL to events. The response holds the signing
+// secret, which is never returned again.
+func (c *Client) CreateWebhook(ctx context.Context, req api.CreateWebhookRequest) (api.CreateWebhookResponse, error) {
+	var resp api.CreateWebhookResponse
+	body, err := json.Marshal(req)
+	if err != nil {
+		return resp, rperrors.Wrap(rperrors.ErrInvalidRequest, err, "unable to encode webhook subscription")
+	}
+	err = c.doJSON(ctx, http.MethodPost, "/webhooks", nil, body, &resp)
+	return resp, err
+}
+
+// ListWebhooks returns every webhook subscription, oldest first
+func (c *Client) ListWebhooks(ctx context.Context) ([]api.WebhookResponse, error) {
+	var resp []api.WebhookResponse
+	err := c.doJSON(ctx, http.MethodGet, "/webhooks", nil, nil, &resp)
+	return resp, err
+}
+
+// GetWebhook returns the webhook subscription with the given ID
+func (c *Client) GetWebhook(ctx context.Context, id string) (api.WebhookResponse, error) {
+	var resp api.WebhookResponse
+	if id == "" {
+		return resp, rperrors.New(rperrors.ErrInvalidRequest, "webhook ID is required")
+	}
+	err := c.doJSON(ctx, http.MethodGet, "/webhooks/"+url.PathEscape(id), nil, nil, &resp)
+	return resp, err
+}
+
+// DeleteWebhook deletes the webhook subscription with the given ID,
+// cancelling its pending deliveries
+func (c *Client) DeleteWebhook(ctx context.Context, id string) error {
+	if id == "" {
+		return rperrors.New(rperrors.ErrInvalidRequest, "webhook ID is required")
+	}
+	return c.doJSON(ctx, http.MethodDelete, "/webhooks/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// WebhookDeliveries returns the most recent deliveries to the webhook
+// subscription with the given ID, newest first
+func (c *Client) WebhookDeliveries(ctx context.Context, id string) ([]webhooks.Delivery, error) {
+	if id == "" {
+		return nil, rperrors.New(rperrors.ErrInvalidRequest, "webhook ID is required")
+	}
+	var resp []webhooks.Delivery
+	err := c.doJSON(ctx, http.MethodGet, "/webhooks/"+url.PathEscape(id)+"/deliveries", nil, nil, &resp)
+	return resp, err
+}
+
+// DeadLetters returns the webhook deliveries that failed every attempt,
+// newest first
+func (c *Client) DeadLetters(ctx context.Context) ([]webhooks.Delivery, error) {
+	var resp []webhooks.Delivery
+	err := c.doJSON(ctx, http.MethodGet, "/webhooks/dead-letters", nil, nil, &resp)
+	return resp, err
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/marcelorm/receipt-processor/api"
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/server"
+	"github.com/marcelorm/receipt-processor/webhooks"
+)
+
+func TestWebhooks(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	dispatcher := webhooks.NewDispatcher(webhooks.NewMemoryOutbox(), webhooks.NewRegistry(webhooks.AllowPrivateURLs()),
+		webhooks.WithPollInterval(10*time.Millisecond))
+	c := setupClient(t, nil, server.WithWebhooks(dispatcher))
+	ctx := context.Background()
+
+	created, err := c.CreateWebhook(ctx, api.CreateWebhookRequest{
+		URL:    receiver.URL,
+		Events: []webhooks.EventType{webhooks.EventReceiptProcessed},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+	if created.ID == "" || created.Secret == "" {
+		t.Fatalf("Expected an ID and a secret, got %+v", created)
+	}
+
+	_, err = c.CreateWebhook(ctx, api.CreateWebhookRequest{URL: receiver.URL, Events: []webhooks.EventType{"receipt.updated"}})
+	if !rperrors.IsCode(err, rperrors.ErrInvalidWebhook) {
+		t.Errorf("Expected error code %s, got %v", rperrors.ErrInvalidWebhook, err)
+	}
+
+	got, err := c.GetWebhook(ctx, created.ID)
+	if err != nil || got.URL != receiver.URL {
+		t.Errorf("Expected webhook for %s, got %+v (%v)", receiver.URL, got, err)
+	}
+	list, err := c.ListWebhooks(ctx)
+	if err != nil || len(list) != 1 || list[0].ID != created.ID {
+		t.Errorf("Expected only webhook %s, got %+v (%v)", created.ID, list, err)
+	}
+
+	if _, err := c.ProcessReceipt(ctx, targetReceipt); err != nil {
+		t.Fatalf("Failed to process receipt: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries, err := c.WebhookDeliveries(ctx, created.ID)
+		if err != nil {
+			t.Fatalf("Failed to list deliveries: %v", err)
+		}
+		if len(deliveries) == 1 && deliveries[0].Status == webhooks.DeliverySucceeded {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected a successful delivery, got %+v", deliveries)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	deadLetters, err := c.DeadLetters(ctx)
+	if err != nil || len(deadLetters) != 0 {
+		t.Errorf("Expected no dead letters, got %+v (%v)", deadLetters, err)
+	}
+
+	if err := c.DeleteWebhook(ctx, created.ID); err != nil {
+		t.Fatalf("Failed to delete webhook: %v", err)
+	}
+	if _, err := c.GetWebhook(ctx, created.ID); !rperrors.IsCode(err, rperrors.ErrWebhookNotFound) {
+		t.Errorf("Expected error code %s, got %v", rperrors.ErrWebhookNotFound, err)
+	}
+}
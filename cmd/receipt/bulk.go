@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/services"
+)
+
+// maxLineSize bounds the length of a single NDJSON line
+const maxLineSize = 10 * 1024 * 1024
+
+// bulkResult is the NDJSON output for one input line. Exactly one of Points
+// and Errors is set.
+type bulkResult struct {
+	Line   int                 `json:"line"`
+	Points *int                `json:"points,omitempty"`
+	Rules  []models.RuleResult `json:"rules,omitempty"`
+	Errors []string            `json:"errors,omitempty"`
+}
+
+// runBulk scores NDJSON receipts in parallel and writes one NDJSON result per
+// receipt, in input order. Blank lines are skipped.
+func runBulk(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var common commonFlags
+	fs := newFlagSet("bulk", stderr, &common, true, false)
+	workers := fs.Int("workers", runtime.NumCPU(), "Number of receipts scored in parallel")
+	file, err := parseFlags(fs, &common, args)
+	if err != nil {
+		fmt.Fprintln(stderr, "receipt bulk:", err)
+		return exitUsage
+	}
+	if *workers < 1 {
+		fmt.Fprintln(stderr, "receipt bulk: -workers must be at least 1")
+		return exitUsage
+	}
+
+	calculator, err := newCalculator(common, stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, "receipt bulk:", err)
+		return exitUsage
+	}
+
+	in, err := openInput(file, stdin)
+	if err != nil {
+		fmt.Fprintln(stderr, "receipt bulk:", err)
+		return exitFailure
+	}
+	defer in.Close()
+
+	scored, failed, err := bulkScore(context.Background(), calculator, in, stdout, *workers)
+	fmt.Fprintf(stderr, "receipt bulk: %d scored, %d failed\n", scored, failed)
+	if err != nil {
+		fmt.Fprintln(stderr, "receipt bulk:", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// bulkScore scores every receipt read from in with up to workers goroutines
+// and writes the results to out in input order. It returns the number of
+// receipts scored and rejected.
+func bulkScore(ctx context.Context, calculator *services.Calculator, in io.Reader, out io.Writer, workers int) (int, int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// pending holds one channel per line in input order; its capacity bounds
+	// how far reading runs ahead of writing
+	pending := make(chan chan bulkResult, workers*2)
+	sem := make(chan struct{}, workers)
+
+	var readErr error
+	var wg sync.WaitGroup
+	go func() {
+		defer close(pending)
+
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+		line := 0
+		for scanner.Scan() {
+			line++
+			data := bytes.TrimSpace(scanner.Bytes())
+			if len(data) == 0 {
+				continue
+			}
+			data = bytes.Clone(data)
+
+			result := make(chan bulkResult, 1)
+			select {
+			case pending <- result:
+			case <-ctx.Done():
+				return
+			}
+
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(line int) {
+				defer func() { <-sem; wg.Done() }()
+				result <- scoreLine(ctx, calculator, line, data)
+			}(line)
+		}
+		readErr = scanner.Err()
+		wg.Wait()
+	}()
+
+	enc := json.NewEncoder(out)
+	scored, failed := 0, 0
+	for result := range pending {
+		r := <-result
+		if r.Errors != nil {
+			failed++
+		} else {
+			scored++
+		}
+		if err := enc.Encode(r); err != nil {
+			cancel()
+			// Drain so the reader and workers can exit
+			for result := range pending {
+				<-result
+			}
+			return scored, failed, err
+		}
+	}
+	return scored, failed, readErr
+}
+
+// scoreLine decodes, validates and scores the receipt on one input line
+func scoreLine(ctx context.Context, calculator *services.Calculator, line int, data []byte) bulkResult {
+	result := bulkResult{Line: line}
+
+	var receipt models.Receipt
+	if err := json.Unmarshal(data, &receipt); err != nil {
+		result.Errors = []string{fmt.Sprintf("invalid receipt JSON: %v", err)}
+		return result
+	}
+	if errs := receipt.ValidateAll(); len(errs) > 0 {
+		result.Errors = errorStrings(errs)
+		return result
+	}
+
+	breakdown, err := calculator.Breakdown(ctx, receipt)
+	if err != nil {
+		result.Errors = []string{err.Error()}
+		return result
+	}
+	result.Points = &breakdown.Total
+	result.Rules = breakdown.Rules
+	return result
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/marcelorm/receipt-processor/csvio"
+	"github.com/marcelorm/receipt-processor/storage"
+)
+
+// runCSV scores the receipts in a long-format CSV file and writes them as
+// CSV with their points and rule hits, keyed by the input receipt keys.
+// Rejected receipts are reported on standard error, and make the command
+// exit with exitFailure once the valid receipts have been written.
+func runCSV(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var common commonFlags
+	fs := newFlagSet("csv", stderr, &common, true, false)
+	columns := fs.String("columns", "", "Column headers of fields as field=header pairs separated by commas, e.g. retailer=Store")
+	file, err := parseFlags(fs, &common, args)
+	if err != nil {
+		fmt.Fprintln(stderr, "receipt csv:", err)
+		return exitUsage
+	}
+	mapping, err := parseColumns(*columns)
+	if err != nil {
+		fmt.Fprintln(stderr, "receipt csv:", err)
+		return exitUsage
+	}
+
+	calculator, err := newCalculator(common, stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, "receipt csv:", err)
+		return exitUsage
+	}
+
+	in, err := openInput(file, stdin)
+	if err != nil {
+		fmt.Fprintln(stderr, "receipt csv:", err)
+		return exitFailure
+	}
+	defer in.Close()
+
+	groups, err := csvio.Read(in, mapping)
+	if err != nil {
+		fmt.Fprintln(stderr, "receipt csv:", err)
+		return exitFailure
+	}
+
+	writer := csvio.NewWriter(stdout)
+	if err := writer.WriteHeader(); err != nil {
+		fmt.Fprintln(stderr, "receipt csv:", err)
+		return exitFailure
+	}
+	scored, failed := 0, 0
+	for _, group := range groups {
+		if len(group.Errors) > 0 {
+			failed++
+			for _, err := range group.Errors {
+				fmt.Fprintf(stderr, "receipt csv: receipt %q: %v\n", group.Key, err)
+			}
+			continue
+		}
+
+		breakdown, err := calculator.Breakdown(context.Background(), group.Receipt)
+		if err != nil {
+			failed++
+			fmt.Fprintf(stderr, "receipt csv: receipt %q: %v\n", group.Key, err)
+			continue
+		}
+		if err := writer.Write(storage.Record{ID: group.Key, Receipt: group.Receipt, Breakdown: breakdown, Points: breakdown.Total}); err != nil {
+			fmt.Fprintln(stderr, "receipt csv:", err)
+			return exitFailure
+		}
+		scored++
+	}
+	if err := writer.Flush(); err != nil {
+		fmt.Fprintln(stderr, "receipt csv:", err)
+		return exitFailure
+	}
+
+	fmt.Fprintf(stderr, "receipt csv: %d scored, %d failed\n", scored, failed)
+	if failed > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// parseColumns parses the -columns flag into a column mapping
+func parseColumns(s string) (csvio.Mapping, error) {
+	mapping := csvio.Mapping{}
+	if strings.TrimSpace(s) == "" {
+		return mapping, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		field, header, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid -columns pair %q: must be field=header", pair)
+		}
+		mapping[strings.TrimSpace(field)] = header
+	}
+	if err := mapping.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid -columns: %w", err)
+	}
+	return mapping, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/marcelorm/receipt-processor/email"
+	"github.com/marcelorm/receipt-processor/models"
+)
+
+// emailResult is the JSON output of the email command
+type emailResult struct {
+	scoreResult
+	Template   string         `json:"template,omitempty"`
+	Confidence float64        `json:"confidence"`
+	Receipt    models.Receipt `json:"receipt"`
+}
+
+// runEmail extracts the receipt from a raw .eml message and prints its points
+// and rule breakdown like the score command
+func runEmail(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var common commonFlags
+	fs := newFlagSet("email", stderr, &common, true, true)
+	file, err := parseFlags(fs, &common, args)
+	if err != nil {
+		fmt.Fprintln(stderr, "receipt email:", err)
+		return exitUsage
+	}
+
+	calculator, err := newCalculator(common, stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, "receipt email:", err)
+		return exitUsage
+	}
+
+	in, err := openInput(file, stdin)
+	if err != nil {
+		fmt.Fprintln(stderr, "receipt email:", err)
+		return exitFailure
+	}
+	defer in.Close()
+
+	msg, err := email.ReadMessage(in)
+	if err != nil {
+		fmt.Fprintln(stderr, "receipt email:", err)
+		return exitFailure
+	}
+	result := email.NewExtractor().Extract(msg)
+	if !result.Complete() {
+		fmt.Fprintf(stderr, "receipt email: unable to find %s in email\n", strings.Join(result.Missing, ", "))
+		return exitFailure
+	}
+	if errs := result.Receipt.ValidateAll(); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintln(stderr, "receipt email:", err)
+		}
+		return exitFailure
+	}
+
+	breakdown, err := calculator.Breakdown(context.Background(), result.Receipt)
+	if err != nil {
+		fmt.Fprintln(stderr, "receipt email:", err)
+		return exitFailure
+	}
+
+	score := scoreResult{Retailer: result.Receipt.Retailer, Points: breakdown.Total, Rules: breakdown.Rules}
+	if common.format == formatJSON {
+		err = writeJSON(stdout, emailResult{
+			scoreResult: score,
+			Template:    result.Template,
+			Confidence:  result.Confidence,
+			Receipt:     result.Receipt,
+		})
+	} else {
+		err = writeScore(stdout, score)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "receipt email:", err)
+		return exitFailure
+	}
+	return exitOK
+}
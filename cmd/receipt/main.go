@@ -0,0 +1,200 @@
+// Command receipt scores and validates receipt JSON files without running the
+// server.
+//
+// Usage:
+//
+//	receipt score [-rules file] [-format human|json] [file]
+//	receipt validate [-format human|json] [file]
+//	receipt bulk [-rules file] [-workers n] [file]
+//	receipt csv [-rules file] [-columns field=header,...] [file]
+//	receipt email [-rules file] [-format human|json] [file.eml]
+//
+// Receipts are read from file, or from standard input when file is omitted
+// or "-". The email command reads a raw email message holding an e-receipt.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	_ "time/tzdata" // Time zones of receipts on systems without a zone database
+
+	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/services"
+	"github.com/marcelorm/receipt-processor/services/rules"
+)
+
+// Output formats accepted by the -format flag
+const (
+	formatHuman = "human"
+	formatJSON  = "json"
+)
+
+// Exit codes
+const (
+	exitOK      = 0
+	exitFailure = 1 // The receipt is invalid or could not be scored
+	exitUsage   = 2
+)
+
+// command is a subcommand run with its arguments and standard streams
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+}
+
+// commands lists the subcommands in the order shown in the usage message
+var commands = []command{
+	{"score", "Score a receipt and print its points and rule breakdown", runScore},
+	{"validate", "Validate a receipt and print every validation error", runValidate},
+	{"bulk", "Score NDJSON receipts in parallel and write NDJSON results", runBulk},
+	{"csv", "Score CSV receipts and write them as CSV with points and rule hits", runCSV},
+	{"email", "Extract a receipt from an .eml message and score it", runEmail},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the subcommand named by args[0] and returns the exit code
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return exitUsage
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage(stdout)
+		return exitOK
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:], stdin, stdout, stderr)
+		}
+	}
+
+	fmt.Fprintf(stderr, "receipt: unknown command %q\n", args[0])
+	usage(stderr)
+	return exitUsage
+}
+
+// usage prints the list of subcommands
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: receipt <command> [flags] [file]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Receipts are read from file, or from standard input when file is omitted or \"-\".")
+	fmt.Fprintln(w, "Run 'receipt <command> -h' for the flags of a command.")
+}
+
+// commonFlags holds the flags shared by several subcommands
+type commonFlags struct {
+	rulesFile string
+	format    string
+	verbose   bool
+}
+
+// newFlagSet creates the flag set for a subcommand, registering the shared
+// flags it uses
+func newFlagSet(name string, stderr io.Writer, common *commonFlags, withRules, withFormat bool) *flag.FlagSet {
+	fs := flag.NewFlagSet("receipt "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	if withRules {
+		fs.StringVar(&common.rulesFile, "rules", "", "Rule config file (YAML or JSON) selecting the rules to apply")
+		fs.BoolVar(&common.verbose, "v", false, "Log each rule evaluation to standard error")
+	}
+	if withFormat {
+		fs.StringVar(&common.format, "format", formatHuman, "Output format: human or json")
+	}
+	return fs
+}
+
+// parseFlags parses args and returns the single optional file argument
+func parseFlags(fs *flag.FlagSet, common *commonFlags, args []string) (string, error) {
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if common.format != "" && common.format != formatHuman && common.format != formatJSON {
+		return "", fmt.Errorf("invalid -format %q: must be %s or %s", common.format, formatHuman, formatJSON)
+	}
+	if fs.NArg() > 1 {
+		return "", fmt.Errorf("expected at most one file, got %d", fs.NArg())
+	}
+	return fs.Arg(0), nil
+}
+
+// openInput opens the named file, or returns stdin for "" and "-"
+func openInput(name string, stdin io.Reader) (io.ReadCloser, error) {
+	if name == "" || name == "-" {
+		return io.NopCloser(stdin), nil
+	}
+	return os.Open(name)
+}
+
+// newCalculator creates a calculator for the rules selected by the rule config
+// file, or every rule when no file is given
+func newCalculator(common commonFlags, stderr io.Writer) (*services.Calculator, error) {
+	ruleSet := rules.GetAllRules()
+	if common.rulesFile != "" {
+		cfg, err := rules.LoadConfig(common.rulesFile)
+		if err != nil {
+			return nil, err
+		}
+		if ruleSet, err = cfg.RuleSet(); err != nil {
+			return nil, err
+		}
+	}
+
+	logOutput := io.Discard
+	if common.verbose {
+		logOutput = stderr
+	}
+	return services.NewCalculator(ruleSet, slog.New(slog.NewTextHandler(logOutput, nil))), nil
+}
+
+// decodeReceipt reads a single receipt JSON document
+func decodeReceipt(r io.Reader) (models.Receipt, error) {
+	var receipt models.Receipt
+	if err := json.NewDecoder(r).Decode(&receipt); err != nil {
+		if errors.Is(err, io.EOF) {
+			return receipt, errors.New("no receipt in input")
+		}
+		return receipt, fmt.Errorf("invalid receipt JSON: %w", err)
+	}
+	return receipt, nil
+}
+
+// readReceipt opens the input named by file and decodes a receipt from it
+func readReceipt(file string, stdin io.Reader) (models.Receipt, error) {
+	in, err := openInput(file, stdin)
+	if err != nil {
+		return models.Receipt{}, err
+	}
+	defer in.Close()
+	return decodeReceipt(in)
+}
+
+// errorStrings converts errors to their messages
+func errorStrings(errs []error) []string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return messages
+}
+
+// writeJSON writes v as indented JSON
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
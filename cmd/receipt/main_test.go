@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const targetReceipt = `{
+  "retailer": "Target",
+  "purchaseDate": "2022-01-01",
+  "purchaseTime": "13:01",
+  "items": [
+    {"shortDescription": "Mountain Dew 12PK", "price": "6.49"},
+    {"shortDescription": "Emils Cheese Pizza", "price": "12.25"},
+    {"shortDescription": "Knorr Creamy Chicken", "price": "1.26"},
+    {"shortDescription": "Doritos Nacho Cheese", "price": "3.35"},
+    {"shortDescription": "   Klarbrunn 12-PK 12 FL OZ  ", "price": "12.00"}
+  ],
+  "total": "35.35"
+}`
+
+const invalidReceipt = `{"retailer": "", "purchaseDate": "2022-13-01", "purchaseTime": "13:01", "items": [], "total": "1.00"}`
+
+// runCommand runs the CLI with args and stdin and returns its exit code and output
+func runCommand(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+// writeFile writes content to a file in a temporary directory and returns its path
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestScore(t *testing.T) {
+	t.Run("Human output from stdin", func(t *testing.T) {
+		code, stdout, stderr := runCommand(t, targetReceipt, "score")
+		if code != exitOK {
+			t.Fatalf("Expected exit code %d, got %d: %s", exitOK, code, stderr)
+		}
+		if !strings.HasPrefix(stdout, "Target: 28 points") {
+			t.Errorf("Expected output to start with the total, got %q", stdout)
+		}
+		if !strings.Contains(stdout, "RetailerNameRule") {
+			t.Errorf("Expected output to list the rules, got %q", stdout)
+		}
+	})
+
+	t.Run("JSON output from file", func(t *testing.T) {
+		path := writeFile(t, "receipt.json", targetReceipt)
+		code, stdout, stderr := runCommand(t, "", "score", "-format", "json", path)
+		if code != exitOK {
+			t.Fatalf("Expected exit code %d, got %d: %s", exitOK, code, stderr)
+		}
+
+		var result scoreResult
+		if err := json.Unmarshal([]byte(stdout), &result); err != nil {
+			t.Fatalf("Failed to unmarshal output: %v", err)
+		}
+		if result.Points != 28 {
+			t.Errorf("Expected 28 points, got %d", result.Points)
+		}
+		if len(result.Rules) != 7 {
+			t.Errorf("Expected 7 rule results, got %d", len(result.Rules))
+		}
+	})
+
+	t.Run("Rule config file", func(t *testing.T) {
+		rules := writeFile(t, "rules.yaml", "enabled:\n  - RetailerNameRule\n")
+		code, stdout, stderr := runCommand(t, targetReceipt, "score", "-rules", rules, "-format", "json")
+		if code != exitOK {
+			t.Fatalf("Expected exit code %d, got %d: %s", exitOK, code, stderr)
+		}
+
+		var result scoreResult
+		if err := json.Unmarshal([]byte(stdout), &result); err != nil {
+			t.Fatalf("Failed to unmarshal output: %v", err)
+		}
+		if result.Points != 6 || len(result.Rules) != 1 {
+			t.Errorf("Expected 6 points from 1 rule, got %d from %d", result.Points, len(result.Rules))
+		}
+	})
+
+	t.Run("Invalid receipt", func(t *testing.T) {
+		code, _, stderr := runCommand(t, invalidReceipt, "score")
+		if code != exitFailure {
+			t.Errorf("Expected exit code %d, got %d", exitFailure, code)
+		}
+		if !strings.Contains(stderr, "retailer is required") {
+			t.Errorf("Expected validation errors on stderr, got %q", stderr)
+		}
+	})
+
+	t.Run("Usage errors", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"score", "-format", "xml"},
+			{"score", "-rules", "missing.yaml"},
+			{"score", "a.json", "b.json"},
+			{"score", "-bogus"},
+		} {
+			if code, _, _ := runCommand(t, targetReceipt, args...); code != exitUsage {
+				t.Errorf("Expected exit code %d for %v, got %d", exitUsage, args, code)
+			}
+		}
+	})
+}
+
+func TestValidate(t *testing.T) {
+	t.Run("Valid receipt", func(t *testing.T) {
+		code, stdout, _ := runCommand(t, targetReceipt, "validate")
+		if code != exitOK || strings.TrimSpace(stdout) != "valid" {
+			t.Errorf("Expected exit code %d and 'valid', got %d and %q", exitOK, code, stdout)
+		}
+	})
+
+	t.Run("Every error is printed", func(t *testing.T) {
+		code, stdout, _ := runCommand(t, invalidReceipt, "validate", "-format", "json")
+		if code != exitFailure {
+			t.Errorf("Expected exit code %d, got %d", exitFailure, code)
+		}
+
+		var result validateResult
+		if err := json.Unmarshal([]byte(stdout), &result); err != nil {
+			t.Fatalf("Failed to unmarshal output: %v", err)
+		}
+		if result.Valid || len(result.Errors) != 3 {
+			t.Errorf("Expected 3 errors, got %v", result.Errors)
+		}
+	})
+
+	t.Run("Malformed JSON", func(t *testing.T) {
+		code, stdout, _ := runCommand(t, `{"retailer": `, "validate")
+		if code != exitFailure || !strings.Contains(stdout, "invalid receipt JSON") {
+			t.Errorf("Expected exit code %d and a JSON error, got %d and %q", exitFailure, code, stdout)
+		}
+	})
+}
+
+func TestBulk(t *testing.T) {
+	compact := new(bytes.Buffer)
+	if err := json.Compact(compact, []byte(targetReceipt)); err != nil {
+		t.Fatal(err)
+	}
+
+	var input strings.Builder
+	for i := 0; i < 50; i++ {
+		input.WriteString(compact.String() + "\n")
+	}
+	input.WriteString("\n")
+	input.WriteString(invalidReceipt + "\n")
+	input.WriteString("not json\n")
+
+	code, stdout, stderr := runCommand(t, input.String(), "bulk", "-workers", "4")
+	if code != exitOK {
+		t.Fatalf("Expected exit code %d, got %d: %s", exitOK, code, stderr)
+	}
+	if !strings.Contains(stderr, "50 scored, 2 failed") {
+		t.Errorf("Expected a summary on stderr, got %q", stderr)
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 52 {
+		t.Fatalf("Expected 52 results, got %d", len(lines))
+	}
+	for i, line := range lines {
+		var result bulkResult
+		if err := json.Unmarshal([]byte(line), &result); err != nil {
+			t.Fatalf("Failed to unmarshal result %d: %v", i, err)
+		}
+
+		switch {
+		case i < 50:
+			if result.Line != i+1 || result.Points == nil || *result.Points != 28 {
+				t.Errorf("Expected line %d to score 28 points, got %s", i+1, line)
+			}
+		case i == 50:
+			// The blank line 51 is skipped
+			if result.Line != 52 || len(result.Errors) != 3 {
+				t.Errorf("Expected line 52 to have 3 errors, got %s", line)
+			}
+		default:
+			if result.Line != 53 || len(result.Errors) != 1 || result.Points != nil {
+				t.Errorf("Expected line 53 to have a JSON error, got %s", line)
+			}
+		}
+	}
+}
+
+func TestCSV(t *testing.T) {
+	input := "Receipt No,Store,purchaseDate,purchaseTime,total,shortDescription,price\n" +
+		"T1,Target,2022-01-01,13:01,35.35,Mountain Dew 12PK,6.49\n" +
+		"T1,,,,,Emils Cheese Pizza,12.25\n" +
+		"T1,,,,,Knorr Creamy Chicken,1.26\n" +
+		"T1,,,,,Doritos Nacho Cheese,3.35\n" +
+		"T1,,,,,   Klarbrunn 12-PK 12 FL OZ  ,12.00\n" +
+		"W1,Walgreens,2022-01-02,08:13,2.65,Pepsi - 12-oz,abc\n"
+
+	code, stdout, stderr := runCommand(t, input, "csv", "-columns", "receipt=Receipt No,retailer=Store")
+	if code != exitFailure {
+		t.Fatalf("Expected exit code %d for a rejected receipt, got %d: %s", exitFailure, code, stderr)
+	}
+	if !strings.Contains(stderr, `receipt "W1": row 7, column price: invalid price format`) || !strings.Contains(stderr, "1 scored, 1 failed") {
+		t.Errorf("Expected the rejected row and a summary on stderr, got %q", stderr)
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("Expected a header and 5 item rows, got %d lines: %s", len(lines), stdout)
+	}
+	if !strings.HasPrefix(lines[0], "receipt,retailer,") || !strings.HasPrefix(lines[1], "T1,Target,2022-01-01,13:01,35.35,Mountain Dew 12PK,6.49,") ||
+		!strings.Contains(lines[1], ",28,RetailerNameRule:6;") {
+		t.Errorf("Expected the Target receipt with 28 points, got %s", stdout)
+	}
+
+	if code, _, stderr := runCommand(t, input, "csv", "-columns", "store"); code != exitUsage {
+		t.Errorf("Expected exit code %d for an invalid -columns, got %d: %s", exitUsage, code, stderr)
+	}
+}
+
+func TestEmail(t *testing.T) {
+	code, stdout, stderr := runCommand(t, "", "email", "-format", "json", "../../email/testdata/walgreens.eml")
+	if code != exitOK {
+		t.Fatalf("Expected exit code %d, got %d: %s", exitOK, code, stderr)
+	}
+	var result emailResult
+	if err := json.Unmarshal([]byte(stdout), &result); err != nil {
+		t.Fatalf("Failed to unmarshal output: %v", err)
+	}
+	if result.Template != "Walgreens" || result.Receipt.Total != 2.65 || len(result.Receipt.Items) != 2 {
+		t.Errorf("Expected the Walgreens receipt, got %+v", result)
+	}
+	if result.Points != 15 {
+		t.Errorf("Expected 15 points, got %d", result.Points)
+	}
+
+	code, _, stderr = runCommand(t, "From: Shop <a@example.com>\n\nThanks!\n", "email")
+	if code != exitFailure || !strings.Contains(stderr, "unable to find purchaseDate, purchaseTime, items, total in email") {
+		t.Errorf("Expected exit code %d and the missing fields, got %d and %q", exitFailure, code, stderr)
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	if code, _, stderr := runCommand(t, "", "frobnicate"); code != exitUsage || !strings.Contains(stderr, "unknown command") {
+		t.Errorf("Expected exit code %d and an unknown command error, got %d and %q", exitUsage, code, stderr)
+	}
+	if code, _, _ := runCommand(t, ""); code != exitUsage {
+		t.Errorf("Expected exit code %d without a command, got %d", exitUsage, code)
+	}
+	if code, stdout, _ := runCommand(t, "", "help"); code != exitOK || !strings.Contains(stdout, "bulk") {
+		t.Errorf("Expected help to list the commands, got %d and %q", code, stdout)
+	}
+}
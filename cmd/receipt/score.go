@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/marcelorm/receipt-processor/models"
+)
+
+// scoreResult is the JSON output of the score command
+type scoreResult struct {
+	Retailer string              `json:"retailer"`
+	Points   int                 `json:"points"`
+	Rules    []models.RuleResult `json:"rules"`
+}
+
+// runScore scores a single receipt and prints its points and rule breakdown
+func runScore(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var common commonFlags
+	fs := newFlagSet("score", stderr, &common, true, true)
+	file, err := parseFlags(fs, &common, args)
+	if err != nil {
+		fmt.Fprintln(stderr, "receipt score:", err)
+		return exitUsage
+	}
+
+	calculator, err := newCalculator(common, stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, "receipt score:", err)
+		return exitUsage
+	}
+
+	receipt, err := readReceipt(file, stdin)
+	if err != nil {
+		fmt.Fprintln(stderr, "receipt score:", err)
+		return exitFailure
+	}
+	if errs := receipt.ValidateAll(); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintln(stderr, "receipt score:", err)
+		}
+		return exitFailure
+	}
+
+	breakdown, err := calculator.Breakdown(context.Background(), receipt)
+	if err != nil {
+		fmt.Fprintln(stderr, "receipt score:", err)
+		return exitFailure
+	}
+
+	result := scoreResult{Retailer: receipt.Retailer, Points: breakdown.Total, Rules: breakdown.Rules}
+	if common.format == formatJSON {
+		err = writeJSON(stdout, result)
+	} else {
+		err = writeScore(stdout, result)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "receipt score:", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// writeScore prints a score as a table of the points awarded by each rule
+func writeScore(w io.Writer, result scoreResult) error {
+	width := 0
+	for _, rule := range result.Rules {
+		width = max(width, len(rule.Rule))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %d points\n\n", result.Retailer, result.Points)
+	for _, rule := range result.Rules {
+		fmt.Fprintf(&b, "  %-*s  %4d\n", width, rule.Rule, rule.Points)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// validateResult is the JSON output of the validate command
+type validateResult struct {
+	Valid  bool     `json:"valid"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+// runValidate validates a single receipt and prints every validation error.
+// It exits with exitFailure when the receipt is invalid.
+func runValidate(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var common commonFlags
+	fs := newFlagSet("validate", stderr, &common, false, true)
+	file, err := parseFlags(fs, &common, args)
+	if err != nil {
+		fmt.Fprintln(stderr, "receipt validate:", err)
+		return exitUsage
+	}
+
+	var result validateResult
+	receipt, err := readReceipt(file, stdin)
+	if err != nil {
+		result.Errors = []string{err.Error()}
+	} else {
+		result.Errors = errorStrings(receipt.ValidateAll())
+	}
+	result.Valid = len(result.Errors) == 0
+
+	if common.format == formatJSON {
+		err = writeJSON(stdout, result)
+	} else if result.Valid {
+		_, err = fmt.Fprintln(stdout, "valid")
+	} else {
+		for _, message := range result.Errors {
+			if _, err = fmt.Fprintln(stdout, message); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "receipt validate:", err)
+		return exitFailure
+	}
+
+	if !result.Valid {
+		return exitFailure
+	}
+	return exitOK
+}
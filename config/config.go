@@ -0,0 +1,335 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/marcelorm/receipt-processor/models"
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secret values when the configuration is printed
+const redacted = "REDACTED"
+
+// Config is the complete, typed configuration of the service
+type Config struct {
+	Port            int            `yaml:"port"`            // Port to run the server on
+	GinMode         string         `yaml:"ginMode"`         // Gin mode (debug, release, test)
+	LogLevel        string         `yaml:"logLevel"`        // Logging level (DEBUG, INFO, WARN, ERROR)
+	MaxBodySize     int64          `yaml:"maxBodySize"`     // Maximum request body size in bytes
+	ShutdownTimeout time.Duration  `yaml:"shutdownTimeout"` // Time allowed for graceful shutdown
+	Tracing         Tracing        `yaml:"tracing"`
+	GRPC            GRPC           `yaml:"grpc"`
+	Webhooks        Webhooks       `yaml:"webhooks"`
+	Events          Events         `yaml:"events"`
+	Consumer        Consumer       `yaml:"consumer"`
+	DateTime        DateTime       `yaml:"dateTime"`
+	TimeZones       TimeZones      `yaml:"timeZones"`
+	Rules           Rules          `yaml:"rules"`
+	Reconciliation  Reconciliation `yaml:"reconciliation"`
+	Currency        Currency       `yaml:"currency"`
+}
+
+// Currency configures the currency rule thresholds are expressed in and the
+// exchange rates receipts in other currencies are converted with
+type Currency struct {
+	Base      string `yaml:"base"`      // ISO 4217 code of the currency rules are expressed in
+	RatesFile string `yaml:"ratesFile"` // YAML or JSON exchange-rate table; empty accepts only the base currency
+}
+
+// Reconciliation configures the check of receipt totals against their items,
+// tax, tip and discounts
+type Reconciliation struct {
+	Tolerance float64 `yaml:"tolerance"` // Largest difference accepted, in currency units
+	Policy    string  `yaml:"policy"`    // What happens to receipts that do not add up (warn, reject)
+}
+
+// Rules configures how the point rules count
+type Rules struct {
+	CountQuantities bool `yaml:"countQuantities"` // Count item pairs by the quantity of each item
+}
+
+// TimeZones configures the local time rules are evaluated in. Zones are IANA
+// names, such as America/Chicago, or UTC offsets, such as -06:00.
+type TimeZones struct {
+	Default string            `yaml:"default"` // Zone of stores not listed; empty scores receipts in their own zone
+	Stores  map[string]string `yaml:"stores"`  // Zone of each retailer's stores, by retailer name
+}
+
+// DateTime configures the purchase date and time formats accepted from
+// clients, which are normalized to YYYY-MM-DD and HH:MM. The formats are set
+// process-wide with models.SetFormats.
+type DateTime struct {
+	DateLayouts []string `yaml:"dateLayouts"` // Go layouts or names such as RFC3339 accepted besides YYYY-MM-DD
+	TimeLayouts []string `yaml:"timeLayouts"` // Go layouts or names such as Kitchen accepted besides HH:MM
+	Mode        string   `yaml:"mode"`        // Parsing mode (strict, lenient)
+}
+
+// Formats returns the date and time formats to set with models.SetFormats
+func (d DateTime) Formats() models.Formats {
+	return models.Formats{
+		DateLayouts: d.DateLayouts,
+		TimeLayouts: d.TimeLayouts,
+		Lenient:     d.Mode == "lenient",
+	}
+}
+
+// Consumer configures ingestion of receipts from a message queue
+type Consumer struct {
+	Source     string `yaml:"source"`     // Queue to consume receipts from (none, spool, nats)
+	SpoolDir   string `yaml:"spoolDir"`   // Directory of receipt JSON files for the spool source
+	Workers    int    `yaml:"workers"`    // Messages processed concurrently
+	MaxBacklog int    `yaml:"maxBacklog"` // Queued receipts above which the service reports unready; 0 disables the check
+	NATS       NATS   `yaml:"nats"`
+}
+
+// NATS configures the JetStream consumer used by the nats source
+type NATS struct {
+	URL               string `yaml:"url"`               // Server URL; credentials in it are secret
+	Stream            string `yaml:"stream"`            // Stream holding the receipts
+	Consumer          string `yaml:"consumer"`          // Durable pull consumer with explicit acks
+	DeadLetterSubject string `yaml:"deadLetterSubject"` // Subject poison messages are republished on
+}
+
+// Events configures the /events stream of scoring activity
+type Events struct {
+	MaxSubscribers int           `yaml:"maxSubscribers"` // Maximum concurrent streams
+	BufferSize     int           `yaml:"bufferSize"`     // Recent events kept for clients resuming with Last-Event-ID
+	Heartbeat      time.Duration `yaml:"heartbeat"`      // Interval between heartbeats on idle streams
+	MaxBacklog     int           `yaml:"maxBacklog"`     // Undelivered events above which the service reports unready; 0 disables the check
+}
+
+// Webhooks configures webhook subscriptions and delivery
+type Webhooks struct {
+	Enabled     bool   `yaml:"enabled"`     // Serve the webhook endpoints and deliver events
+	Dir         string `yaml:"dir"`         // Directory persisting subscriptions and the outbox; empty keeps them in memory
+	MaxAttempts int    `yaml:"maxAttempts"` // Delivery attempts before an event is dead-lettered
+
+	AllowPrivateURLs bool `yaml:"allowPrivateURLs"` // Deliver to loopback, private and link-local addresses
+}
+
+// GRPC configures the gRPC API
+type GRPC struct {
+	Enabled bool `yaml:"enabled"` // Serve the gRPC API
+	Port    int  `yaml:"port"`    // Port for the gRPC API; 0 shares the HTTP port
+}
+
+// Tracing configures span sampling and export
+type Tracing struct {
+	Exporter     string            `yaml:"exporter"`     // Span exporter (none, stdout, file, otlp)
+	File         string            `yaml:"file"`         // Output file for the file exporter
+	OTLPEndpoint string            `yaml:"otlpEndpoint"` // Collector URL for the otlp exporter
+	OTLPHeaders  map[string]string `yaml:"otlpHeaders"`  // Headers sent to the collector (secret)
+	SampleRatio  float64           `yaml:"sampleRatio"`  // Fraction of new traces to sample
+}
+
+// Default returns the configuration used when nothing else is specified
+func Default() Config {
+	return Config{
+		Port:            8080,
+		GinMode:         "debug",
+		LogLevel:        "INFO",
+		MaxBodySize:     1024 * 1024,
+		ShutdownTimeout: 5 * time.Second,
+		Tracing: Tracing{
+			Exporter:    "none",
+			SampleRatio: 1,
+		},
+		GRPC: GRPC{
+			Enabled: true,
+		},
+		Webhooks: Webhooks{
+			MaxAttempts: 8,
+		},
+		Events: Events{
+			MaxSubscribers: 100,
+			BufferSize:     1000,
+			Heartbeat:      15 * time.Second,
+			MaxBacklog:     10000,
+		},
+		Consumer: Consumer{
+			Source:     "none",
+			Workers:    4,
+			MaxBacklog: 10000,
+		},
+		DateTime: DateTime{
+			Mode: "strict",
+		},
+		Reconciliation: Reconciliation{
+			Tolerance: 0.01,
+			Policy:    "warn",
+		},
+		Currency: Currency{
+			Base: "USD",
+		},
+	}
+}
+
+// Validate checks every setting and reports all problems at once
+func (c Config) Validate() error {
+	var errs []error
+	invalid := func(name, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: "+format, append([]any{name}, args...)...))
+	}
+
+	if c.Port < 1 || c.Port > 65535 {
+		invalid("port", "must be between 1 and 65535, got %d", c.Port)
+	}
+	if !oneOf(c.GinMode, "debug", "release", "test") {
+		invalid("ginMode", "must be one of debug, release, test, got %q", c.GinMode)
+	}
+	if !oneOf(c.LogLevel, "DEBUG", "INFO", "WARN", "ERROR") {
+		invalid("logLevel", "must be one of DEBUG, INFO, WARN, ERROR, got %q", c.LogLevel)
+	}
+	if c.MaxBodySize <= 0 {
+		invalid("maxBodySize", "must be a positive number of bytes, got %d", c.MaxBodySize)
+	}
+	if c.ShutdownTimeout <= 0 {
+		invalid("shutdownTimeout", "must be a positive duration, got %s", c.ShutdownTimeout)
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	case "file":
+		if c.Tracing.File == "" {
+			invalid("tracing.file", "is required when the file exporter is used")
+		}
+	default:
+		invalid("tracing.exporter", "must be one of none, stdout, file, otlp, got %q", c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio <= 0 || c.Tracing.SampleRatio > 1 {
+		invalid("tracing.sampleRatio", "must be greater than 0 and at most 1, got %g", c.Tracing.SampleRatio)
+	}
+
+	if c.GRPC.Port < 0 || c.GRPC.Port > 65535 {
+		invalid("grpc.port", "must be between 0 and 65535, got %d", c.GRPC.Port)
+	} else if c.GRPC.Enabled && c.GRPC.Port == c.Port {
+		invalid("grpc.port", "must differ from port %d; use 0 to share the HTTP port", c.Port)
+	}
+
+	if c.Webhooks.MaxAttempts < 1 {
+		invalid("webhooks.maxAttempts", "must be at least 1, got %d", c.Webhooks.MaxAttempts)
+	}
+
+	if c.Events.MaxSubscribers < 1 {
+		invalid("events.maxSubscribers", "must be at least 1, got %d", c.Events.MaxSubscribers)
+	}
+	if c.Events.BufferSize < 0 {
+		invalid("events.bufferSize", "must not be negative, got %d", c.Events.BufferSize)
+	}
+	if c.Events.Heartbeat <= 0 {
+		invalid("events.heartbeat", "must be a positive duration, got %s", c.Events.Heartbeat)
+	}
+	if c.Events.MaxBacklog < 0 {
+		invalid("events.maxBacklog", "must not be negative, got %d", c.Events.MaxBacklog)
+	}
+
+	switch c.Consumer.Source {
+	case "none":
+	case "spool":
+		if c.Consumer.SpoolDir == "" {
+			invalid("consumer.spoolDir", "is required when the spool source is used")
+		}
+	case "nats":
+		if c.Consumer.NATS.URL == "" {
+			invalid("consumer.nats.url", "is required when the nats source is used")
+		}
+		if c.Consumer.NATS.Stream == "" {
+			invalid("consumer.nats.stream", "is required when the nats source is used")
+		}
+		if c.Consumer.NATS.Consumer == "" {
+			invalid("consumer.nats.consumer", "is required when the nats source is used")
+		}
+	default:
+		invalid("consumer.source", "must be one of none, spool, nats, got %q", c.Consumer.Source)
+	}
+	if c.Consumer.Workers < 1 {
+		invalid("consumer.workers", "must be at least 1, got %d", c.Consumer.Workers)
+	}
+	if c.Consumer.MaxBacklog < 0 {
+		invalid("consumer.maxBacklog", "must not be negative, got %d", c.Consumer.MaxBacklog)
+	}
+
+	if !oneOf(c.DateTime.Mode, "strict", "lenient") {
+		invalid("dateTime.mode", "must be one of strict, lenient, got %q", c.DateTime.Mode)
+	}
+	if err := c.DateTime.Formats().Validate(); err != nil {
+		invalid("dateTime", "%v", err)
+	}
+
+	if c.TimeZones.Default != "" {
+		if _, err := models.LoadZone(c.TimeZones.Default); err != nil {
+			invalid("timeZones.default", "%v", err)
+		}
+	}
+	retailers := make([]string, 0, len(c.TimeZones.Stores))
+	for retailer := range c.TimeZones.Stores {
+		retailers = append(retailers, retailer)
+	}
+	slices.Sort(retailers)
+	for _, retailer := range retailers {
+		if _, err := models.LoadZone(c.TimeZones.Stores[retailer]); err != nil {
+			invalid("timeZones.stores", "%s: %v", retailer, err)
+		}
+	}
+
+	if c.Reconciliation.Tolerance < 0 {
+		invalid("reconciliation.tolerance", "must not be negative, got %g", c.Reconciliation.Tolerance)
+	}
+	if !oneOf(c.Reconciliation.Policy, "warn", "reject") {
+		invalid("reconciliation.policy", "must be one of warn, reject, got %q", c.Reconciliation.Policy)
+	}
+	if _, err := models.LookupCurrency(c.Currency.Base); err != nil {
+		invalid("currency.base", "%v", err)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Redacted returns a copy of the configuration with secret values masked
+func (c Config) Redacted() Config {
+	if len(c.Tracing.OTLPHeaders) > 0 {
+		headers := make(map[string]string, len(c.Tracing.OTLPHeaders))
+		for k := range c.Tracing.OTLPHeaders {
+			headers[k] = redacted
+		}
+		c.Tracing.OTLPHeaders = headers
+	}
+	if u, err := url.Parse(c.Consumer.NATS.URL); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		} else {
+			// A user without a password is a token
+			u.User = url.User(redacted)
+		}
+		c.Consumer.NATS.URL = u.String()
+	}
+	return c
+}
+
+// Print writes the effective configuration as YAML with secrets redacted
+func (c Config) Print(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// oneOf reports whether value is one of the allowed values
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
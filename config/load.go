@@ -0,0 +1,395 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// setting describes a single configuration value and where it can be set
+type setting struct {
+	env   string                      // Environment variable
+	flag  string                      // Command-line flag
+	usage string                      // Flag usage text
+	set   func(*Config, string) error // Parses and stores a string value
+}
+
+// settings lists every value that can be set from the environment or flags
+var settings = []setting{
+	{"PORT", "port", "Port to run the server on", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", v)
+		}
+		c.Port = n
+		return nil
+	}},
+	{"GIN_MODE", "gin-mode", "Gin mode (debug, release, test)", func(c *Config, v string) error {
+		c.GinMode = v
+		return nil
+	}},
+	{"LOG_LEVEL", "log-level", "Logging level (DEBUG, INFO, WARN, ERROR)", func(c *Config, v string) error {
+		c.LogLevel = v
+		return nil
+	}},
+	{"MAX_BODY_SIZE", "max-body-size", "Maximum request body size in bytes", func(c *Config, v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", v)
+		}
+		c.MaxBodySize = n
+		return nil
+	}},
+	{"SHUTDOWN_TIMEOUT", "shutdown-timeout", "Time allowed for graceful shutdown, e.g. 5s", func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", v)
+		}
+		c.ShutdownTimeout = d
+		return nil
+	}},
+	{"TRACING_EXPORTER", "tracing-exporter", "Span exporter (none, stdout, file, otlp)", func(c *Config, v string) error {
+		c.Tracing.Exporter = v
+		return nil
+	}},
+	{"TRACING_FILE", "tracing-file", "Output file for the file exporter", func(c *Config, v string) error {
+		c.Tracing.File = v
+		return nil
+	}},
+	{"TRACING_OTLP_ENDPOINT", "tracing-otlp-endpoint", "Collector URL for the otlp exporter", func(c *Config, v string) error {
+		c.Tracing.OTLPEndpoint = v
+		return nil
+	}},
+	{"TRACING_OTLP_HEADERS", "tracing-otlp-headers", "Headers sent to the collector as key=value,key=value", func(c *Config, v string) error {
+		headers, err := parseHeaders(v)
+		if err != nil {
+			return err
+		}
+		c.Tracing.OTLPHeaders = headers
+		return nil
+	}},
+	{"TRACING_SAMPLE_RATIO", "tracing-sample-ratio", "Fraction of new traces to sample (0-1]", func(c *Config, v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", v)
+		}
+		c.Tracing.SampleRatio = f
+		return nil
+	}},
+	{"GRPC_ENABLED", "grpc-enabled", "Serve the gRPC API (true, false)", func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", v)
+		}
+		c.GRPC.Enabled = b
+		return nil
+	}},
+	{"GRPC_PORT", "grpc-port", "Port for the gRPC API; 0 shares the HTTP port", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", v)
+		}
+		c.GRPC.Port = n
+		return nil
+	}},
+	{"WEBHOOKS_ENABLED", "webhooks-enabled", "Serve the webhook endpoints and deliver events (true, false)", func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", v)
+		}
+		c.Webhooks.Enabled = b
+		return nil
+	}},
+	{"WEBHOOKS_DIR", "webhooks-dir", "Directory persisting webhook subscriptions and the outbox", func(c *Config, v string) error {
+		c.Webhooks.Dir = v
+		return nil
+	}},
+	{"WEBHOOKS_MAX_ATTEMPTS", "webhooks-max-attempts", "Delivery attempts before an event is dead-lettered", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", v)
+		}
+		c.Webhooks.MaxAttempts = n
+		return nil
+	}},
+	{"WEBHOOKS_ALLOW_PRIVATE_URLS", "webhooks-allow-private-urls", "Deliver webhooks to loopback, private and link-local addresses (true, false)", func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", v)
+		}
+		c.Webhooks.AllowPrivateURLs = b
+		return nil
+	}},
+	{"EVENTS_MAX_SUBSCRIBERS", "events-max-subscribers", "Maximum concurrent /events streams", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", v)
+		}
+		c.Events.MaxSubscribers = n
+		return nil
+	}},
+	{"EVENTS_BUFFER_SIZE", "events-buffer-size", "Recent events kept for clients resuming with Last-Event-ID", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", v)
+		}
+		c.Events.BufferSize = n
+		return nil
+	}},
+	{"EVENTS_HEARTBEAT", "events-heartbeat", "Interval between heartbeats on idle /events streams, e.g. 15s", func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", v)
+		}
+		c.Events.Heartbeat = d
+		return nil
+	}},
+	{"EVENTS_MAX_BACKLOG", "events-max-backlog", "Undelivered events above which the service reports unready; 0 disables the check", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", v)
+		}
+		c.Events.MaxBacklog = n
+		return nil
+	}},
+	{"CONSUMER_SOURCE", "consumer-source", "Queue to consume receipts from (none, spool, nats)", func(c *Config, v string) error {
+		c.Consumer.Source = v
+		return nil
+	}},
+	{"CONSUMER_SPOOL_DIR", "consumer-spool-dir", "Directory of receipt JSON files for the spool source", func(c *Config, v string) error {
+		c.Consumer.SpoolDir = v
+		return nil
+	}},
+	{"CONSUMER_WORKERS", "consumer-workers", "Queued receipts processed concurrently", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", v)
+		}
+		c.Consumer.Workers = n
+		return nil
+	}},
+	{"CONSUMER_MAX_BACKLOG", "consumer-max-backlog", "Queued receipts above which the service reports unready; 0 disables the check", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", v)
+		}
+		c.Consumer.MaxBacklog = n
+		return nil
+	}},
+	{"CONSUMER_NATS_URL", "consumer-nats-url", "NATS server URL for the nats source", func(c *Config, v string) error {
+		c.Consumer.NATS.URL = v
+		return nil
+	}},
+	{"CONSUMER_NATS_STREAM", "consumer-nats-stream", "JetStream stream holding the receipts", func(c *Config, v string) error {
+		c.Consumer.NATS.Stream = v
+		return nil
+	}},
+	{"CONSUMER_NATS_CONSUMER", "consumer-nats-consumer", "Durable JetStream pull consumer to receive from", func(c *Config, v string) error {
+		c.Consumer.NATS.Consumer = v
+		return nil
+	}},
+	{"CONSUMER_NATS_DEAD_LETTER_SUBJECT", "consumer-nats-dead-letter-subject", "Subject poison messages are republished on", func(c *Config, v string) error {
+		c.Consumer.NATS.DeadLetterSubject = v
+		return nil
+	}},
+	{"RULES_COUNT_QUANTITIES", "rules-count-quantities", "Count item pairs by the quantity of each item (true, false)", func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", v)
+		}
+		c.Rules.CountQuantities = b
+		return nil
+	}},
+	{"RECONCILIATION_TOLERANCE", "reconciliation-tolerance", "Largest difference accepted between a total and its items, tax, tip and discounts", func(c *Config, v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", v)
+		}
+		c.Reconciliation.Tolerance = f
+		return nil
+	}},
+	{"RECONCILIATION_POLICY", "reconciliation-policy", "What happens to receipts whose total does not add up (warn, reject)", func(c *Config, v string) error {
+		c.Reconciliation.Policy = v
+		return nil
+	}},
+	{"CURRENCY_BASE", "currency-base", "ISO 4217 currency rule thresholds are expressed in", func(c *Config, v string) error {
+		c.Currency.Base = v
+		return nil
+	}},
+	{"CURRENCY_RATES_FILE", "currency-rates-file", "YAML or JSON exchange-rate table for receipts in other currencies", func(c *Config, v string) error {
+		c.Currency.RatesFile = v
+		return nil
+	}},
+	{"TIME_ZONE_DEFAULT", "time-zone-default", "Time zone of stores without one, e.g. America/Chicago", func(c *Config, v string) error {
+		c.TimeZones.Default = v
+		return nil
+	}},
+	{"TIME_ZONE_STORES", "time-zone-stores", "Time zone of each retailer's stores as retailer=zone,retailer=zone", func(c *Config, v string) error {
+		stores, err := parseStoreZones(v)
+		if err != nil {
+			return err
+		}
+		c.TimeZones.Stores = stores
+		return nil
+	}},
+	{"DATE_LAYOUTS", "date-layouts", "Date layouts accepted besides 2006-01-02, separated by semicolons", func(c *Config, v string) error {
+		c.DateTime.DateLayouts = splitLayouts(v)
+		return nil
+	}},
+	{"TIME_LAYOUTS", "time-layouts", "Time layouts accepted besides 15:04, separated by semicolons", func(c *Config, v string) error {
+		c.DateTime.TimeLayouts = splitLayouts(v)
+		return nil
+	}},
+	{"DATE_TIME_MODE", "date-time-mode", "Date and time parsing mode (strict, lenient)", func(c *Config, v string) error {
+		c.DateTime.Mode = v
+		return nil
+	}},
+}
+
+// Loader builds the configuration from a config file, environment variables
+// and command-line flags
+type Loader struct {
+	fs    *flag.FlagSet
+	file  *string
+	flags map[string]*string
+}
+
+// NewLoader registers the -config flag and a flag for every setting on fs.
+// Load must be called after fs has been parsed.
+func NewLoader(fs *flag.FlagSet) *Loader {
+	l := &Loader{
+		fs:    fs,
+		file:  fs.String("config", "", "Path to a YAML config file (env CONFIG_FILE)"),
+		flags: make(map[string]*string, len(settings)),
+	}
+	for _, s := range settings {
+		l.flags[s.flag] = fs.String(s.flag, "", fmt.Sprintf("%s (env %s)", s.usage, s.env))
+	}
+	return l
+}
+
+// Load returns the validated configuration. Sources are applied in increasing
+// order of precedence: built-in defaults, the config file named by -config or
+// CONFIG_FILE, environment variables, and finally command-line flags.
+func (l *Loader) Load(lookupEnv func(string) (string, bool)) (Config, error) {
+	cfg := Default()
+	var errs []error
+
+	// Config file
+	path := *l.file
+	if path == "" {
+		path, _ = lookupEnv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return Config{}, fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+
+	// Environment variables
+	for _, s := range settings {
+		if v, ok := lookupEnv(s.env); ok && v != "" {
+			if err := s.set(&cfg, v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.env, err))
+			}
+		}
+	}
+
+	// Command-line flags that were explicitly set
+	explicit := make(map[string]bool)
+	l.fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	for _, s := range settings {
+		if explicit[s.flag] {
+			if err := s.set(&cfg, *l.flags[s.flag]); err != nil {
+				errs = append(errs, fmt.Errorf("-%s: %w", s.flag, err))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return Config{}, fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+
+	cfg.normalize()
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// loadFile decodes a YAML config file over cfg, rejecting unknown keys
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// normalize canonicalises the case of enumerated values
+func (c *Config) normalize() {
+	c.GinMode = strings.ToLower(strings.TrimSpace(c.GinMode))
+	c.LogLevel = strings.ToUpper(strings.TrimSpace(c.LogLevel))
+	c.Tracing.Exporter = strings.ToLower(strings.TrimSpace(c.Tracing.Exporter))
+	c.DateTime.Mode = strings.ToLower(strings.TrimSpace(c.DateTime.Mode))
+	c.Reconciliation.Policy = strings.ToLower(strings.TrimSpace(c.Reconciliation.Policy))
+	c.Currency.Base = strings.ToUpper(strings.TrimSpace(c.Currency.Base))
+}
+
+// parseStoreZones parses a comma separated list of retailer=zone pairs
+func parseStoreZones(v string) (map[string]string, error) {
+	stores := make(map[string]string)
+	for _, pair := range strings.Split(v, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		retailer, zone, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(retailer) == "" {
+			return nil, fmt.Errorf("invalid store zone %q, expected retailer=zone", pair)
+		}
+		stores[strings.TrimSpace(retailer)] = strings.TrimSpace(zone)
+	}
+	return stores, nil
+}
+
+// splitLayouts splits a list of layouts separated by semicolons, since
+// layouts such as "Jan 2, 2006" may contain commas
+func splitLayouts(v string) []string {
+	var layouts []string
+	for _, layout := range strings.Split(v, ";") {
+		if layout = strings.TrimSpace(layout); layout != "" {
+			layouts = append(layouts, layout)
+		}
+	}
+	return layouts
+}
+
+// parseHeaders parses a comma separated list of key=value pairs
+func parseHeaders(v string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(v, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid header %q, expected key=value", pair)
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
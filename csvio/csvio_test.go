@@ -0,0 +1,412 @@
+package csvio
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/storage"
+)
+
+// item creates an item
+func item(description string, price models.Price) models.Item {
+	return models.Item{ShortDescription: description, Price: price}
+}
+
+// header is the default header row
+const header = "receipt,retailer,purchaseDate,purchaseTime,total,shortDescription,price\n"
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name     string
+		mapping  Mapping
+		input    string
+		expected []Group
+	}{
+		{
+			name: "Receipt fields on every row",
+			input: header +
+				"r1,Target,2022-01-01,13:01,18.74,Mountain Dew 12PK,6.49\n" +
+				"r1,Target,2022-01-01,13:01,18.74,Emils Cheese Pizza,12.25\n",
+			expected: []Group{{
+				Key:  "r1",
+				Rows: []int{2, 3},
+				Receipt: models.Receipt{
+					Retailer: "Target", PurchaseDate: models.MustParseDate("2022-01-01"), PurchaseTime: models.MustParseTime("13:01"), Total: 18.74,
+					Items: []models.Item{item("Mountain Dew 12PK", 6.49), item("Emils Cheese Pizza", 12.25)},
+				},
+			}},
+		},
+		{
+			name: "Receipt fields once and interleaved keys",
+			input: header +
+				"a,Target,2022-01-01,13:01,6.49,Mountain Dew 12PK,6.49\n" +
+				"b,Walgreens,2022-01-02,08:13,2.65,Pepsi - 12-oz,1.25\n" +
+				"b,,,,,Dasani,1.40\n",
+			expected: []Group{
+				{
+					Key:  "a",
+					Rows: []int{2},
+					Receipt: models.Receipt{
+						Retailer: "Target", PurchaseDate: models.MustParseDate("2022-01-01"), PurchaseTime: models.MustParseTime("13:01"), Total: 6.49,
+						Items: []models.Item{item("Mountain Dew 12PK", 6.49)},
+					},
+				},
+				{
+					Key:  "b",
+					Rows: []int{3, 4},
+					Receipt: models.Receipt{
+						Retailer: "Walgreens", PurchaseDate: models.MustParseDate("2022-01-02"), PurchaseTime: models.MustParseTime("08:13"), Total: 2.65,
+						Items: []models.Item{item("Pepsi - 12-oz", 1.25), item("Dasani", 1.40)},
+					},
+				},
+			},
+		},
+		{
+			name:    "Custom mapping",
+			mapping: Mapping{FieldReceipt: "Receipt No", FieldRetailer: "Store", FieldPrice: "Amount"},
+			input: "Receipt No,Store,purchaseDate,purchaseTime,total,shortDescription,Amount,Notes\n" +
+				"7,Target,2022-01-01,13:01,1.26,Knorr Creamy Chicken,1.26,ignored\n",
+			expected: []Group{{
+				Key:  "7",
+				Rows: []int{2},
+				Receipt: models.Receipt{
+					Retailer: "Target", PurchaseDate: models.MustParseDate("2022-01-01"), PurchaseTime: models.MustParseTime("13:01"), Total: 1.26,
+					Items: []models.Item{item("Knorr Creamy Chicken", 1.26)},
+				},
+			}},
+		},
+		{
+			name: "Subtotal, tax and tip",
+			input: "receipt,retailer,purchaseDate,purchaseTime,total,shortDescription,price,subtotal,tax,tip,discounts\n" +
+				"r1,Target,2022-01-01,13:01,20.35,Mountain Dew 12PK,6.49,18.74,1.61,1.00,1.00\n" +
+				"r1,,,,,Emils Cheese Pizza,12.25,,,,\n",
+			expected: []Group{{
+				Key:  "r1",
+				Rows: []int{2, 3},
+				Receipt: models.Receipt{
+					Retailer: "Target", PurchaseDate: models.MustParseDate("2022-01-01"), PurchaseTime: models.MustParseTime("13:01"), Total: 20.35,
+					Items:    []models.Item{item("Mountain Dew 12PK", 6.49), item("Emils Cheese Pizza", 12.25)},
+					Subtotal: 18.74, Tax: 1.61, Tip: 1.00, Discounts: 1.00,
+				},
+			}},
+		},
+		{
+			name:  "Byte order mark and blank rows",
+			input: "\ufeff" + header + "\n,,,,,,\nr1,Target,2022-01-01,13:01,1.00,Gum,1.00\n",
+			expected: []Group{{
+				Key:  "r1",
+				Rows: []int{3},
+				Receipt: models.Receipt{
+					Retailer: "Target", PurchaseDate: models.MustParseDate("2022-01-01"), PurchaseTime: models.MustParseTime("13:01"), Total: 1,
+					Items: []models.Item{item("Gum", 1)},
+				},
+			}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			groups, err := Read(strings.NewReader(tc.input), tc.mapping)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(groups, tc.expected) {
+				t.Errorf("Expected %+v, got %+v", tc.expected, groups)
+			}
+		})
+	}
+}
+
+func TestReadRowErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		rows     string
+		expected []RowError
+	}{
+		{
+			name: "Conflicting retailer",
+			rows: "r1,Target,2022-01-01,13:01,2.00,Gum,1.00\n" +
+				"r1,Walmart,,,,Mints,1.00\n",
+			expected: []RowError{{3, "retailer", rperrors.ErrInvalidReceiptData, `"Walmart" conflicts with "Target" on row 2`}},
+		},
+		{
+			name:     "Invalid price",
+			rows:     "r1,Target,2022-01-01,13:01,2.00,Gum,abc\n",
+			expected: []RowError{{2, "price", rperrors.ErrInvalidItemPrice, `invalid price format: strconv.ParseFloat: parsing "abc": invalid syntax`}},
+		},
+		{
+			name: "Missing description and price",
+			rows: "r1,Target,2022-01-01,13:01,2.00,Gum,1.00\n" +
+				"r1,,,,,,1.00\n" +
+				"r1,,,,,Mints,\n",
+			expected: []RowError{
+				{3, "shortDescription", rperrors.ErrInvalidItemDescription, "short description is required"},
+				{4, "price", rperrors.ErrInvalidItemPrice, "price is required"},
+			},
+		},
+		{
+			name: "Invalid receipt fields",
+			rows: "r1,,2022-13-01,25:00,,Gum,1.00\n",
+			expected: []RowError{
+				{2, "retailer", rperrors.ErrInvalidRetailer, "retailer is required"},
+				{2, "purchaseDate", rperrors.ErrInvalidPurchaseDate, `invalid date format: parsing time "2022-13-01": month out of range`},
+				{2, "purchaseTime", rperrors.ErrInvalidPurchaseTime, `invalid time format: parsing time "25:00": hour out of range`},
+				{2, "total", rperrors.ErrInvalidTotal, "total is required"},
+			},
+		},
+		{
+			name:     "No items",
+			rows:     "r1,Target,2022-01-01,13:01,2.00,,\n",
+			expected: []RowError{{2, "", rperrors.ErrMissingItems, "at least one item is required"}},
+		},
+		{
+			name:     "Missing receipt key",
+			rows:     ",Target,2022-01-01,13:01,2.00,Gum,1.00\n",
+			expected: []RowError{{2, "receipt", rperrors.ErrInvalidReceiptData, "receipt key is required"}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			groups, err := Read(strings.NewReader(header+tc.rows), nil)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if len(groups) != 1 {
+				t.Fatalf("Expected 1 receipt, got %d", len(groups))
+			}
+			if !reflect.DeepEqual(groups[0].Errors, tc.expected) {
+				t.Errorf("Expected errors %+v, got %+v", tc.expected, groups[0].Errors)
+			}
+		})
+	}
+}
+
+func TestReadInvalidFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		mapping  Mapping
+		input    string
+		expected string
+	}{
+		{"Empty", nil, "", "no header row"},
+		{"Missing columns", nil, "receipt,retailer,purchaseDate,purchaseTime,total\n", `missing columns: "shortDescription" (shortDescription), "price" (price)`},
+		{"Missing mapped column", Mapping{FieldTax: "VAT"}, header, `missing columns: "VAT" (tax)`},
+		{"Unknown field", Mapping{"store": "Store"}, header, `unknown field "store"`},
+		{"Empty column", Mapping{FieldRetailer: " "}, header, "column for field retailer must not be empty"},
+		{"Malformed CSV", nil, header + "r1,\"Target,2022-01-01\n", "extraneous or missing"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Read(strings.NewReader(tc.input), tc.mapping)
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("Expected error containing %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	processedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	record := storage.Record{
+		ID: "7fb1377b",
+		Receipt: models.Receipt{
+			Retailer: "M&M Corner Market", PurchaseDate: models.MustParseDate("2022-03-20"), PurchaseTime: models.MustParseTime("14:33"), Total: 9.00,
+			Items: []models.Item{item("Gatorade, \"Cool Blue\"", 2.25), item("Gatorade", 6.75)},
+		},
+		Breakdown: models.PointsBreakdown{Total: 109, Rules: []models.RuleResult{
+			{Rule: "RetailerNameRule", Points: 14},
+			{Rule: "OddDayRule", Points: 0},
+			{Rule: "RoundDollarRule", Points: 50},
+			{Rule: "QuarterMultipleRule", Points: 25},
+			{Rule: "ItemPairsRule", Points: 5},
+			{Rule: "AfternoonTimeRule", Points: 15},
+		}},
+		Points:      82, // Less the points clawed back by a refund
+		ProcessedAt: processedAt,
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.Write(record); err != nil {
+		t.Fatalf("Failed to write record: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	expected := "receipt,retailer,purchaseDate,purchaseTime,total,shortDescription,price,quantity,unitPrice,discount,sku,upc,category,subtotal,tax,tip,discounts,currency,refundOf,points,rules,processedAt\n" +
+		`7fb1377b,M&M Corner Market,2022-03-20,14:33,9.00,"Gatorade, ""Cool Blue""",2.25,,,,,,,,,,,,,82,RetailerNameRule:14;RoundDollarRule:50;QuarterMultipleRule:25;ItemPairsRule:5;AfternoonTimeRule:15,2024-01-01T12:00:00Z` + "\n" +
+		"7fb1377b,M&M Corner Market,2022-03-20,14:33,9.00,Gatorade,6.75,,,,,,,,,,,,,82,RetailerNameRule:14;RoundDollarRule:50;QuarterMultipleRule:25;ItemPairsRule:5;AfternoonTimeRule:15,2024-01-01T12:00:00Z\n"
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	// An export can be imported again with the default mapping
+	groups, err := Read(&buf, nil)
+	if err != nil {
+		t.Fatalf("Failed to read export: %v", err)
+	}
+	if len(groups) != 1 || len(groups[0].Errors) != 0 {
+		t.Fatalf("Expected one valid receipt, got %+v", groups)
+	}
+	if !reflect.DeepEqual(groups[0].Receipt, record.Receipt) {
+		t.Errorf("Expected %+v, got %+v", record.Receipt, groups[0].Receipt)
+	}
+}
+
+func TestCurrencyColumn(t *testing.T) {
+	record := storage.Record{
+		ID: "k1",
+		Receipt: models.Receipt{
+			Retailer: "Lawson", PurchaseDate: models.MustParseDate("2022-03-20"), PurchaseTime: models.MustParseTime("14:33"),
+			Currency: "JPY", Total: 1650, Tax: 150,
+			Items: []models.Item{item("Onigiri", 1500)},
+		},
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.Write(record); err != nil {
+		t.Fatalf("Failed to write record: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	if row := strings.Split(buf.String(), "\n")[1]; !strings.HasPrefix(row, "k1,Lawson,2022-03-20,14:33,1650,Onigiri,1500,,,,,,,,150,,,JPY,") {
+		t.Errorf("Expected whole yen and the currency, got %s", row)
+	}
+
+	groups, err := Read(&buf, nil)
+	if err != nil {
+		t.Fatalf("Failed to read export: %v", err)
+	}
+	if len(groups) != 1 || !reflect.DeepEqual(groups[0].Receipt, record.Receipt) {
+		t.Errorf("Expected %+v, got %+v", record.Receipt, groups)
+	}
+
+	groups, err = Read(strings.NewReader(strings.TrimSuffix(header, "\n")+",currency\nr1,Target,2022-01-01,13:01,1.00,Gum,1.00,usd\n"), nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := []RowError{{2, "currency", rperrors.ErrInvalidCurrency, `invalid currency "usd", expected an ISO 4217 code such as USD`}}
+	if !reflect.DeepEqual(groups[0].Errors, expected) {
+		t.Errorf("Expected errors %+v, got %+v", expected, groups[0].Errors)
+	}
+}
+
+func TestItemColumns(t *testing.T) {
+	record := storage.Record{
+		ID: "k1",
+		Receipt: models.Receipt{
+			Retailer: "Target", PurchaseDate: models.MustParseDate("2022-01-01"), PurchaseTime: models.MustParseTime("13:01"), Total: 5.50,
+			Items: []models.Item{
+				{ShortDescription: "Gum", Price: 2.50, Quantity: 2, UnitPrice: 1.50, Discount: 0.50, SKU: "GUM-1", UPC: "012345678905", Category: "Candy"},
+				{ShortDescription: "Apples", Price: 3.00, Quantity: 0.75, UnitPrice: 4.00, Category: "Produce"},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.Write(record); err != nil {
+		t.Fatalf("Failed to write record: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	rows := strings.Split(buf.String(), "\n")
+	if !strings.HasPrefix(rows[1], "k1,Target,2022-01-01,13:01,5.50,Gum,2.50,2,1.50,0.50,GUM-1,012345678905,Candy,") {
+		t.Errorf("Expected the item columns, got %s", rows[1])
+	}
+	if !strings.HasPrefix(rows[2], "k1,Target,2022-01-01,13:01,5.50,Apples,3.00,0.75,4.00,,,,Produce,") {
+		t.Errorf("Expected the item columns, got %s", rows[2])
+	}
+
+	groups, err := Read(&buf, nil)
+	if err != nil {
+		t.Fatalf("Failed to read export: %v", err)
+	}
+	if len(groups) != 1 || !reflect.DeepEqual(groups[0].Receipt, record.Receipt) {
+		t.Errorf("Expected %+v, got %+v", record.Receipt, groups)
+	}
+
+	itemHeader := strings.TrimSuffix(header, "\n") + ",quantity,unitPrice,discount,upc\n"
+	tests := []struct {
+		name     string
+		row      string
+		expected RowError
+	}{
+		{"Invalid quantity", "r1,Target,2022-01-01,13:01,3.00,Gum,3.00,two,1.50,,\n",
+			RowError{2, "quantity", rperrors.ErrInvalidItemData, `invalid quantity "two"`}},
+		{"Invalid unit price", "r1,Target,2022-01-01,13:01,3.00,Gum,3.00,2,abc,,\n",
+			RowError{2, "unitPrice", rperrors.ErrInvalidItemData, `invalid price format: strconv.ParseFloat: parsing "abc": invalid syntax`}},
+		{"Price does not match quantity", "r1,Target,2022-01-01,13:01,3.00,Gum,3.00,2,1.00,,\n",
+			RowError{2, "price", rperrors.ErrInvalidItemPrice, "price 3.00 does not match quantity 2 at unit price 1.00 less discount 0.00"}},
+		{"Invalid UPC", "r1,Target,2022-01-01,13:01,3.00,Gum,3.00,,,,012345678900\n",
+			RowError{2, "upc", rperrors.ErrInvalidItemData, `invalid upc "012345678900", expected 12 or 13 digits with a valid check digit`}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			groups, err := Read(strings.NewReader(itemHeader+tc.row), nil)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if len(groups) != 1 || !reflect.DeepEqual(groups[0].Errors, []RowError{tc.expected}) {
+				t.Errorf("Expected errors %+v, got %+v", []RowError{tc.expected}, groups)
+			}
+		})
+	}
+}
+
+func TestRefundOfColumn(t *testing.T) {
+	record := storage.Record{
+		ID: "k2",
+		Receipt: models.Receipt{
+			Retailer: "Target", PurchaseDate: models.MustParseDate("2022-01-02"), PurchaseTime: models.MustParseTime("10:00"),
+			RefundOf: "k1", Total: -2.25,
+			Items: []models.Item{item("Gatorade", -2.25)},
+		},
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.Write(record); err != nil {
+		t.Fatalf("Failed to write record: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	if row := strings.Split(buf.String(), "\n")[1]; !strings.Contains(row, ",-2.25,,,,,,,,,,,,k1,0,") {
+		t.Errorf("Expected the refunded receipt and no points, got %s", row)
+	}
+
+	groups, err := Read(&buf, nil)
+	if err != nil {
+		t.Fatalf("Failed to read export: %v", err)
+	}
+	if len(groups) != 1 || !reflect.DeepEqual(groups[0].Receipt, record.Receipt) {
+		t.Errorf("Expected %+v, got %+v", record.Receipt, groups)
+	}
+}
+
+func TestWriterEmptyExport(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.WriteHeader(); err != nil {
+		t.Fatalf("Failed to write header: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 1 {
+		t.Errorf("Expected only the header row, got %q", buf.String())
+	}
+}
@@ -0,0 +1,439 @@
+// Package csvio reads and writes receipts as CSV in a long format with one
+// row per item. Rows belonging to the same receipt share a receipt key, and
+// the receipt-level columns (retailer, date, time and total) may be repeated
+// on every row or given only once. The item columns other than the
+// description and price, and the subtotal, tax, tip, discounts, currency and
+// refundOf columns, are optional. Column headers are mapped to receipt
+// fields with a Mapping, so spreadsheets with their own headers can be read
+// without being edited.
+package csvio
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/models"
+)
+
+// Receipt fields that can be mapped to a column
+const (
+	FieldReceipt          = "receipt"
+	FieldRetailer         = "retailer"
+	FieldPurchaseDate     = "purchaseDate"
+	FieldPurchaseTime     = "purchaseTime"
+	FieldTotal            = "total"
+	FieldShortDescription = "shortDescription"
+	FieldPrice            = "price"
+	FieldQuantity         = "quantity"
+	FieldUnitPrice        = "unitPrice"
+	FieldDiscount         = "discount"
+	FieldSKU              = "sku"
+	FieldUPC              = "upc"
+	FieldCategory         = "category"
+	FieldSubtotal         = "subtotal"
+	FieldTax              = "tax"
+	FieldTip              = "tip"
+	FieldDiscounts        = "discounts"
+	FieldCurrency         = "currency"
+	FieldRefundOf         = "refundOf"
+)
+
+// fields lists the mappable fields in column order
+var fields = []string{
+	FieldReceipt, FieldRetailer, FieldPurchaseDate, FieldPurchaseTime,
+	FieldTotal, FieldShortDescription, FieldPrice,
+	FieldQuantity, FieldUnitPrice, FieldDiscount, FieldSKU, FieldUPC, FieldCategory,
+	FieldSubtotal, FieldTax, FieldTip, FieldDiscounts, FieldCurrency, FieldRefundOf,
+}
+
+// optionalFields are read only when their column exists, unless mapped
+var optionalFields = []string{
+	FieldQuantity, FieldUnitPrice, FieldDiscount, FieldSKU, FieldUPC, FieldCategory,
+	FieldSubtotal, FieldTax, FieldTip, FieldDiscounts, FieldCurrency, FieldRefundOf,
+}
+
+// Mapping names the column header holding each receipt field. Fields that
+// are not mapped are read from the column named after the field, so a nil
+// Mapping reads the columns written by Writer. Headers are matched
+// case-insensitively, ignoring surrounding spaces.
+type Mapping map[string]string
+
+// Validate checks that every mapped field exists and names a column
+func (m Mapping) Validate() error {
+	for field, header := range m {
+		if !slices.Contains(fields, field) {
+			return fmt.Errorf("unknown field %q; fields are %s", field, strings.Join(fields, ", "))
+		}
+		if strings.TrimSpace(header) == "" {
+			return fmt.Errorf("column for field %s must not be empty", field)
+		}
+	}
+	return nil
+}
+
+// column returns the header of the column holding field
+func (m Mapping) column(field string) string {
+	if header, ok := m[field]; ok {
+		return strings.TrimSpace(header)
+	}
+	return field
+}
+
+// RowError is a problem with a receipt, attributed to the row and column
+// where it was found. Rows are numbered as in a spreadsheet, with the header
+// as row 1.
+type RowError struct {
+	Row     int                `json:"row"`
+	Column  string             `json:"column,omitempty"` // Header of the offending column
+	Code    rperrors.ErrorCode `json:"code"`
+	Message string             `json:"message"`
+}
+
+// Error implements error
+func (e RowError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("row %d: %s", e.Row, e.Message)
+	}
+	return fmt.Sprintf("row %d, column %s: %s", e.Row, e.Column, e.Message)
+}
+
+// Group is a receipt assembled from the rows sharing a receipt key. The
+// receipt is valid and ready to be scored when Errors is empty.
+type Group struct {
+	Key     string
+	Rows    []int // Rows the receipt was read from, in order
+	Receipt models.Receipt
+	Errors  []RowError
+}
+
+// fieldValue is the value of a receipt-level field and the row setting it
+type fieldValue struct {
+	row   int
+	value string
+}
+
+// groupState tracks where the receipt-level fields of a group were set
+type groupState struct {
+	*Group
+	mapping Mapping
+	values  map[string]fieldValue
+}
+
+// Read reads every receipt in r, grouping rows by receipt key in the order
+// keys first appear. Problems with individual receipts are reported in the
+// Errors of their group; an error is returned only when r is not readable
+// CSV or lacks a mapped column.
+func Read(r io.Reader, mapping Mapping) ([]Group, error) {
+	if err := mapping.Validate(); err != nil {
+		return nil, err
+	}
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("no header row")
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns, err := columnIndexes(header, mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []*groupState
+	byKey := make(map[string]*groupState)
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		value := func(field string) string {
+			if i, ok := columns[field]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+		if blank(record) {
+			continue
+		}
+
+		key := strings.TrimSpace(value(FieldReceipt))
+		if key == "" {
+			groups = append(groups, &groupState{Group: &Group{
+				Rows:   []int{row},
+				Errors: []RowError{{row, mapping.column(FieldReceipt), rperrors.ErrInvalidReceiptData, "receipt key is required"}},
+			}})
+			continue
+		}
+		g, ok := byKey[key]
+		if !ok {
+			g = &groupState{Group: &Group{Key: key}, mapping: mapping, values: make(map[string]fieldValue)}
+			byKey[key] = g
+			groups = append(groups, g)
+		}
+		g.Rows = append(g.Rows, row)
+		g.readRow(row, value)
+	}
+
+	result := make([]Group, len(groups))
+	for i, g := range groups {
+		if g.values != nil {
+			g.validate()
+		}
+		result[i] = *g.Group
+	}
+	return result, nil
+}
+
+// columnIndexes finds the column of every mapped field in header
+func columnIndexes(header []string, mapping Mapping) (map[string]int, error) {
+	if len(header) > 0 {
+		// Spreadsheets often save CSV with a byte order mark
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	columns := make(map[string]int, len(fields))
+	var missing []string
+	for _, field := range fields {
+		found := false
+		for i, name := range header {
+			if strings.EqualFold(strings.TrimSpace(name), mapping.column(field)) {
+				columns[field] = i
+				found = true
+				break
+			}
+		}
+		_, mapped := mapping[field]
+		if !found && (mapped || !slices.Contains(optionalFields, field)) {
+			missing = append(missing, fmt.Sprintf("%q (%s)", mapping.column(field), field))
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing columns: %s", strings.Join(missing, ", "))
+	}
+	return columns, nil
+}
+
+// blank reports whether every field of record is empty
+func blank(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// readRow adds the receipt-level values and the item on one row to the group
+func (g *groupState) readRow(row int, value func(string) string) {
+	g.setField(row, FieldRetailer, value(FieldRetailer), func(v string) {
+		g.Receipt.Retailer = v
+	})
+	g.setField(row, FieldPurchaseDate, value(FieldPurchaseDate), func(v string) {
+		g.Receipt.PurchaseDate, _ = models.ParseDate(v)
+	})
+	g.setField(row, FieldPurchaseTime, value(FieldPurchaseTime), func(v string) {
+		g.Receipt.PurchaseTime, _ = models.ParseTime(v)
+	})
+	g.setField(row, FieldTotal, value(FieldTotal), func(v string) {
+		total, err := models.ParsePrice(v)
+		if err != nil {
+			g.addError(row, FieldTotal, rperrors.ErrInvalidTotal, err.Error())
+			return
+		}
+		g.Receipt.Total = total
+	})
+	g.setField(row, FieldCurrency, value(FieldCurrency), func(v string) {
+		if _, err := models.LookupCurrency(v); err != nil {
+			g.addError(row, FieldCurrency, rperrors.ErrInvalidCurrency, err.Error())
+			return
+		}
+		g.Receipt.Currency = v
+	})
+	g.setField(row, FieldRefundOf, value(FieldRefundOf), func(v string) {
+		g.Receipt.RefundOf = v
+	})
+	for _, amount := range []struct {
+		field string
+		dst   *models.Price
+	}{
+		{FieldSubtotal, &g.Receipt.Subtotal},
+		{FieldTax, &g.Receipt.Tax},
+		{FieldTip, &g.Receipt.Tip},
+		{FieldDiscounts, &g.Receipt.Discounts},
+	} {
+		g.setField(row, amount.field, value(amount.field), func(v string) {
+			parsed, err := models.ParsePrice(v)
+			if err != nil {
+				g.addError(row, amount.field, rperrors.ErrInvalidTotal, err.Error())
+				return
+			}
+			*amount.dst = parsed
+		})
+	}
+
+	// A row without an item only carries receipt-level values
+	if !slices.ContainsFunc(itemFields, func(field string) bool { return strings.TrimSpace(value(field)) != "" }) {
+		return
+	}
+
+	item := models.Item{
+		ShortDescription: value(FieldShortDescription),
+		SKU:              strings.TrimSpace(value(FieldSKU)),
+		UPC:              strings.TrimSpace(value(FieldUPC)),
+		Category:         strings.TrimSpace(value(FieldCategory)),
+	}
+	if strings.TrimSpace(item.ShortDescription) == "" {
+		g.addError(row, FieldShortDescription, rperrors.ErrInvalidItemDescription, "short description is required")
+		return
+	}
+	price := strings.TrimSpace(value(FieldPrice))
+	if price == "" {
+		g.addError(row, FieldPrice, rperrors.ErrInvalidItemPrice, "price is required")
+		return
+	}
+	parsed, err := models.ParsePrice(price)
+	if err != nil {
+		g.addError(row, FieldPrice, rperrors.ErrInvalidItemPrice, err.Error())
+		return
+	}
+	item.Price = parsed
+	if v := strings.TrimSpace(value(FieldQuantity)); v != "" {
+		quantity, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			g.addError(row, FieldQuantity, rperrors.ErrInvalidItemData, fmt.Sprintf("invalid quantity %q", v))
+			return
+		}
+		item.Quantity = quantity
+	}
+	for _, amount := range []struct {
+		field string
+		dst   *models.Price
+	}{
+		{FieldUnitPrice, &item.UnitPrice},
+		{FieldDiscount, &item.Discount},
+	} {
+		if v := strings.TrimSpace(value(amount.field)); v != "" {
+			parsed, err := models.ParsePrice(v)
+			if err != nil {
+				g.addError(row, amount.field, rperrors.ErrInvalidItemData, err.Error())
+				return
+			}
+			*amount.dst = parsed
+		}
+	}
+	if err := item.Validate(); err != nil {
+		field, code := itemErrorField(err)
+		g.addError(row, field, code, err.Error())
+		return
+	}
+	g.Receipt.Items = append(g.Receipt.Items, item)
+}
+
+// itemFields are the columns describing the item on a row
+var itemFields = []string{
+	FieldShortDescription, FieldPrice,
+	FieldQuantity, FieldUnitPrice, FieldDiscount, FieldSKU, FieldUPC, FieldCategory,
+}
+
+// itemErrorField returns the field and code of an error returned by
+// models.Item.Validate
+func itemErrorField(err error) (string, rperrors.ErrorCode) {
+	msg := err.Error()
+	switch {
+	case strings.HasPrefix(msg, "quantity "):
+		return FieldQuantity, rperrors.ErrInvalidItemData
+	case strings.HasPrefix(msg, "unit price "):
+		return FieldUnitPrice, rperrors.ErrInvalidItemData
+	case strings.HasPrefix(msg, "discount "):
+		return FieldDiscount, rperrors.ErrInvalidItemData
+	case strings.HasPrefix(msg, "invalid upc"):
+		return FieldUPC, rperrors.ErrInvalidItemData
+	case strings.HasPrefix(msg, "price "):
+		return FieldPrice, rperrors.ErrInvalidItemPrice
+	}
+	return FieldShortDescription, rperrors.ErrInvalidItemDescription
+}
+
+// setField sets a receipt-level field from the first row giving it, and
+// reports later rows giving a different value
+func (g *groupState) setField(row int, field, value string, set func(string)) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+	first, ok := g.values[field]
+	if !ok {
+		g.values[field] = fieldValue{row: row, value: value}
+		set(value)
+		return
+	}
+	if first.value != value {
+		g.addError(row, field, rperrors.ErrInvalidReceiptData,
+			fmt.Sprintf("%q conflicts with %q on row %d", value, first.value, first.row))
+	}
+}
+
+// validate checks the assembled receipt, attributing each problem to the
+// row that set the field, or the group's first row when no row did
+func (g *groupState) validate() {
+	row := func(field string) int {
+		if v, ok := g.values[field]; ok {
+			return v.row
+		}
+		return g.Rows[0]
+	}
+
+	if g.Receipt.Retailer == "" {
+		g.addError(row(FieldRetailer), FieldRetailer, rperrors.ErrInvalidRetailer, "retailer is required")
+	}
+	if err := g.Receipt.PurchaseDate.Validate(); err != nil {
+		g.addError(row(FieldPurchaseDate), FieldPurchaseDate, rperrors.ErrInvalidPurchaseDate, err.Error())
+	}
+	if err := g.Receipt.PurchaseTime.Validate(); err != nil {
+		g.addError(row(FieldPurchaseTime), FieldPurchaseTime, rperrors.ErrInvalidPurchaseTime, err.Error())
+	}
+	if _, ok := g.values[FieldTotal]; !ok {
+		g.addError(row(FieldTotal), FieldTotal, rperrors.ErrInvalidTotal, "total is required")
+	}
+	if len(g.Receipt.Items) == 0 && !g.hasItemErrors() {
+		g.addError(g.Rows[0], "", rperrors.ErrMissingItems, "at least one item is required")
+	}
+
+	// Report problems in row order
+	slices.SortStableFunc(g.Errors, func(a, b RowError) int {
+		return a.Row - b.Row
+	})
+}
+
+// hasItemErrors reports whether an item was rejected, so the receipt is not
+// also reported as having no items
+func (g *groupState) hasItemErrors() bool {
+	for _, err := range g.Errors {
+		switch err.Code {
+		case rperrors.ErrInvalidItemDescription, rperrors.ErrInvalidItemPrice, rperrors.ErrInvalidItemData:
+			return true
+		}
+	}
+	return false
+}
+
+// addError records a problem with the receipt in the column holding field
+func (g *groupState) addError(row int, field string, code rperrors.ErrorCode, message string) {
+	column := ""
+	if field != "" {
+		column = g.mapping.column(field)
+	}
+	g.Errors = append(g.Errors, RowError{Row: row, Column: column, Code: code, Message: message})
+}
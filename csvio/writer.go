@@ -0,0 +1,141 @@
+package csvio
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/storage"
+)
+
+// Columns added by Writer after the receipt fields
+const (
+	ColumnPoints      = "points"      // Points held by the receipt, less any clawed back by refunds
+	ColumnRules       = "rules"       // Rules that awarded points, as rule:points pairs separated by semicolons
+	ColumnProcessedAt = "processedAt" // When the receipt was stored, in RFC 3339 format
+)
+
+// Writer writes scored receipts in the long format read by Read, with the
+// receipt ID as the receipt key and the points and rule hits repeated on
+// every item row. The header is written before the first receipt.
+type Writer struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+// NewWriter creates a writer writing CSV to w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: csv.NewWriter(w)}
+}
+
+// WriteHeader writes the header row if it has not been written yet, so an
+// export without receipts still has one
+func (w *Writer) WriteHeader() error {
+	if w.wroteHeader {
+		return nil
+	}
+	w.wroteHeader = true
+	header := append(append([]string(nil), fields...), ColumnPoints, ColumnRules, ColumnProcessedAt)
+	return w.w.Write(header)
+}
+
+// Write writes one row per item of a stored receipt
+func (w *Writer) Write(record storage.Record) error {
+	if err := w.WriteHeader(); err != nil {
+		return err
+	}
+
+	processedAt := ""
+	if !record.ProcessedAt.IsZero() {
+		processedAt = record.ProcessedAt.Format(time.RFC3339)
+	}
+	receipt := record.Receipt
+	items := receipt.Items
+	if len(items) == 0 {
+		// Keep receipts without items in the export
+		items = []models.Item{{}}
+	}
+
+	formatPrice := priceFormatter(receipt.Currency)
+	formatAmount := func(p models.Price) string {
+		if p == 0 {
+			return ""
+		}
+		return formatPrice(p)
+	}
+
+	for _, item := range items {
+		price := ""
+		if item.ShortDescription != "" {
+			price = formatPrice(item.Price)
+		}
+		row := []string{
+			record.ID,
+			receipt.Retailer,
+			receipt.PurchaseDate.String(),
+			receipt.PurchaseTime.String(),
+			formatPrice(receipt.Total),
+			item.ShortDescription,
+			price,
+			formatQuantity(item.Quantity),
+			formatAmount(item.UnitPrice),
+			formatAmount(item.Discount),
+			item.SKU,
+			item.UPC,
+			item.Category,
+			formatAmount(receipt.Subtotal),
+			formatAmount(receipt.Tax),
+			formatAmount(receipt.Tip),
+			formatAmount(receipt.Discounts),
+			receipt.Currency,
+			receipt.RefundOf,
+			strconv.Itoa(record.Points),
+			FormatRules(record.Breakdown.Rules),
+			processedAt,
+		}
+		if err := w.w.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush writes any buffered rows to the underlying writer
+func (w *Writer) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// FormatRules formats the rules that awarded points as rule:points pairs
+// separated by semicolons, in evaluation order
+func FormatRules(results []models.RuleResult) string {
+	var hits []string
+	for _, result := range results {
+		if result.Points != 0 {
+			hits = append(hits, result.Rule+":"+strconv.Itoa(result.Points))
+		}
+	}
+	return strings.Join(hits, ";")
+}
+
+// formatQuantity formats an item quantity with as many decimals as needed,
+// or as empty when the item has no quantity
+func formatQuantity(q float64) string {
+	if q == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(q, 'f', -1, 64)
+}
+
+// priceFormatter returns a function formatting prices with the decimals of
+// the minor unit of currency, or as in receipt JSON when it is empty or
+// unknown
+func priceFormatter(currency string) func(models.Price) string {
+	if c, err := models.LookupCurrency(currency); err == nil {
+		return c.Format
+	}
+	return models.Price.String
+}
@@ -0,0 +1,236 @@
+package email
+
+import (
+	"net/mail"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marcelorm/receipt-processor/models"
+)
+
+// item creates an item
+func item(description string, price models.Price) models.Item {
+	return models.Item{ShortDescription: description, Price: price}
+}
+
+// readFixture reads a message from testdata
+func readFixture(t *testing.T, name string) *Message {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	msg, err := ReadMessage(f)
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	return msg
+}
+
+func TestReadMessage(t *testing.T) {
+	tests := []struct {
+		fixture   string
+		from      string
+		subject   string
+		forwarded bool
+		text      string // Expected in the text body
+		html      string // Expected in the HTML body
+	}{
+		{"target.eml", "orders@oe.target.com", "Your Target order — thanks!", false, "Klarbrunn 12-PK 12 FL OZ ........ $12.00", "Mountain Dew 12PK\t$6.49"},
+		{"walgreens.eml", "receipts@e.walgreens.com", "Your Walgreens receipt", false, "", "Pepsi - 12-oz\t$1.25"},
+		{"forwarded.eml", "orders@oe.target.com", "Your Target order", true, "Order total ........ $18.74", ""},
+		{"inline_forward.eml", "receipts@walgreens.com", "Your Walgreens receipt", true, "\nDasani    $1.40\n", ""},
+		{"generic.eml", "receipts@mmcorner.example", "Your receipt", false, "Merci et à bientôt, Zoë!", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.fixture, func(t *testing.T) {
+			msg := readFixture(t, tc.fixture)
+			if msg.From == nil || msg.From.Address != tc.from {
+				t.Errorf("Expected sender %s, got %v", tc.from, msg.From)
+			}
+			if msg.Subject != tc.subject {
+				t.Errorf("Expected subject %q, got %q", tc.subject, msg.Subject)
+			}
+			if msg.Forwarded != tc.forwarded {
+				t.Errorf("Expected forwarded %v, got %v", tc.forwarded, msg.Forwarded)
+			}
+			if !strings.Contains(msg.Text, tc.text) || (tc.text == "" && msg.Text != "") {
+				t.Errorf("Expected text body containing %q, got %q", tc.text, msg.Text)
+			}
+			if !strings.Contains(msg.HTML, tc.html) || (tc.html == "" && msg.HTML != "") {
+				t.Errorf("Expected HTML body containing %q, got %q", tc.html, msg.HTML)
+			}
+		})
+	}
+}
+
+func TestReadMessageErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"Not a message", "not an email", "invalid message"},
+		{"No body", "From: a@example.com\nContent-Type: image/png\n\nPNG", "no text or HTML body"},
+		{"Bad content type", "From: a@example.com\nContent-Type: text/plain; charset\n\nhi", "invalid Content-Type"},
+		{"Unknown charset", "From: a@example.com\nContent-Type: text/plain; charset=x-klingon\n\nhi", `unsupported charset "x-klingon"`},
+		{"Unterminated multipart", "From: a@example.com\nContent-Type: multipart/mixed; boundary=b\n\n--b\nContent-Type: text/plain\n\nhi", "unexpected EOF"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ReadMessage(strings.NewReader(tc.input))
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("Expected error containing %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		fixture    string
+		template   string
+		confidence float64
+		expected   models.Receipt
+	}{
+		{
+			fixture:    "target.eml",
+			template:   "Target",
+			confidence: 1,
+			expected: models.Receipt{
+				Retailer: "Target", PurchaseDate: models.MustParseDate("2022-01-01"), PurchaseTime: models.MustParseTime("13:01"),
+				Subtotal: 35.35, Total: 35.35,
+				Items: []models.Item{
+					item("Mountain Dew 12PK", 6.49), item("Emils Cheese Pizza", 12.25), item("Knorr Creamy Chicken", 1.26),
+					item("Doritos Nacho Cheese", 3.35), item("Klarbrunn 12-PK 12 FL OZ", 12.00),
+				},
+			},
+		},
+		{
+			fixture:    "target_taxed.eml",
+			template:   "Target",
+			confidence: 1,
+			expected: models.Receipt{
+				Retailer: "Target", PurchaseDate: models.MustParseDate("2022-01-01"), PurchaseTime: models.MustParseTime("13:01"),
+				Subtotal: 35.35, Tax: 2.83, Total: 38.18,
+				Items: []models.Item{
+					item("Mountain Dew 12PK", 6.49), item("Emils Cheese Pizza", 12.25), item("Knorr Creamy Chicken", 1.26),
+					item("Doritos Nacho Cheese", 3.35), item("Klarbrunn 12-PK 12 FL OZ", 12.00),
+				},
+			},
+		},
+		{
+			fixture:    "walgreens.eml",
+			template:   "Walgreens",
+			confidence: 1,
+			expected: models.Receipt{
+				Retailer: "Walgreens", PurchaseDate: models.MustParseDate("2022-01-02"), PurchaseTime: models.MustParseTime("08:13"),
+				Subtotal: 2.65, Total: 2.65,
+				Items: []models.Item{item("Pepsi - 12-oz", 1.25), item("Dasani", 1.40)},
+			},
+		},
+		{
+			fixture:    "forwarded.eml",
+			template:   "Target",
+			confidence: 1,
+			expected: models.Receipt{
+				Retailer: "Target", PurchaseDate: models.MustParseDate("2022-01-01"), PurchaseTime: models.MustParseTime("13:01"), Total: 18.74,
+				Items: []models.Item{item("Mountain Dew 12PK", 6.49), item("Emils Cheese Pizza", 12.25)},
+			},
+		},
+		{
+			fixture:    "inline_forward.eml",
+			template:   "Walgreens",
+			confidence: 1,
+			expected: models.Receipt{
+				Retailer: "Walgreens", PurchaseDate: models.MustParseDate("2022-01-02"), PurchaseTime: models.MustParseTime("08:13"), Total: 2.65,
+				Items: []models.Item{item("Pepsi - 12-oz", 1.25), item("Dasani", 1.40)},
+			},
+		},
+		{
+			// No template matches, so the text parser reads the body and the
+			// purchase time comes from the Date header
+			fixture:    "generic.eml",
+			confidence: 0.7,
+			expected: models.Receipt{
+				Retailer: "M&M Corner Market", PurchaseDate: models.MustParseDate("2022-03-20"), PurchaseTime: models.MustParseTime("14:33"), Total: 9.00,
+				Items: []models.Item{item("Gatorade", 2.25), item("Gatorade", 2.25), item("Gatorade", 2.25), item("Gatorade", 2.25)},
+			},
+		},
+	}
+
+	extractor := NewExtractor()
+	for _, tc := range tests {
+		t.Run(tc.fixture, func(t *testing.T) {
+			result := extractor.Extract(readFixture(t, tc.fixture))
+			if !result.Complete() {
+				t.Errorf("Expected a complete receipt, missing %v", result.Missing)
+			}
+			if result.Template != tc.template {
+				t.Errorf("Expected template %q, got %q", tc.template, result.Template)
+			}
+			if result.Confidence != tc.confidence {
+				t.Errorf("Expected confidence %v, got %v", tc.confidence, result.Confidence)
+			}
+			if !reflect.DeepEqual(result.Receipt, tc.expected) {
+				t.Errorf("Expected %+v, got %+v", tc.expected, result.Receipt)
+			}
+			if r := result.Receipt.Reconcile(0.01); r != nil {
+				t.Errorf("Expected the receipt to reconcile, got %v", r.Problems)
+			}
+		})
+	}
+}
+
+func TestExtractCustomTemplate(t *testing.T) {
+	corner := Template{
+		Retailer: "M&M Corner Market",
+		Senders:  []string{"mmcorner.example"},
+		Date:     regexp.MustCompile(`^Sold (?P<date>\S+)$`),
+		Item:     regexp.MustCompile(`^(?P<description>\D+?)\s+(?P<price>\d+\.\d{2})$`),
+		Total:    regexp.MustCompile(`^Total\s+(?P<total>\d+\.\d{2})$`),
+	}
+	result := NewExtractor(WithTemplates(corner)).Extract(readFixture(t, "generic.eml"))
+	if result.Template != "M&M Corner Market" || len(result.Receipt.Items) != 4 || result.Receipt.Total != 9 {
+		t.Errorf("Expected the custom template to read 4 items and the total, got %+v", result)
+	}
+}
+
+func TestExtractIncomplete(t *testing.T) {
+	// The date and time come from the Date header, but the body holds no items
+	msg := &Message{
+		From: &mail.Address{Address: "shop@example.com"},
+		Date: time.Date(2022, 1, 1, 13, 1, 0, 0, time.UTC),
+		Text: "Thanks for your order!",
+	}
+	result := NewExtractor().Extract(msg)
+	expected := []string{"items", "total"}
+	if !reflect.DeepEqual(result.Missing, expected) {
+		t.Errorf("Expected missing %v, got %v", expected, result.Missing)
+	}
+}
+
+func TestHTMLText(t *testing.T) {
+	input := `<html><head><title>Receipt</title></head><body>
+<div>Thanks,<br>Jane &amp; co</div>
+<table><tr><th> Item </th>
+<th>Price</th></tr><tr><td>Gum</td><td>$1.00</td></tr></table>
+<style>p { color: red }</style><p>Bye</p></body></html>`
+	got, err := htmlText(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := "Thanks,\nJane & co\nItem\tPrice\nGum\t$1.00\nBye"
+	if got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
@@ -0,0 +1,165 @@
+package email
+
+import (
+	"math"
+
+	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/parser"
+)
+
+// Result is a receipt extracted from an email
+type Result struct {
+	Receipt    models.Receipt `json:"receipt"`
+	Template   string         `json:"template,omitempty"` // Retailer of the template used, empty when the text parser was used
+	Confidence float64        `json:"confidence"`         // From 0 to 1
+	Missing    []string       `json:"missing,omitempty"`  // Fields that could not be found
+}
+
+// Complete reports whether every field of the receipt was found
+func (r Result) Complete() bool {
+	return len(r.Missing) == 0
+}
+
+// Extractor extracts receipts from emails
+type Extractor struct {
+	templates []Template
+}
+
+// Option configures an Extractor
+type Option func(*Extractor)
+
+// WithTemplates adds retailer templates, which are tried before the
+// built-in ones
+func WithTemplates(templates ...Template) Option {
+	return func(e *Extractor) {
+		e.templates = append(append([]Template(nil), templates...), e.templates...)
+	}
+}
+
+// NewExtractor creates an extractor using the built-in templates
+func NewExtractor(opts ...Option) *Extractor {
+	e := &Extractor{templates: append([]Template(nil), Templates...)}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Extract extracts the receipt in msg with the template of its sender, or
+// with the plain-text receipt parser when no template matches. A purchase
+// date or time missing from the body is taken from when the email was sent.
+func (e *Extractor) Extract(msg *Message) Result {
+	var result Result
+	var hasTotal bool
+	if t, ok := e.template(msg); ok {
+		result, hasTotal = extractTemplate(t, msg)
+	} else {
+		result, hasTotal = extractText(msg)
+	}
+
+	receipt := &result.Receipt
+	if !msg.Date.IsZero() {
+		if receipt.PurchaseDate.IsZero() {
+			receipt.PurchaseDate = models.NewDate(msg.Date.Date())
+		}
+		if receipt.PurchaseTime.IsZero() {
+			receipt.PurchaseTime = models.NewTime(msg.Date.Hour(), msg.Date.Minute())
+		}
+	}
+
+	result.Missing = nil
+	for _, missing := range []struct {
+		field string
+		ok    bool
+	}{
+		{parser.FieldRetailer, receipt.Retailer != ""},
+		{parser.FieldPurchaseDate, !receipt.PurchaseDate.IsZero()},
+		{parser.FieldPurchaseTime, !receipt.PurchaseTime.IsZero()},
+		{parser.FieldItems, len(receipt.Items) > 0},
+		{parser.FieldTotal, hasTotal},
+	} {
+		if !missing.ok {
+			result.Missing = append(result.Missing, missing.field)
+		}
+	}
+	return result
+}
+
+// template finds the template for the sender of msg
+func (e *Extractor) template(msg *Message) (Template, bool) {
+	for _, t := range e.templates {
+		if t.Matches(msg.From) {
+			return t, true
+		}
+	}
+	return Template{}, false
+}
+
+// extractTemplate extracts a receipt with a retailer template, from the text
+// body or, when it holds fewer fields, the HTML body, reporting whether the
+// total was found
+func extractTemplate(t Template, msg *Message) (Result, bool) {
+	var best models.Receipt
+	bestFields, bestTotal := -1, false
+	for _, body := range []string{msg.Text, msg.HTML} {
+		if body == "" {
+			continue
+		}
+		receipt, hasTotal := t.extract(body)
+		if fields := countFields(receipt, hasTotal); fields > bestFields {
+			best, bestFields, bestTotal = receipt, fields, hasTotal
+		}
+	}
+
+	// Fields found and items adding up to the subtotal or total each add to
+	// the confidence, as with the text parser
+	confidence := 0.15*float64(bestFields) + 0.10
+	var sum float64
+	for _, item := range best.Items {
+		sum += float64(item.Price)
+	}
+	beforeTax := float64(best.Total - best.Tax - best.Tip)
+	if len(best.Items) > 0 && ((best.Subtotal != 0 && cents(sum) == cents(float64(best.Subtotal))) ||
+		(bestTotal && cents(sum) == cents(beforeTax))) {
+		confidence += 0.15
+	}
+	return Result{Receipt: best, Template: t.Retailer, Confidence: math.Round(confidence*100) / 100}, bestTotal
+}
+
+// extractText extracts a receipt with the plain-text receipt parser, naming
+// the retailer after the sender when it has a display name, since emails
+// rarely start with the retailer name as printed receipts do. It reports
+// whether the total was found.
+func extractText(msg *Message) (Result, bool) {
+	body := msg.Text
+	if body == "" {
+		body = msg.HTML
+	}
+	parsed := parser.Parse(body)
+	if msg.From != nil && msg.From.Name != "" {
+		parsed.Receipt.Retailer = msg.From.Name
+	}
+	hasTotal := true
+	for _, field := range parsed.Missing {
+		if field == parser.FieldTotal {
+			hasTotal = false
+		}
+	}
+	return Result{Receipt: parsed.Receipt, Confidence: parsed.Confidence}, hasTotal
+}
+
+// countFields counts the fields of a receipt that were found
+func countFields(receipt models.Receipt, hasTotal bool) int {
+	n := 1 // The template names the retailer
+	for _, found := range []bool{!receipt.PurchaseDate.IsZero(), !receipt.PurchaseTime.IsZero(), len(receipt.Items) > 0, hasTotal} {
+		if found {
+			n++
+		}
+	}
+	return n
+}
+
+// cents rounds an amount to whole cents for comparison
+func cents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
@@ -0,0 +1,67 @@
+package email
+
+import (
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	spacePattern = regexp.MustCompile(`[ \t\r\n\f\x{a0}]+`)
+	cellPattern  = regexp.MustCompile(` *\t[ \t]*`)
+)
+
+// htmlText converts an HTML body to text with one line per block element,
+// such as a paragraph or table row, and table cells separated by tabs
+func htmlText(r io.Reader) (string, error) {
+	z := html.NewTokenizer(r)
+	var b strings.Builder
+	hidden := 0 // Depth inside elements whose text is not displayed
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if errors.Is(z.Err(), io.EOF) {
+				return tidyText(b.String()), nil
+			}
+			return "", z.Err()
+		case html.TextToken:
+			if hidden == 0 {
+				b.WriteString(spacePattern.ReplaceAllString(string(z.Text()), " "))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			name, _ := z.TagName()
+			switch a := atom.Lookup(name); a {
+			case atom.Head, atom.Script, atom.Style, atom.Title:
+				if tt == html.StartTagToken {
+					hidden++
+				} else if tt == html.EndTagToken && hidden > 0 {
+					hidden--
+				}
+			case atom.Td, atom.Th:
+				if tt != html.EndTagToken {
+					b.WriteByte('\t')
+				}
+			case atom.Br, atom.P, atom.Div, atom.Tr, atom.Li, atom.Table, atom.H1, atom.H2,
+				atom.H3, atom.H4, atom.H5, atom.H6, atom.Hr, atom.Ul, atom.Ol:
+				b.WriteByte('\n')
+			}
+		}
+	}
+}
+
+// tidyText trims the lines of converted HTML and drops blank lines
+func tidyText(text string) string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Trim(cellPattern.ReplaceAllString(line, "\t"), " \t")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,215 @@
+// Package email extracts receipts from e-receipts received by email. It reads
+// raw RFC 822 messages, walks their MIME parts for text and HTML bodies, and
+// extracts the receipt with the template of the retailer that sent it, or
+// with the plain-text receipt parser when no template matches.
+package email
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+// maxDepth limits how deeply MIME parts and attached messages may nest
+const maxDepth = 10
+
+// Message is the part of an email read for receipts
+type Message struct {
+	From      *mail.Address // Sender of the receipt, which for a forwarded receipt is its original sender
+	Subject   string
+	Date      time.Time // When the receipt was sent, zero when unknown
+	Forwarded bool      // The receipt was forwarded, attached or inline
+	Text      string    // Plain text bodies
+	HTML      string    // HTML bodies converted to text
+}
+
+var (
+	// forwardPattern matches the line introducing an inline forwarded message
+	forwardPattern = regexp.MustCompile(`(?i)^(?:-+\s*(?:forwarded|original)\s+message\s*-+|begin forwarded message:)$`)
+
+	// quotePattern matches the quote markers of quoted lines
+	quotePattern = regexp.MustCompile(`(?m)^(?:>[ \t]?)+`)
+)
+
+// ReadMessage reads a raw RFC 822 message, collecting its text and HTML
+// bodies. Attachments other than attached messages are skipped.
+func ReadMessage(r io.Reader) (*Message, error) {
+	m, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message: %w", err)
+	}
+
+	msg := &Message{}
+	msg.headers(m.Header)
+	if err := msg.part(textproto.MIMEHeader(m.Header), m.Body, 0); err != nil {
+		return nil, err
+	}
+	if msg.Text == "" && msg.HTML == "" {
+		return nil, errors.New("message has no text or HTML body")
+	}
+	msg.inlineForward()
+	return msg, nil
+}
+
+// headers records the sender, subject and date of a message
+func (msg *Message) headers(h mail.Header) {
+	if from, err := h.AddressList("From"); err == nil && len(from) > 0 {
+		msg.From = from[0]
+	}
+	subject := h.Get("Subject")
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(subject); err == nil {
+		subject = decoded
+	}
+	msg.Subject = subject
+	if date, err := h.Date(); err == nil {
+		msg.Date = date
+	}
+}
+
+// part reads one MIME part, descending into multipart bodies and attached
+// messages
+func (msg *Message) part(header textproto.MIMEHeader, body io.Reader, depth int) error {
+	if depth > maxDepth {
+		return errors.New("MIME parts nested too deeply")
+	}
+
+	mediaType, params := "text/plain", map[string]string{}
+	if contentType := header.Get("Content-Type"); contentType != "" {
+		var err error
+		if mediaType, params, err = mime.ParseMediaType(contentType); err != nil {
+			return fmt.Errorf("invalid Content-Type %q: %w", contentType, err)
+		}
+	}
+	disposition, _, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("invalid multipart body: %w", err)
+			}
+			if err := msg.part(p.Header, p, depth+1); err != nil {
+				return err
+			}
+		}
+	case mediaType == "message/rfc822":
+		// A receipt forwarded as an attachment keeps its original headers
+		inner, err := mail.ReadMessage(transferDecoder(header, body))
+		if err != nil {
+			return fmt.Errorf("invalid attached message: %w", err)
+		}
+		msg.Forwarded = true
+		msg.headers(inner.Header)
+		return msg.part(textproto.MIMEHeader(inner.Header), inner.Body, depth+1)
+	case disposition == "attachment":
+		return nil
+	case mediaType == "text/plain", mediaType == "text/html":
+		r, err := charsetDecoder(params["charset"], transferDecoder(header, body))
+		if err != nil {
+			return err
+		}
+		if mediaType == "text/html" {
+			text, err := htmlText(r)
+			if err != nil {
+				return fmt.Errorf("invalid HTML body: %w", err)
+			}
+			msg.HTML = joinBodies(msg.HTML, text)
+			return nil
+		}
+		text, err := io.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("invalid text body: %w", err)
+		}
+		msg.Text = joinBodies(msg.Text, plainText(string(text)))
+	}
+	return nil
+}
+
+// inlineForward finds the original sender of a receipt forwarded inline in
+// the text body, as most mail clients do
+func (msg *Message) inlineForward() {
+	lines := strings.Split(msg.Text, "\n")
+	for i, line := range lines {
+		if !forwardPattern.MatchString(strings.TrimSpace(line)) {
+			continue
+		}
+		for _, header := range lines[i+1:] {
+			name, value, ok := strings.Cut(strings.TrimSpace(header), ":")
+			if !ok {
+				break
+			}
+			value = strings.TrimSpace(value)
+			switch strings.ToLower(name) {
+			case "from":
+				if from, err := mail.ParseAddress(value); err == nil {
+					msg.From = from
+					msg.Forwarded = true
+				}
+			case "subject":
+				msg.Subject = value
+			case "date":
+				// Mail clients write the date in their own formats, which
+				// are only used when they are RFC 5322 dates
+				if date, err := mail.ParseDate(value); err == nil {
+					msg.Date = date
+				}
+			}
+		}
+		return
+	}
+}
+
+// transferDecoder decodes a body with its Content-Transfer-Encoding
+func transferDecoder(header textproto.MIMEHeader, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+	return body
+}
+
+// charsetDecoder converts a body in the named charset to UTF-8
+func charsetDecoder(label string, body io.Reader) (io.Reader, error) {
+	switch strings.ToLower(label) {
+	case "", "utf-8", "utf8", "us-ascii":
+		return body, nil
+	}
+	r, err := charset.NewReaderLabel(label, body)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %q", label)
+	}
+	return r, nil
+}
+
+// plainText normalizes line endings and removes the quote markers of
+// replies and forwards
+func plainText(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return quotePattern.ReplaceAllString(text, "")
+}
+
+// joinBodies appends body to the bodies read so far
+func joinBodies(bodies, body string) string {
+	if bodies == "" {
+		return body
+	}
+	return bodies + "\n" + body
+}
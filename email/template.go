@@ -0,0 +1,124 @@
+package email
+
+import (
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/parser"
+)
+
+// Template extracts receipts from the emails of one retailer. Each pattern is
+// matched against whole lines of the text and HTML bodies.
+type Template struct {
+	Retailer string         // Retailer name given to the receipts
+	Senders  []string       // Sender domains, also matching their subdomains
+	Date     *regexp.Regexp // Purchase date line, with a "date" group and an optional "time" group
+	Item     *regexp.Regexp // Item line, with "description" and "price" groups
+	Total    *regexp.Regexp // Total line, with a "total" group
+	Subtotal *regexp.Regexp // Optional subtotal line, with a "subtotal" group
+	Tax      *regexp.Regexp // Optional tax line, with a "tax" group
+	Tip      *regexp.Regexp // Optional tip line, with a "tip" group
+	Skip     *regexp.Regexp // Optional lines matching Item that are not items, such as shipping
+}
+
+// Templates are the built-in retailer templates
+var Templates = []Template{
+	{
+		Retailer: "Target",
+		Senders:  []string{"target.com"},
+		Date:     regexp.MustCompile(`(?i)^order date:\s*(?P<date>.+?)(?:\s+at\s+(?P<time>.+))?$`),
+		Item:     regexp.MustCompile(`^(?P<description>\S.*?)(?:\s+\.+)?\s+\$(?P<price>\d+\.\d{2})$`),
+		Total:    regexp.MustCompile(`(?i)^order total:?(?:\s+\.+)?\s+\$(?P<total>\d+\.\d{2})$`),
+		Subtotal: regexp.MustCompile(`(?i)^subtotal:?(?:\s+\.+)?\s+\$(?P<subtotal>\d+\.\d{2})$`),
+		Tax:      regexp.MustCompile(`(?i)^(?:estimated )?tax:?(?:\s+\.+)?\s+\$(?P<tax>\d+\.\d{2})$`),
+		Skip:     regexp.MustCompile(`(?i)^(?:subtotal|estimated tax|tax|shipping|delivery)\b`),
+	},
+	{
+		Retailer: "Walgreens",
+		Senders:  []string{"walgreens.com"},
+		Date:     regexp.MustCompile(`(?i)^purchase date:\s*(?P<date>\S+)\s+(?P<time>.+)$`),
+		Item:     regexp.MustCompile(`^(?P<description>.+?)(?:\t|\s{2,})\$(?P<price>\d+\.\d{2})$`),
+		Total:    regexp.MustCompile(`(?i)^total(?::\s*|\t|\s{2,})\$(?P<total>\d+\.\d{2})$`),
+		Subtotal: regexp.MustCompile(`(?i)^subtotal(?::\s*|\t|\s{2,})\$(?P<subtotal>\d+\.\d{2})$`),
+		Tax:      regexp.MustCompile(`(?i)^tax(?::\s*|\t|\s{2,})\$(?P<tax>\d+\.\d{2})$`),
+		Skip:     regexp.MustCompile(`(?i)^(?:subtotal|tax|balance rewards)\b`),
+	},
+}
+
+// Matches reports whether the template applies to emails from the sender
+func (t Template) Matches(from *mail.Address) bool {
+	if from == nil {
+		return false
+	}
+	_, domain, ok := strings.Cut(strings.ToLower(from.Address), "@")
+	if !ok {
+		return false
+	}
+	for _, sender := range t.Senders {
+		sender = strings.ToLower(sender)
+		if domain == sender || strings.HasSuffix(domain, "."+sender) {
+			return true
+		}
+	}
+	return false
+}
+
+// extract reads the receipt in a body, reporting whether the total was found
+func (t Template) extract(body string) (models.Receipt, bool) {
+	receipt := models.Receipt{Retailer: t.Retailer}
+	hasTotal := false
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case !hasTotal && t.Total.MatchString(line):
+			if total, err := models.ParsePrice(group(t.Total, line, "total")); err == nil {
+				receipt.Total = total
+				hasTotal = true
+			}
+		case receipt.PurchaseDate.IsZero() && t.Date.MatchString(line):
+			receipt.PurchaseDate, _ = parser.ParseDate(group(t.Date, line, "date"))
+			if s := group(t.Date, line, "time"); s != "" {
+				receipt.PurchaseTime, _ = parser.ParseTime(s)
+			}
+		case amount(t.Subtotal, line, "subtotal", &receipt.Subtotal):
+		case amount(t.Tax, line, "tax", &receipt.Tax):
+		case amount(t.Tip, line, "tip", &receipt.Tip):
+		case t.Skip != nil && t.Skip.MatchString(line):
+		case t.Item.MatchString(line):
+			price, err := models.ParsePrice(group(t.Item, line, "price"))
+			if err != nil {
+				continue
+			}
+			receipt.Items = append(receipt.Items, models.Item{
+				ShortDescription: group(t.Item, line, "description"),
+				Price:            price,
+			})
+		}
+	}
+	return receipt, hasTotal
+}
+
+// amount stores the named group of an optional pattern matching line in
+// dst, reporting whether it did. Only the first match of a pattern is kept,
+// since bodies may repeat the summary in text and HTML.
+func amount(pattern *regexp.Regexp, line, name string, dst *models.Price) bool {
+	if pattern == nil || !pattern.MatchString(line) {
+		return false
+	}
+	if *dst == 0 {
+		*dst, _ = models.ParsePrice(group(pattern, line, name))
+	}
+	return true
+}
+
+// group returns the named group of pattern matched in s
+func group(pattern *regexp.Regexp, s, name string) string {
+	m := pattern.FindStringSubmatch(s)
+	if i := pattern.SubexpIndex(name); m != nil && i >= 0 {
+		return strings.TrimSpace(m[i])
+	}
+	return ""
+}
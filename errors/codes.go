@@ -11,6 +11,10 @@ const (
 	ErrContextCancelled ErrorCode = "RP0003" // Request context cancelled or timed out
 	ErrRequestTooLarge  ErrorCode = "RP0004" // Request body too large
 	ErrInvalidRequest   ErrorCode = "RP0005" // Invalid request
+	ErrTooManySubscribers ErrorCode = "RP0006" // Too many concurrent event stream subscribers
+	ErrInvalidCSV       ErrorCode = "RP0007" // Invalid CSV in request body
+	ErrUnparsableReceipt ErrorCode = "RP0008" // Receipt text could not be parsed
+	ErrInvalidEmail     ErrorCode = "RP0009" // Invalid email message in request body
 
 	// Validation errors (0100-0199)
 	ErrInvalidReceiptData    ErrorCode = "RP0101" // Invalid or missing receipt data
@@ -22,10 +26,18 @@ const (
 	ErrInvalidItemData       ErrorCode = "RP0107" // Invalid item data
 	ErrInvalidItemDescription ErrorCode = "RP0108" // Invalid item description
 	ErrInvalidItemPrice      ErrorCode = "RP0109" // Invalid item price
+	ErrInvalidWebhook        ErrorCode = "RP0110" // Invalid webhook subscription
+	ErrInvalidTimeZone       ErrorCode = "RP0111" // Invalid purchase time zone
+	ErrInvalidRefund         ErrorCode = "RP0112" // Refund does not match its original receipt
+	ErrInvalidCurrency       ErrorCode = "RP0113" // Unknown or unconvertible currency
+	ErrInvalidAccount        ErrorCode = "RP0114" // Receipt names an unknown loyalty account
+	ErrInvalidLedgerEntry    ErrorCode = "RP0115" // Invalid points ledger entry
 
 	// Storage errors (0200-0299)
 	ErrReceiptNotFound ErrorCode = "RP0201" // Receipt ID not found
 	ErrStorageFailure  ErrorCode = "RP0202" // Failed to store receipt
+	ErrWebhookNotFound ErrorCode = "RP0203" // Webhook subscription ID not found
+	ErrAccountNotFound ErrorCode = "RP0204" // Loyalty account ID not found
 	
 	// Calculation errors (0300-0399)
 	ErrCalculationFailed ErrorCode = "RP0301" // Failed to calculate points
@@ -39,6 +51,10 @@ var errorMap = map[ErrorCode]string{
 	ErrContextCancelled: "Request cancelled or timed out",
 	ErrRequestTooLarge:  "Request body too large",
 	ErrInvalidRequest:   "Invalid request",
+	ErrTooManySubscribers: "Too many event stream subscribers, try again later",
+	ErrInvalidCSV:       "Invalid CSV in request body",
+	ErrUnparsableReceipt: "Unable to parse receipt text",
+	ErrInvalidEmail:     "Invalid email message in request body",
 
 	// Validation errors
 	ErrInvalidReceiptData:    "Invalid or missing receipt data",
@@ -50,10 +66,18 @@ var errorMap = map[ErrorCode]string{
 	ErrInvalidItemData:       "Invalid item data",
 	ErrInvalidItemDescription: "Invalid item description",
 	ErrInvalidItemPrice:      "Invalid item price",
+	ErrInvalidWebhook:        "Invalid webhook subscription",
+	ErrInvalidTimeZone:       "Invalid purchase time zone",
+	ErrInvalidRefund:         "Refund does not match its original receipt",
+	ErrInvalidCurrency:       "Unknown currency or no exchange rate for it",
+	ErrInvalidAccount:        "Unknown loyalty account",
+	ErrInvalidLedgerEntry:    "Invalid points ledger entry",
 
 	// Storage errors
 	ErrReceiptNotFound: "Receipt not found",
 	ErrStorageFailure:  "Failed to store receipt data",
+	ErrWebhookNotFound: "Webhook subscription not found",
+	ErrAccountNotFound: "Loyalty account not found",
 	
 	// Calculation errors
 	ErrCalculationFailed: "Failed to calculate receipt points",
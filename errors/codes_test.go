@@ -13,23 +13,36 @@ func TestErrorCodes(t *testing.T) {
 	// Test error code prefix
 	allCodes := []ErrorCode{
 		// General errors
-		ErrInternal, ErrInvalidJSON, ErrContextCancelled,
+		ErrInternal, ErrInvalidJSON, ErrContextCancelled, ErrRequestTooLarge,
+		ErrInvalidRequest, ErrTooManySubscribers, ErrInvalidCSV,
+		ErrUnparsableReceipt, ErrInvalidEmail,
 
 		// Validation errors
 		ErrInvalidReceiptData, ErrInvalidRetailer, ErrInvalidPurchaseDate,
 		ErrInvalidPurchaseTime, ErrInvalidTotal, ErrMissingItems,
 		ErrInvalidItemData, ErrInvalidItemDescription, ErrInvalidItemPrice,
+		ErrInvalidWebhook, ErrInvalidTimeZone, ErrInvalidRefund,
+		ErrInvalidCurrency, ErrInvalidAccount, ErrInvalidLedgerEntry,
 
 		// Storage errors
-		ErrReceiptNotFound, ErrStorageFailure,
+		ErrReceiptNotFound, ErrStorageFailure, ErrWebhookNotFound,
+		ErrAccountNotFound,
 
 		// Calculation errors
 		ErrCalculationFailed,
 	}
 
+	seen := make(map[ErrorCode]bool)
 	for _, code := range allCodes {
+		if seen[code] {
+			t.Errorf("ErrorCode %s is used by more than one error", code)
+		}
+		seen[code] = true
 		if len(code) < 2 || code[:2] != "RP" {
 			t.Errorf("ErrorCode %s does not start with the required prefix RP", code)
 		}
+		if errorMap[code] == "" {
+			t.Errorf("ErrorCode %s has no message", code)
+		}
 	}
 }
@@ -14,9 +14,11 @@ type AppError struct {
 	Err     error     // Original error (if any)
 }
 
+// APIError is the error body returned to API clients
 type APIError struct {
-	Code    ErrorCode `json:"code"`
-	Message string    `json:"message"`
+	Code      ErrorCode `json:"code"`
+	Message   string    `json:"message"`
+	RequestID string    `json:"requestId,omitempty"` // Correlates the error with server logs
 }
 
 // Error implements the error interface
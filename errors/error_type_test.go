@@ -1,10 +1,14 @@
 package errors
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"log/slog"
 	"strings"
 	"testing"
+
+	"github.com/marcelorm/receipt-processor/requestid"
 )
 
 func TestAppError(t *testing.T) {
@@ -83,3 +87,20 @@ func TestAppErrorLog(t *testing.T) {
 		t.Log(logOutput.String())
 	}
 }
+
+func TestAppErrorLogRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	original := slog.Default()
+	slog.SetDefault(slog.New(requestid.NewLogHandler(slog.NewTextHandler(&buf, nil))))
+	defer slog.SetDefault(original)
+
+	err := New(ErrReceiptNotFound, "receipt with ID abc not found")
+	err.Log(requestid.NewContext(context.Background(), "req-123"))
+
+	if !strings.Contains(buf.String(), "request_id=req-123") {
+		t.Errorf("Expected log to contain the request ID, got %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "error_code=RP0201") {
+		t.Errorf("Expected log to contain the error code, got %s", buf.String())
+	}
+}
@@ -0,0 +1,257 @@
+// Package events defines the typed domain events recorded when receipts
+// change and delivers them to integrations. Storage records each event in an
+// outbox atomically with the change, and a Dispatcher hands the recorded
+// events to pluggable sinks such as webhooks and the in-process Bus, which
+// fans scoring activity out to live subscribers such as the /events stream.
+package events
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marcelorm/receipt-processor/models"
+)
+
+const (
+	// DefaultBufferSize is the number of recent events kept for resuming
+	DefaultBufferSize = 1000
+
+	// DefaultMaxSubscribers is the default limit on concurrent subscribers
+	DefaultMaxSubscribers = 100
+
+	// subscriberBuffer is the number of live events queued per subscriber
+	subscriberBuffer = 256
+)
+
+// TypeReceiptProcessed is the type of events published for scored receipts
+const TypeReceiptProcessed = "receipt.processed"
+
+// Errors returned by Subscribe
+var (
+	ErrTooManySubscribers = errors.New("too many event subscribers")
+	ErrClosed             = errors.New("event bus closed")
+)
+
+// Event is the live view of a scored receipt published on a Bus
+type Event struct {
+	ID          uint64              `json:"-"` // Sequence number assigned by the bus
+	Type        string              `json:"type"`
+	ReceiptID   string              `json:"id"`
+	Retailer    string              `json:"retailer"`
+	Tenant      string              `json:"tenant,omitempty"`
+	Points      int                 `json:"points"`
+	Rules       []models.RuleResult `json:"rules"` // Rules that awarded points
+	ProcessedAt time.Time           `json:"processedAt"`
+}
+
+// Filter selects the events delivered to a subscriber
+type Filter struct {
+	Retailer string // Case-insensitive retailer name; empty matches every retailer
+	Tenant   string // Exact tenant of the receipt; empty matches every tenant
+}
+
+// Matches reports whether event is selected by the filter
+func (f Filter) Matches(event Event) bool {
+	if f.Tenant != "" && event.Tenant != f.Tenant {
+		return false
+	}
+	return f.Retailer == "" || strings.EqualFold(strings.TrimSpace(event.Retailer), strings.TrimSpace(f.Retailer))
+}
+
+// Bus fans published events out to subscribers. A nil *Bus discards every
+// event, so publishers do not need to check whether a bus is configured.
+type Bus struct {
+	bufferSize     int
+	maxSubscribers int
+
+	mu          sync.Mutex
+	seq         uint64
+	buffer      []Event // Ring of recent events
+	head        int     // Index of the oldest event once the ring is full
+	subscribers map[*Subscription]struct{}
+	closed      bool
+}
+
+// Option configures a Bus
+type Option func(*Bus)
+
+// WithBufferSize keeps the n most recent events for subscribers resuming
+// after a disconnect
+func WithBufferSize(n int) Option {
+	return func(b *Bus) {
+		b.bufferSize = n
+	}
+}
+
+// WithMaxSubscribers limits the number of concurrent subscribers
+func WithMaxSubscribers(n int) Option {
+	return func(b *Bus) {
+		b.maxSubscribers = n
+	}
+}
+
+// NewBus creates an event bus
+func NewBus(opts ...Option) *Bus {
+	b := &Bus{
+		bufferSize:     DefaultBufferSize,
+		maxSubscribers: DefaultMaxSubscribers,
+		subscribers:    make(map[*Subscription]struct{}),
+		// Event IDs start from the current time, so IDs from before a
+		// restart are always older than every buffered event
+		seq: uint64(time.Now().UnixNano()),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// PublishReceipt publishes a receipt.processed event for a scored receipt
+func (b *Bus) PublishReceipt(processed ReceiptProcessed) {
+	if b == nil {
+		return
+	}
+
+	var hits []models.RuleResult
+	for _, result := range processed.Rules {
+		if result.Points > 0 {
+			hits = append(hits, result)
+		}
+	}
+	b.Publish(Event{
+		Type:        TypeReceiptProcessed,
+		ReceiptID:   processed.ReceiptID,
+		Retailer:    processed.Retailer,
+		Tenant:      processed.Tenant,
+		Points:      processed.Points,
+		Rules:       hits,
+		ProcessedAt: processed.ProcessedAt,
+	})
+}
+
+// Publish assigns the next ID to event, buffers it and delivers it to the
+// matching subscribers. Subscribers that have fallen too far behind are
+// disconnected rather than slowing the publisher; they can resume from the
+// last event they received.
+func (b *Bus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.seq++
+	event.ID = b.seq
+
+	if b.bufferSize > 0 {
+		if len(b.buffer) < b.bufferSize {
+			b.buffer = append(b.buffer, event)
+		} else {
+			b.buffer[b.head] = event
+			b.head = (b.head + 1) % len(b.buffer)
+		}
+	}
+
+	for sub := range b.subscribers {
+		if !sub.filter.Matches(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			b.remove(sub)
+		}
+	}
+}
+
+// Subscribe returns a subscription to the events matching filter. When
+// lastID is not zero, buffered events published after it are delivered
+// first; events that are no longer buffered are skipped.
+func (b *Bus) Subscribe(filter Filter, lastID uint64) (*Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+	if b.maxSubscribers > 0 && len(b.subscribers) >= b.maxSubscribers {
+		return nil, ErrTooManySubscribers
+	}
+
+	var replay []Event
+	if lastID != 0 {
+		for i := range b.buffer {
+			event := b.buffer[(b.head+i)%len(b.buffer)]
+			if event.ID > lastID && filter.Matches(event) {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	sub := &Subscription{
+		bus:    b,
+		filter: filter,
+		events: make(chan Event, len(replay)+subscriberBuffer),
+	}
+	for _, event := range replay {
+		sub.events <- event
+	}
+	b.subscribers[sub] = struct{}{}
+	return sub, nil
+}
+
+// Subscribers returns the number of active subscriptions
+func (b *Bus) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.subscribers)
+}
+
+// Close ends every subscription and discards later events
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subscribers {
+		b.remove(sub)
+	}
+}
+
+// remove ends a subscription; the caller must hold b.mu
+func (b *Bus) remove(sub *Subscription) {
+	if _, ok := b.subscribers[sub]; !ok {
+		return
+	}
+	delete(b.subscribers, sub)
+	close(sub.events)
+}
+
+// Subscription receives the events matching its filter
+type Subscription struct {
+	bus    *Bus
+	filter Filter
+	events chan Event
+}
+
+// Events returns the channel events are delivered on. It is closed when the
+// subscription ends, either through Close or because the subscriber fell
+// too far behind.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Close ends the subscription
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	s.bus.remove(s)
+}
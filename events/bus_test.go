@@ -0,0 +1,180 @@
+package events
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/marcelorm/receipt-processor/models"
+)
+
+// receive returns the events currently queued on sub
+func receive(sub *Subscription) []Event {
+	var received []Event
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				return received
+			}
+			received = append(received, event)
+		default:
+			return received
+		}
+	}
+}
+
+func TestPublishReceipt(t *testing.T) {
+	bus := NewBus()
+	sub, err := bus.Subscribe(Filter{}, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	bus.PublishReceipt(ReceiptProcessed{
+		ReceiptID: "r1",
+		Retailer:  "Target",
+		Tenant:    "acme",
+		Points:    6,
+		Rules:     []models.RuleResult{{Rule: "retailer_name", Points: 6}, {Rule: "odd_day", Points: 0}},
+	})
+
+	received := receive(sub)
+	if len(received) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(received))
+	}
+	event := received[0]
+	if event.ID == 0 || event.Type != TypeReceiptProcessed || event.ReceiptID != "r1" || event.Tenant != "acme" || event.Points != 6 {
+		t.Errorf("Unexpected event %+v", event)
+	}
+	if len(event.Rules) != 1 || event.Rules[0].Rule != "retailer_name" {
+		t.Errorf("Expected only the rules that awarded points, got %+v", event.Rules)
+	}
+
+	// A nil bus discards events
+	var nilBus *Bus
+	nilBus.PublishReceipt(ReceiptProcessed{ReceiptID: "r2"})
+}
+
+func TestSubscribeFilter(t *testing.T) {
+	bus := NewBus()
+	sub, _ := bus.Subscribe(Filter{Retailer: " target "}, 0)
+
+	bus.Publish(Event{ReceiptID: "r1", Retailer: "Target"})
+	bus.Publish(Event{ReceiptID: "r2", Retailer: "Walmart"})
+	bus.Publish(Event{ReceiptID: "r3", Retailer: "TARGET"})
+
+	received := receive(sub)
+	if len(received) != 2 || received[0].ReceiptID != "r1" || received[1].ReceiptID != "r3" {
+		t.Errorf("Expected the Target receipts r1 and r3, got %+v", received)
+	}
+	if received[0].ID >= received[1].ID {
+		t.Errorf("Expected increasing event IDs, got %d and %d", received[0].ID, received[1].ID)
+	}
+
+	// Tenants must match exactly and combine with the retailer
+	tenant, _ := bus.Subscribe(Filter{Retailer: "target", Tenant: "acme"}, 0)
+	bus.Publish(Event{ReceiptID: "r4", Retailer: "Target", Tenant: "acme"})
+	bus.Publish(Event{ReceiptID: "r5", Retailer: "Target", Tenant: "Acme"})
+	bus.Publish(Event{ReceiptID: "r6", Retailer: "Walmart", Tenant: "acme"})
+	bus.Publish(Event{ReceiptID: "r7", Retailer: "Target"})
+
+	received = receive(tenant)
+	if len(received) != 1 || received[0].ReceiptID != "r4" {
+		t.Errorf("Expected only the acme Target receipt r4, got %+v", received)
+	}
+}
+
+func TestSubscribeResume(t *testing.T) {
+	bus := NewBus(WithBufferSize(3))
+	live, _ := bus.Subscribe(Filter{}, 0)
+	for _, id := range []string{"r1", "r2", "r3", "r4", "r5"} {
+		bus.Publish(Event{ReceiptID: id})
+	}
+	published := receive(live)
+
+	tests := []struct {
+		name   string
+		lastID uint64
+		want   []string
+	}{
+		{"Live only", 0, nil},
+		{"Resume from a buffered event", published[2].ID, []string{"r4", "r5"}},
+		{"Resume from an evicted event", published[0].ID, []string{"r3", "r4", "r5"}},
+		{"Resume from the latest event", published[4].ID, nil},
+		{"Resume from before a restart", 1, []string{"r3", "r4", "r5"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sub, err := bus.Subscribe(Filter{}, tc.lastID)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			defer sub.Close()
+
+			var got []string
+			for _, event := range receive(sub) {
+				got = append(got, event.ReceiptID)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("Expected %v, got %v", tc.want, got)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("Expected %v, got %v", tc.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestMaxSubscribers(t *testing.T) {
+	bus := NewBus(WithMaxSubscribers(1))
+	sub, err := bus.Subscribe(Filter{}, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := bus.Subscribe(Filter{}, 0); !errors.Is(err, ErrTooManySubscribers) {
+		t.Errorf("Expected ErrTooManySubscribers, got %v", err)
+	}
+
+	// Closing a subscription frees its slot
+	sub.Close()
+	sub.Close()
+	if _, err := bus.Subscribe(Filter{}, 0); err != nil {
+		t.Errorf("Expected a free slot after closing, got %v", err)
+	}
+}
+
+func TestSlowSubscriberIsDisconnected(t *testing.T) {
+	bus := NewBus()
+	sub, _ := bus.Subscribe(Filter{}, 0)
+
+	for i := 0; i < subscriberBuffer+1; i++ {
+		bus.Publish(Event{})
+	}
+
+	if received := receive(sub); len(received) != subscriberBuffer {
+		t.Errorf("Expected %d queued events, got %d", subscriberBuffer, len(received))
+	}
+	if _, ok := <-sub.Events(); ok {
+		t.Error("Expected the subscription to be closed")
+	}
+	if bus.Subscribers() != 0 {
+		t.Errorf("Expected no subscribers, got %d", bus.Subscribers())
+	}
+}
+
+func TestClose(t *testing.T) {
+	bus := NewBus()
+	sub, _ := bus.Subscribe(Filter{}, 0)
+	bus.Close()
+
+	if _, ok := <-sub.Events(); ok {
+		t.Error("Expected the subscription to be closed")
+	}
+	if _, err := bus.Subscribe(Filter{}, 0); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+	bus.Publish(Event{})
+}
@@ -0,0 +1,390 @@
+package events
+
+import (
+	"context"
+	"hash/fnv"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/marcelorm/receipt-processor/requestid"
+)
+
+// Defaults used when the corresponding dispatcher option is not given
+const (
+	DefaultWorkers        = 4
+	DefaultPollInterval   = 100 * time.Millisecond
+	DefaultInitialBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff     = 30 * time.Second
+	DefaultMaxAttempts    = 10
+)
+
+// batchSize is the number of new events read from the outbox per poll
+const batchSize = 100
+
+// Outbox holds recorded events until every sink has handled them. Storage
+// implementations record events in their outbox atomically with the change
+// they describe.
+type Outbox interface {
+	// PendingEvents returns up to limit unacknowledged events in the order
+	// they were recorded, or every one when limit is 0
+	PendingEvents(ctx context.Context, limit int) ([]Envelope, error)
+
+	// AckEvent removes an event that every sink has handled
+	AckEvent(ctx context.Context, id string) error
+
+	// ParkEvent moves an event that a sink failed to handle too many times
+	// out of the pending events, keeping it for inspection
+	ParkEvent(ctx context.Context, id string) error
+
+	// ParkedEvents returns the parked events in the order they were parked
+	ParkedEvents(ctx context.Context) ([]Envelope, error)
+}
+
+// Sink receives the events delivered by a Dispatcher. Handle may be called
+// more than once for the same event, so sinks should be idempotent or
+// tolerate duplicates.
+type Sink interface {
+	// Name identifies the sink in logs
+	Name() string
+
+	// Handle processes an event; an error causes it to be retried
+	Handle(ctx context.Context, envelope Envelope) error
+}
+
+// funcSink adapts a function to the Sink interface
+type funcSink struct {
+	name   string
+	handle func(ctx context.Context, envelope Envelope) error
+}
+
+// NewSink creates a sink named name that handles events with handle
+func NewSink(name string, handle func(ctx context.Context, envelope Envelope) error) Sink {
+	return funcSink{name: name, handle: handle}
+}
+
+// Name implements Sink
+func (s funcSink) Name() string { return s.name }
+
+// Handle implements Sink
+func (s funcSink) Handle(ctx context.Context, envelope Envelope) error {
+	return s.handle(ctx, envelope)
+}
+
+// BusSink publishes receipt events on bus for live subscribers
+func BusSink(bus *Bus) Sink {
+	return NewSink("bus", func(ctx context.Context, envelope Envelope) error {
+		event, err := envelope.Decode()
+		if err != nil {
+			return err
+		}
+		if processed, ok := event.(ReceiptProcessed); ok {
+			bus.PublishReceipt(processed)
+		}
+		return nil
+	})
+}
+
+// Dispatcher delivers the events in an outbox to a set of sinks with
+// at-least-once semantics. Events are spread over workers by aggregate ID,
+// so events for the same receipt are delivered in order while other
+// receipts proceed in parallel. A sink that fails is retried with
+// exponential backoff, holding back later events for the same receipt, and
+// an event is acknowledged once every sink has handled it. An event that a
+// sink still fails after the maximum number of attempts is parked in the
+// outbox, so that it no longer holds back the events after it.
+type Dispatcher struct {
+	outbox         Outbox
+	sinks          []Sink
+	logger         *slog.Logger
+	workers        int
+	pollInterval   time.Duration
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	maxAttempts    int
+
+	mu       sync.Mutex
+	inFlight map[string]bool
+	started  bool
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	queues  []chan Envelope
+	running sync.WaitGroup
+}
+
+// DispatcherOption configures a Dispatcher
+type DispatcherOption func(*Dispatcher)
+
+// WithWorkers delivers events for up to n receipts in parallel
+func WithWorkers(n int) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.workers = n
+	}
+}
+
+// WithPollInterval checks the outbox for new events every interval
+func WithPollInterval(interval time.Duration) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.pollInterval = interval
+	}
+}
+
+// WithBackoff waits initial after a sink first fails, doubling the wait
+// after every further failure up to max
+func WithBackoff(initial, max time.Duration) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.initialBackoff = initial
+		d.maxBackoff = max
+	}
+}
+
+// WithMaxAttempts parks an event once a sink has failed to handle it n times
+func WithMaxAttempts(n int) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.maxAttempts = n
+	}
+}
+
+// WithLogger logs through the given logger instead of the default logger
+func WithLogger(logger *slog.Logger) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.logger = logger
+	}
+}
+
+// NewDispatcher creates a dispatcher delivering the events in outbox to
+// sinks. Delivery begins when Start is called.
+func NewDispatcher(outbox Outbox, sinks []Sink, opts ...DispatcherOption) *Dispatcher {
+	d := &Dispatcher{
+		outbox:         outbox,
+		sinks:          sinks,
+		logger:         slog.Default(),
+		workers:        DefaultWorkers,
+		pollInterval:   DefaultPollInterval,
+		initialBackoff: DefaultInitialBackoff,
+		maxBackoff:     DefaultMaxBackoff,
+		maxAttempts:    DefaultMaxAttempts,
+		inFlight:       make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	d.workers = max(d.workers, 1)
+	d.maxAttempts = max(d.maxAttempts, 1)
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	return d
+}
+
+// Backlog returns the number of events waiting to be delivered and the
+// number of events parked after failing every attempt
+func (d *Dispatcher) Backlog(ctx context.Context) (pending, parked int, err error) {
+	pendingEvents, err := d.outbox.PendingEvents(ctx, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	parkedEvents, err := d.outbox.ParkedEvents(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	return len(pendingEvents), len(parkedEvents), nil
+}
+
+// Start begins delivering events in the background
+func (d *Dispatcher) Start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.started {
+		return
+	}
+	d.started = true
+
+	d.queues = make([]chan Envelope, d.workers)
+	for i := range d.queues {
+		d.queues[i] = make(chan Envelope, batchSize)
+		d.running.Add(1)
+		go d.work(d.queues[i])
+	}
+	d.running.Add(1)
+	go d.run()
+}
+
+// Stop stops delivering events, waiting for sinks to return until ctx is
+// done. Events that were not acknowledged stay in the outbox.
+func (d *Dispatcher) Stop(ctx context.Context) error {
+	d.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		d.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run polls the outbox until the dispatcher is stopped
+func (d *Dispatcher) run() {
+	defer d.running.Done()
+
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+	for {
+		d.poll()
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll queues the pending events that are not already in flight, in the
+// order they were recorded. An event whose worker is backed up stays pending
+// for a later poll, along with the events after it in the same partition,
+// so a receipt whose sink keeps failing does not hold back other partitions.
+func (d *Dispatcher) poll() {
+	d.mu.Lock()
+	limit := len(d.inFlight) + batchSize
+	d.mu.Unlock()
+
+	envelopes, err := d.outbox.PendingEvents(d.ctx, limit)
+	if err != nil {
+		if d.ctx.Err() == nil {
+			d.logger.Error("Failed to read event outbox", "error", err)
+		}
+		return
+	}
+
+	full := make(map[int]bool)
+	for _, envelope := range envelopes {
+		partition := d.partition(envelope.AggregateID)
+		if full[partition] {
+			continue
+		}
+
+		d.mu.Lock()
+		queued := d.inFlight[envelope.ID]
+		d.inFlight[envelope.ID] = true
+		d.mu.Unlock()
+		if queued {
+			continue
+		}
+
+		select {
+		case d.queues[partition] <- envelope:
+		default:
+			d.mu.Lock()
+			delete(d.inFlight, envelope.ID)
+			d.mu.Unlock()
+			full[partition] = true
+		}
+	}
+}
+
+// partition returns the worker responsible for an aggregate
+func (d *Dispatcher) partition(aggregateID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(aggregateID))
+	return int(h.Sum32() % uint32(len(d.queues)))
+}
+
+// work delivers the events of one partition in order
+func (d *Dispatcher) work(queue <-chan Envelope) {
+	defer d.running.Done()
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case envelope := <-queue:
+			if !d.deliver(envelope) {
+				return
+			}
+		}
+	}
+}
+
+// deliver hands envelope to every sink, retrying each until it succeeds or
+// fails every attempt, and then acknowledges or parks it. Sinks are called
+// with the ID of the request that recorded the event, so that their logs can
+// be correlated with it. It reports false when the dispatcher stopped first.
+func (d *Dispatcher) deliver(envelope Envelope) bool {
+	ctx := d.ctx
+	if envelope.RequestID != "" {
+		ctx = requestid.NewContext(ctx, envelope.RequestID)
+	}
+	defer func() {
+		d.mu.Lock()
+		delete(d.inFlight, envelope.ID)
+		d.mu.Unlock()
+	}()
+
+	for _, sink := range d.sinks {
+		for attempt := 1; ; attempt++ {
+			err := sink.Handle(ctx, envelope)
+			if err == nil {
+				break
+			}
+			if ctx.Err() != nil {
+				return false
+			}
+
+			if attempt >= d.maxAttempts {
+				d.logger.ErrorContext(ctx, "Event sink failed every attempt; parking event",
+					"sink", sink.Name(),
+					"event_id", envelope.ID,
+					"event_type", envelope.Type,
+					"aggregate_id", envelope.AggregateID,
+					"attempts", attempt,
+					"error", err)
+				if err := d.outbox.ParkEvent(context.WithoutCancel(ctx), envelope.ID); err != nil {
+					// The event stays pending and is delivered again
+					d.logger.ErrorContext(ctx, "Failed to park event", "event_id", envelope.ID, "error", err)
+				}
+				return true
+			}
+
+			wait := d.backoff(attempt)
+			d.logger.WarnContext(ctx, "Event sink failed",
+				"sink", sink.Name(),
+				"event_id", envelope.ID,
+				"event_type", envelope.Type,
+				"aggregate_id", envelope.AggregateID,
+				"attempt", attempt,
+				"retry_in", wait,
+				"error", err)
+			select {
+			case <-ctx.Done():
+				return false
+			case <-time.After(wait):
+			}
+		}
+	}
+
+	if err := d.outbox.AckEvent(context.WithoutCancel(ctx), envelope.ID); err != nil {
+		// The event stays pending and is delivered again
+		d.logger.ErrorContext(ctx, "Failed to acknowledge event", "event_id", envelope.ID, "error", err)
+	}
+	return true
+}
+
+// backoff returns the wait after attempt failures, doubling from the
+// initial backoff up to the maximum with jitter
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	wait := d.initialBackoff
+	for i := 1; i < attempt && wait < d.maxBackoff; i++ {
+		wait *= 2
+	}
+	wait = min(wait, d.maxBackoff)
+	if wait < 2 {
+		return wait
+	}
+	return wait/2 + rand.N(wait/2)
+}
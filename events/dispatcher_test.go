@@ -0,0 +1,334 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marcelorm/receipt-processor/requestid"
+)
+
+// memoryOutbox is an Outbox holding envelopes in memory
+type memoryOutbox struct {
+	mu        sync.Mutex
+	envelopes []Envelope
+	parked    []Envelope
+}
+
+func (o *memoryOutbox) add(t *testing.T, event DomainEvent) Envelope {
+	t.Helper()
+	envelope, err := NewEnvelope(event)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.envelopes = append(o.envelopes, envelope)
+	return envelope
+}
+
+func (o *memoryOutbox) PendingEvents(ctx context.Context, limit int) ([]Envelope, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	n := len(o.envelopes)
+	if limit > 0 {
+		n = min(n, limit)
+	}
+	return append([]Envelope(nil), o.envelopes[:n]...), nil
+}
+
+func (o *memoryOutbox) AckEvent(ctx context.Context, id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i, envelope := range o.envelopes {
+		if envelope.ID == id {
+			o.envelopes = append(o.envelopes[:i], o.envelopes[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (o *memoryOutbox) ParkEvent(ctx context.Context, id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i, envelope := range o.envelopes {
+		if envelope.ID == id {
+			o.envelopes = append(o.envelopes[:i], o.envelopes[i+1:]...)
+			o.parked = append(o.parked, envelope)
+			break
+		}
+	}
+	return nil
+}
+
+func (o *memoryOutbox) ParkedEvents(ctx context.Context) ([]Envelope, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]Envelope(nil), o.parked...), nil
+}
+
+func (o *memoryOutbox) pending() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.envelopes)
+}
+
+// recordingSink records the events it handles, failing the first failures
+// calls for each event
+type recordingSink struct {
+	failures int
+
+	mu       sync.Mutex
+	attempts map[string]int
+	handled  []Envelope // Events in the order they succeeded
+}
+
+func (s *recordingSink) Name() string { return "recording" }
+
+func (s *recordingSink) Handle(ctx context.Context, envelope Envelope) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attempts == nil {
+		s.attempts = make(map[string]int)
+	}
+	s.attempts[envelope.ID]++
+	if s.attempts[envelope.ID] <= s.failures {
+		return errors.New("sink unavailable")
+	}
+	s.handled = append(s.handled, envelope)
+	return nil
+}
+
+func (s *recordingSink) results() []Envelope {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Envelope(nil), s.handled...)
+}
+
+// newTestDispatcher creates a started dispatcher that polls and retries quickly
+func newTestDispatcher(t *testing.T, outbox Outbox, sinks ...Sink) *Dispatcher {
+	d := NewDispatcher(outbox, sinks,
+		WithPollInterval(time.Millisecond),
+		WithBackoff(time.Millisecond, 5*time.Millisecond),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	d.Start()
+	t.Cleanup(func() { d.Stop(context.Background()) })
+	return d
+}
+
+// waitFor waits until condition holds
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDispatcherDeliversToEverySink(t *testing.T) {
+	outbox := &memoryOutbox{}
+	first, second := &recordingSink{}, &recordingSink{failures: 2}
+	newTestDispatcher(t, outbox, first, second)
+
+	outbox.add(t, ReceiptProcessed{ReceiptID: "r1"})
+	waitFor(t, "the event to be acknowledged", func() bool { return outbox.pending() == 0 })
+
+	// The failing sink is retried without handing the event to the other
+	// sink again
+	if got := first.results(); len(got) != 1 {
+		t.Errorf("Expected the first sink to handle the event once, got %v", got)
+	}
+	if got := second.results(); len(got) != 1 {
+		t.Errorf("Expected the second sink to handle the event once, got %v", got)
+	}
+	for id, attempts := range second.attempts {
+		if attempts != 3 {
+			t.Errorf("Expected 3 attempts for %s, got %d", id, attempts)
+		}
+	}
+}
+
+func TestDispatcherOrdersEventsPerReceipt(t *testing.T) {
+	outbox := &memoryOutbox{}
+	sink := &recordingSink{failures: 1}
+
+	// Event IDs per receipt, in the order they were recorded
+	want := make(map[string][]string)
+	for i := 0; i < 30; i++ {
+		envelope := outbox.add(t, ReceiptProcessed{ReceiptID: fmt.Sprintf("r%d", i%3)})
+		want[envelope.AggregateID] = append(want[envelope.AggregateID], envelope.ID)
+	}
+	newTestDispatcher(t, outbox, sink)
+	waitFor(t, "every event to be acknowledged", func() bool { return outbox.pending() == 0 })
+
+	// Receipts may be interleaved, but each receipt's events keep their
+	// order even though every event fails once
+	got := make(map[string][]string)
+	for _, envelope := range sink.results() {
+		got[envelope.AggregateID] = append(got[envelope.AggregateID], envelope.ID)
+	}
+	for receipt, ids := range want {
+		if fmt.Sprint(got[receipt]) != fmt.Sprint(ids) {
+			t.Errorf("Expected events %v for %s, got %v", ids, receipt, got[receipt])
+		}
+	}
+}
+
+func TestDispatcherStopLeavesEventsPending(t *testing.T) {
+	outbox := &memoryOutbox{}
+	blocked := NewSink("blocked", func(ctx context.Context, envelope Envelope) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	d := newTestDispatcher(t, outbox, blocked)
+	envelope := outbox.add(t, ReceiptProcessed{ReceiptID: "r1"})
+
+	time.Sleep(10 * time.Millisecond)
+	if err := d.Stop(context.Background()); err != nil {
+		t.Fatalf("Failed to stop: %v", err)
+	}
+	if outbox.pending() != 1 {
+		t.Fatalf("Expected the event to stay pending, got %d", outbox.pending())
+	}
+
+	// A new dispatcher delivers the event again
+	sink := &recordingSink{}
+	newTestDispatcher(t, outbox, sink)
+	waitFor(t, "the event to be redelivered", func() bool { return outbox.pending() == 0 })
+	if got := sink.results(); len(got) != 1 || got[0].ID != envelope.ID {
+		t.Errorf("Expected the event for r1 to be redelivered, got %v", got)
+	}
+}
+
+func TestDispatcherParksPoisonEvents(t *testing.T) {
+	outbox := &memoryOutbox{}
+	poison := NewSink("poison", func(ctx context.Context, envelope Envelope) error {
+		if envelope.AggregateID == "r1" {
+			return errors.New("cannot handle r1")
+		}
+		return nil
+	})
+	sink := &recordingSink{}
+	d := NewDispatcher(outbox, []Sink{poison, sink},
+		WithWorkers(1),
+		WithPollInterval(time.Millisecond),
+		WithBackoff(time.Millisecond, 5*time.Millisecond),
+		WithMaxAttempts(3),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	bad := outbox.add(t, ReceiptProcessed{ReceiptID: "r1"})
+	good := outbox.add(t, ReceiptProcessed{ReceiptID: "r2"})
+	d.Start()
+	t.Cleanup(func() { d.Stop(context.Background()) })
+
+	// The poison event is parked rather than holding back the next event
+	waitFor(t, "every event to leave the outbox", func() bool { return outbox.pending() == 0 })
+	if got := sink.results(); len(got) != 1 || got[0].ID != good.ID {
+		t.Errorf("Expected only the event for r2 to be handled, got %v", got)
+	}
+
+	pending, parked, err := d.Backlog(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if pending != 0 || parked != 1 {
+		t.Errorf("Expected 0 pending and 1 parked event, got %d and %d", pending, parked)
+	}
+	if events, _ := outbox.ParkedEvents(context.Background()); len(events) != 1 || events[0].ID != bad.ID {
+		t.Errorf("Expected the event for r1 to be parked, got %v", events)
+	}
+}
+
+func TestDispatcherDoesNotHoldBackOtherPartitions(t *testing.T) {
+	outbox := &memoryOutbox{}
+	stuck := NewSink("stuck", func(ctx context.Context, envelope Envelope) error {
+		if envelope.AggregateID == "r0" {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	})
+	sink := &recordingSink{}
+	d := NewDispatcher(outbox, []Sink{stuck, sink},
+		WithWorkers(2),
+		WithPollInterval(time.Millisecond),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	d.Start()
+	t.Cleanup(func() { d.Stop(context.Background()) })
+
+	// Find a receipt handled by the other worker
+	other := ""
+	for i := 1; other == ""; i++ {
+		if id := fmt.Sprintf("r%d", i); d.partition(id) != d.partition("r0") {
+			other = id
+		}
+	}
+
+	// More events for the stuck receipt than its worker's queue holds
+	for i := 0; i < 2*batchSize; i++ {
+		outbox.add(t, ReceiptProcessed{ReceiptID: "r0"})
+	}
+	good := outbox.add(t, ReceiptProcessed{ReceiptID: other})
+
+	waitFor(t, "the event for "+other+" to be handled", func() bool { return len(sink.results()) == 1 })
+	if got := sink.results(); got[0].ID != good.ID {
+		t.Errorf("Expected only the event for %s to be handled, got %v", other, got)
+	}
+}
+
+func TestDispatcherRestoresRequestID(t *testing.T) {
+	outbox := &memoryOutbox{}
+	ids := make(chan string, 1)
+	sink := NewSink("request-id", func(ctx context.Context, envelope Envelope) error {
+		ids <- requestid.FromContext(ctx)
+		return nil
+	})
+	envelope, err := NewEnvelope(ReceiptProcessed{ReceiptID: "r1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	envelope.RequestID = "req-1"
+	outbox.mu.Lock()
+	outbox.envelopes = append(outbox.envelopes, envelope)
+	outbox.mu.Unlock()
+
+	newTestDispatcher(t, outbox, sink)
+	select {
+	case id := <-ids:
+		if id != "req-1" {
+			t.Errorf("Expected request ID req-1 in the sink context, got %q", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the event")
+	}
+}
+
+func TestBusSink(t *testing.T) {
+	bus := NewBus()
+	sub, _ := bus.Subscribe(Filter{}, 0)
+	envelope, err := NewEnvelope(ReceiptProcessed{ReceiptID: "r1", Retailer: "Target", Points: 6})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := BusSink(bus).Handle(context.Background(), envelope); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	received := receive(sub)
+	if len(received) != 1 || received[0].ReceiptID != "r1" || received[0].Points != 6 {
+		t.Errorf("Expected the receipt r1 on the bus, got %+v", received)
+	}
+
+	envelope.Type = "receipt.unknown"
+	if err := BusSink(bus).Handle(context.Background(), envelope); err == nil {
+		t.Error("Expected an error for an unknown event type")
+	}
+}
@@ -0,0 +1,76 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/marcelorm/receipt-processor/models"
+)
+
+// DomainEvent is a typed change to a receipt
+type DomainEvent interface {
+	// EventType names the kind of change, e.g. receipt.processed
+	EventType() string
+
+	// AggregateID is the ID of the receipt the event belongs to. Events with
+	// the same aggregate ID are delivered in the order they were recorded.
+	AggregateID() string
+}
+
+// ReceiptProcessed is recorded when a receipt is scored and stored
+type ReceiptProcessed struct {
+	ReceiptID   string              `json:"id"`
+	Retailer    string              `json:"retailer"`
+	Tenant      string              `json:"tenant,omitempty"`
+	Points      int                 `json:"points"`
+	Rules       []models.RuleResult `json:"rules"` // Result of every rule
+	ProcessedAt time.Time           `json:"processedAt"`
+}
+
+// EventType implements DomainEvent
+func (ReceiptProcessed) EventType() string { return TypeReceiptProcessed }
+
+// AggregateID implements DomainEvent
+func (e ReceiptProcessed) AggregateID() string { return e.ReceiptID }
+
+// Envelope is a recorded domain event as stored in an outbox and handed to
+// sinks
+type Envelope struct {
+	ID          string          `json:"id"`                  // Unique event ID, stable across redeliveries
+	Type        string          `json:"type"`                // Kind of change
+	AggregateID string          `json:"aggregateId"`         // Receipt the event belongs to
+	OccurredAt  time.Time       `json:"occurredAt"`          // When the event was recorded
+	RequestID   string          `json:"requestId,omitempty"` // Request that caused the change, for correlating logs
+	Payload     json.RawMessage `json:"payload"`             // The encoded domain event
+}
+
+// NewEnvelope records event with a new ID
+func NewEnvelope(event DomainEvent) (Envelope, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("encoding %s event: %w", event.EventType(), err)
+	}
+	return Envelope{
+		ID:          uuid.New().String(),
+		Type:        event.EventType(),
+		AggregateID: event.AggregateID(),
+		OccurredAt:  time.Now().UTC(),
+		Payload:     payload,
+	}, nil
+}
+
+// Decode returns the typed domain event held by the envelope
+func (e Envelope) Decode() (DomainEvent, error) {
+	switch e.Type {
+	case TypeReceiptProcessed:
+		var event ReceiptProcessed
+		if err := json.Unmarshal(e.Payload, &event); err != nil {
+			return nil, fmt.Errorf("decoding %s event %s: %w", e.Type, e.ID, err)
+		}
+		return event, nil
+	default:
+		return nil, fmt.Errorf("unknown event type %q", e.Type)
+	}
+}
@@ -0,0 +1,339 @@
+// Package graphqlapi serves receipts, points and aggregate statistics over
+// GraphQL, sharing storage and the scoring pipeline with the REST API in
+// package api.
+package graphqlapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/metrics"
+	"github.com/marcelorm/receipt-processor/requestid"
+	"github.com/marcelorm/receipt-processor/services"
+	"github.com/marcelorm/receipt-processor/services/rules"
+	"github.com/marcelorm/receipt-processor/storage"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// DefaultMaxDepth is the default limit on how deeply selections may nest
+	DefaultMaxDepth = 8
+
+	// DefaultMaxComplexity is the default limit on the estimated cost of a query
+	DefaultMaxComplexity = 2000
+
+	// defaultBodyLimit caps request bodies when no limit is configured
+	defaultBodyLimit = 1 << 20
+)
+
+// tracer creates the spans recorded by the GraphQL layer
+var tracer = otel.Tracer("github.com/marcelorm/receipt-processor/graphqlapi")
+
+// Handler executes GraphQL requests against the receipt store
+type Handler struct {
+	store         storage.ReceiptStorage
+	calculator    *services.Calculator
+	processor     *services.Processor
+	metrics       *metrics.Metrics
+	logger        *slog.Logger
+	maxDepth      int
+	maxComplexity int
+	bodyLimit     int64
+	schema        graphql.Schema
+}
+
+// Option configures optional dependencies and limits of a Handler
+type Option func(*Handler)
+
+// WithCalculator scores receipts with the given calculator instead of the default rules
+func WithCalculator(calculator *services.Calculator) Option {
+	return func(h *Handler) {
+		h.calculator = calculator
+	}
+}
+
+// WithMetrics records scoring metrics for every processed receipt
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(h *Handler) {
+		h.metrics = m
+	}
+}
+
+// WithLogger logs through the given logger instead of the default logger
+func WithLogger(logger *slog.Logger) Option {
+	return func(h *Handler) {
+		h.logger = logger
+	}
+}
+
+// WithMaxDepth rejects queries whose selections nest deeper than n levels
+func WithMaxDepth(n int) Option {
+	return func(h *Handler) {
+		h.maxDepth = n
+	}
+}
+
+// WithMaxComplexity rejects queries whose estimated cost exceeds n
+func WithMaxComplexity(n int) Option {
+	return func(h *Handler) {
+		h.maxComplexity = n
+	}
+}
+
+// WithBodyLimit rejects request bodies larger than n bytes
+func WithBodyLimit(n int64) Option {
+	return func(h *Handler) {
+		h.bodyLimit = n
+	}
+}
+
+// NewHandler creates a GraphQL handler backed by store
+func NewHandler(store storage.ReceiptStorage, opts ...Option) (*Handler, error) {
+	h := &Handler{
+		store:         store,
+		logger:        slog.Default(),
+		maxDepth:      DefaultMaxDepth,
+		maxComplexity: DefaultMaxComplexity,
+		bodyLimit:     defaultBodyLimit,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.calculator == nil {
+		h.calculator = services.NewCalculator(rules.GetAllRules(), h.logger)
+	}
+	h.processor = services.NewProcessor(h.calculator, h.store, h.metrics, h.logger)
+
+	schema, err := newSchema(h)
+	if err != nil {
+		return nil, err
+	}
+	h.schema = schema
+	return h, nil
+}
+
+// Request is a GraphQL request as sent in a POST body
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+// ServeHTTP executes GraphQL requests sent as a JSON POST body or as GET
+// query parameters. Mutations are only accepted over POST.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	switch r.Method {
+	case http.MethodGet:
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if vars := r.URL.Query().Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				h.writeError(w, r, http.StatusBadRequest, rperrors.New(rperrors.ErrInvalidJSON, "invalid variables"))
+				return
+			}
+		}
+	case http.MethodPost:
+		body := http.MaxBytesReader(w, r.Body, h.bodyLimit)
+		if err := json.NewDecoder(body).Decode(&req); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				h.writeError(w, r, http.StatusRequestEntityTooLarge, rperrors.New(rperrors.ErrRequestTooLarge, err.Error()))
+				return
+			}
+			h.writeError(w, r, http.StatusBadRequest, rperrors.Wrap(rperrors.ErrInvalidJSON, err, "invalid GraphQL request body"))
+			return
+		}
+		_, _ = io.Copy(io.Discard, body)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		h.writeError(w, r, http.StatusMethodNotAllowed, rperrors.New(rperrors.ErrInvalidRequest, "GraphQL requests must use GET or POST"))
+		return
+	}
+
+	if strings.TrimSpace(req.Query) == "" {
+		h.writeError(w, r, http.StatusBadRequest, rperrors.New(rperrors.ErrInvalidRequest, "query is required"))
+		return
+	}
+
+	doc, result := h.prepare(r.Context(), req)
+	if result != nil {
+		// The request never reached execution
+		writeJSON(w, http.StatusBadRequest, result)
+		return
+	}
+
+	operation := selectOperation(doc, req.OperationName)
+	if r.Method == http.MethodGet && operation != nil && operation.Operation == ast.OperationTypeMutation {
+		w.Header().Set("Allow", "POST")
+		h.writeError(w, r, http.StatusMethodNotAllowed, rperrors.New(rperrors.ErrInvalidRequest, "mutations must use POST"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.execute(r.Context(), doc, req))
+}
+
+// Execute parses, validates and executes a GraphQL request
+func (h *Handler) Execute(ctx context.Context, req Request) *graphql.Result {
+	doc, result := h.prepare(ctx, req)
+	if result != nil {
+		return result
+	}
+	return h.execute(ctx, doc, req)
+}
+
+// prepare parses and validates the request and enforces the query limits,
+// returning a result holding the errors when the request cannot be executed
+func (h *Handler) prepare(ctx context.Context, req Request) (*ast.Document, *graphql.Result) {
+	_, span := tracer.Start(ctx, "GraphQL.Validate")
+	defer span.End()
+
+	doc, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"}),
+	})
+	if err != nil {
+		return nil, &graphql.Result{Errors: withCode(gqlerrors.FormatErrors(err), rperrors.ErrInvalidRequest)}
+	}
+
+	validation := graphql.ValidateDocument(&h.schema, doc, nil)
+	if !validation.IsValid {
+		return nil, &graphql.Result{Errors: withCode(validation.Errors, rperrors.ErrInvalidRequest)}
+	}
+
+	operation := selectOperation(doc, req.OperationName)
+	if operation == nil {
+		// Executing reports the missing or ambiguous operation
+		return doc, nil
+	}
+
+	cost := analyze(doc, operation, req.Variables)
+	span.SetAttributes(
+		attribute.Int("graphql.depth", cost.depth),
+		attribute.Int("graphql.complexity", cost.complexity),
+	)
+	if h.maxDepth > 0 && cost.depth > h.maxDepth {
+		return nil, &graphql.Result{Errors: []gqlerrors.FormattedError{formatError(ctx,
+			rperrors.New(rperrors.ErrInvalidRequest, "query exceeds the maximum depth"),
+			fmt.Sprintf("query depth %d exceeds the maximum of %d", cost.depth, h.maxDepth))}}
+	}
+	if h.maxComplexity > 0 && cost.complexity > h.maxComplexity {
+		return nil, &graphql.Result{Errors: []gqlerrors.FormattedError{formatError(ctx,
+			rperrors.New(rperrors.ErrInvalidRequest, "query exceeds the maximum complexity"),
+			fmt.Sprintf("query complexity %d exceeds the maximum of %d", cost.complexity, h.maxComplexity))}}
+	}
+	return doc, nil
+}
+
+// execute runs a validated document
+func (h *Handler) execute(ctx context.Context, doc *ast.Document, req Request) *graphql.Result {
+	ctx, span := tracer.Start(ctx, "GraphQL.Execute")
+	defer span.End()
+	if req.OperationName != "" {
+		span.SetAttributes(attribute.String("graphql.operation.name", req.OperationName))
+	}
+
+	return graphql.Execute(graphql.ExecuteParams{
+		Schema:        h.schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       ctx,
+	})
+}
+
+// writeError writes a GraphQL response holding a single request error
+func (h *Handler) writeError(w http.ResponseWriter, r *http.Request, status int, err *rperrors.AppError) {
+	err.Log(r.Context())
+	writeJSON(w, status, &graphql.Result{Errors: []gqlerrors.FormattedError{formatError(r.Context(), err, err.Message)}})
+}
+
+// writeJSON writes v as the JSON response body
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// selectOperation returns the operation named name, or the only operation
+// in the document when name is empty
+func selectOperation(doc *ast.Document, name string) *ast.OperationDefinition {
+	var selected *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		operation, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if name == "" {
+			if selected != nil {
+				return nil
+			}
+			selected = operation
+		} else if operation.Name != nil && operation.Name.Value == name {
+			return operation
+		}
+	}
+	return selected
+}
+
+// fieldError is returned by resolvers so that the application error code
+// and request ID are reported in the GraphQL error extensions
+type fieldError struct {
+	*rperrors.AppError
+	requestID string
+}
+
+// Extensions implements gqlerrors.ExtendedError
+func (e *fieldError) Extensions() map[string]any {
+	extensions := map[string]any{"code": e.Code}
+	if e.requestID != "" {
+		extensions["requestId"] = e.requestID
+	}
+	return extensions
+}
+
+// Error returns the user-facing message of the error
+func (e *fieldError) Error() string {
+	return e.Message
+}
+
+// fail logs err and converts it into an error reported by a resolver
+func (h *Handler) fail(ctx context.Context, err error) error {
+	appErr, ok := err.(*rperrors.AppError)
+	if !ok {
+		h.logger.ErrorContext(ctx, "Unexpected non-application error", "error", err)
+		appErr = rperrors.Wrap(rperrors.ErrInternal, err, "unexpected error")
+	} else {
+		appErr.Log(ctx)
+	}
+	return &fieldError{AppError: appErr, requestID: requestid.FromContext(ctx)}
+}
+
+// formatError builds a request-level GraphQL error carrying the code of err
+func formatError(ctx context.Context, err *rperrors.AppError, message string) gqlerrors.FormattedError {
+	formatted := gqlerrors.NewFormattedError(message)
+	formatted.Extensions = (&fieldError{AppError: err, requestID: requestid.FromContext(ctx)}).Extensions()
+	return formatted
+}
+
+// withCode tags request errors reported by the GraphQL library with code
+func withCode(errs []gqlerrors.FormattedError, code rperrors.ErrorCode) []gqlerrors.FormattedError {
+	for i := range errs {
+		if errs[i].Extensions == nil {
+			errs[i].Extensions = map[string]any{"code": code}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,549 @@
+package graphqlapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/services"
+	"github.com/marcelorm/receipt-processor/services/rules"
+	"github.com/marcelorm/receipt-processor/storage"
+)
+
+func init() {
+	// Configure minimal logging for tests
+	handler := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError, // Only log errors during tests
+	})
+	slog.SetDefault(slog.New(handler))
+}
+
+// targetReceipt is the Target example receipt, worth 28 points
+var targetReceipt = map[string]any{
+	"retailer":     "Target",
+	"purchaseDate": "2022-01-01",
+	"purchaseTime": "13:01",
+	"items": []map[string]any{
+		{"shortDescription": "Mountain Dew 12PK", "price": "6.49"},
+		{"shortDescription": "Emils Cheese Pizza", "price": "12.25"},
+		{"shortDescription": "Knorr Creamy Chicken", "price": "1.26"},
+		{"shortDescription": "Doritos Nacho Cheese", "price": "3.35"},
+		{"shortDescription": "   Klarbrunn 12-PK 12 FL OZ  ", "price": "12.00"},
+	},
+	"total": "35.35",
+}
+
+// mmReceipt is the M&M Corner Market example receipt, worth 109 points
+var mmReceipt = map[string]any{
+	"retailer":     "M&M Corner Market",
+	"purchaseDate": "2022-03-20",
+	"purchaseTime": "14:33",
+	"items": []map[string]any{
+		{"shortDescription": "Gatorade", "price": "2.25"},
+		{"shortDescription": "Gatorade", "price": "2.25"},
+		{"shortDescription": "Gatorade", "price": "2.25"},
+		{"shortDescription": "Gatorade", "price": "2.25"},
+	},
+	"total": "9.00",
+}
+
+const processMutation = `mutation Process($receipt: ReceiptInput!) {
+  processReceipt(receipt: $receipt) { id points }
+}`
+
+// response is a decoded GraphQL response
+type response struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string         `json:"message"`
+		Extensions map[string]any `json:"extensions"`
+	} `json:"errors"`
+}
+
+// errorCode returns the code extension of the first error
+func (r response) errorCode() rperrors.ErrorCode {
+	if len(r.Errors) == 0 {
+		return ""
+	}
+	code, _ := r.Errors[0].Extensions["code"].(string)
+	return rperrors.ErrorCode(code)
+}
+
+// setupHandler creates a handler backed by a fresh in-memory store
+func setupHandler(t *testing.T, opts ...Option) *Handler {
+	t.Helper()
+
+	h, err := NewHandler(storage.NewMemoryStorage(), opts...)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	return h
+}
+
+// post sends a GraphQL request and decodes the response into data
+func post(t *testing.T, h http.Handler, req Request, data any) (int, response) {
+	t.Helper()
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+	return serve(t, h, httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body)), data)
+}
+
+// serve sends r to h and decodes the response into data
+func serve(t *testing.T, h http.Handler, r *http.Request, data any) (int, response) {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	var resp response
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to unmarshal response %q: %v", w.Body.String(), err)
+	}
+	if data != nil && len(resp.Data) > 0 {
+		if err := json.Unmarshal(resp.Data, data); err != nil {
+			t.Fatalf("Failed to unmarshal data %s: %v", resp.Data, err)
+		}
+	}
+	return w.Code, resp
+}
+
+// process submits receipt through the processReceipt mutation and returns its ID
+func process(t *testing.T, h http.Handler, receipt map[string]any) string {
+	t.Helper()
+
+	var data struct {
+		ProcessReceipt struct {
+			ID string `json:"id"`
+		} `json:"processReceipt"`
+	}
+	code, resp := post(t, h, Request{Query: processMutation, Variables: map[string]any{"receipt": receipt}}, &data)
+	if code != http.StatusOK || len(resp.Errors) > 0 {
+		t.Fatalf("Expected the receipt to be processed, got %d: %+v", code, resp.Errors)
+	}
+	return data.ProcessReceipt.ID
+}
+
+func TestProcessAndQueryReceipt(t *testing.T) {
+	h := setupHandler(t)
+	id := process(t, h, targetReceipt)
+
+	var data struct {
+		Receipt struct {
+			ID        string                   `json:"id"`
+			Retailer  string                   `json:"retailer"`
+			Total     string                   `json:"total"`
+			Points    int                      `json:"points"`
+			Items     []struct{ Price string } `json:"items"`
+			Breakdown []struct {
+				Rule   string `json:"rule"`
+				Points int    `json:"points"`
+			} `json:"breakdown"`
+		} `json:"receipt"`
+		Missing *struct{} `json:"missing"`
+	}
+	code, resp := post(t, h, Request{
+		Query: `query($id: ID!) {
+  receipt(id: $id) { id retailer total points items { price } breakdown { rule points } }
+  missing: receipt(id: "nonexistent-id") { id }
+}`,
+		Variables: map[string]any{"id": id},
+	}, &data)
+	if code != http.StatusOK || len(resp.Errors) > 0 {
+		t.Fatalf("Expected a successful query, got %d: %+v", code, resp.Errors)
+	}
+
+	r := data.Receipt
+	if r.ID != id || r.Retailer != "Target" || r.Total != "35.35" || r.Points != 28 {
+		t.Errorf("Expected the Target receipt worth 28 points, got %+v", r)
+	}
+	if len(r.Items) != 5 || r.Items[4].Price != "12.00" {
+		t.Errorf("Expected 5 items ending at 12.00, got %+v", r.Items)
+	}
+	if len(r.Breakdown) != 7 {
+		t.Errorf("Expected 7 rule results, got %d", len(r.Breakdown))
+	}
+	if data.Missing != nil {
+		t.Errorf("Expected null for an unknown receipt, got %+v", data.Missing)
+	}
+}
+
+func TestRichItems(t *testing.T) {
+	h := setupHandler(t)
+	id := process(t, h, map[string]any{
+		"retailer":     "Target",
+		"purchaseDate": "2022-01-01",
+		"purchaseTime": "13:01",
+		"items": []map[string]any{
+			{"shortDescription": "Milk", "price": "4.00", "quantity": 3, "unitPrice": "1.50", "discount": "0.50", "upc": "036000291452", "category": "Dairy"},
+			{"shortDescription": "Gum", "price": "1.00"},
+		},
+		"total": "5.00",
+	})
+
+	var data struct {
+		Receipt struct {
+			Items []struct {
+				Quantity  *float64 `json:"quantity"`
+				UnitPrice *string  `json:"unitPrice"`
+				Discount  *string  `json:"discount"`
+				UPC       *string  `json:"upc"`
+				Category  *string  `json:"category"`
+			} `json:"items"`
+		} `json:"receipt"`
+	}
+	code, resp := post(t, h, Request{
+		Query:     `query($id: ID!) { receipt(id: $id) { items { quantity unitPrice discount upc category } } }`,
+		Variables: map[string]any{"id": id},
+	}, &data)
+	if code != http.StatusOK || len(resp.Errors) > 0 {
+		t.Fatalf("Expected a successful query, got %d: %+v", code, resp.Errors)
+	}
+
+	items := data.Receipt.Items
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 items, got %d", len(items))
+	}
+	milk := items[0]
+	if milk.Quantity == nil || *milk.Quantity != 3 || *milk.UnitPrice != "1.50" || *milk.Discount != "0.50" ||
+		*milk.UPC != "036000291452" || *milk.Category != "Dairy" {
+		t.Errorf("Expected the item details to be kept, got %+v", milk)
+	}
+	if gum := items[1]; gum.Quantity != nil || gum.UnitPrice != nil || gum.Category != nil {
+		t.Errorf("Expected null details for a plain item, got %+v", gum)
+	}
+
+	// The price must match the quantity at the unit price less the discount
+	receipt := map[string]any{
+		"retailer":     "Target",
+		"purchaseDate": "2022-01-01",
+		"purchaseTime": "13:01",
+		"items":        []map[string]any{{"shortDescription": "Milk", "price": "4.50", "quantity": 3, "unitPrice": "1.50", "discount": "0.50"}},
+		"total":        "4.50",
+	}
+	_, resp = post(t, h, Request{Query: processMutation, Variables: map[string]any{"receipt": receipt}}, nil)
+	if resp.errorCode() != rperrors.ErrInvalidItemPrice {
+		t.Errorf("Expected error code %s, got %+v", rperrors.ErrInvalidItemPrice, resp.Errors)
+	}
+}
+
+func TestReconciliation(t *testing.T) {
+	receipt := map[string]any{
+		"retailer":     "Target",
+		"purchaseDate": "2022-01-01",
+		"purchaseTime": "13:01",
+		"items":        []map[string]any{{"shortDescription": "Gum", "price": "0.01"}},
+		"tax":          "0.99",
+		"total":        "100.00",
+	}
+
+	// Warnings keep the receipt and record why its total did not add up
+	h := setupHandler(t, WithCalculator(services.NewCalculator(rules.GetAllRules(), nil,
+		services.WithReconciliation(0.01, services.ReconcileWarn))))
+	id := process(t, h, receipt)
+
+	var data struct {
+		Receipt struct {
+			Tax            *string `json:"tax"`
+			Tip            *string `json:"tip"`
+			Reconciliation *struct {
+				Expected   string   `json:"expected"`
+				Difference string   `json:"difference"`
+				Problems   []string `json:"problems"`
+			} `json:"reconciliation"`
+		} `json:"receipt"`
+	}
+	code, resp := post(t, h, Request{
+		Query:     `query($id: ID!) { receipt(id: $id) { tax tip reconciliation { expected difference problems } } }`,
+		Variables: map[string]any{"id": id},
+	}, &data)
+	if code != http.StatusOK || len(resp.Errors) > 0 {
+		t.Fatalf("Expected a successful query, got %d: %+v", code, resp.Errors)
+	}
+	if data.Receipt.Tax == nil || *data.Receipt.Tax != "0.99" || data.Receipt.Tip != nil {
+		t.Errorf("Expected tax 0.99 and no tip, got %v and %v", data.Receipt.Tax, data.Receipt.Tip)
+	}
+	r := data.Receipt.Reconciliation
+	if r == nil || r.Expected != "1.00" || r.Difference != "99.00" || len(r.Problems) != 1 {
+		t.Errorf("Expected the reconciliation failure to be recorded, got %+v", r)
+	}
+
+	// Rejection fails the mutation with the invalid total code
+	h = setupHandler(t, WithCalculator(services.NewCalculator(rules.GetAllRules(), nil,
+		services.WithReconciliation(0.01, services.ReconcileReject))))
+	_, resp = post(t, h, Request{Query: processMutation, Variables: map[string]any{"receipt": receipt}}, nil)
+	if resp.errorCode() != rperrors.ErrInvalidTotal {
+		t.Errorf("Expected error code %s, got %+v", rperrors.ErrInvalidTotal, resp.Errors)
+	}
+}
+
+func TestCurrency(t *testing.T) {
+	rates, err := services.NewExchangeRates("2024-06-01", "USD", map[string]float64{"KWD": 3.25})
+	if err != nil {
+		t.Fatalf("Failed to create exchange rates: %v", err)
+	}
+	h := setupHandler(t, WithCalculator(services.NewCalculator(rules.GetAllRules(), nil,
+		services.WithExchangeRates(rates))))
+	id := process(t, h, map[string]any{
+		"retailer":     "Target",
+		"purchaseDate": "2022-01-01",
+		"purchaseTime": "13:01",
+		"currency":     "KWD",
+		"items":        []map[string]any{{"shortDescription": "Gum", "price": "1.125"}},
+		"total":        "1.125",
+	})
+
+	var data struct {
+		Receipt struct {
+			Currency   *string `json:"currency"`
+			Total      string  `json:"total"`
+			Conversion *struct {
+				Currency     string  `json:"currency"`
+				Base         string  `json:"base"`
+				Rate         float64 `json:"rate"`
+				RatesVersion string  `json:"ratesVersion"`
+			} `json:"conversion"`
+		} `json:"receipt"`
+	}
+	code, resp := post(t, h, Request{
+		Query:     `query($id: ID!) { receipt(id: $id) { currency total conversion { currency base rate ratesVersion } } }`,
+		Variables: map[string]any{"id": id},
+	}, &data)
+	if code != http.StatusOK || len(resp.Errors) > 0 {
+		t.Fatalf("Expected a successful query, got %d: %+v", code, resp.Errors)
+	}
+	if data.Receipt.Currency == nil || *data.Receipt.Currency != "KWD" || data.Receipt.Total != "1.125" {
+		t.Errorf("Expected the total 1.125 KWD, got %s %v", data.Receipt.Total, data.Receipt.Currency)
+	}
+	c := data.Receipt.Conversion
+	if c == nil || c.Currency != "KWD" || c.Base != "USD" || c.Rate != 3.25 || c.RatesVersion != "2024-06-01" {
+		t.Errorf("Expected the conversion to be recorded, got %+v", c)
+	}
+
+	// Unknown currencies fail the mutation with the invalid currency code
+	receipt := maps.Clone(targetReceipt)
+	receipt["currency"] = "XYZ"
+	_, resp = post(t, h, Request{Query: processMutation, Variables: map[string]any{"receipt": receipt}}, nil)
+	if resp.errorCode() != rperrors.ErrInvalidCurrency {
+		t.Errorf("Expected error code %s, got %+v", rperrors.ErrInvalidCurrency, resp.Errors)
+	}
+}
+
+func TestReceiptsAndStats(t *testing.T) {
+	h := setupHandler(t)
+	process(t, h, targetReceipt)
+	process(t, h, mmReceipt)
+	process(t, h, targetReceipt)
+
+	var data struct {
+		Targets []struct {
+			Points int `json:"points"`
+		} `json:"targets"`
+		Page []struct {
+			Retailer string `json:"retailer"`
+		} `json:"page"`
+		Stats struct {
+			Receipts      int     `json:"receipts"`
+			TotalPoints   int     `json:"totalPoints"`
+			AveragePoints float64 `json:"averagePoints"`
+			MinPoints     *int    `json:"minPoints"`
+			MaxPoints     *int    `json:"maxPoints"`
+			Rules         []struct {
+				Rule   string `json:"rule"`
+				Hits   int    `json:"hits"`
+				Points int    `json:"points"`
+			} `json:"rules"`
+		} `json:"stats"`
+		Empty struct {
+			Receipts  int  `json:"receipts"`
+			MinPoints *int `json:"minPoints"`
+		} `json:"empty"`
+	}
+	code, resp := post(t, h, Request{Query: `{
+  targets: receipts(retailer: "target") { points }
+  page: receipts(limit: 1, offset: 1) { retailer }
+  stats { receipts totalPoints averagePoints minPoints maxPoints rules { rule hits points } }
+  empty: stats(retailer: "Costco") { receipts minPoints }
+}`}, &data)
+	if code != http.StatusOK || len(resp.Errors) > 0 {
+		t.Fatalf("Expected a successful query, got %d: %+v", code, resp.Errors)
+	}
+
+	if len(data.Targets) != 2 || data.Targets[0].Points != 28 {
+		t.Errorf("Expected 2 Target receipts worth 28 points, got %+v", data.Targets)
+	}
+	if len(data.Page) != 1 || data.Page[0].Retailer != "M&M Corner Market" {
+		t.Errorf("Expected the second receipt, got %+v", data.Page)
+	}
+
+	s := data.Stats
+	if s.Receipts != 3 || s.TotalPoints != 165 || s.AveragePoints != 55 {
+		t.Errorf("Expected 3 receipts worth 165 points, got %+v", s)
+	}
+	if s.MinPoints == nil || *s.MinPoints != 28 || s.MaxPoints == nil || *s.MaxPoints != 109 {
+		t.Errorf("Expected points between 28 and 109, got %v and %v", s.MinPoints, s.MaxPoints)
+	}
+	for _, rule := range s.Rules {
+		if rule.Rule == "RetailerNameRule" && (rule.Hits != 3 || rule.Points != 26) {
+			t.Errorf("Expected RetailerNameRule to award 26 points to 3 receipts, got %+v", rule)
+		}
+		if rule.Rule == "RoundDollarRule" && rule.Hits != 1 {
+			t.Errorf("Expected RoundDollarRule to award points to 1 receipt, got %+v", rule)
+		}
+	}
+
+	if data.Empty.Receipts != 0 || data.Empty.MinPoints != nil {
+		t.Errorf("Expected empty stats, got %+v", data.Empty)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	h := setupHandler(t)
+
+	invalidDate := map[string]any{}
+	for k, v := range targetReceipt {
+		invalidDate[k] = v
+	}
+	invalidDate["purchaseDate"] = "01/01/2022"
+
+	invalidPrice := map[string]any{}
+	for k, v := range targetReceipt {
+		invalidPrice[k] = v
+	}
+	invalidPrice["items"] = []map[string]any{{"shortDescription": "Gum", "price": "cheap"}}
+
+	tests := []struct {
+		name       string
+		request    Request
+		statusCode int
+		errorCode  rperrors.ErrorCode
+	}{
+		{
+			"Invalid purchase date",
+			Request{Query: processMutation, Variables: map[string]any{"receipt": invalidDate}},
+			http.StatusOK, rperrors.ErrInvalidPurchaseDate,
+		},
+		{
+			"Invalid item price",
+			Request{Query: processMutation, Variables: map[string]any{"receipt": invalidPrice}},
+			http.StatusOK, rperrors.ErrInvalidItemPrice,
+		},
+		{
+			"Limit out of range",
+			Request{Query: `{ receipts(limit: 1000) { id } }`},
+			http.StatusOK, rperrors.ErrInvalidRequest,
+		},
+		{
+			"Syntax error",
+			Request{Query: `{ receipts { id `},
+			http.StatusBadRequest, rperrors.ErrInvalidRequest,
+		},
+		{
+			"Unknown field",
+			Request{Query: `{ receipts { cashier } }`},
+			http.StatusBadRequest, rperrors.ErrInvalidRequest,
+		},
+		{
+			"Missing query",
+			Request{},
+			http.StatusBadRequest, rperrors.ErrInvalidRequest,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			code, resp := post(t, h, tc.request, nil)
+			if code != tc.statusCode {
+				t.Errorf("Expected status code %d, got %d", tc.statusCode, code)
+			}
+			if got := resp.errorCode(); got != tc.errorCode {
+				t.Errorf("Expected error code %s, got %s: %+v", tc.errorCode, got, resp.Errors)
+			}
+		})
+	}
+
+	t.Run("Invalid JSON", func(t *testing.T) {
+		code, resp := serve(t, h, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{"query": `)), nil)
+		if code != http.StatusBadRequest || resp.errorCode() != rperrors.ErrInvalidJSON {
+			t.Errorf("Expected 400 with %s, got %d with %s", rperrors.ErrInvalidJSON, code, resp.errorCode())
+		}
+	})
+
+	t.Run("Body too large", func(t *testing.T) {
+		small := setupHandler(t, WithBodyLimit(16))
+		code, resp := post(t, small, Request{Query: `{ stats { receipts totalPoints } }`}, nil)
+		if code != http.StatusRequestEntityTooLarge || resp.errorCode() != rperrors.ErrRequestTooLarge {
+			t.Errorf("Expected 413 with %s, got %d with %s", rperrors.ErrRequestTooLarge, code, resp.errorCode())
+		}
+	})
+}
+
+func TestLimits(t *testing.T) {
+	h := setupHandler(t, WithMaxDepth(3), WithMaxComplexity(100))
+
+	tests := []struct {
+		name    string
+		query   string
+		allowed bool
+	}{
+		{"Shallow query", `{ receipts(limit: 5) { id items { price } } }`, true},
+		{"Fragments are followed", `{ a: receipts(limit: 1) { ...R } } fragment R on Receipt { items { ... on Item { price } } breakdown { rule } }`, true},
+		{"At the depth limit", `{ receipts(limit: 1) { items { price } } stats { rules { rule } } }`, true},
+		{"Complexity over the limit", `{ receipts(limit: 100) { id retailer } }`, false},
+		{"Default page size counts", `{ receipts { id retailer points total purchaseDate } }`, false},
+		{"Variable limit", `query($n: Int) { receipts(limit: $n) { id retailer } }`, false},
+		{"Introspection is free", `{ __schema { types { name fields { name type { name ofType { name ofType { name } } } } } } }`, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			code, resp := post(t, h, Request{Query: tc.query, Variables: map[string]any{"n": 50}}, nil)
+			if tc.allowed && len(resp.Errors) > 0 {
+				t.Errorf("Expected the query to be allowed, got %+v", resp.Errors)
+			}
+			if !tc.allowed && (code != http.StatusBadRequest || resp.errorCode() != rperrors.ErrInvalidRequest) {
+				t.Errorf("Expected the query to be rejected, got %d: %+v", code, resp.Errors)
+			}
+		})
+	}
+
+	deep := setupHandler(t, WithMaxDepth(2))
+	code, resp := post(t, deep, Request{Query: `{ receipts(limit: 1) { items { price } } }`}, nil)
+	if code != http.StatusBadRequest || !strings.Contains(resp.Errors[0].Message, "depth 3") {
+		t.Errorf("Expected a depth error, got %d: %+v", code, resp.Errors)
+	}
+}
+
+func TestGet(t *testing.T) {
+	h := setupHandler(t)
+	process(t, h, targetReceipt)
+
+	query := url.Values{"query": {`query Points($retailer: String) { receipts(retailer: $retailer) { points } }`}}
+	query.Set("variables", `{"retailer": "Target"}`)
+
+	var data struct {
+		Receipts []struct {
+			Points int `json:"points"`
+		} `json:"receipts"`
+	}
+	code, resp := serve(t, h, httptest.NewRequest(http.MethodGet, "/graphql?"+query.Encode(), nil), &data)
+	if code != http.StatusOK || len(resp.Errors) > 0 || len(data.Receipts) != 1 {
+		t.Errorf("Expected one receipt, got %d: %+v", code, resp.Errors)
+	}
+
+	mutation := url.Values{"query": {`mutation { processReceipt(receipt: {retailer: "", purchaseDate: "", purchaseTime: "", items: [], total: ""}) { id } }`}}
+	code, _ = serve(t, h, httptest.NewRequest(http.MethodGet, "/graphql?"+mutation.Encode(), nil), nil)
+	if code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status code %d for a mutation over GET, got %d", http.StatusMethodNotAllowed, code)
+	}
+}
@@ -0,0 +1,122 @@
+package graphqlapi
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// listSizes estimates how many elements list fields without a limit
+// argument return, so that selections below them are costed per element
+var listSizes = map[string]int{
+	"receipts":  defaultPageSize,
+	"items":     10,
+	"breakdown": 10,
+	"rules":     10,
+}
+
+// queryCost is the static cost of an operation
+type queryCost struct {
+	depth      int // Deepest nesting of field selections
+	complexity int // Estimated number of resolved fields
+}
+
+// analyze computes the depth and complexity of operation. Every field costs
+// one and the cost of the selections below a list field is multiplied by the
+// number of elements it can return. Introspection fields are free, so tools
+// can always load the schema.
+func analyze(doc *ast.Document, operation *ast.OperationDefinition, variables map[string]any) queryCost {
+	fragments := make(map[string]*ast.FragmentDefinition)
+	for _, def := range doc.Definitions {
+		if fragment, ok := def.(*ast.FragmentDefinition); ok {
+			fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	a := analyzer{fragments: fragments, variables: variables}
+	return a.selectionSet(operation.SelectionSet)
+}
+
+// analyzer walks a validated document, which is guaranteed to have no
+// fragment cycles
+type analyzer struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]any
+}
+
+// selectionSet returns the cost of the fields selected by set, following
+// fragments
+func (a analyzer) selectionSet(set *ast.SelectionSet) queryCost {
+	var cost queryCost
+	if set == nil {
+		return cost
+	}
+
+	for _, selection := range set.Selections {
+		var child queryCost
+		switch s := selection.(type) {
+		case *ast.Field:
+			child = a.field(s)
+		case *ast.InlineFragment:
+			child = a.selectionSet(s.SelectionSet)
+		case *ast.FragmentSpread:
+			if fragment, ok := a.fragments[s.Name.Value]; ok {
+				child = a.selectionSet(fragment.SelectionSet)
+			}
+		}
+		cost.depth = max(cost.depth, child.depth)
+		cost.complexity += child.complexity
+	}
+	return cost
+}
+
+// field returns the cost of a single field and its selections
+func (a analyzer) field(field *ast.Field) queryCost {
+	name := field.Name.Value
+	if strings.HasPrefix(name, "__") {
+		return queryCost{}
+	}
+
+	children := a.selectionSet(field.SelectionSet)
+	return queryCost{
+		depth:      children.depth + 1,
+		complexity: 1 + a.listSize(field)*children.complexity,
+	}
+}
+
+// listSize returns the number of elements field can return, using its limit
+// argument when present
+func (a analyzer) listSize(field *ast.Field) int {
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "limit" {
+			continue
+		}
+		if n, ok := a.intValue(arg.Value); ok && n > 0 {
+			return min(n, maxPageSize)
+		}
+		return maxPageSize
+	}
+
+	if size, ok := listSizes[field.Name.Value]; ok {
+		return size
+	}
+	return 1
+}
+
+// intValue resolves an integer literal or variable
+func (a analyzer) intValue(value ast.Value) (int, bool) {
+	switch v := value.(type) {
+	case *ast.IntValue:
+		n, err := strconv.Atoi(v.Value)
+		return n, err == nil
+	case *ast.Variable:
+		switch n := a.variables[v.Name.Value].(type) {
+		case int:
+			return n, true
+		case float64:
+			return int(n), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,668 @@
+package graphqlapi
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/storage"
+)
+
+const (
+	// defaultPageSize is the number of receipts returned when no limit is given
+	defaultPageSize = 20
+
+	// maxPageSize is the largest number of receipts a single query can return
+	maxPageSize = 100
+)
+
+// itemType is a line item on a receipt
+var itemType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Item",
+	Description: "A line item on a receipt",
+	Fields: graphql.Fields{
+		"shortDescription": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(models.Item).ShortDescription, nil
+			},
+		},
+		"price": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.String),
+			Description: "Price with two decimal places, such as \"6.49\"",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return formatPrice(p.Source.(models.Item).Price), nil
+			},
+		},
+		"quantity": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "Units or weight sold",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				if q := p.Source.(models.Item).Quantity; q != 0 {
+					return q, nil
+				}
+				return nil, nil
+			},
+		},
+		"unitPrice": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Price of one unit before any discount",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return optionalPrice(p.Source.(models.Item).UnitPrice), nil
+			},
+		},
+		"discount": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Amount taken off the line",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return optionalPrice(p.Source.(models.Item).Discount), nil
+			},
+		},
+		"sku": &graphql.Field{
+			Type: graphql.String,
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return optionalString(p.Source.(models.Item).SKU), nil
+			},
+		},
+		"upc": &graphql.Field{
+			Type: graphql.String,
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return optionalString(p.Source.(models.Item).UPC), nil
+			},
+		},
+		"category": &graphql.Field{
+			Type: graphql.String,
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return optionalString(p.Source.(models.Item).Category), nil
+			},
+		},
+	},
+})
+
+// ruleResultType is the points a single rule awarded to a receipt
+var ruleResultType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "RuleResult",
+	Description: "The points a single rule awarded to a receipt",
+	Fields: graphql.Fields{
+		"rule": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(models.RuleResult).Rule, nil
+			},
+		},
+		"points": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Int),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(models.RuleResult).Points, nil
+			},
+		},
+	},
+})
+
+// reconciliationType is how a receipt total failed to add up
+var reconciliationType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Reconciliation",
+	Description: "How a receipt total failed to add up to its items, tax, tip and discounts",
+	Fields: graphql.Fields{
+		"expected": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.String),
+			Description: "Item sum less discounts plus tax and tip",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return formatPrice(p.Source.(*models.Reconciliation).Expected), nil
+			},
+		},
+		"difference": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.String),
+			Description: "Total less the expected total",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return formatPrice(p.Source.(*models.Reconciliation).Difference), nil
+			},
+		},
+		"problems": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(*models.Reconciliation).Problems, nil
+			},
+		},
+	},
+})
+
+// conversionType is the exchange rate a receipt was scored with
+var conversionType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Conversion",
+	Description: "The exchange rate a receipt was converted into the base currency with",
+	Fields: graphql.Fields{
+		"currency": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.String),
+			Description: "ISO 4217 code of the receipt amounts",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(*models.Conversion).Currency, nil
+			},
+		},
+		"base": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.String),
+			Description: "ISO 4217 code of the currency the rules are expressed in",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(*models.Conversion).Base, nil
+			},
+		},
+		"rate": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.Float),
+			Description: "Units of the base currency per unit of the receipt currency",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(*models.Conversion).Rate, nil
+			},
+		},
+		"ratesVersion": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.String),
+			Description: "Version of the exchange-rate table the rate was taken from",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(*models.Conversion).RatesVersion, nil
+			},
+		},
+	},
+})
+
+// receiptType is a processed receipt along with its points
+var receiptType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Receipt",
+	Description: "A processed receipt along with the points it was awarded",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.ID),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(storage.Record).ID, nil
+			},
+		},
+		"retailer": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(storage.Record).Receipt.Retailer, nil
+			},
+		},
+		"purchaseDate": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.String),
+			Description: "Purchase date as YYYY-MM-DD",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(storage.Record).Receipt.PurchaseDate.String(), nil
+			},
+		},
+		"purchaseTime": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.String),
+			Description: "Purchase time as 24-hour HH:MM",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(storage.Record).Receipt.PurchaseTime.String(), nil
+			},
+		},
+		"timeZone": &graphql.Field{
+			Type:        graphql.String,
+			Description: "IANA time zone or UTC offset of the purchase date and time, null for store local time",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				if zone := p.Source.(storage.Record).Receipt.Zone(); zone != "" {
+					return zone, nil
+				}
+				return nil, nil
+			},
+		},
+		"refundOf": &graphql.Field{
+			Type:        graphql.ID,
+			Description: "ID of the receipt refunded, null for purchases",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return optionalString(p.Source.(storage.Record).Receipt.RefundOf), nil
+			},
+		},
+		"accountId": &graphql.Field{
+			Type:        graphql.ID,
+			Description: "ID of the loyalty account the receipt earned points into, null when none was given",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return optionalString(p.Source.(storage.Record).Receipt.AccountID), nil
+			},
+		},
+		"tenant": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Tenant the receipt belongs to, null when none was given",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return optionalString(p.Source.(storage.Record).Receipt.Tenant), nil
+			},
+		},
+		"currency": &graphql.Field{
+			Type:        graphql.String,
+			Description: "ISO 4217 code of the amounts, null for the base currency",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return optionalString(p.Source.(storage.Record).Receipt.Currency), nil
+			},
+		},
+		"refunded": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Amount refunded by later refunds, null when nothing was refunded",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return optionalPrice(p.Source.(storage.Record).Refunded), nil
+			},
+		},
+		"total": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return formatPrice(p.Source.(storage.Record).Receipt.Total), nil
+			},
+		},
+		"subtotal": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Sum of the item prices before receipt discounts",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return optionalPrice(p.Source.(storage.Record).Receipt.Subtotal), nil
+			},
+		},
+		"tax": &graphql.Field{
+			Type: graphql.String,
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return optionalPrice(p.Source.(storage.Record).Receipt.Tax), nil
+			},
+		},
+		"tip": &graphql.Field{
+			Type: graphql.String,
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return optionalPrice(p.Source.(storage.Record).Receipt.Tip), nil
+			},
+		},
+		"discounts": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Amount taken off the whole receipt",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return optionalPrice(p.Source.(storage.Record).Receipt.Discounts), nil
+			},
+		},
+		"items": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(itemType))),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(storage.Record).Receipt.Items, nil
+			},
+		},
+		"reconciliation": &graphql.Field{
+			Type:        reconciliationType,
+			Description: "Why the total did not add up, for fraud review, or null when it did",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				if r := p.Source.(storage.Record).Breakdown.Reconciliation; r != nil {
+					return r, nil
+				}
+				return nil, nil
+			},
+		},
+		"conversion": &graphql.Field{
+			Type:        conversionType,
+			Description: "The exchange rate the receipt was scored with, or null when it names no currency",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				if c := p.Source.(storage.Record).Breakdown.Conversion; c != nil {
+					return c, nil
+				}
+				return nil, nil
+			},
+		},
+		"points": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.Int),
+			Description: "The points held, after any refunds clawed points back",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(storage.Record).Points, nil
+			},
+		},
+		"breakdown": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(ruleResultType))),
+			Description: "The points awarded by every rule, in evaluation order",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(storage.Record).Breakdown.Rules, nil
+			},
+		},
+		"processedAt": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.String),
+			Description: "When the receipt was processed, in RFC 3339 format",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(storage.Record).ProcessedAt.Format(time.RFC3339), nil
+			},
+		},
+	},
+})
+
+// stats summarizes the points awarded to a set of receipts
+type stats struct {
+	Receipts      int         `json:"receipts"`
+	TotalPoints   int         `json:"totalPoints"`
+	AveragePoints float64     `json:"averagePoints"`
+	MinPoints     *int        `json:"minPoints"`
+	MaxPoints     *int        `json:"maxPoints"`
+	Rules         []ruleStats `json:"rules"`
+}
+
+// ruleStats summarizes the points awarded by a single rule
+type ruleStats struct {
+	Rule   string `json:"rule"`
+	Hits   int    `json:"hits"`
+	Points int    `json:"points"`
+}
+
+// ruleStatsType is the aggregate result of a single rule
+var ruleStatsType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "RuleStats",
+	Description: "The points a single rule awarded across receipts",
+	Fields: graphql.Fields{
+		"rule":   &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"hits":   &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Description: "Receipts the rule awarded points to"},
+		"points": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+	},
+})
+
+// statsType is the aggregate points of a set of receipts
+var statsType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Stats",
+	Description: "Aggregate points of the processed receipts",
+	Fields: graphql.Fields{
+		"receipts":      &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"totalPoints":   &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"averagePoints": &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+		"minPoints":     &graphql.Field{Type: graphql.Int, Description: "Null when there are no receipts"},
+		"maxPoints":     &graphql.Field{Type: graphql.Int, Description: "Null when there are no receipts"},
+		"rules":         &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(ruleStatsType)))},
+	},
+})
+
+// itemInputType is a line item submitted for processing
+var itemInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "ItemInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"shortDescription": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"price":            &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"quantity":         &graphql.InputObjectFieldConfig{Type: graphql.Float},
+		"unitPrice":        &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"discount":         &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"sku":              &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"upc":              &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"category":         &graphql.InputObjectFieldConfig{Type: graphql.String},
+	},
+})
+
+// receiptInputType is a receipt submitted for processing, using the same
+// formats as the REST API
+var receiptInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "ReceiptInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"retailer":     &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"purchaseDate": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"purchaseTime": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"timeZone":     &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"refundOf":     &graphql.InputObjectFieldConfig{Type: graphql.ID},
+		"currency":     &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"accountId":    &graphql.InputObjectFieldConfig{Type: graphql.ID},
+		"tenant":       &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"items":        &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(itemInputType)))},
+		"subtotal":     &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"tax":          &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"tip":          &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"discounts":    &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"total":        &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+	},
+})
+
+// newSchema builds the schema with resolvers backed by h
+func newSchema(h *Handler) (graphql.Schema, error) {
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"receipt": &graphql.Field{
+				Type:        receiptType,
+				Description: "A processed receipt by ID, or null when there is none",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: h.resolveReceipt,
+			},
+			"receipts": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(receiptType))),
+				Description: "Processed receipts, oldest first",
+				Args: graphql.FieldConfigArgument{
+					"retailer": &graphql.ArgumentConfig{Type: graphql.String, Description: "Case-insensitive retailer name"},
+					"limit":    &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultPageSize},
+					"offset":   &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+				},
+				Resolve: h.resolveReceipts,
+			},
+			"stats": &graphql.Field{
+				Type:        graphql.NewNonNull(statsType),
+				Description: "Aggregate points of every processed receipt",
+				Args: graphql.FieldConfigArgument{
+					"retailer": &graphql.ArgumentConfig{Type: graphql.String, Description: "Case-insensitive retailer name"},
+				},
+				Resolve: h.resolveStats,
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"processReceipt": &graphql.Field{
+				Type:        graphql.NewNonNull(receiptType),
+				Description: "Validates, scores and stores a receipt",
+				Args: graphql.FieldConfigArgument{
+					"receipt": &graphql.ArgumentConfig{Type: graphql.NewNonNull(receiptInputType)},
+				},
+				Resolve: h.resolveProcessReceipt,
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+// resolveReceipt looks up a single receipt
+func (h *Handler) resolveReceipt(p graphql.ResolveParams) (any, error) {
+	id, _ := p.Args["id"].(string)
+	record, err := h.store.GetReceipt(p.Context, id)
+	if err != nil {
+		if rperrors.IsCode(err, rperrors.ErrReceiptNotFound) {
+			return nil, nil
+		}
+		return nil, h.storageError(p.Context, err, "error retrieving receipt "+id)
+	}
+	return record, nil
+}
+
+// resolveReceipts lists a page of receipts
+func (h *Handler) resolveReceipts(p graphql.ResolveParams) (any, error) {
+	filter := storage.Filter{Retailer: stringArg(p.Args, "retailer")}
+	filter.Limit, _ = p.Args["limit"].(int)
+	filter.Offset, _ = p.Args["offset"].(int)
+	if filter.Limit < 1 || filter.Limit > maxPageSize {
+		return nil, h.fail(p.Context, rperrors.New(rperrors.ErrInvalidRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageSize)))
+	}
+	if filter.Offset < 0 {
+		return nil, h.fail(p.Context, rperrors.New(rperrors.ErrInvalidRequest, "offset must not be negative"))
+	}
+
+	records, err := h.store.ListReceipts(p.Context, filter)
+	if err != nil {
+		return nil, h.storageError(p.Context, err, "error listing receipts")
+	}
+	if records == nil {
+		records = []storage.Record{}
+	}
+	return records, nil
+}
+
+// resolveStats aggregates the points of every matching receipt
+func (h *Handler) resolveStats(p graphql.ResolveParams) (any, error) {
+	records, err := h.store.ListReceipts(p.Context, storage.Filter{Retailer: stringArg(p.Args, "retailer")})
+	if err != nil {
+		return nil, h.storageError(p.Context, err, "error listing receipts")
+	}
+	return aggregate(records), nil
+}
+
+// resolveProcessReceipt validates, scores and stores a receipt
+func (h *Handler) resolveProcessReceipt(p graphql.ResolveParams) (any, error) {
+	ctx := p.Context
+	input, _ := p.Args["receipt"].(map[string]any)
+
+	receipt, err := toModel(input)
+	if err != nil {
+		h.metrics.ObserveValidationFailure(string(rperrors.GetCode(err)))
+		return nil, h.fail(ctx, err)
+	}
+
+	id, _, err := h.processor.Process(ctx, receipt)
+	if err != nil {
+		return nil, h.fail(ctx, err)
+	}
+
+	record, err := h.store.GetReceipt(ctx, id)
+	if err != nil {
+		return nil, h.storageError(ctx, err, "error retrieving receipt "+id)
+	}
+	return record, nil
+}
+
+// storageError logs and converts a failed read from storage
+func (h *Handler) storageError(ctx context.Context, err error, detail string) error {
+	if !rperrors.IsCode(err, rperrors.ErrContextCancelled) {
+		err = rperrors.Wrap(rperrors.ErrInternal, err, detail)
+	}
+	return h.fail(ctx, err)
+}
+
+// aggregate summarizes the points awarded to records
+func aggregate(records []storage.Record) stats {
+	s := stats{Receipts: len(records), Rules: []ruleStats{}}
+	byRule := make(map[string]*ruleStats)
+	for _, record := range records {
+		points := record.Breakdown.Total
+		s.TotalPoints += points
+		if s.MinPoints == nil || points < *s.MinPoints {
+			s.MinPoints = &points
+		}
+		if s.MaxPoints == nil || points > *s.MaxPoints {
+			s.MaxPoints = &points
+		}
+
+		for _, result := range record.Breakdown.Rules {
+			rs, ok := byRule[result.Rule]
+			if !ok {
+				rs = &ruleStats{Rule: result.Rule}
+				byRule[result.Rule] = rs
+			}
+			// Rules that awarded nothing are not counted as hits
+			if result.Points > 0 {
+				rs.Hits++
+				rs.Points += result.Points
+			}
+		}
+	}
+	if len(records) > 0 {
+		s.AveragePoints = float64(s.TotalPoints) / float64(len(records))
+	}
+
+	for _, rs := range byRule {
+		s.Rules = append(s.Rules, *rs)
+	}
+	sort.Slice(s.Rules, func(i, j int) bool { return s.Rules[i].Rule < s.Rules[j].Rule })
+	return s
+}
+
+// toModel converts a ReceiptInput argument into the model used for
+// validation and scoring
+func toModel(input map[string]any) (models.Receipt, error) {
+	total, err := models.ParsePrice(stringArg(input, "total"))
+	if err != nil {
+		return models.Receipt{}, rperrors.Wrap(rperrors.ErrInvalidTotal, err, "invalid total "+stringArg(input, "total"))
+	}
+
+	var amounts [4]models.Price
+	for i, name := range []string{"subtotal", "tax", "tip", "discounts"} {
+		if amounts[i], err = priceArg(input, name); err != nil {
+			return models.Receipt{}, rperrors.Wrap(rperrors.ErrInvalidTotal, err, "invalid "+name+" "+stringArg(input, name))
+		}
+	}
+
+	// Unparsable dates and times are kept for validation to report
+	purchaseDate, _ := models.ParseDate(stringArg(input, "purchaseDate"))
+	purchaseTime, _ := models.ParseTime(stringArg(input, "purchaseTime"))
+	items, _ := input["items"].([]any)
+	receipt := models.Receipt{
+		Retailer:     stringArg(input, "retailer"),
+		PurchaseDate: purchaseDate,
+		PurchaseTime: purchaseTime,
+		TimeZone:     stringArg(input, "timeZone"),
+		RefundOf:     stringArg(input, "refundOf"),
+		Currency:     stringArg(input, "currency"),
+		AccountID:    stringArg(input, "accountId"),
+		Tenant:       stringArg(input, "tenant"),
+		Items:        make([]models.Item, 0, len(items)),
+		Subtotal:     amounts[0],
+		Tax:          amounts[1],
+		Tip:          amounts[2],
+		Discounts:    amounts[3],
+		Total:        total,
+	}
+	for _, v := range items {
+		item, _ := v.(map[string]any)
+		price, err := models.ParsePrice(stringArg(item, "price"))
+		if err != nil {
+			return models.Receipt{}, rperrors.Wrap(rperrors.ErrInvalidItemPrice, err, "invalid item price "+stringArg(item, "price"))
+		}
+		unitPrice, err := priceArg(item, "unitPrice")
+		if err != nil {
+			return models.Receipt{}, rperrors.Wrap(rperrors.ErrInvalidItemPrice, err, "invalid item unit price "+stringArg(item, "unitPrice"))
+		}
+		discount, err := priceArg(item, "discount")
+		if err != nil {
+			return models.Receipt{}, rperrors.Wrap(rperrors.ErrInvalidItemPrice, err, "invalid item discount "+stringArg(item, "discount"))
+		}
+		quantity, _ := item["quantity"].(float64)
+		receipt.Items = append(receipt.Items, models.Item{
+			ShortDescription: stringArg(item, "shortDescription"),
+			Price:            price,
+			Quantity:         quantity,
+			UnitPrice:        unitPrice,
+			Discount:         discount,
+			SKU:              stringArg(item, "sku"),
+			UPC:              stringArg(item, "upc"),
+			Category:         stringArg(item, "category"),
+		})
+	}
+	return receipt, nil
+}
+
+// priceArg parses the optional price argument name, which is zero when unset
+func priceArg(args map[string]any, name string) (models.Price, error) {
+	if s := stringArg(args, name); s != "" {
+		return models.ParsePrice(s)
+	}
+	return 0, nil
+}
+
+// stringArg returns the string argument name, or an empty string when it is unset
+func stringArg(args map[string]any, name string) string {
+	s, _ := args[name].(string)
+	return s
+}
+
+// optionalString returns s, or nil for an unset field when s is empty
+func optionalString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// optionalPrice formats p, or returns nil for an unset field when p is zero
+func optionalPrice(p models.Price) any {
+	if p == 0 {
+		return nil
+	}
+	return formatPrice(p)
+}
+
+// formatPrice formats a price the way the REST API does
+func formatPrice(p models.Price) string {
+	return p.String()
+}
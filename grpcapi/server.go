@@ -0,0 +1,154 @@
+package grpcapi
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	receiptsv1 "github.com/marcelorm/receipt-processor/proto/receipts/v1"
+	"github.com/marcelorm/receipt-processor/requestid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDKey is the metadata key carrying the request ID, matching the
+// X-Request-ID HTTP header
+const requestIDKey = "x-request-id"
+
+// tracer creates the spans recorded by the gRPC layer
+var tracer = otel.Tracer("github.com/marcelorm/receipt-processor/grpcapi")
+
+// NewServer creates a gRPC server serving svc along with the standard health
+// and reflection services. The returned health server reports SERVING until
+// its Shutdown method is called.
+func NewServer(svc *ReceiptService, opts ...grpc.ServerOption) (*grpc.Server, *health.Server) {
+	opts = append([]grpc.ServerOption{grpc.ChainUnaryInterceptor(
+		RequestIDInterceptor(),
+		TracingInterceptor(),
+		LoggingInterceptor(svc.logger),
+	)}, opts...)
+
+	srv := grpc.NewServer(opts...)
+	receiptsv1.RegisterReceiptServiceServer(srv, svc)
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(receiptsv1.ReceiptService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(srv, healthServer)
+
+	reflection.Register(srv)
+
+	return srv, healthServer
+}
+
+// RequestIDInterceptor accepts the client's x-request-id metadata or generates
+// a new ID, stores it in the context and returns it in the response header
+func RequestIDInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		var id string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(requestIDKey); len(values) > 0 {
+				id = values[0]
+			}
+		}
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+
+		ctx = requestid.NewContext(ctx, id)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, id))
+
+		return handler(ctx, req)
+	}
+}
+
+// TracingInterceptor starts a server span for every call, continuing any
+// trace propagated by the client in the traceparent metadata
+func TracingInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+
+		ctx, span := tracer.Start(ctx, info.FullMethod,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("rpc.system", "grpc"),
+				attribute.String("rpc.method", info.FullMethod),
+			))
+		if id := requestid.FromContext(ctx); id != "" {
+			span.SetAttributes(attribute.String("request.id", id))
+		}
+		defer span.End()
+
+		resp, err := handler(ctx, req)
+
+		code := status.Code(err)
+		span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(code)))
+		if code == codes.Internal || code == codes.Unavailable || code == codes.Unknown {
+			span.SetStatus(otelcodes.Error, code.String())
+		}
+		return resp, err
+	}
+}
+
+// LoggingInterceptor logs every call with its status code and latency
+func LoggingInterceptor(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+
+		resp, err := handler(ctx, req)
+
+		code := status.Code(err)
+		callLogger := logger.With(
+			"method", info.FullMethod,
+			"code", code.String(),
+			"latency", time.Since(start).String(),
+		)
+		switch code {
+		case codes.OK:
+			callLogger.InfoContext(ctx, "RPC processed")
+		case codes.Internal, codes.Unavailable, codes.Unknown:
+			callLogger.ErrorContext(ctx, "Server error")
+		default:
+			callLogger.WarnContext(ctx, "Client error")
+		}
+		return resp, err
+	}
+}
+
+// metadataCarrier adapts gRPC metadata for trace context propagation
+type metadataCarrier metadata.MD
+
+// Get returns the first value for key
+func (c metadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Set sets the value for key
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+// Keys lists the metadata keys
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Verify metadataCarrier implements propagation.TextMapCarrier
+var _ propagation.TextMapCarrier = metadataCarrier(nil)
@@ -0,0 +1,201 @@
+// Package grpcapi serves the receipt processor over gRPC, sharing storage and
+// the scoring pipeline with the REST API in package api.
+package grpcapi
+
+import (
+	"context"
+	"log/slog"
+
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/metrics"
+	"github.com/marcelorm/receipt-processor/models"
+	receiptsv1 "github.com/marcelorm/receipt-processor/proto/receipts/v1"
+	"github.com/marcelorm/receipt-processor/services"
+	"github.com/marcelorm/receipt-processor/services/rules"
+	"github.com/marcelorm/receipt-processor/storage"
+)
+
+// ReceiptService implements the receipts.v1.ReceiptService gRPC service
+type ReceiptService struct {
+	receiptsv1.UnimplementedReceiptServiceServer
+
+	store      storage.ReceiptStorage
+	calculator *services.Calculator
+	processor  *services.Processor
+	metrics    *metrics.Metrics
+	logger     *slog.Logger
+}
+
+// ServiceOption configures optional dependencies of a ReceiptService
+type ServiceOption func(*ReceiptService)
+
+// WithCalculator scores receipts with the given calculator instead of the default rules
+func WithCalculator(calculator *services.Calculator) ServiceOption {
+	return func(s *ReceiptService) {
+		s.calculator = calculator
+	}
+}
+
+// WithMetrics records scoring metrics for every processed receipt
+func WithMetrics(m *metrics.Metrics) ServiceOption {
+	return func(s *ReceiptService) {
+		s.metrics = m
+	}
+}
+
+// WithLogger logs through the given logger instead of the default logger
+func WithLogger(logger *slog.Logger) ServiceOption {
+	return func(s *ReceiptService) {
+		s.logger = logger
+	}
+}
+
+// NewReceiptService creates a gRPC receipt service backed by store
+func NewReceiptService(store storage.ReceiptStorage, opts ...ServiceOption) *ReceiptService {
+	s := &ReceiptService{
+		store:  store,
+		logger: slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.calculator == nil {
+		s.calculator = services.NewCalculator(rules.GetAllRules(), s.logger)
+	}
+	s.processor = services.NewProcessor(s.calculator, s.store, s.metrics, s.logger)
+	return s
+}
+
+// ProcessReceipt validates, scores and stores a receipt
+func (s *ReceiptService) ProcessReceipt(ctx context.Context, req *receiptsv1.ProcessReceiptRequest) (*receiptsv1.ProcessReceiptResponse, error) {
+	receipt, err := toModel(req.GetReceipt())
+	if err != nil {
+		s.metrics.ObserveValidationFailure(string(rperrors.GetCode(err)))
+		return nil, s.fail(ctx, err)
+	}
+
+	id, breakdown, err := s.processor.Process(ctx, receipt)
+	if err != nil {
+		return nil, s.fail(ctx, err)
+	}
+
+	return &receiptsv1.ProcessReceiptResponse{
+		Id:        id,
+		Breakdown: toProtoBreakdown(breakdown),
+	}, nil
+}
+
+// GetPoints returns the points awarded to a stored receipt
+func (s *ReceiptService) GetPoints(ctx context.Context, req *receiptsv1.GetPointsRequest) (*receiptsv1.GetPointsResponse, error) {
+	id := req.GetId()
+	if id == "" {
+		return nil, s.fail(ctx, rperrors.New(rperrors.ErrInvalidRequest, "receipt ID is required"))
+	}
+
+	points, err := s.store.GetPoints(ctx, id)
+	if err != nil {
+		if !rperrors.IsCode(err, rperrors.ErrReceiptNotFound) && !rperrors.IsCode(err, rperrors.ErrContextCancelled) {
+			err = rperrors.Wrap(rperrors.ErrInternal, err, "error retrieving points for ID "+id)
+		}
+		return nil, s.fail(ctx, err)
+	}
+
+	return &receiptsv1.GetPointsResponse{Points: int64(points)}, nil
+}
+
+// fail logs err and converts it into a gRPC status error
+func (s *ReceiptService) fail(ctx context.Context, err error) error {
+	if appErr, ok := err.(*rperrors.AppError); ok {
+		appErr.Log(ctx)
+	} else {
+		s.logger.ErrorContext(ctx, "Unexpected non-application error", "error", err)
+	}
+	return Status(ctx, err)
+}
+
+// toModel converts a protobuf receipt into the model used for validation and scoring
+func toModel(r *receiptsv1.Receipt) (models.Receipt, error) {
+	if r == nil {
+		return models.Receipt{}, rperrors.New(rperrors.ErrInvalidReceiptData, "receipt is required")
+	}
+
+	total, err := models.ParsePrice(r.GetTotal())
+	if err != nil {
+		return models.Receipt{}, rperrors.Wrap(rperrors.ErrInvalidTotal, err, "invalid total "+r.GetTotal())
+	}
+
+	// Unparsable dates and times are kept for validation to report
+	purchaseDate, _ := models.ParseDate(r.GetPurchaseDate())
+	purchaseTime, _ := models.ParseTime(r.GetPurchaseTime())
+	receipt := models.Receipt{
+		Retailer:     r.GetRetailer(),
+		PurchaseDate: purchaseDate,
+		PurchaseTime: purchaseTime,
+		TimeZone:     r.GetTimeZone(),
+		RefundOf:     r.GetRefundOf(),
+		Currency:     r.GetCurrency(),
+		AccountID:    r.GetAccountId(),
+		Tenant:       r.GetTenant(),
+		Items:        make([]models.Item, 0, len(r.GetItems())),
+		Total:        total,
+	}
+	for _, amount := range []struct {
+		name  string
+		value string
+		dst   *models.Price
+	}{
+		{"subtotal", r.GetSubtotal(), &receipt.Subtotal},
+		{"tax", r.GetTax(), &receipt.Tax},
+		{"tip", r.GetTip(), &receipt.Tip},
+		{"discounts", r.GetDiscounts(), &receipt.Discounts},
+	} {
+		if *amount.dst, err = optionalPrice(amount.value); err != nil {
+			return models.Receipt{}, rperrors.Wrap(rperrors.ErrInvalidTotal, err, "invalid "+amount.name+" "+amount.value)
+		}
+	}
+	for _, item := range r.GetItems() {
+		price, err := models.ParsePrice(item.GetPrice())
+		if err != nil {
+			return models.Receipt{}, rperrors.Wrap(rperrors.ErrInvalidItemPrice, err, "invalid item price "+item.GetPrice())
+		}
+		unitPrice, err := optionalPrice(item.GetUnitPrice())
+		if err != nil {
+			return models.Receipt{}, rperrors.Wrap(rperrors.ErrInvalidItemPrice, err, "invalid item unit price "+item.GetUnitPrice())
+		}
+		discount, err := optionalPrice(item.GetDiscount())
+		if err != nil {
+			return models.Receipt{}, rperrors.Wrap(rperrors.ErrInvalidItemPrice, err, "invalid item discount "+item.GetDiscount())
+		}
+		receipt.Items = append(receipt.Items, models.Item{
+			ShortDescription: item.GetShortDescription(),
+			Price:            price,
+			Quantity:         item.GetQuantity(),
+			UnitPrice:        unitPrice,
+			Discount:         discount,
+			SKU:              item.GetSku(),
+			UPC:              item.GetUpc(),
+			Category:         item.GetCategory(),
+		})
+	}
+	return receipt, nil
+}
+
+// optionalPrice parses an optional amount, which is zero when empty
+func optionalPrice(s string) (models.Price, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return models.ParsePrice(s)
+}
+
+// toProtoBreakdown converts a points breakdown into its protobuf form
+func toProtoBreakdown(b models.PointsBreakdown) *receiptsv1.PointsBreakdown {
+	pb := &receiptsv1.PointsBreakdown{
+		Total: int64(b.Total),
+		Rules: make([]*receiptsv1.RuleResult, len(b.Rules)),
+	}
+	for i, r := range b.Rules {
+		pb.Rules[i] = &receiptsv1.RuleResult{Rule: r.Rule, Points: int64(r.Points)}
+	}
+	return pb
+}
@@ -0,0 +1,367 @@
+package grpcapi
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/metrics"
+	"github.com/marcelorm/receipt-processor/models"
+	receiptsv1 "github.com/marcelorm/receipt-processor/proto/receipts/v1"
+	"github.com/marcelorm/receipt-processor/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func init() {
+	// Configure minimal logging for tests
+	handler := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError, // Only log errors during tests
+	})
+	slog.SetDefault(slog.New(handler))
+}
+
+// targetReceipt is the Target example receipt, worth 28 points
+func targetReceipt() *receiptsv1.Receipt {
+	return &receiptsv1.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items: []*receiptsv1.Item{
+			{ShortDescription: "Mountain Dew 12PK", Price: "6.49"},
+			{ShortDescription: "Emils Cheese Pizza", Price: "12.25"},
+			{ShortDescription: "Knorr Creamy Chicken", Price: "1.26"},
+			{ShortDescription: "Doritos Nacho Cheese", Price: "3.35"},
+			{ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: "12.00"},
+		},
+		Total: "35.35",
+	}
+}
+
+// setupServer serves svc on an in-process bufconn listener and returns a
+// client connection to it
+func setupServer(t *testing.T, svc *ReceiptService) *grpc.ClientConn {
+	t.Helper()
+
+	lis := bufconn.Listen(1024 * 1024)
+	srv, _ := NewServer(svc)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial bufconn: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestProcessReceiptAndGetPoints(t *testing.T) {
+	m := metrics.New()
+	client := receiptsv1.NewReceiptServiceClient(setupServer(t, NewReceiptService(storage.NewMemoryStorage(), WithMetrics(m))))
+	ctx := context.Background()
+
+	var header metadata.MD
+	resp, err := client.ProcessReceipt(ctx, &receiptsv1.ProcessReceiptRequest{Receipt: targetReceipt()}, grpc.Header(&header))
+	if err != nil {
+		t.Fatalf("ProcessReceipt failed: %v", err)
+	}
+	if resp.GetId() == "" {
+		t.Error("Expected a receipt ID, got empty string")
+	}
+	if resp.GetBreakdown().GetTotal() != 28 {
+		t.Errorf("Expected 28 points, got %d", resp.GetBreakdown().GetTotal())
+	}
+	if len(resp.GetBreakdown().GetRules()) != 7 {
+		t.Errorf("Expected 7 rule results, got %d", len(resp.GetBreakdown().GetRules()))
+	}
+	if len(header.Get(requestIDKey)) != 1 {
+		t.Errorf("Expected a request ID in the response header, got %v", header)
+	}
+
+	points, err := client.GetPoints(ctx, &receiptsv1.GetPointsRequest{Id: resp.GetId()})
+	if err != nil {
+		t.Fatalf("GetPoints failed: %v", err)
+	}
+	if points.GetPoints() != 28 {
+		t.Errorf("Expected 28 points, got %d", points.GetPoints())
+	}
+}
+
+func TestStatusMapping(t *testing.T) {
+	client := receiptsv1.NewReceiptServiceClient(setupServer(t, NewReceiptService(storage.NewMemoryStorage())))
+
+	withReceipt := func(modify func(*receiptsv1.Receipt)) *receiptsv1.ProcessReceiptRequest {
+		r := targetReceipt()
+		modify(r)
+		return &receiptsv1.ProcessReceiptRequest{Receipt: r}
+	}
+
+	tests := []struct {
+		name      string
+		call      func(context.Context) error
+		grpcCode  codes.Code
+		errorCode rperrors.ErrorCode
+	}{
+		{
+			"Missing receipt",
+			func(ctx context.Context) error {
+				_, err := client.ProcessReceipt(ctx, &receiptsv1.ProcessReceiptRequest{})
+				return err
+			},
+			codes.InvalidArgument, rperrors.ErrInvalidReceiptData,
+		},
+		{
+			"Missing retailer",
+			func(ctx context.Context) error {
+				_, err := client.ProcessReceipt(ctx, withReceipt(func(r *receiptsv1.Receipt) { r.Retailer = "" }))
+				return err
+			},
+			codes.InvalidArgument, rperrors.ErrInvalidRetailer,
+		},
+		{
+			"Invalid date",
+			func(ctx context.Context) error {
+				_, err := client.ProcessReceipt(ctx, withReceipt(func(r *receiptsv1.Receipt) { r.PurchaseDate = "01/01/2022" }))
+				return err
+			},
+			codes.InvalidArgument, rperrors.ErrInvalidPurchaseDate,
+		},
+		{
+			"Invalid time zone",
+			func(ctx context.Context) error {
+				_, err := client.ProcessReceipt(ctx, withReceipt(func(r *receiptsv1.Receipt) { r.TimeZone = "Nowhere" }))
+				return err
+			},
+			codes.InvalidArgument, rperrors.ErrInvalidTimeZone,
+		},
+		{
+			"Currency without exchange rates",
+			func(ctx context.Context) error {
+				_, err := client.ProcessReceipt(ctx, withReceipt(func(r *receiptsv1.Receipt) { r.Currency = "EUR" }))
+				return err
+			},
+			codes.InvalidArgument, rperrors.ErrInvalidCurrency,
+		},
+		{
+			"Unknown account",
+			func(ctx context.Context) error {
+				_, err := client.ProcessReceipt(ctx, withReceipt(func(r *receiptsv1.Receipt) { r.AccountId = "non-existent-id" }))
+				return err
+			},
+			codes.InvalidArgument, rperrors.ErrInvalidAccount,
+		},
+		{
+			"Invalid item price",
+			func(ctx context.Context) error {
+				_, err := client.ProcessReceipt(ctx, withReceipt(func(r *receiptsv1.Receipt) { r.Items[0].Price = "six" }))
+				return err
+			},
+			codes.InvalidArgument, rperrors.ErrInvalidItemPrice,
+		},
+		{
+			"Invalid item discount",
+			func(ctx context.Context) error {
+				_, err := client.ProcessReceipt(ctx, withReceipt(func(r *receiptsv1.Receipt) { r.Items[0].Discount = "half" }))
+				return err
+			},
+			codes.InvalidArgument, rperrors.ErrInvalidItemPrice,
+		},
+		{
+			"Invalid tax",
+			func(ctx context.Context) error {
+				_, err := client.ProcessReceipt(ctx, withReceipt(func(r *receiptsv1.Receipt) { r.Tax = "some" }))
+				return err
+			},
+			codes.InvalidArgument, rperrors.ErrInvalidTotal,
+		},
+		{
+			"Invalid total",
+			func(ctx context.Context) error {
+				_, err := client.ProcessReceipt(ctx, withReceipt(func(r *receiptsv1.Receipt) { r.Total = "" }))
+				return err
+			},
+			codes.InvalidArgument, rperrors.ErrInvalidTotal,
+		},
+		{
+			"Receipt not found",
+			func(ctx context.Context) error {
+				_, err := client.GetPoints(ctx, &receiptsv1.GetPointsRequest{Id: "nonexistent-id"})
+				return err
+			},
+			codes.NotFound, rperrors.ErrReceiptNotFound,
+		},
+		{
+			"Missing ID",
+			func(ctx context.Context) error {
+				_, err := client.GetPoints(ctx, &receiptsv1.GetPointsRequest{})
+				return err
+			},
+			codes.InvalidArgument, rperrors.ErrInvalidRequest,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.call(context.Background())
+			if got := status.Code(err); got != tc.grpcCode {
+				t.Errorf("Expected status code %s, got %s", tc.grpcCode, got)
+			}
+			if got := ErrorCode(err); got != tc.errorCode {
+				t.Errorf("Expected error code %s, got %s", tc.errorCode, got)
+			}
+		})
+	}
+}
+
+func TestToModel(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*receiptsv1.Receipt)
+		check  func(models.Receipt) bool
+	}{
+		{
+			"Tenant",
+			func(r *receiptsv1.Receipt) { r.Tenant = "acme" },
+			func(m models.Receipt) bool { return m.Tenant == "acme" },
+		},
+		{
+			"Time zone",
+			func(r *receiptsv1.Receipt) { r.TimeZone = "America/Chicago" },
+			func(m models.Receipt) bool { return m.TimeZone == "America/Chicago" },
+		},
+		{
+			"Refund",
+			func(r *receiptsv1.Receipt) { r.RefundOf = "7fb1377b" },
+			func(m models.Receipt) bool { return m.RefundOf == "7fb1377b" },
+		},
+		{
+			"Currency",
+			func(r *receiptsv1.Receipt) { r.Currency = "EUR" },
+			func(m models.Receipt) bool { return m.Currency == "EUR" },
+		},
+		{
+			"Account",
+			func(r *receiptsv1.Receipt) { r.AccountId = "a1" },
+			func(m models.Receipt) bool { return m.AccountID == "a1" },
+		},
+		{
+			"Subtotal, tax and tip",
+			func(r *receiptsv1.Receipt) {
+				r.Subtotal, r.Tax, r.Tip, r.Discounts, r.Total = "35.35", "2.83", "5.00", "1.00", "42.18"
+			},
+			func(m models.Receipt) bool {
+				return m.Subtotal == 35.35 && m.Tax == 2.83 && m.Tip == 5 && m.Discounts == 1 && m.Total == 42.18
+			},
+		},
+		{
+			"Item details",
+			func(r *receiptsv1.Receipt) {
+				r.Items[0] = &receiptsv1.Item{ShortDescription: "Bananas", Price: "1.50", Quantity: 2.5, UnitPrice: "0.80",
+					Discount: "0.50", Sku: "BAN-1", Upc: "012345678905", Category: "Produce"}
+			},
+			func(m models.Receipt) bool {
+				return m.Items[0] == models.Item{ShortDescription: "Bananas", Price: 1.5, Quantity: 2.5, UnitPrice: 0.8,
+					Discount: 0.5, SKU: "BAN-1", UPC: "012345678905", Category: "Produce"}
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := targetReceipt()
+			tc.modify(r)
+			receipt, err := toModel(r)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !tc.check(receipt) {
+				t.Errorf("Expected the field to be converted, got %+v", receipt)
+			}
+		})
+	}
+}
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		code     rperrors.ErrorCode
+		expected codes.Code
+	}{
+		{rperrors.ErrInvalidJSON, codes.InvalidArgument},
+		{rperrors.ErrMissingItems, codes.InvalidArgument},
+		{rperrors.ErrRequestTooLarge, codes.ResourceExhausted},
+		{rperrors.ErrReceiptNotFound, codes.NotFound},
+		{rperrors.ErrContextCancelled, codes.Canceled},
+		{rperrors.ErrStorageFailure, codes.Unavailable},
+		{rperrors.ErrCalculationFailed, codes.Internal},
+		{rperrors.ErrInternal, codes.Internal},
+	}
+
+	for _, tc := range tests {
+		if got := Code(tc.code); got != tc.expected {
+			t.Errorf("Expected %s to map to %s, got %s", tc.code, tc.expected, got)
+		}
+	}
+
+	// Deadlines are reported as DeadlineExceeded rather than Canceled
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	err := Status(ctx, rperrors.Wrap(rperrors.ErrContextCancelled, ctx.Err(), "timed out"))
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("Expected %s, got %s", codes.DeadlineExceeded, status.Code(err))
+	}
+}
+
+func TestHealthAndReflection(t *testing.T) {
+	conn := setupServer(t, NewReceiptService(storage.NewMemoryStorage()))
+	ctx := context.Background()
+
+	for _, service := range []string{"", receiptsv1.ReceiptService_ServiceDesc.ServiceName} {
+		resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			t.Fatalf("Health check for %q failed: %v", service, err)
+		}
+		if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("Expected %q to be SERVING, got %s", service, resp.GetStatus())
+		}
+	}
+
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		t.Fatalf("Failed to open reflection stream: %v", err)
+	}
+	if err := stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	}); err != nil {
+		t.Fatalf("Failed to send reflection request: %v", err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Failed to receive reflection response: %v", err)
+	}
+
+	found := false
+	for _, service := range resp.GetListServicesResponse().GetService() {
+		if service.GetName() == receiptsv1.ReceiptService_ServiceDesc.ServiceName {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected reflection to list %s, got %v", receiptsv1.ReceiptService_ServiceDesc.ServiceName, resp.GetListServicesResponse().GetService())
+	}
+}
@@ -0,0 +1,92 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/requestid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorDomain is the ErrorInfo domain of the error details attached to
+// failed calls
+const ErrorDomain = "receipt-processor"
+
+// Code maps an application error code to the matching gRPC status code
+func Code(code rperrors.ErrorCode) codes.Code {
+	switch code {
+	case rperrors.ErrInvalidJSON,
+		rperrors.ErrInvalidRequest,
+		rperrors.ErrInvalidReceiptData,
+		rperrors.ErrInvalidRetailer,
+		rperrors.ErrInvalidPurchaseDate,
+		rperrors.ErrInvalidPurchaseTime,
+		rperrors.ErrInvalidTimeZone,
+		rperrors.ErrInvalidRefund,
+		rperrors.ErrInvalidCurrency,
+		rperrors.ErrInvalidAccount,
+		rperrors.ErrInvalidLedgerEntry,
+		rperrors.ErrInvalidTotal,
+		rperrors.ErrMissingItems,
+		rperrors.ErrInvalidItemData,
+		rperrors.ErrInvalidItemDescription,
+		rperrors.ErrInvalidItemPrice:
+		return codes.InvalidArgument
+	case rperrors.ErrRequestTooLarge:
+		return codes.ResourceExhausted
+	case rperrors.ErrReceiptNotFound, rperrors.ErrAccountNotFound:
+		return codes.NotFound
+	case rperrors.ErrContextCancelled:
+		return codes.Canceled
+	case rperrors.ErrStorageFailure:
+		return codes.Unavailable
+	default:
+		return codes.Internal
+	}
+}
+
+// Status converts err into a gRPC status error. The application error code
+// and request ID are attached as an ErrorInfo detail, with the code as its
+// reason, so clients can recover the code with ErrorCode.
+func Status(ctx context.Context, err error) error {
+	code := rperrors.ErrInternal
+	message := "An unexpected error occurred"
+	if appErr, ok := err.(*rperrors.AppError); ok {
+		code = appErr.Code
+		message = appErr.Message
+	}
+
+	grpcCode := Code(code)
+	if grpcCode == codes.Canceled && errors.Is(err, context.DeadlineExceeded) {
+		grpcCode = codes.DeadlineExceeded
+	}
+
+	info := &errdetails.ErrorInfo{Domain: ErrorDomain, Reason: string(code)}
+	if id := requestid.FromContext(ctx); id != "" {
+		info.Metadata = map[string]string{"requestId": id}
+	}
+
+	st, detailErr := status.New(grpcCode, message).WithDetails(info)
+	if detailErr != nil {
+		return status.Error(grpcCode, message)
+	}
+	return st.Err()
+}
+
+// ErrorCode returns the application error code attached to a status error
+// returned by the service, or an empty code when there is none
+func ErrorCode(err error) rperrors.ErrorCode {
+	st, ok := status.FromError(err)
+	if !ok {
+		return ""
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.GetDomain() == ErrorDomain {
+			return rperrors.ErrorCode(info.GetReason())
+		}
+	}
+	return ""
+}
@@ -0,0 +1,216 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Status values reported by the health endpoints
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// DefaultTimeout bounds a check registered without its own timeout
+const DefaultTimeout = 2 * time.Second
+
+// Check reports whether a dependency is healthy. A nil error means healthy.
+type Check func(ctx context.Context) error
+
+// registeredCheck is a named check with its timeout
+type registeredCheck struct {
+	name    string
+	check   Check
+	timeout time.Duration
+}
+
+// CheckResult is the outcome of a single readiness check
+type CheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Report is the JSON body returned by the readiness endpoint
+type Report struct {
+	Status string                 `json:"status"`
+	Reason string                 `json:"reason,omitempty"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Checker runs the registered readiness checks
+type Checker struct {
+	mu           sync.RWMutex
+	checks       []registeredCheck
+	shuttingDown atomic.Bool
+}
+
+// NewChecker creates a checker with no registered checks
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// Register adds a readiness check. A timeout of zero uses DefaultTimeout.
+func (c *Checker) Register(name string, timeout time.Duration, check Check) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, registeredCheck{name: name, check: check, timeout: timeout})
+}
+
+// Shutdown marks the service as shutting down so that it reports unready
+// while in-flight requests drain
+func (c *Checker) Shutdown() {
+	c.shuttingDown.Store(true)
+}
+
+// Ready runs every check concurrently, each bounded by its own timeout, and
+// reports the overall readiness of the service
+func (c *Checker) Ready(ctx context.Context) Report {
+	if c.shuttingDown.Load() {
+		return Report{Status: StatusUnavailable, Reason: "shutting down"}
+	}
+
+	c.mu.RLock()
+	checks := make([]registeredCheck, len(c.checks))
+	copy(checks, c.checks)
+	c.mu.RUnlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, rc := range checks {
+		wg.Add(1)
+		go func(i int, rc registeredCheck) {
+			defer wg.Done()
+			results[i] = run(ctx, rc)
+		}(i, rc)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(checks))}
+	for i, rc := range checks {
+		report.Checks[rc.name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusUnavailable
+		}
+	}
+	return report
+}
+
+// Names returns the names of the registered checks in sorted order
+func (c *Checker) Names() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	names := make([]string, 0, len(c.checks))
+	for _, rc := range c.checks {
+		names = append(names, rc.name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// run executes a single check, treating a timeout or panic as a failure
+func run(ctx context.Context, rc registeredCheck) (result CheckResult) {
+	ctx, cancel := context.WithTimeout(ctx, rc.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("check panicked: %v", r)
+			}
+		}()
+		done <- rc.check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %s", rc.timeout)
+	}
+
+	result = CheckResult{Status: StatusOK, Duration: time.Since(start).String()}
+	if err != nil {
+		result.Status = StatusUnavailable
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// LivenessHandler reports that the process is up and serving requests
+func LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, Report{Status: StatusOK})
+	})
+}
+
+// ReadinessHandler runs the readiness checks and responds with 200 when all
+// of them pass and 503 otherwise, with the result of every check in the body
+func (c *Checker) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Ready(r.Context())
+		status := http.StatusOK
+		if report.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, report)
+	})
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// Probe requests url and returns an error unless it responds with 200 OK.
+// It is used by the -health-check flag to probe a running server.
+func Probe(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var report Report
+		if err := json.NewDecoder(resp.Body).Decode(&report); err == nil {
+			if report.Reason != "" {
+				return fmt.Errorf("%s returned %d: %s", url, resp.StatusCode, report.Reason)
+			}
+			var failed []string
+			for name, result := range report.Checks {
+				if result.Status != StatusOK {
+					failed = append(failed, name+": "+result.Error)
+				}
+			}
+			if len(failed) > 0 {
+				sort.Strings(failed)
+				return fmt.Errorf("%s returned %d: %s", url, resp.StatusCode, strings.Join(failed, "; "))
+			}
+		}
+		return fmt.Errorf("%s returned %d", url, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadiness(t *testing.T) {
+	checker := NewChecker()
+	checker.Register("storage", 0, func(ctx context.Context) error { return nil })
+	checker.Register("rules", 0, func(ctx context.Context) error { return nil })
+
+	report := checker.Ready(context.Background())
+	if report.Status != StatusOK {
+		t.Errorf("Expected status %s, got %s", StatusOK, report.Status)
+	}
+	if len(report.Checks) != 2 {
+		t.Errorf("Expected 2 check results, got %d", len(report.Checks))
+	}
+
+	if names := checker.Names(); len(names) != 2 || names[0] != "rules" || names[1] != "storage" {
+		t.Errorf("Expected sorted check names [rules storage], got %v", names)
+	}
+}
+
+func TestReadinessFailures(t *testing.T) {
+	tests := []struct {
+		name  string
+		check Check
+		error string
+	}{
+		{
+			name:  "Error",
+			check: func(ctx context.Context) error { return errors.New("storage unreachable") },
+			error: "storage unreachable",
+		},
+		{
+			name: "Timeout",
+			check: func(ctx context.Context) error {
+				time.Sleep(time.Second)
+				return nil
+			},
+			error: "timed out after 20ms",
+		},
+		{
+			name:  "Panic",
+			check: func(ctx context.Context) error { panic("boom") },
+			error: "check panicked: boom",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			checker := NewChecker()
+			checker.Register("healthy", 0, func(ctx context.Context) error { return nil })
+			checker.Register("failing", 20*time.Millisecond, tc.check)
+
+			report := checker.Ready(context.Background())
+			if report.Status != StatusUnavailable {
+				t.Errorf("Expected status %s, got %s", StatusUnavailable, report.Status)
+			}
+			if report.Checks["healthy"].Status != StatusOK {
+				t.Errorf("Expected healthy check to pass, got %+v", report.Checks["healthy"])
+			}
+			if got := report.Checks["failing"].Error; got != tc.error {
+				t.Errorf("Expected error %q, got %q", tc.error, got)
+			}
+		})
+	}
+}
+
+func TestReadinessHandler(t *testing.T) {
+	checker := NewChecker()
+	checker.Register("storage", 0, func(ctx context.Context) error { return nil })
+	checker.Register("queue", 0, func(ctx context.Context) error { return errors.New("queue saturated") })
+
+	resp := httptest.NewRecorder()
+	checker.ReadinessHandler().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d, got %d", http.StatusServiceUnavailable, resp.Code)
+	}
+
+	var report Report
+	if err := json.Unmarshal(resp.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to unmarshal report: %v", err)
+	}
+	if report.Checks["queue"].Error != "queue saturated" {
+		t.Errorf("Expected per-check error in body, got %+v", report.Checks)
+	}
+	if report.Checks["storage"].Status != StatusOK {
+		t.Errorf("Expected storage check to pass, got %+v", report.Checks["storage"])
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	checker := NewChecker()
+	checker.Register("storage", 0, func(ctx context.Context) error { return nil })
+
+	checker.Shutdown()
+
+	resp := httptest.NewRecorder()
+	checker.ReadinessHandler().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d during shutdown, got %d", http.StatusServiceUnavailable, resp.Code)
+	}
+	if !strings.Contains(resp.Body.String(), "shutting down") {
+		t.Errorf("Expected shutdown reason in body, got %s", resp.Body.String())
+	}
+
+	// Liveness is unaffected by shutdown
+	resp = httptest.NewRecorder()
+	LivenessHandler().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	if resp.Code != http.StatusOK {
+		t.Errorf("Expected liveness status code %d, got %d", http.StatusOK, resp.Code)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	ready := NewChecker()
+	failing := NewChecker()
+	failing.Register("storage", 0, func(ctx context.Context) error { return errors.New("unreachable") })
+
+	readyServer := httptest.NewServer(ready.ReadinessHandler())
+	defer readyServer.Close()
+	failingServer := httptest.NewServer(failing.ReadinessHandler())
+	defer failingServer.Close()
+
+	ctx := context.Background()
+
+	if err := Probe(ctx, readyServer.URL); err != nil {
+		t.Errorf("Expected probe of ready server to pass, got %v", err)
+	}
+
+	err := Probe(ctx, failingServer.URL)
+	if err == nil || !strings.Contains(err.Error(), "storage: unreachable") {
+		t.Errorf("Expected probe to report the failing check, got %v", err)
+	}
+
+	// Nothing listening
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	if err := Probe(ctx, closed.URL); err == nil {
+		t.Error("Expected probe of a stopped server to fail, got nil")
+	}
+}
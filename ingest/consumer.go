@@ -0,0 +1,221 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/metrics"
+	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/requestid"
+	"github.com/marcelorm/receipt-processor/services"
+	"github.com/marcelorm/receipt-processor/services/rules"
+	"github.com/marcelorm/receipt-processor/storage"
+)
+
+// Defaults used when the corresponding option is not given
+const (
+	DefaultWorkers        = 4
+	DefaultInitialBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff     = 30 * time.Second
+)
+
+// Outcomes recorded for every handled message
+const (
+	outcomeAcked        = "acked"
+	outcomeRetried      = "retried"
+	outcomeDeadLettered = "dead_lettered"
+)
+
+// Consumer scores and stores the receipts received from a Source
+type Consumer struct {
+	source         Source
+	calculator     *services.Calculator
+	processor      *services.Processor
+	metrics        *metrics.Metrics
+	logger         *slog.Logger
+	workers        int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+// Option configures a Consumer
+type Option func(*Consumer)
+
+// WithCalculator scores receipts with the given calculator instead of the default rules
+func WithCalculator(calculator *services.Calculator) Option {
+	return func(c *Consumer) {
+		c.calculator = calculator
+	}
+}
+
+// WithMetrics records scoring and consumer metrics for every message
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(c *Consumer) {
+		c.metrics = m
+	}
+}
+
+// WithLogger logs through the given logger instead of the default logger
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Consumer) {
+		c.logger = logger
+	}
+}
+
+// WithWorkers processes up to n messages concurrently
+func WithWorkers(n int) Option {
+	return func(c *Consumer) {
+		c.workers = n
+	}
+}
+
+// WithBackoff pauses a worker for initial after a message is returned to the
+// source or receiving fails, doubling the pause after every further failure
+// up to max
+func WithBackoff(initial, max time.Duration) Option {
+	return func(c *Consumer) {
+		c.initialBackoff = initial
+		c.maxBackoff = max
+	}
+}
+
+// NewConsumer creates a consumer storing the receipts received from source in store
+func NewConsumer(source Source, store storage.ReceiptStorage, opts ...Option) *Consumer {
+	c := &Consumer{
+		source:         source,
+		logger:         slog.Default(),
+		workers:        DefaultWorkers,
+		initialBackoff: DefaultInitialBackoff,
+		maxBackoff:     DefaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.workers = max(c.workers, 1)
+	if c.calculator == nil {
+		c.calculator = services.NewCalculator(rules.GetAllRules(), c.logger)
+	}
+	c.processor = services.NewProcessor(c.calculator, store, c.metrics, c.logger.With("source", source.Name()))
+	return c
+}
+
+// Run consumes messages until ctx is done. Messages already being processed
+// are settled before Run returns.
+func (c *Consumer) Run(ctx context.Context) {
+	c.logger.Info("Starting receipt consumer", "source", c.source.Name(), "workers", c.workers)
+
+	var workers sync.WaitGroup
+	for i := 0; i < c.workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			c.work(ctx)
+		}()
+	}
+	workers.Wait()
+
+	c.logger.Info("Receipt consumer stopped", "source", c.source.Name())
+}
+
+// work receives and handles messages until ctx is done, backing off while
+// the source or storage is failing
+func (c *Consumer) work(ctx context.Context) {
+	failures := 0
+	for {
+		msg, err := c.source.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			c.logger.Error("Failed to receive message", "source", c.source.Name(), "error", err)
+		} else if c.handle(ctx, msg) {
+			failures = 0
+			continue
+		}
+
+		failures++
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.backoff(failures)):
+		}
+	}
+}
+
+// handle processes a message and settles it with the source. It reports
+// false when the message was returned to the source to be retried.
+func (c *Consumer) handle(ctx context.Context, msg Message) bool {
+	// A message being processed is settled even when the consumer stops
+	ctx = requestid.NewContext(context.WithoutCancel(ctx), requestid.New())
+	source := c.source.Name()
+
+	id, err := c.process(ctx, msg.Data())
+	if err == nil {
+		if err := msg.Ack(ctx); err != nil {
+			// The receipt is stored; the message may be delivered again
+			c.logger.ErrorContext(ctx, "Failed to acknowledge message",
+				"source", source, "message_id", msg.ID(), "id", id, "error", err)
+		}
+		c.metrics.ObserveConsumedMessage(source, outcomeAcked)
+		return true
+	}
+
+	if retryable(err) {
+		c.logger.WarnContext(ctx, "Failed to process message; returning it to the source",
+			"source", source, "message_id", msg.ID(), "code", rperrors.GetCode(err), "error", err)
+		if err := msg.Nack(ctx); err != nil {
+			c.logger.ErrorContext(ctx, "Failed to return message", "source", source, "message_id", msg.ID(), "error", err)
+		}
+		c.metrics.ObserveConsumedMessage(source, outcomeRetried)
+		return false
+	}
+
+	c.logger.WarnContext(ctx, "Dead-lettering message",
+		"source", source, "message_id", msg.ID(), "code", rperrors.GetCode(err), "error", err)
+	if err := msg.DeadLetter(ctx, err); err != nil {
+		c.logger.ErrorContext(ctx, "Failed to dead-letter message", "source", source, "message_id", msg.ID(), "error", err)
+		if err := msg.Nack(ctx); err != nil {
+			c.logger.ErrorContext(ctx, "Failed to return message", "source", source, "message_id", msg.ID(), "error", err)
+		}
+		c.metrics.ObserveConsumedMessage(source, outcomeRetried)
+		return false
+	}
+	c.metrics.ObserveConsumedMessage(source, outcomeDeadLettered)
+	return true
+}
+
+// retryable reports whether processing may succeed when the message is
+// received again. Anything else is a problem with the message itself.
+func retryable(err error) bool {
+	return rperrors.IsCode(err, rperrors.ErrStorageFailure) || rperrors.IsCode(err, rperrors.ErrContextCancelled)
+}
+
+// process decodes, validates, scores and stores a receipt and returns its ID
+func (c *Consumer) process(ctx context.Context, data []byte) (string, error) {
+	var receipt models.Receipt
+	if err := json.Unmarshal(data, &receipt); err != nil {
+		c.metrics.ObserveValidationFailure(string(rperrors.ErrInvalidJSON))
+		return "", rperrors.Wrap(rperrors.ErrInvalidJSON, err, "invalid receipt JSON")
+	}
+	id, _, err := c.processor.Process(ctx, receipt)
+	return id, err
+}
+
+// backoff returns the pause after failures consecutive failures, doubling
+// from the initial backoff up to the maximum with jitter
+func (c *Consumer) backoff(failures int) time.Duration {
+	wait := c.initialBackoff
+	for i := 1; i < failures && wait < c.maxBackoff; i++ {
+		wait *= 2
+	}
+	wait = min(wait, c.maxBackoff)
+	if wait < 2 {
+		return wait
+	}
+	return wait/2 + rand.N(wait/2)
+}
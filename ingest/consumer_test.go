@@ -0,0 +1,240 @@
+package ingest
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/storage"
+)
+
+// targetReceipt is the Target example receipt, worth 28 points
+const targetReceipt = `{
+	"retailer": "Target",
+	"purchaseDate": "2022-01-01",
+	"purchaseTime": "13:01",
+	"items": [
+		{"shortDescription": "Mountain Dew 12PK", "price": "6.49"},
+		{"shortDescription": "Emils Cheese Pizza", "price": "12.25"},
+		{"shortDescription": "Knorr Creamy Chicken", "price": "1.26"},
+		{"shortDescription": "Doritos Nacho Cheese", "price": "3.35"},
+		{"shortDescription": "   Klarbrunn 12-PK 12 FL OZ  ", "price": "12.00"}
+	],
+	"total": "35.35"
+}`
+
+// flakyStorage fails the first failures saves
+type flakyStorage struct {
+	storage.ReceiptStorage
+
+	mu       sync.Mutex
+	failures int
+}
+
+func (s *flakyStorage) SaveReceipt(ctx context.Context, receipt models.Receipt, breakdown models.PointsBreakdown) (string, error) {
+	s.mu.Lock()
+	fail := s.failures > 0
+	s.failures--
+	s.mu.Unlock()
+	if fail {
+		return "", rperrors.New(rperrors.ErrStorageFailure, "storage unavailable")
+	}
+	return s.ReceiptStorage.SaveReceipt(ctx, receipt, breakdown)
+}
+
+// runConsumer consumes from source into store until the test ends
+func runConsumer(t *testing.T, source Source, store storage.ReceiptStorage) {
+	consumer := NewConsumer(source, store,
+		WithBackoff(time.Millisecond, 5*time.Millisecond),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		consumer.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// waitFor waits until condition holds
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// spoolFiles returns the names of the files in a spool subdirectory
+func spoolFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", dir, err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
+func TestConsumerSpool(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		stored   int
+		deadCode rperrors.ErrorCode // Code recorded for a dead-lettered file; empty when stored
+	}{
+		{"Valid receipt", targetReceipt, 1, ""},
+		{"Malformed JSON", `{"retailer": `, 0, rperrors.ErrInvalidJSON},
+		{"Invalid receipt", strings.Replace(targetReceipt, "2022-01-01", "2022-13-01", 1), 0, rperrors.ErrInvalidPurchaseDate},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "receipt.json"), []byte(tc.data), 0o600); err != nil {
+				t.Fatalf("Failed to write receipt: %v", err)
+			}
+			source, err := OpenSpool(dir, WithSpoolPollInterval(time.Millisecond))
+			if err != nil {
+				t.Fatalf("Failed to open spool: %v", err)
+			}
+			store := storage.NewMemoryStorage()
+			runConsumer(t, source, store)
+
+			waitFor(t, "the file to be handled", func() bool {
+				return len(spoolFiles(t, dir)) == 0 && len(spoolFiles(t, filepath.Join(dir, spoolProcessing))) == 0
+			})
+
+			if count, _ := store.Count(context.Background()); count != tc.stored {
+				t.Errorf("Expected %d stored receipts, got %d", tc.stored, count)
+			}
+			dead := spoolFiles(t, filepath.Join(dir, spoolDeadLetter))
+			if tc.deadCode == "" {
+				if len(dead) != 0 {
+					t.Errorf("Expected no dead-lettered files, got %v", dead)
+				}
+				return
+			}
+			if len(dead) != 2 {
+				t.Fatalf("Expected the file and its reason to be dead-lettered, got %v", dead)
+			}
+			reason, _ := os.ReadFile(filepath.Join(dir, spoolDeadLetter, "receipt.json.error"))
+			if !strings.Contains(string(reason), string(tc.deadCode)) {
+				t.Errorf("Expected the reason to contain %s, got %q", tc.deadCode, reason)
+			}
+		})
+	}
+}
+
+func TestConsumerRetriesStorageFailures(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "receipt.json"), []byte(targetReceipt), 0o600); err != nil {
+		t.Fatalf("Failed to write receipt: %v", err)
+	}
+	source, err := OpenSpool(dir, WithSpoolPollInterval(time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to open spool: %v", err)
+	}
+	store := &flakyStorage{ReceiptStorage: storage.NewMemoryStorage(), failures: 3}
+	runConsumer(t, source, store)
+
+	waitFor(t, "the receipt to be stored", func() bool {
+		count, _ := store.Count(context.Background())
+		return count == 1
+	})
+	waitFor(t, "the file to be acknowledged", func() bool {
+		return len(spoolFiles(t, dir)) == 0 && len(spoolFiles(t, filepath.Join(dir, spoolProcessing))) == 0
+	})
+	if dead := spoolFiles(t, filepath.Join(dir, spoolDeadLetter)); len(dead) != 0 {
+		t.Errorf("Expected a storage failure not to dead-letter the file, got %v", dead)
+	}
+}
+
+func TestOpenSpoolRecoversClaimedFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, spoolProcessing), 0o700); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	// A file claimed by a consumer that stopped before acknowledging it
+	if err := os.WriteFile(filepath.Join(dir, spoolProcessing, "a.json"), []byte(targetReceipt), 0o600); err != nil {
+		t.Fatalf("Failed to write receipt: %v", err)
+	}
+	// Files still being written are not received
+	if err := os.WriteFile(filepath.Join(dir, "b.json.tmp"), []byte(targetReceipt), 0o600); err != nil {
+		t.Fatalf("Failed to write receipt: %v", err)
+	}
+
+	source, err := OpenSpool(dir, WithSpoolPollInterval(time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to open spool: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	msg, err := source.Receive(ctx)
+	if err != nil {
+		t.Fatalf("Expected the recovered file, got %v", err)
+	}
+	if msg.ID() != "a.json" || string(msg.Data()) != targetReceipt {
+		t.Errorf("Expected a.json, got %s", msg.ID())
+	}
+	if _, err := source.Receive(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected no further files, got %v", err)
+	}
+
+	// A returned file is received again
+	if err := msg.Nack(ctx); err != nil {
+		t.Fatalf("Failed to return file: %v", err)
+	}
+	if again, err := source.Receive(context.Background()); err != nil || again.ID() != "a.json" {
+		t.Errorf("Expected a.json again, got %v", err)
+	}
+}
+
+func TestSpoolBacklog(t *testing.T) {
+	dir := t.TempDir()
+	source, err := OpenSpool(dir, WithSpoolPollInterval(time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to open spool: %v", err)
+	}
+	for _, name := range []string{"a.json", "b.json", "c.json.tmp", ".d.json"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(targetReceipt), 0o600); err != nil {
+			t.Fatalf("Failed to write receipt: %v", err)
+		}
+	}
+
+	backlog, err := source.Backlog(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to read backlog: %v", err)
+	}
+	if backlog != 2 {
+		t.Errorf("Expected a backlog of 2, got %d", backlog)
+	}
+
+	// Claimed files are no longer waiting
+	if _, err := source.Receive(context.Background()); err != nil {
+		t.Fatalf("Failed to receive: %v", err)
+	}
+	if backlog, _ := source.Backlog(context.Background()); backlog != 1 {
+		t.Errorf("Expected a backlog of 1 after a file is claimed, got %d", backlog)
+	}
+}
@@ -0,0 +1,176 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// DefaultNATSFetchWait is how long a single pull from JetStream waits for a
+// message, bounding how long a stopping consumer waits for Receive to return
+const DefaultNATSFetchWait = time.Second
+
+// Headers added to dead-lettered NATS messages
+const (
+	HeaderDeadLetterReason   = "Receipt-Error"           // Why the receipt could not be processed
+	HeaderDeadLetterSubject  = "Receipt-Source-Subject"  // Subject the receipt was published on
+	HeaderDeadLetterSequence = "Receipt-Source-Sequence" // Stream sequence of the original message
+)
+
+// NATSConfig identifies the JetStream consumer receipts are pulled from
+type NATSConfig struct {
+	URL               string        // Server URL, e.g. nats://localhost:4222
+	Stream            string        // Stream holding the receipts
+	Consumer          string        // Durable pull consumer with explicit acks
+	DeadLetterSubject string        // Subject poison messages are republished on; empty only terminates them
+	FetchWait         time.Duration // Maximum wait per pull; 0 uses DefaultNATSFetchWait
+}
+
+// NATSSource receives receipts from a durable JetStream pull consumer.
+// Messages are acknowledged once stored, negatively acknowledged for
+// redelivery on transient failures, and terminated after being republished
+// to the dead-letter subject when they cannot be processed. The stream and
+// consumer are managed outside the service; messages whose ack wait expires
+// are redelivered by the server.
+type NATSSource struct {
+	conn       *nats.Conn
+	js         jetstream.JetStream
+	consumer   jetstream.Consumer
+	deadLetter string
+	fetchWait  time.Duration
+}
+
+// Verify NATSSource implements Source and Backlogger interfaces
+var (
+	_ Source     = (*NATSSource)(nil)
+	_ Backlogger = (*NATSSource)(nil)
+)
+
+// OpenNATS connects to the server and looks up the configured consumer
+func OpenNATS(ctx context.Context, cfg NATSConfig, opts ...nats.Option) (*NATSSource, error) {
+	opts = append([]nats.Option{nats.Name("receipt-processor")}, opts...)
+	conn, err := nats.Connect(cfg.URL, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to NATS: %w", err)
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("creating JetStream context: %w", err)
+	}
+	consumer, err := js.Consumer(ctx, cfg.Stream, cfg.Consumer)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("looking up consumer %s on stream %s: %w", cfg.Consumer, cfg.Stream, err)
+	}
+
+	s := &NATSSource{
+		conn:       conn,
+		js:         js,
+		consumer:   consumer,
+		deadLetter: cfg.DeadLetterSubject,
+		fetchWait:  cfg.FetchWait,
+	}
+	if s.fetchWait <= 0 {
+		s.fetchWait = DefaultNATSFetchWait
+	}
+	return s, nil
+}
+
+// Name implements Source
+func (s *NATSSource) Name() string {
+	return "nats"
+}
+
+// Receive pulls the next message from the consumer
+func (s *NATSSource) Receive(ctx context.Context) (Message, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		msg, err := s.consumer.Next(jetstream.FetchMaxWait(s.fetchWait))
+		if errors.Is(err, nats.ErrTimeout) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &natsMessage{source: s, msg: msg}, nil
+	}
+}
+
+// Backlog returns the number of messages in the stream not yet delivered to
+// the consumer
+func (s *NATSSource) Backlog(ctx context.Context) (int, error) {
+	info, err := s.consumer.Info(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("looking up consumer: %w", err)
+	}
+	return int(info.NumPending), nil
+}
+
+// Close drains the connection, waiting for pending acknowledgements to be sent
+func (s *NATSSource) Close() error {
+	return s.conn.Drain()
+}
+
+// natsMessage is a message pulled from JetStream
+type natsMessage struct {
+	source *NATSSource
+	msg    jetstream.Msg
+}
+
+// ID returns the stream name and sequence of the message
+func (m *natsMessage) ID() string {
+	meta, err := m.msg.Metadata()
+	if err != nil {
+		return m.msg.Subject()
+	}
+	return meta.Stream + ":" + strconv.FormatUint(meta.Sequence.Stream, 10)
+}
+
+// Data implements Message
+func (m *natsMessage) Data() []byte {
+	return m.msg.Data()
+}
+
+// Ack acknowledges the message
+func (m *natsMessage) Ack(ctx context.Context) error {
+	return m.msg.Ack()
+}
+
+// Nack asks the server to redeliver the message
+func (m *natsMessage) Nack(ctx context.Context) error {
+	return m.msg.Nak()
+}
+
+// DeadLetter republishes the message on the dead-letter subject and
+// terminates it so it is never redelivered. The copy is published with a
+// message ID derived from the original, so JetStream discards duplicates
+// when dead-lettering is retried.
+func (m *natsMessage) DeadLetter(ctx context.Context, reason error) error {
+	if m.source.deadLetter != "" {
+		dead := nats.NewMsg(m.source.deadLetter)
+		for key, values := range m.msg.Headers() {
+			dead.Header[key] = values
+		}
+		dead.Header.Set(HeaderDeadLetterReason, reason.Error())
+		dead.Header.Set(HeaderDeadLetterSubject, m.msg.Subject())
+		var opts []jetstream.PublishOpt
+		if meta, err := m.msg.Metadata(); err == nil {
+			sequence := strconv.FormatUint(meta.Sequence.Stream, 10)
+			dead.Header.Set(HeaderDeadLetterSequence, sequence)
+			opts = append(opts, jetstream.WithMsgID(meta.Stream+"-"+sequence))
+		}
+		dead.Data = m.msg.Data()
+		if _, err := m.source.js.PublishMsg(ctx, dead, opts...); err != nil {
+			return fmt.Errorf("publishing to dead-letter subject %s: %w", m.source.deadLetter, err)
+		}
+	}
+	return m.msg.TermWithReason(reason.Error())
+}
@@ -0,0 +1,390 @@
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marcelorm/receipt-processor/storage"
+)
+
+// jetStreamStub is a local stand-in for a NATS server holding one
+// JetStream stream with one pull consumer. It implements just the parts of
+// the client protocol and JetStream API that NATSSource uses: consumer
+// lookup, pull requests, acknowledgements and publishing with a message ID.
+type jetStreamStub struct {
+	listener net.Listener
+	stream   string
+	consumer string
+
+	mu        sync.Mutex
+	seq       uint64
+	queue     []*stubMsg          // Messages waiting to be delivered, in order
+	inFlight  map[uint64]*stubMsg // Delivered messages awaiting an acknowledgement
+	acks      map[uint64]string   // Final acknowledgement of each message
+	pulls     []*stubPull         // Pull requests waiting for messages
+	published []stubPublished     // Messages published to other streams
+	msgIDs    map[string]bool
+}
+
+// stubMsg is a message in the stub's stream
+type stubMsg struct {
+	seq       uint64
+	data      []byte
+	delivered int
+}
+
+// stubPull is an outstanding pull request
+type stubPull struct {
+	conn      *stubConn
+	inbox     string
+	remaining int
+}
+
+// stubPublished is a message published outside the consumer's stream
+type stubPublished struct {
+	subject string
+	header  map[string]string
+	data    []byte
+}
+
+// stubConn is a client connection to the stub
+type stubConn struct {
+	conn net.Conn
+	wmu  sync.Mutex
+	subs map[string]string // Subject by subscription ID; guarded by jetStreamStub.mu
+}
+
+// write sends a protocol line followed by an optional payload
+func (c *stubConn) write(line string, payload []byte) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	io.WriteString(c.conn, line+"\r\n")
+	if payload != nil {
+		c.conn.Write(payload)
+		io.WriteString(c.conn, "\r\n")
+	}
+}
+
+// newJetStreamStub starts a stub serving stream and consumer
+func newJetStreamStub(t *testing.T, stream, consumer string) *jetStreamStub {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := &jetStreamStub{
+		listener: l,
+		stream:   stream,
+		consumer: consumer,
+		inFlight: make(map[uint64]*stubMsg),
+		acks:     make(map[uint64]string),
+		msgIDs:   make(map[string]bool),
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(&stubConn{conn: conn, subs: make(map[string]string)})
+		}
+	}()
+	t.Cleanup(func() { l.Close() })
+	return s
+}
+
+// URL returns the address clients connect to
+func (s *jetStreamStub) URL() string {
+	return "nats://" + s.listener.Addr().String()
+}
+
+// add appends a message to the stream and returns its sequence
+func (s *jetStreamStub) add(data string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	s.queue = append(s.queue, &stubMsg{seq: s.seq, data: []byte(data)})
+	s.deliver()
+	return s.seq
+}
+
+// ack returns the final acknowledgement of a message, if any
+func (s *jetStreamStub) ack(seq uint64) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.acks[seq]
+}
+
+// deadLetters returns the messages published outside the stream
+func (s *jetStreamStub) deadLetters() []stubPublished {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]stubPublished(nil), s.published...)
+}
+
+// serve reads protocol operations from a client
+func (s *jetStreamStub) serve(c *stubConn) {
+	defer c.conn.Close()
+	c.write(fmt.Sprintf(`INFO {"server_id":"stub","version":"2.10.0","proto":1,"headers":true,"max_payload":1048576,"jetstream":true,"host":"127.0.0.1","port":%d}`,
+		s.listener.Addr().(*net.TCPAddr).Port), nil)
+
+	r := bufio.NewReader(c.conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "PING":
+			c.write("PONG", nil)
+		case "SUB":
+			s.mu.Lock()
+			c.subs[fields[len(fields)-1]] = fields[1]
+			s.mu.Unlock()
+		case "UNSUB":
+			s.mu.Lock()
+			delete(c.subs, fields[1])
+			s.mu.Unlock()
+		case "PUB", "HPUB":
+			// PUB <subject> [reply] <size> or HPUB <subject> [reply] <header size> <size>
+			sizes := 1
+			if fields[0] == "HPUB" {
+				sizes = 2
+			}
+			total, _ := strconv.Atoi(fields[len(fields)-1])
+			headerSize := 0
+			if sizes == 2 {
+				headerSize, _ = strconv.Atoi(fields[len(fields)-2])
+			}
+			reply := ""
+			if len(fields) == 3+sizes {
+				reply = fields[2]
+			}
+			payload := make([]byte, total+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			s.handle(c, fields[1], reply, parseStubHeader(payload[:headerSize]), payload[headerSize:total])
+		}
+	}
+}
+
+// parseStubHeader parses a NATS/1.0 header block
+func parseStubHeader(block []byte) map[string]string {
+	header := make(map[string]string)
+	for _, line := range strings.Split(string(block), "\r\n")[1:] {
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			header[key] = strings.TrimSpace(value)
+		}
+	}
+	return header
+}
+
+// handle responds to a published message
+func (s *jetStreamStub) handle(c *stubConn, subject, reply string, header map[string]string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case subject == "$JS.API.CONSUMER.INFO."+s.stream+"."+s.consumer:
+		info := fmt.Sprintf(`{"type":"io.nats.jetstream.api.v1.consumer_info_response","stream_name":%q,"name":%q,"config":{"durable_name":%q,"ack_policy":"explicit"},"num_pending":%d}`,
+			s.stream, s.consumer, s.consumer, len(s.queue))
+		s.send(c, reply, "", nil, []byte(info))
+	case strings.HasPrefix(subject, "$JS.API.CONSUMER.INFO."):
+		s.send(c, reply, "", nil, []byte(`{"error":{"code":404,"err_code":10014,"description":"consumer not found"}}`))
+	case subject == "$JS.API.CONSUMER.MSG.NEXT."+s.stream+"."+s.consumer:
+		var req struct {
+			Batch   int           `json:"batch"`
+			Expires time.Duration `json:"expires"`
+		}
+		json.Unmarshal(data, &req)
+		pull := &stubPull{conn: c, inbox: reply, remaining: max(req.Batch, 1)}
+		s.pulls = append(s.pulls, pull)
+		if req.Expires > 0 {
+			time.AfterFunc(req.Expires, func() { s.expire(pull) })
+		}
+		s.deliver()
+	case strings.HasPrefix(subject, "$JS.ACK."):
+		seq, _ := strconv.ParseUint(strings.Split(subject, ".")[5], 10, 64)
+		msg := s.inFlight[seq]
+		if msg == nil {
+			return
+		}
+		delete(s.inFlight, seq)
+		if string(data) == "-NAK" {
+			s.queue = append([]*stubMsg{msg}, s.queue...)
+			s.deliver()
+			return
+		}
+		s.acks[seq] = string(data)
+	case reply != "":
+		// A JetStream publish to another stream, deduplicated by message ID
+		if id := header["Nats-Msg-Id"]; id != "" && s.msgIDs[id] {
+			s.send(c, reply, "", nil, []byte(`{"stream":"DEAD","seq":1,"duplicate":true}`))
+			return
+		} else if id != "" {
+			s.msgIDs[id] = true
+		}
+		s.published = append(s.published, stubPublished{subject: subject, header: header, data: data})
+		s.send(c, reply, "", nil, []byte(fmt.Sprintf(`{"stream":"DEAD","seq":%d}`, len(s.published))))
+	}
+}
+
+// deliver hands queued messages to waiting pull requests; s.mu must be held
+func (s *jetStreamStub) deliver() {
+	for len(s.pulls) > 0 && len(s.queue) > 0 {
+		pull, msg := s.pulls[0], s.queue[0]
+		s.queue = s.queue[1:]
+		msg.delivered++
+		s.inFlight[msg.seq] = msg
+
+		ackSubject := fmt.Sprintf("$JS.ACK.%s.%s.%d.%d.%d.%d.%d",
+			s.stream, s.consumer, msg.delivered, msg.seq, msg.seq, time.Now().UnixNano(), len(s.queue))
+		s.send(pull.conn, pull.inbox, ackSubject, nil, msg.data)
+
+		pull.remaining--
+		if pull.remaining == 0 {
+			s.pulls = s.pulls[1:]
+		}
+	}
+}
+
+// expire ends a pull request that is still waiting with a timeout status
+func (s *jetStreamStub) expire(pull *stubPull) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, p := range s.pulls {
+		if p == pull {
+			s.pulls = append(s.pulls[:i], s.pulls[i+1:]...)
+			s.send(pull.conn, pull.inbox, "", []byte("NATS/1.0 408 Request Timeout\r\n\r\n"), nil)
+			return
+		}
+	}
+}
+
+// send delivers a message to the client's subscription matching subject;
+// s.mu must be held
+func (s *jetStreamStub) send(c *stubConn, subject, reply string, header, data []byte) {
+	for sid, pattern := range c.subs {
+		if !matchSubject(pattern, subject) {
+			continue
+		}
+		prefix := subject + " " + sid
+		if reply != "" {
+			prefix += " " + reply
+		}
+		payload := append(append([]byte(nil), header...), data...)
+		if header == nil {
+			c.write(fmt.Sprintf("MSG %s %d", prefix, len(payload)), payload)
+		} else {
+			c.write(fmt.Sprintf("HMSG %s %d %d", prefix, len(header), len(payload)), payload)
+		}
+		return
+	}
+}
+
+// matchSubject reports whether subject matches a subscription pattern with
+// * and > wildcards
+func matchSubject(pattern, subject string) bool {
+	patternTokens, subjectTokens := strings.Split(pattern, "."), strings.Split(subject, ".")
+	for i, token := range patternTokens {
+		if token == ">" {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) || (token != "*" && token != subjectTokens[i]) {
+			return false
+		}
+	}
+	return len(patternTokens) == len(subjectTokens)
+}
+
+func TestOpenNATSUnknownConsumer(t *testing.T) {
+	stub := newJetStreamStub(t, "RECEIPTS", "processor")
+	_, err := OpenNATS(context.Background(), NATSConfig{URL: stub.URL(), Stream: "RECEIPTS", Consumer: "other"})
+	if err == nil {
+		t.Fatal("Expected an error for an unknown consumer")
+	}
+}
+
+func TestConsumerNATS(t *testing.T) {
+	stub := newJetStreamStub(t, "RECEIPTS", "processor")
+	source, err := OpenNATS(context.Background(), NATSConfig{
+		URL:               stub.URL(),
+		Stream:            "RECEIPTS",
+		Consumer:          "processor",
+		DeadLetterSubject: "receipts.dead",
+		FetchWait:         50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to open NATS source: %v", err)
+	}
+	// Registered before the consumer so the connection outlives it
+	t.Cleanup(func() { source.Close() })
+
+	store := &flakyStorage{ReceiptStorage: storage.NewMemoryStorage(), failures: 1}
+	runConsumer(t, source, store)
+
+	valid := stub.add(targetReceipt)
+	poison := stub.add(`{"retailer": `)
+
+	waitFor(t, "both messages to be settled", func() bool {
+		return stub.ack(valid) != "" && stub.ack(poison) != ""
+	})
+
+	// The valid receipt is stored after being redelivered once
+	if got := stub.ack(valid); got != "+ACK" {
+		t.Errorf("Expected the valid receipt to be acknowledged, got %q", got)
+	}
+	if count, _ := store.Count(context.Background()); count != 1 {
+		t.Errorf("Expected 1 stored receipt, got %d", count)
+	}
+
+	// The poison message is republished with the reason and terminated
+	if got := stub.ack(poison); !strings.HasPrefix(got, "+TERM") || !strings.Contains(got, "RP0002") {
+		t.Errorf("Expected the poison message to be terminated with its reason, got %q", got)
+	}
+	dead := stub.deadLetters()
+	if len(dead) != 1 {
+		t.Fatalf("Expected 1 dead-lettered message, got %d", len(dead))
+	}
+	if dead[0].subject != "receipts.dead" || string(dead[0].data) != `{"retailer": ` {
+		t.Errorf("Expected the original message on receipts.dead, got %+v", dead[0])
+	}
+	if !strings.Contains(dead[0].header[HeaderDeadLetterReason], "RP0002") ||
+		dead[0].header[HeaderDeadLetterSequence] != strconv.FormatUint(poison, 10) ||
+		dead[0].header["Nats-Msg-Id"] == "" {
+		t.Errorf("Unexpected dead-letter headers %v", dead[0].header)
+	}
+}
+
+func TestNATSBacklog(t *testing.T) {
+	stub := newJetStreamStub(t, "RECEIPTS", "processor")
+	source, err := OpenNATS(context.Background(), NATSConfig{URL: stub.URL(), Stream: "RECEIPTS", Consumer: "processor"})
+	if err != nil {
+		t.Fatalf("Failed to open NATS source: %v", err)
+	}
+	defer source.Close()
+
+	stub.add(targetReceipt)
+	stub.add(targetReceipt)
+
+	backlog, err := source.Backlog(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to read backlog: %v", err)
+	}
+	if backlog != 2 {
+		t.Errorf("Expected a backlog of 2, got %d", backlog)
+	}
+}
@@ -0,0 +1,50 @@
+// Package ingest consumes receipts from message queues. A Consumer pulls
+// messages from a pluggable Source, runs them through the same validation
+// and scoring pipeline as the HTTP API, and acknowledges each message only
+// once its receipt has been stored. Messages that can never be processed,
+// such as malformed JSON or invalid receipts, are moved to the source's
+// dead-letter location instead of being retried.
+package ingest
+
+import "context"
+
+// Message is a single receipt received from a Source
+type Message interface {
+	// ID identifies the message in logs
+	ID() string
+
+	// Data returns the receipt JSON
+	Data() []byte
+
+	// Ack removes the message from the source once its receipt is stored
+	Ack(ctx context.Context) error
+
+	// Nack returns the message to the source to be received again later
+	Nack(ctx context.Context) error
+
+	// DeadLetter moves a message that cannot be processed to the source's
+	// dead-letter location, recording reason
+	DeadLetter(ctx context.Context, reason error) error
+}
+
+// Source delivers queued receipts. Receive is called concurrently by the
+// consumer's workers. Messages that are received but never acknowledged
+// must eventually be delivered again, so delivery is at least once.
+type Source interface {
+	// Name identifies the source in logs and metrics
+	Name() string
+
+	// Receive blocks until a message is available or ctx is done
+	Receive(ctx context.Context) (Message, error)
+
+	// Close releases the source's resources
+	Close() error
+}
+
+// Backlogger is implemented by sources that can report how many messages
+// are waiting to be received, so the service can report unready when it
+// falls behind
+type Backlogger interface {
+	// Backlog returns the number of messages not yet received
+	Backlog(ctx context.Context) (int, error)
+}
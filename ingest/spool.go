@@ -0,0 +1,201 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultSpoolPollInterval is how often an empty spool directory is checked
+// for new files
+const DefaultSpoolPollInterval = time.Second
+
+// Subdirectories of a spool directory
+const (
+	spoolProcessing = "processing"  // Files claimed by a worker
+	spoolDeadLetter = "dead-letter" // Files that could not be processed
+)
+
+// SpoolSource receives receipts from the JSON files in a directory. Each
+// *.json file holds one receipt; producers should write files under another
+// name and rename them into place so a file is never read half-written.
+//
+// A received file is moved to the processing subdirectory, removed once its
+// receipt is stored, or moved to the dead-letter subdirectory along with a
+// .error file giving the reason. Files left in processing by a consumer that
+// stopped abruptly are returned to the spool when it is opened again, so a
+// spool directory must only be consumed by one process at a time.
+type SpoolSource struct {
+	dir          string
+	pollInterval time.Duration
+}
+
+// Verify SpoolSource implements Source and Backlogger interfaces
+var (
+	_ Source     = (*SpoolSource)(nil)
+	_ Backlogger = (*SpoolSource)(nil)
+)
+
+// SpoolOption configures a SpoolSource
+type SpoolOption func(*SpoolSource)
+
+// WithSpoolPollInterval checks an empty spool for new files every interval
+func WithSpoolPollInterval(interval time.Duration) SpoolOption {
+	return func(s *SpoolSource) {
+		s.pollInterval = interval
+	}
+}
+
+// OpenSpool opens the spool directory dir, creating it if needed, and
+// returns files left in processing to the spool
+func OpenSpool(dir string, opts ...SpoolOption) (*SpoolSource, error) {
+	s := &SpoolSource{dir: dir, pollInterval: DefaultSpoolPollInterval}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	for _, sub := range []string{spoolProcessing, spoolDeadLetter} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o700); err != nil {
+			return nil, fmt.Errorf("creating spool directory: %w", err)
+		}
+	}
+
+	claimed, err := os.ReadDir(filepath.Join(dir, spoolProcessing))
+	if err != nil {
+		return nil, fmt.Errorf("reading spool directory: %w", err)
+	}
+	for _, entry := range claimed {
+		if err := os.Rename(filepath.Join(dir, spoolProcessing, entry.Name()), filepath.Join(dir, entry.Name())); err != nil {
+			return nil, fmt.Errorf("recovering spool file: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// Name implements Source
+func (s *SpoolSource) Name() string {
+	return "spool"
+}
+
+// Receive claims the oldest file in the spool by name, waiting for one to
+// arrive when the spool is empty
+func (s *SpoolSource) Receive(ctx context.Context) (Message, error) {
+	for {
+		msg, err := s.claim()
+		if msg != nil || err != nil {
+			return msg, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(s.pollInterval):
+		}
+	}
+}
+
+// claim moves the first unclaimed file to processing and reads it. It
+// returns nil when the spool is empty.
+func (s *SpoolSource) claim() (Message, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading spool directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if !spooled(entry) {
+			continue
+		}
+
+		// Renaming is atomic, so only one worker claims each file
+		msg := &spoolMessage{source: s, name: name}
+		if err := os.Rename(filepath.Join(s.dir, name), msg.path()); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("claiming spool file: %w", err)
+		}
+		msg.data, err = os.ReadFile(msg.path())
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("reading spool file: %w", err), msg.Nack(context.Background()))
+		}
+		return msg, nil
+	}
+	return nil, nil
+}
+
+// Backlog returns the number of files waiting in the spool, not counting
+// files being processed
+func (s *SpoolSource) Backlog(ctx context.Context) (int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, fmt.Errorf("reading spool directory: %w", err)
+	}
+	n := 0
+	for _, entry := range entries {
+		if spooled(entry) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// spooled reports whether a directory entry is a receipt waiting to be
+// claimed, rather than a subdirectory or a file still being written
+func spooled(entry fs.DirEntry) bool {
+	name := entry.Name()
+	return entry.Type().IsRegular() && strings.HasSuffix(name, ".json") && !strings.HasPrefix(name, ".")
+}
+
+// Close implements Source
+func (s *SpoolSource) Close() error {
+	return nil
+}
+
+// spoolMessage is a file claimed from a spool directory
+type spoolMessage struct {
+	source *SpoolSource
+	name   string
+	data   []byte
+}
+
+// path returns the location of the claimed file
+func (m *spoolMessage) path() string {
+	return filepath.Join(m.source.dir, spoolProcessing, m.name)
+}
+
+// ID implements Message
+func (m *spoolMessage) ID() string {
+	return m.name
+}
+
+// Data implements Message
+func (m *spoolMessage) Data() []byte {
+	return m.data
+}
+
+// Ack removes the file
+func (m *spoolMessage) Ack(ctx context.Context) error {
+	return os.Remove(m.path())
+}
+
+// Nack returns the file to the spool
+func (m *spoolMessage) Nack(ctx context.Context) error {
+	return os.Rename(m.path(), filepath.Join(m.source.dir, m.name))
+}
+
+// DeadLetter moves the file to the dead-letter directory and writes the
+// reason next to it
+func (m *spoolMessage) DeadLetter(ctx context.Context, reason error) error {
+	dead := filepath.Join(m.source.dir, spoolDeadLetter, m.name)
+	if err := os.WriteFile(dead+".error", []byte(reason.Error()+"\n"), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(m.path(), dead)
+}
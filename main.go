@@ -5,69 +5,40 @@ import (
 	"flag"
 	"fmt"
 	"log/slog"
-	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"syscall"
 	"time"
+	_ "time/tzdata" // Time zones of receipts and stores in images without a zone database
 
 	"github.com/gin-gonic/gin"
-	"github.com/marcelorm/receipt-processor/api"
-	"github.com/marcelorm/receipt-processor/storage"
+	"github.com/marcelorm/receipt-processor/config"
+	"github.com/marcelorm/receipt-processor/events"
+	"github.com/marcelorm/receipt-processor/health"
+	"github.com/marcelorm/receipt-processor/ingest"
+	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/requestid"
+	"github.com/marcelorm/receipt-processor/server"
+	"github.com/marcelorm/receipt-processor/services"
+	"github.com/marcelorm/receipt-processor/services/rules"
+	"github.com/marcelorm/receipt-processor/tracing"
+	"github.com/marcelorm/receipt-processor/webhooks"
 )
 
-// requestLoggerMiddleware logs information about incoming requests
-func requestLoggerMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// Start timer
-		start := time.Now()
-		path := c.Request.URL.Path
-		method := c.Request.Method
-
-		// Process request
-		c.Next()
-
-		// Log the request details
-		latency := time.Since(start)
-		statusCode := c.Writer.Status()
-
-		// Log at appropriate level based on status code
-		logger := slog.With(
-			"method", method,
-			"path", path,
-			"status", statusCode,
-			"latency", latency.String(),
-			"client_ip", c.ClientIP(),
-		)
-
-		switch {
-		case statusCode >= 500:
-			logger.Error("Server error")
-		case statusCode >= 400:
-			logger.Warn("Client error")
-		default:
-			logger.Info("Request processed")
-		}
-	}
-}
-
-func setupLogging() {
-	// Get log level from environment
-	logLevel := os.Getenv("LOG_LEVEL")
+func setupLogging(cfg config.Config) {
 	var level slog.Level
 
-	switch logLevel {
+	switch cfg.LogLevel {
 	case "DEBUG":
 		level = slog.LevelDebug
-	case "INFO":
-		level = slog.LevelInfo
 	case "WARN":
 		level = slog.LevelWarn
 	case "ERROR":
 		level = slog.LevelError
 	default:
-		level = slog.LevelInfo // Default level
+		level = slog.LevelInfo
 	}
 
 	// Configure structured logging
@@ -76,83 +47,214 @@ func setupLogging() {
 	}
 
 	// Use JSON handler in production
+	var handler slog.Handler
 	if gin.Mode() == gin.ReleaseMode {
-		handler := slog.NewJSONHandler(os.Stdout, opts)
-		slog.SetDefault(slog.New(handler))
+		handler = slog.NewJSONHandler(os.Stdout, opts)
 	} else {
-		handler := slog.NewTextHandler(os.Stdout, opts)
-		slog.SetDefault(slog.New(handler))
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	}
+
+	// Add request, trace and span IDs to records logged with a request context
+	slog.SetDefault(slog.New(requestid.NewLogHandler(tracing.NewLogHandler(handler))))
+}
+
+// setupTracing configures span export from the tracing configuration
+func setupTracing(ctx context.Context, cfg config.Tracing) (func(context.Context) error, error) {
+	return tracing.Setup(ctx, tracing.Config{
+		ServiceName:  "receipt-processor",
+		Exporter:     cfg.Exporter,
+		FilePath:     cfg.File,
+		OTLPEndpoint: cfg.OTLPEndpoint,
+		OTLPHeaders:  cfg.OTLPHeaders,
+		SampleRatio:  cfg.SampleRatio,
+	})
+}
+
+// setupWebhooks creates the webhook dispatcher, persisting subscriptions and
+// undelivered events in the configured directory when one is set
+func setupWebhooks(cfg config.Webhooks) (*webhooks.Dispatcher, error) {
+	var opts []webhooks.RegistryOption
+	if cfg.AllowPrivateURLs {
+		opts = append(opts, webhooks.AllowPrivateURLs())
+	}
+	if cfg.Dir == "" {
+		return webhooks.NewDispatcher(webhooks.NewMemoryOutbox(), webhooks.NewRegistry(opts...),
+			webhooks.WithMaxAttempts(cfg.MaxAttempts)), nil
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("creating webhooks directory: %w", err)
 	}
+	registry, err := webhooks.OpenFileRegistry(filepath.Join(cfg.Dir, "subscriptions.json"), opts...)
+	if err != nil {
+		return nil, err
+	}
+	outbox, err := webhooks.OpenFileOutbox(filepath.Join(cfg.Dir, "outbox.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	return webhooks.NewDispatcher(outbox, registry, webhooks.WithMaxAttempts(cfg.MaxAttempts)), nil
+}
+
+// setupExchangeRates loads the exchange-rate table, or returns a table of the
+// base currency alone when no rates file is configured
+func setupExchangeRates(cfg config.Currency) (*services.ExchangeRates, error) {
+	if cfg.RatesFile == "" {
+		return services.NewExchangeRates("none", cfg.Base, nil)
+	}
+
+	rates, err := services.LoadExchangeRates(cfg.RatesFile)
+	if err != nil {
+		return nil, err
+	}
+	if rates.Base != cfg.Base {
+		return nil, fmt.Errorf("exchange rates %s are based on %s, not %s", cfg.RatesFile, rates.Base, cfg.Base)
+	}
+	return rates, nil
+}
+
+// setupConsumerSource opens the queue receipts are consumed from, or returns
+// nil when queue consumption is disabled
+func setupConsumerSource(ctx context.Context, cfg config.Consumer) (ingest.Source, error) {
+	switch cfg.Source {
+	case "spool":
+		return ingest.OpenSpool(cfg.SpoolDir)
+	case "nats":
+		return ingest.OpenNATS(ctx, ingest.NATSConfig{
+			URL:               cfg.NATS.URL,
+			Stream:            cfg.NATS.Stream,
+			Consumer:          cfg.NATS.Consumer,
+			DeadLetterSubject: cfg.NATS.DeadLetterSubject,
+		})
+	default:
+		return nil, nil
+	}
+}
+
+// runHealthCheck probes the liveness endpoint of the server running on port.
+// Liveness rather than readiness is probed, so that a backlog or a slow
+// dependency does not get the container restarted.
+func runHealthCheck(port int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return health.Probe(ctx, fmt.Sprintf("http://127.0.0.1:%d/livez", port))
 }
 
 func main() {
 	// Parse command-line flags
-	var healthCheck bool
+	var healthCheck, printConfig bool
 	flag.BoolVar(&healthCheck, "health-check", false, "Run a health check and exit")
+	flag.BoolVar(&printConfig, "print-config", false, "Print the effective configuration with secrets redacted and exit")
+	loader := config.NewLoader(flag.CommandLine)
 	flag.Parse()
 
-	// If health check flag is provided, just return success and exit
+	// Load and validate the configuration
+	cfg, err := loader.Load(os.LookupEnv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	// If health check flag is provided, probe the running server and exit
 	if healthCheck {
+		if err := runHealthCheck(cfg.Port); err != nil {
+			fmt.Fprintln(os.Stderr, "Health check failed:", err)
+			os.Exit(1)
+		}
 		fmt.Println("Health check passed")
 		os.Exit(0)
 	}
 
-	// Set up structured logging
-	setupLogging()
-
-	// Read configuration from environment
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080" // Default port
-	}
-
-	// Set Gin mode from environment
-	ginMode := os.Getenv("GIN_MODE")
-	if ginMode != "" {
-		gin.SetMode(ginMode)
+	if printConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
 	}
 
-	// Create a new in-memory receipt store
-	store := storage.NewMemoryStorage()
-
-	// Create a new receipt handler
-	handler := api.NewReceiptHandler(store)
+	// Set Gin mode from configuration
+	gin.SetMode(cfg.GinMode)
 
-	// Create a new Gin router with custom middleware
-	router := gin.New()
-	router.Use(gin.Recovery())
-	router.Use(requestLoggerMiddleware())
-	maxBodySize := int64(1024 * 1024) // Default 1MB, or load from env/config
-if envSize := os.Getenv("MAX_BODY_SIZE"); envSize != "" {
-	if v, err := strconv.ParseInt(envSize, 10, 64); err == nil {
-		maxBodySize = v
+	// Set the accepted date and time formats, already checked by Validate
+	if err := models.SetFormats(cfg.DateTime.Formats()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
-}
-
-receipts := router.Group("/receipts")
-receipts.Use(api.JSONValidationMiddleware(maxBodySize))
-receipts.POST("/process", handler.ProcessReceipt)
-receipts.GET(":id/points", handler.GetPoints)
 
-	// Add health check endpoint
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "ok"})
-	})
+	// Set up structured logging
+	setupLogging(cfg)
 
-	// Create the HTTP server
-	server := &http.Server{
-		Addr:    ":" + port,
-		Handler: router,
+	// Set up tracing
+	shutdownTracing, err := setupTracing(context.Background(), cfg.Tracing)
+	if err != nil {
+		slog.Error("Failed to set up tracing", "error", err)
+		os.Exit(1)
 	}
 
-	// Start the server in a goroutine
-	go func() {
-		slog.Info("Starting server", "port", port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			slog.Error("Failed to start server", "error", err)
+	// Create the receipt processor server
+	opts := []server.Option{
+		server.WithAddr(":" + strconv.Itoa(cfg.Port)),
+		server.WithBodyLimit(cfg.MaxBodySize),
+		server.WithEventBus(events.NewBus(
+			events.WithMaxSubscribers(cfg.Events.MaxSubscribers),
+			events.WithBufferSize(cfg.Events.BufferSize))),
+		server.WithEventHeartbeat(cfg.Events.Heartbeat),
+		server.WithEventBacklogLimit(cfg.Events.MaxBacklog),
+	}
+	ruleSet, err := rules.Config{CountQuantities: cfg.Rules.CountQuantities}.RuleSet()
+	if err != nil {
+		slog.Error("Failed to set up rules", "error", err)
+		os.Exit(1)
+	}
+	opts = append(opts, server.WithRuleSet(ruleSet))
+	zones, err := services.NewStoreZones(cfg.TimeZones.Default, cfg.TimeZones.Stores)
+	if err != nil {
+		slog.Error("Failed to set up store time zones", "error", err)
+		os.Exit(1)
+	}
+	rates, err := setupExchangeRates(cfg.Currency)
+	if err != nil {
+		slog.Error("Failed to set up exchange rates", "error", err)
+		os.Exit(1)
+	}
+	opts = append(opts, server.WithStoreZones(zones), server.WithExchangeRates(rates),
+		server.WithReconciliation(cfg.Reconciliation.Tolerance, services.ReconcilePolicy(cfg.Reconciliation.Policy)))
+	if cfg.GRPC.Enabled {
+		if cfg.GRPC.Port == 0 {
+			opts = append(opts, server.WithGRPC())
+		} else {
+			opts = append(opts, server.WithGRPCAddr(":"+strconv.Itoa(cfg.GRPC.Port)))
+		}
+	}
+	if cfg.Webhooks.Enabled {
+		dispatcher, err := setupWebhooks(cfg.Webhooks)
+		if err != nil {
+			slog.Error("Failed to set up webhooks", "error", err)
 			os.Exit(1)
 		}
-	}()
+		opts = append(opts, server.WithWebhooks(dispatcher))
+	}
+	source, err := setupConsumerSource(context.Background(), cfg.Consumer)
+	if err != nil {
+		slog.Error("Failed to set up queue consumer", "error", err)
+		os.Exit(1)
+	}
+	if source != nil {
+		opts = append(opts, server.WithConsumer(source, ingest.WithWorkers(cfg.Consumer.Workers)),
+			server.WithConsumerBacklogLimit(cfg.Consumer.MaxBacklog))
+	}
+	srv, err := server.New(opts...)
+	if err != nil {
+		slog.Error("Failed to create server", "error", err)
+		os.Exit(1)
+	}
+
+	// Start serving
+	if err := srv.Start(); err != nil {
+		slog.Error("Failed to start server", "error", err)
+		os.Exit(1)
+	}
 
 	// Wait for interrupt signal to gracefully shut down the server
 	quit := make(chan os.Signal, 1)
@@ -162,13 +264,18 @@ receipts.GET(":id/points", handler.GetPoints)
 	slog.Info("Shutting down server...")
 
 	// Create context with timeout for shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
 
 	// Attempt graceful shutdown
-	if err := server.Shutdown(ctx); err != nil {
+	if err := srv.Shutdown(ctx); err != nil {
 		slog.Error("Server forced to shutdown", "error", err)
 	}
 
+	// Flush any buffered spans
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("Failed to flush traces", "error", err)
+	}
+
 	slog.Info("Server exited")
 }
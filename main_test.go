@@ -1,37 +1,28 @@
 package main
 
 import (
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/gin-gonic/gin"
-	"github.com/marcelorm/receipt-processor/api"
-	"github.com/marcelorm/receipt-processor/storage"
+	"github.com/marcelorm/receipt-processor/server"
 )
 
-// setupRouter creates a test router similar to the one in main
-func setupRouter() *gin.Engine {
+// setupRouter creates a test server wired the same way as in main
+func setupRouter(t *testing.T) http.Handler {
 	gin.SetMode(gin.TestMode)
 
-	// Create a new in-memory receipt store
-	store := storage.NewMemoryStorage()
-
-	// Create a new receipt handler
-	handler := api.NewReceiptHandler(store)
-
-	// Create a new Gin router
-	router := gin.Default()
-
-	// Set up routes
-	router.POST("/receipts/process", handler.ProcessReceipt)
-	router.GET("/receipts/:id/points", handler.GetPoints)
-
-	return router
+	srv, err := server.New()
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	return srv
 }
 
 func TestRoutes(t *testing.T) {
-	router := setupRouter()
+	router := setupRouter(t)
 
 	tests := []struct {
 		name           string
@@ -51,6 +42,24 @@ func TestRoutes(t *testing.T) {
 			path:           "/receipts/invalid-id/points",
 			expectedStatus: http.StatusNotFound,
 		},
+		{
+			name:           "Liveness Route",
+			method:         "GET",
+			path:           "/livez",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Readiness Route",
+			method:         "GET",
+			path:           "/readyz",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Metrics Route",
+			method:         "GET",
+			path:           "/metrics",
+			expectedStatus: http.StatusOK,
+		},
 		{
 			name:           "Unknown Route",
 			method:         "GET",
@@ -71,3 +80,22 @@ func TestRoutes(t *testing.T) {
 		})
 	}
 }
+
+func TestRunHealthCheck(t *testing.T) {
+	var probed string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probed = r.URL.Path
+		if r.URL.Path != "/livez" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	port := ts.Listener.Addr().(*net.TCPAddr).Port
+	if err := runHealthCheck(port); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if probed != "/livez" {
+		t.Errorf("Expected the health check to probe /livez, got %s", probed)
+	}
+}
@@ -0,0 +1,201 @@
+package metrics
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/marcelorm/receipt-processor/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes every metric exported by the service
+const namespace = "receipt_processor"
+
+// Metrics holds the Prometheus collectors exported by the service.
+// All methods are safe to call on a nil *Metrics, which records nothing.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requestsTotal      *prometheus.CounterVec
+	requestDuration    *prometheus.HistogramVec
+	receiptsProcessed  prometheus.Counter
+	pointsAwarded      prometheus.Histogram
+	ruleHits           *prometheus.CounterVec
+	rulePoints         *prometheus.CounterVec
+	validationFailures *prometheus.CounterVec
+	storageDuration    *prometheus.HistogramVec
+	storageReceipts    prometheus.Gauge
+	consumedMessages   *prometheus.CounterVec
+}
+
+// New creates a Metrics instance backed by its own registry, including the Go
+// runtime and process collectors
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Total number of HTTP requests by route, method and status.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		receiptsProcessed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "receipts_processed_total",
+			Help:      "Total number of receipts scored and stored.",
+		}),
+		pointsAwarded: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "points_awarded",
+			Help:      "Distribution of the points awarded per receipt.",
+			Buckets:   []float64{0, 10, 25, 50, 75, 100, 150, 200, 300, 500},
+		}),
+		ruleHits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rule_hits_total",
+			Help:      "Number of receipts for which a rule awarded points.",
+		}, []string{"rule"}),
+		rulePoints: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rule_points_total",
+			Help:      "Total points awarded by each rule.",
+		}, []string{"rule"}),
+		validationFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "validation_failures_total",
+			Help:      "Number of rejected requests by error code.",
+		}, []string{"code"}),
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "storage_operation_duration_seconds",
+			Help:      "Latency of receipt storage operations by operation and outcome.",
+			Buckets:   []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+		}, []string{"operation", "outcome"}),
+		storageReceipts: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "storage_receipts",
+			Help:      "Number of receipts currently held in storage.",
+		}),
+		consumedMessages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "consumed_messages_total",
+			Help:      "Number of queued receipt messages handled by source and outcome.",
+		}, []string{"source", "outcome"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requestsTotal,
+		m.requestDuration,
+		m.receiptsProcessed,
+		m.pointsAwarded,
+		m.ruleHits,
+		m.rulePoints,
+		m.validationFailures,
+		m.storageDuration,
+		m.storageReceipts,
+		m.consumedMessages,
+	)
+
+	return m
+}
+
+// Registry returns the registry the metrics are registered with, so callers
+// can add their own collectors
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Handler returns an HTTP handler serving the metrics in the Prometheus text
+// exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// ObserveRequest records a completed HTTP request
+func (m *Metrics) ObserveRequest(route, method string, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	code := strconv.Itoa(status)
+	m.requestsTotal.WithLabelValues(route, method, code).Inc()
+	m.requestDuration.WithLabelValues(route, method, code).Observe(duration.Seconds())
+}
+
+// ObserveReceipt records a scored receipt along with the result of every rule
+func (m *Metrics) ObserveReceipt(breakdown models.PointsBreakdown) {
+	if m == nil {
+		return
+	}
+	m.receiptsProcessed.Inc()
+	m.pointsAwarded.Observe(float64(breakdown.Total))
+	for _, result := range breakdown.Rules {
+		if result.Points > 0 {
+			m.ruleHits.WithLabelValues(result.Rule).Inc()
+			m.rulePoints.WithLabelValues(result.Rule).Add(float64(result.Points))
+		}
+	}
+}
+
+// ObserveValidationFailure records a request rejected with the given error code
+func (m *Metrics) ObserveValidationFailure(code string) {
+	if m == nil {
+		return
+	}
+	m.validationFailures.WithLabelValues(code).Inc()
+}
+
+// ObserveConsumedMessage records a queued receipt message handled with the
+// given outcome (acked, retried or dead_lettered)
+func (m *Metrics) ObserveConsumedMessage(source, outcome string) {
+	if m == nil {
+		return
+	}
+	m.consumedMessages.WithLabelValues(source, outcome).Inc()
+}
+
+// WatchEventOutbox exports the number of domain events waiting for delivery
+// and the number parked after failing every attempt, reading both from
+// backlog whenever the metrics are collected
+func (m *Metrics) WatchEventOutbox(backlog func() (pending, parked int, err error)) {
+	if m == nil {
+		return
+	}
+	gauge := func(name, help string, value func(pending, parked int) int) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      name,
+			Help:      help,
+		}, func() float64 {
+			pending, parked, err := backlog()
+			if err != nil {
+				return math.NaN()
+			}
+			return float64(value(pending, parked))
+		})
+	}
+	// A Metrics shared by several servers keeps watching the first outbox
+	_ = m.registry.Register(gauge("events_pending", "Number of domain events waiting for delivery to every sink.",
+		func(pending, _ int) int { return pending }))
+	_ = m.registry.Register(gauge("events_parked", "Number of domain events parked after a sink failed every attempt.",
+		func(_, parked int) int { return parked }))
+}
+
+// observeStorage records the latency and outcome of a storage operation
+func (m *Metrics) observeStorage(operation string, start time.Time, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	m.storageDuration.WithLabelValues(operation, outcome).Observe(time.Since(start).Seconds())
+}
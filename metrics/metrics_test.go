@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/storage"
+)
+
+// scrape fetches the metrics endpoint the same way Prometheus would
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+
+	server := httptest.NewServer(m.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to scrape metrics: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read metrics: %v", err)
+	}
+	return string(body)
+}
+
+func TestMetricsExposition(t *testing.T) {
+	m := New()
+
+	m.ObserveRequest("/receipts/process", http.MethodPost, http.StatusOK, 10*time.Millisecond)
+	m.ObserveValidationFailure("RP0103")
+	m.ObserveConsumedMessage("spool", "dead_lettered")
+	m.ObserveReceipt(models.PointsBreakdown{
+		Total: 56,
+		Rules: []models.RuleResult{
+			{Rule: "RetailerNameRule", Points: 6},
+			{Rule: "RoundDollarRule", Points: 50},
+			{Rule: "OddDayRule", Points: 0},
+		},
+	})
+
+	body := scrape(t, m)
+
+	expected := []string{
+		`receipt_processor_http_requests_total{method="POST",route="/receipts/process",status="200"} 1`,
+		`receipt_processor_http_request_duration_seconds_count{method="POST",route="/receipts/process",status="200"} 1`,
+		`receipt_processor_validation_failures_total{code="RP0103"} 1`,
+		`receipt_processor_consumed_messages_total{outcome="dead_lettered",source="spool"} 1`,
+		`receipt_processor_receipts_processed_total 1`,
+		`receipt_processor_points_awarded_sum 56`,
+		`receipt_processor_rule_hits_total{rule="RetailerNameRule"} 1`,
+		`receipt_processor_rule_points_total{rule="RoundDollarRule"} 50`,
+		`go_goroutines`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line) {
+			t.Errorf("Expected metrics to contain %q", line)
+		}
+	}
+
+	// Rules that awarded nothing are not counted as hits
+	if strings.Contains(body, `rule="OddDayRule"`) {
+		t.Error("Expected no series for a rule that awarded no points")
+	}
+}
+
+func TestInstrumentStorage(t *testing.T) {
+	m := New()
+	ctx := context.Background()
+
+	store := m.InstrumentStorage(ctx, storage.NewMemoryStorage())
+
+	id, err := store.SaveReceipt(ctx, models.Receipt{Retailer: "Target"}, models.PointsBreakdown{Total: 42})
+	if err != nil {
+		t.Fatalf("Failed to save receipt: %v", err)
+	}
+	if _, err := store.GetPoints(ctx, id); err != nil {
+		t.Fatalf("Failed to retrieve points: %v", err)
+	}
+	if _, err := store.GetPoints(ctx, "non-existent-id"); err == nil {
+		t.Fatal("Expected error for non-existent ID, got nil")
+	}
+
+	body := scrape(t, m)
+
+	expected := []string{
+		`receipt_processor_storage_operation_duration_seconds_count{operation="save_receipt",outcome="success"} 1`,
+		`receipt_processor_storage_operation_duration_seconds_count{operation="get_points",outcome="success"} 1`,
+		`receipt_processor_storage_operation_duration_seconds_count{operation="get_points",outcome="error"} 1`,
+		`receipt_processor_storage_receipts 1`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line) {
+			t.Errorf("Expected metrics to contain %q", line)
+		}
+	}
+}
+
+func TestWatchEventOutbox(t *testing.T) {
+	m := New()
+	m.WatchEventOutbox(func() (int, int, error) { return 3, 1, nil })
+
+	body := scrape(t, m)
+	for _, line := range []string{"receipt_processor_events_pending 3", "receipt_processor_events_parked 1"} {
+		if !strings.Contains(body, line) {
+			t.Errorf("Expected metrics to contain %q", line)
+		}
+	}
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+
+	// A nil *Metrics must be usable without panicking
+	m.ObserveRequest("/health", http.MethodGet, http.StatusOK, time.Millisecond)
+	m.ObserveReceipt(models.PointsBreakdown{Total: 10})
+	m.ObserveValidationFailure("RP0002")
+	m.ObserveConsumedMessage("nats", "acked")
+	m.WatchEventOutbox(func() (int, int, error) { return 0, 0, nil })
+
+	store := storage.NewMemoryStorage()
+	if got := m.InstrumentStorage(context.Background(), store); got != store {
+		t.Error("Expected nil metrics to return the store unwrapped")
+	}
+}
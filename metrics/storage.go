@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/storage"
+)
+
+// instrumentedStorage decorates a ReceiptStorage with latency and size metrics
+type instrumentedStorage struct {
+	next    storage.ReceiptStorage
+	metrics *Metrics
+}
+
+// Verify instrumentedStorage implements ReceiptStorage interface
+var _ storage.ReceiptStorage = (*instrumentedStorage)(nil)
+
+// InstrumentStorage wraps store so that every operation is recorded. The
+// storage size gauge is seeded from the current count of the store.
+func (m *Metrics) InstrumentStorage(ctx context.Context, store storage.ReceiptStorage) storage.ReceiptStorage {
+	if m == nil {
+		return store
+	}
+	if count, err := store.Count(ctx); err == nil {
+		m.storageReceipts.Set(float64(count))
+	}
+	return &instrumentedStorage{next: store, metrics: m}
+}
+
+// SaveReceipt saves a scored receipt and returns the generated ID
+func (s *instrumentedStorage) SaveReceipt(ctx context.Context, receipt models.Receipt, breakdown models.PointsBreakdown) (string, error) {
+	start := time.Now()
+	id, err := s.next.SaveReceipt(ctx, receipt, breakdown)
+	s.metrics.observeStorage("save_receipt", start, err)
+	if err == nil {
+		s.metrics.storageReceipts.Inc()
+	}
+	return id, err
+}
+
+// GetPoints retrieves the points for a receipt by ID
+func (s *instrumentedStorage) GetPoints(ctx context.Context, id string) (int, error) {
+	start := time.Now()
+	points, err := s.next.GetPoints(ctx, id)
+	s.metrics.observeStorage("get_points", start, err)
+	return points, err
+}
+
+// Ledger returns the points ledger entries of a receipt by ID
+func (s *instrumentedStorage) Ledger(ctx context.Context, id string) ([]models.LedgerEntry, error) {
+	start := time.Now()
+	entries, err := s.next.Ledger(ctx, id)
+	s.metrics.observeStorage("ledger", start, err)
+	return entries, err
+}
+
+// GetReceipt retrieves a stored receipt by ID
+func (s *instrumentedStorage) GetReceipt(ctx context.Context, id string) (storage.Record, error) {
+	start := time.Now()
+	record, err := s.next.GetReceipt(ctx, id)
+	s.metrics.observeStorage("get_receipt", start, err)
+	return record, err
+}
+
+// ListReceipts returns the stored receipts matching filter
+func (s *instrumentedStorage) ListReceipts(ctx context.Context, filter storage.Filter) ([]storage.Record, error) {
+	start := time.Now()
+	records, err := s.next.ListReceipts(ctx, filter)
+	s.metrics.observeStorage("list_receipts", start, err)
+	return records, err
+}
+
+// Count returns the number of receipts in the store
+func (s *instrumentedStorage) Count(ctx context.Context) (int, error) {
+	start := time.Now()
+	count, err := s.next.Count(ctx)
+	s.metrics.observeStorage("count", start, err)
+	if err == nil {
+		s.metrics.storageReceipts.Set(float64(count))
+	}
+	return count, err
+}
+
+// CreateAccount opens a loyalty account
+func (s *instrumentedStorage) CreateAccount(ctx context.Context, name string) (models.Account, error) {
+	start := time.Now()
+	account, err := s.next.CreateAccount(ctx, name)
+	s.metrics.observeStorage("create_account", start, err)
+	return account, err
+}
+
+// GetAccount retrieves a loyalty account by ID
+func (s *instrumentedStorage) GetAccount(ctx context.Context, id string) (models.Account, error) {
+	start := time.Now()
+	account, err := s.next.GetAccount(ctx, id)
+	s.metrics.observeStorage("get_account", start, err)
+	return account, err
+}
+
+// PostEntry posts an entry to a loyalty account
+func (s *instrumentedStorage) PostEntry(ctx context.Context, accountID string, entry models.EntryRequest) (models.Posting, error) {
+	start := time.Now()
+	posting, err := s.next.PostEntry(ctx, accountID, entry)
+	s.metrics.observeStorage("post_entry", start, err)
+	return posting, err
+}
+
+// AccountHistory returns the ledger postings of a loyalty account by ID
+func (s *instrumentedStorage) AccountHistory(ctx context.Context, id string) ([]models.Posting, error) {
+	start := time.Now()
+	postings, err := s.next.AccountHistory(ctx, id)
+	s.metrics.observeStorage("account_history", start, err)
+	return postings, err
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// System accounts balancing the points ledger. Points are issued to loyalty
+// accounts from AccountIssued, and leave them for AccountRedeemed or
+// AccountExpired, so the balances of all accounts always sum to zero.
+const (
+	AccountIssued   = "system:issued"
+	AccountRedeemed = "system:redeemed"
+	AccountExpired  = "system:expired"
+)
+
+// SystemAccounts lists the system accounts every points ledger holds
+var SystemAccounts = []string{AccountIssued, AccountRedeemed, AccountExpired}
+
+// IsSystemAccount reports whether id names a system account rather than a
+// loyalty account
+func IsSystemAccount(id string) bool {
+	return strings.HasPrefix(id, "system:")
+}
+
+// Account is a loyalty account that receipts earn points into
+type Account struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	Balance   int       `json:"balance"` // Points credited less points debited
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// AccountRequest is the body of a request opening a loyalty account
+type AccountRequest struct {
+	Name string `json:"name"`
+}
+
+// Posting is a double-entry points ledger entry, moving points from the
+// debited account to the credited account
+type Posting struct {
+	ID        string     `json:"id"`
+	Kind      LedgerKind `json:"kind"`
+	Debit     string     `json:"debit"`  // Account the points leave
+	Credit    string     `json:"credit"` // Account the points go to
+	Points    int        `json:"points"` // Never negative
+	ReceiptID string     `json:"receiptId,omitempty"`
+	Note      string     `json:"note,omitempty"`
+	At        time.Time  `json:"at"`
+}
+
+// Amount returns the change the posting makes to the balance of account
+func (p Posting) Amount(account string) int {
+	switch account {
+	case p.Credit:
+		return p.Points
+	case p.Debit:
+		return -p.Points
+	default:
+		return 0
+	}
+}
+
+// EntryRequest is the body of a request posting an adjustment, redemption or
+// expiry to a loyalty account. Earn and clawback entries are only posted by
+// processing receipts.
+type EntryRequest struct {
+	Kind      LedgerKind `json:"kind"`
+	Points    int        `json:"points"`              // Positive for redemptions and expiries, signed for adjustments
+	ReceiptID string     `json:"receiptId,omitempty"` // Receipt of the account the entry relates to
+	Note      string     `json:"note,omitempty"`
+}
+
+// Validate checks the kind and points of the entry
+func (e EntryRequest) Validate() error {
+	switch e.Kind {
+	case LedgerAdjust:
+		if e.Points == 0 {
+			return fmt.Errorf("points of an adjustment must not be zero")
+		}
+	case LedgerRedeem, LedgerExpire:
+		if e.Points <= 0 {
+			return fmt.Errorf("points to %s must be positive, got %d", e.Kind, e.Points)
+		}
+	default:
+		return fmt.Errorf("kind must be one of adjust, redeem, expire, got %q", e.Kind)
+	}
+	return nil
+}
+
+// Posting returns the double-entry posting of the entry to account
+func (e EntryRequest) Posting(account string) Posting {
+	p := Posting{Kind: e.Kind, Points: e.Points, ReceiptID: e.ReceiptID, Note: e.Note}
+	switch {
+	case e.Kind == LedgerRedeem:
+		p.Debit, p.Credit = account, AccountRedeemed
+	case e.Kind == LedgerExpire:
+		p.Debit, p.Credit = account, AccountExpired
+	case e.Points < 0:
+		p.Debit, p.Credit, p.Points = account, AccountIssued, -e.Points
+	default:
+		p.Debit, p.Credit = AccountIssued, account
+	}
+	return p
+}
+
+// BalanceResponse is returned when querying the balance of a loyalty account
+type BalanceResponse struct {
+	AccountID string `json:"accountId"`
+	Points    int    `json:"points"`
+}
+
+// HistoryResponse is returned when querying the ledger postings of a loyalty
+// account
+type HistoryResponse struct {
+	AccountID string    `json:"accountId"`
+	Points    int       `json:"points"`  // Balance after every posting
+	Entries   []Posting `json:"entries"` // Oldest first
+}
@@ -0,0 +1,46 @@
+package models
+
+import "testing"
+
+func TestEntryRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		entry  EntryRequest
+		valid  bool
+		debit  string
+		credit string
+		points int
+	}{
+		{"Redeem", EntryRequest{Kind: LedgerRedeem, Points: 30}, true, "acct", AccountRedeemed, 30},
+		{"Expire", EntryRequest{Kind: LedgerExpire, Points: 15}, true, "acct", AccountExpired, 15},
+		{"Credit adjustment", EntryRequest{Kind: LedgerAdjust, Points: 5}, true, AccountIssued, "acct", 5},
+		{"Debit adjustment", EntryRequest{Kind: LedgerAdjust, Points: -5}, true, "acct", AccountIssued, 5},
+		{"Zero adjustment", EntryRequest{Kind: LedgerAdjust}, false, "", "", 0},
+		{"Negative redemption", EntryRequest{Kind: LedgerRedeem, Points: -30}, false, "", "", 0},
+		{"Earn", EntryRequest{Kind: LedgerEarn, Points: 10}, false, "", "", 0},
+		{"Clawback", EntryRequest{Kind: LedgerClawback, Points: 10}, false, "", "", 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.entry.Validate()
+			if !tc.valid {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			p := tc.entry.Posting("acct")
+			if p.Debit != tc.debit || p.Credit != tc.credit || p.Points != tc.points {
+				t.Errorf("Expected %d points from %s to %s, got %+v", tc.points, tc.debit, tc.credit, p)
+			}
+			if p.Amount(p.Debit)+p.Amount(p.Credit) != 0 {
+				t.Errorf("Expected the posting to balance, got %+v", p)
+			}
+		})
+	}
+}
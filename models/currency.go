@@ -0,0 +1,102 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// minorUnits holds the number of decimal places of every active ISO 4217
+// currency, by code
+var minorUnits = func() map[string]int {
+	units := make(map[string]int)
+	for _, code := range strings.Fields(`
+		AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BMD BND BOB BRL
+		BSD BTN BWP BYN BZD CAD CDF CHF CNY COP CRC CUP CVE CZK DKK DOP DZD EGP
+		ERN ETB EUR FJD FKP GBP GEL GHS GIP GMD GTQ GYD HKD HNL HTG HUF IDR ILS
+		INR IRR JMD KES KGS KHR KPW KYD KZT LAK LBP LKR LRD LSL MAD MDL MGA MKD
+		MMK MNT MOP MRU MUR MVR MWK MXN MYR MZN NAD NGN NIO NOK NPR NZD PAB PEN
+		PGK PHP PKR PLN QAR RON RSD RUB SAR SBD SCR SDG SEK SGD SHP SLE SOS SRD
+		SSP STN SVC SYP SZL THB TJS TMT TOP TRY TTD TWD TZS UAH USD UYU UZS VES
+		WST XCD YER ZAR ZMW ZWL`) {
+		units[code] = 2
+	}
+	for _, code := range strings.Fields("BIF CLP DJF GNF ISK JPY KMF KRW PYG RWF UGX VND VUV XAF XOF XPF") {
+		units[code] = 0
+	}
+	for _, code := range strings.Fields("BHD IQD JOD KWD LYD OMR TND") {
+		units[code] = 3
+	}
+	return units
+}()
+
+// Currency is an ISO 4217 currency
+type Currency struct {
+	Code       string // Three-letter code, such as USD
+	MinorUnits int    // Decimal places of the minor unit, such as 2 for cents
+}
+
+// Conversion records the exchange rate a receipt was scored at
+type Conversion struct {
+	Currency     string  `json:"currency"`     // Currency of the receipt
+	Base         string  `json:"base"`         // Currency the rules are expressed in
+	Rate         float64 `json:"rate"`         // Units of the base currency per unit of the receipt currency
+	RatesVersion string  `json:"ratesVersion"` // Version of the exchange-rate table
+}
+
+// LookupCurrency returns the currency with the given ISO 4217 code
+func LookupCurrency(code string) (Currency, error) {
+	units, ok := minorUnits[code]
+	if !ok {
+		return Currency{}, fmt.Errorf("invalid currency %q, expected an ISO 4217 code such as USD", code)
+	}
+	return Currency{Code: code, MinorUnits: units}, nil
+}
+
+// Round rounds an amount to the minor unit of the currency
+func (c Currency) Round(amount float64) Price {
+	scale := math.Pow10(c.MinorUnits)
+	return Price(math.Round(amount*scale) / scale)
+}
+
+// Format formats a price with the decimals of the minor unit of the currency,
+// such as 1250 for yen or 1.125 for Kuwaiti dinar
+func (c Currency) Format(p Price) string {
+	return strconv.FormatFloat(float64(c.Round(float64(p))), 'f', c.MinorUnits, 64)
+}
+
+// Exact reports whether a price is a whole number of minor units of the
+// currency, such as whole yen or whole cents
+func (c Currency) Exact(p Price) bool {
+	scaled := float64(p) * math.Pow10(c.MinorUnits)
+	return math.Abs(scaled-math.Round(scaled)) < 1e-6
+}
+
+// validateAmounts checks that every amount on the receipt is a whole number
+// of minor units of the currency
+func (r *Receipt) validateAmounts(c Currency) []error {
+	var errs []error
+	inexact := func(name string, p Price) error {
+		return fmt.Errorf("%s %s has more than %d decimals for %s", name, p, c.MinorUnits, c.Code)
+	}
+	for i, item := range r.Items {
+		for _, amount := range []struct {
+			name  string
+			value Price
+		}{{"price", item.Price}, {"unit price", item.UnitPrice}, {"discount", item.Discount}} {
+			if !c.Exact(amount.value) {
+				errs = append(errs, fmt.Errorf("item %d: %w", i+1, inexact(amount.name, amount.value)))
+			}
+		}
+	}
+	for _, amount := range []struct {
+		name  string
+		value Price
+	}{{"subtotal", r.Subtotal}, {"tax", r.Tax}, {"tip", r.Tip}, {"discounts", r.Discounts}, {"total", r.Total}} {
+		if !c.Exact(amount.value) {
+			errs = append(errs, inexact(amount.name, amount.value))
+		}
+	}
+	return errs
+}
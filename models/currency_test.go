@@ -0,0 +1,104 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCurrencyValidation(t *testing.T) {
+	valid := func() Receipt {
+		return Receipt{
+			Retailer:     "Target",
+			PurchaseDate: MustParseDate("2022-01-01"),
+			PurchaseTime: MustParseTime("13:01"),
+			Items:        []Item{{ShortDescription: "Pepsi - 12-oz", Price: 1.25}},
+			Total:        1.25,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(*Receipt)
+		expected string // Prefix of the error, empty when valid
+	}{
+		{"No currency", func(r *Receipt) {}, ""},
+		{"Dollars", func(r *Receipt) { r.Currency = "USD" }, ""},
+		{"Lower case", func(r *Receipt) { r.Currency = "usd" }, `invalid currency "usd"`},
+		{"Unknown", func(r *Receipt) { r.Currency = "XYZ" }, `invalid currency "XYZ"`},
+		{"Whole yen", func(r *Receipt) { r.Currency, r.Items[0].Price, r.Total = "JPY", 125, 125 }, ""},
+		{"Fractional yen", func(r *Receipt) { r.Currency = "JPY" }, "item 1: price 1.25 has more than 0 decimals for JPY"},
+		{"Fils", func(r *Receipt) { r.Currency, r.Items[0].Price, r.Total = "KWD", 1.125, 1.125 }, ""},
+		{"Fractional cents", func(r *Receipt) { r.Currency, r.Items[0].Price, r.Total = "EUR", 1.125, 1.125 }, "item 1: price 1.125 has more than 2 decimals for EUR"},
+		{"Fractional tax", func(r *Receipt) { r.Currency, r.Tax = "EUR", 0.001 }, "tax 0.001 has more than 2 decimals for EUR"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			receipt := valid()
+			tc.modify(&receipt)
+
+			err := receipt.Validate()
+			if tc.expected == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tc.expected) {
+				t.Errorf("Expected error starting with %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestCurrencyRound(t *testing.T) {
+	tests := []struct {
+		code      string
+		amount    float64
+		expected  Price
+		formatted string
+	}{
+		{"USD", 17.675, 17.68, "17.68"},
+		{"JPY", 1234.5, 1235, "1235"},
+		{"KWD", 0.12345, 0.123, "0.123"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.code, func(t *testing.T) {
+			currency, err := LookupCurrency(tc.code)
+			if err != nil {
+				t.Fatalf("Expected %s to be known, got %v", tc.code, err)
+			}
+			if got := currency.Round(tc.amount); got != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, got)
+			}
+			if got := currency.Format(Price(tc.amount)); got != tc.formatted {
+				t.Errorf("Expected %s formatted, got %s", tc.formatted, got)
+			}
+		})
+	}
+}
+
+func TestPriceJSON(t *testing.T) {
+	tests := []struct {
+		price    Price
+		expected string
+	}{
+		{35.35, `"35.35"`},
+		{1250, `"1250.00"`},
+		{1.125, `"1.125"`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.expected, func(t *testing.T) {
+			data, err := json.Marshal(tc.price)
+			if err != nil {
+				t.Fatalf("Failed to marshal price: %v", err)
+			}
+			if string(data) != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, data)
+			}
+		})
+	}
+}
@@ -0,0 +1,350 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Canonical layouts that dates and times are normalized to, and which are
+// always accepted
+const (
+	DateLayout = "2006-01-02"
+	TimeLayout = "15:04"
+)
+
+// layoutNames are the names that may stand for a layout in Formats
+var layoutNames = map[string]string{
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"DateOnly":    time.DateOnly,
+	"TimeOnly":    time.TimeOnly,
+	"Kitchen":     time.Kitchen,
+}
+
+// Formats configures the layouts accepted when parsing dates and times
+type Formats struct {
+	// Go reference layouts, such as "01/02/2006", or the names RFC3339,
+	// RFC3339Nano, DateOnly, TimeOnly and Kitchen, tried after the
+	// canonical layout
+	DateLayouts []string
+	TimeLayouts []string
+
+	// Lenient also accepts surrounding spaces, numbers without leading
+	// zeros, and any case of AM and PM with or without dots and spaces.
+	// Otherwise values must match a layout exactly.
+	Lenient bool
+}
+
+// formats are the formats used by ParseDate, ParseTime and JSON decoding.
+// They are shared by the whole process, since JSON decoding has no way to
+// carry them per request.
+var formats atomic.Pointer[Formats]
+
+func init() {
+	formats.Store(&Formats{})
+}
+
+// SetFormats sets the formats used to parse dates and times, including those
+// decoded from JSON. The formats are process-wide: they apply to every
+// server, decoder and goroutine in the process, not to a single instance. It
+// is meant to be called once at startup.
+func SetFormats(f Formats) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	f.DateLayouts = resolveLayouts(f.DateLayouts)
+	f.TimeLayouts = resolveLayouts(f.TimeLayouts)
+	formats.Store(&f)
+	return nil
+}
+
+// CurrentFormats returns the formats set by SetFormats
+func CurrentFormats() Formats {
+	return *formats.Load()
+}
+
+// Validate checks that every date layout holds a year, month and day, and
+// every time layout an hour and minute
+func (f Formats) Validate() error {
+	reference := time.Date(2024, time.November, 28, 21, 37, 0, 0, time.UTC)
+	for _, layout := range resolveLayouts(f.DateLayouts) {
+		parsed, err := time.Parse(layout, reference.Format(layout))
+		if err != nil || parsed.YearDay() != reference.YearDay() || parsed.Year() != reference.Year() {
+			return fmt.Errorf("date layout %q must hold a year, month and day", layout)
+		}
+	}
+	for _, layout := range resolveLayouts(f.TimeLayouts) {
+		parsed, err := time.Parse(layout, reference.Format(layout))
+		if err != nil || parsed.Hour() != reference.Hour() || parsed.Minute() != reference.Minute() {
+			return fmt.Errorf("time layout %q must hold an hour and minute", layout)
+		}
+	}
+	return nil
+}
+
+// resolveLayouts replaces layout names with their layouts
+func resolveLayouts(layouts []string) []string {
+	resolved := make([]string, len(layouts))
+	for i, layout := range layouts {
+		if named, ok := layoutNames[layout]; ok {
+			layout = named
+		}
+		resolved[i] = layout
+	}
+	return resolved
+}
+
+var (
+	// meridiemPattern matches AM or PM in any case, with or without dots
+	meridiemPattern = regexp.MustCompile(`(?i)(\d)\s*([ap])\.?\s*m\.?$`)
+
+	// lenientLayout replaces the zero-padded month, day and 12-hour elements
+	// of a layout with ones that also accept a single digit, and drops the
+	// space before PM, which is also dropped from values
+	lenientLayout = strings.NewReplacer("01", "1", "02", "2", "03", "3", " PM", "PM")
+)
+
+// parse parses s with the canonical layout or one of layouts, returning the
+// error of the canonical layout when none match. zone is the UTC offset
+// written in s, such as Z or -06:00, or empty when the matching layout has no
+// offset.
+func (f Formats) parse(s, canonical string, layouts []string) (t time.Time, zone string, err error) {
+	t, canonicalErr := time.Parse(canonical, s)
+	if canonicalErr == nil {
+		return t, "", nil
+	}
+	candidates := layouts
+	if f.Lenient {
+		s = strings.TrimSpace(s)
+		if m := meridiemPattern.FindStringSubmatchIndex(s); m != nil {
+			s = s[:m[3]] + strings.ToUpper(s[m[4]:m[5]]) + "M"
+		}
+		candidates = nil
+		for _, layout := range append([]string{canonical}, layouts...) {
+			candidates = append(candidates, lenientLayout.Replace(layout))
+		}
+	}
+	for _, layout := range candidates {
+		if t, err := time.Parse(layout, s); err == nil {
+			if hasOffset(layout) {
+				zone = formatOffset(t)
+			}
+			return t, zone, nil
+		}
+	}
+	return time.Time{}, "", canonicalErr
+}
+
+// hasOffset reports whether a layout holds a numeric UTC offset, such as
+// the Z07:00 of RFC3339. Zone abbreviations are not offsets, since Go parses
+// unknown ones as UTC.
+func hasOffset(layout string) bool {
+	return strings.Contains(layout, "Z07") || strings.Contains(layout, "-07")
+}
+
+// formatOffset returns the UTC offset of t as Z or ±hh:mm
+func formatOffset(t time.Time) string {
+	_, offset := t.Zone()
+	if offset == 0 {
+		return "Z"
+	}
+	sign := '+'
+	if offset < 0 {
+		sign, offset = '-', -offset
+	}
+	return fmt.Sprintf("%c%02d:%02d", sign, offset/3600, offset%3600/60)
+}
+
+// Date is a calendar date, written as YYYY-MM-DD. A value that could not be
+// parsed is kept as given and reported by Validate.
+type Date struct {
+	year  int
+	month time.Month
+	day   int
+	zone  string // UTC offset written in the value, if any
+	valid bool
+	raw   string // Value that could not be parsed
+}
+
+// NewDate returns the date of the given year, month and day
+func NewDate(year int, month time.Month, day int) Date {
+	t := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	return Date{year: t.Year(), month: t.Month(), day: t.Day(), valid: true}
+}
+
+// ParseDate parses a date with the canonical layout or one of the layouts
+// accepted by the current formats, keeping any UTC offset written in s. On
+// failure the returned date keeps s, so it is reported by Validate.
+func ParseDate(s string) (Date, error) {
+	f := CurrentFormats()
+	t, zone, err := f.parse(s, DateLayout, f.DateLayouts)
+	if err != nil {
+		return Date{raw: s}, fmt.Errorf("invalid date format: %w", err)
+	}
+	d := NewDate(t.Date())
+	d.zone = zone
+	return d, nil
+}
+
+// MustParseDate parses a date like ParseDate, panicking if it is invalid
+func MustParseDate(s string) Date {
+	d, err := ParseDate(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// Year returns the year of the date
+func (d Date) Year() int { return d.year }
+
+// Month returns the month of the date
+func (d Date) Month() time.Month { return d.month }
+
+// Day returns the day of the month of the date
+func (d Date) Day() int { return d.day }
+
+// Zone returns the UTC offset written in the parsed value, such as Z or
+// -06:00, or an empty string when it had none
+func (d Date) Zone() string { return d.zone }
+
+// IsZero reports whether the date is unset
+func (d Date) IsZero() bool {
+	return !d.valid && d.raw == ""
+}
+
+// String returns the date as YYYY-MM-DD, or as given when it is invalid
+func (d Date) String() string {
+	if !d.valid {
+		return d.raw
+	}
+	return fmt.Sprintf("%04d-%02d-%02d", d.year, d.month, d.day)
+}
+
+// Validate checks that the date was parsed
+func (d Date) Validate() error {
+	if d.valid {
+		return nil
+	}
+	if _, err := time.Parse(DateLayout, d.raw); err != nil {
+		return fmt.Errorf("invalid date format: %w", err)
+	}
+	return errors.New("invalid date format")
+}
+
+// MarshalJSON writes the date as a YYYY-MM-DD string
+func (d Date) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON parses a date string with the current formats, keeping
+// invalid values for Validate to report
+func (d *Date) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*d, _ = ParseDate(s)
+	return nil
+}
+
+// Time is a time of day to the minute, written as HH:MM. A value that could
+// not be parsed is kept as given and reported by Validate.
+type Time struct {
+	hour   int
+	minute int
+	zone   string // UTC offset written in the value, if any
+	valid  bool
+	raw    string // Value that could not be parsed
+}
+
+// NewTime returns the time of the given hour and minute. A time out of
+// range is reported by Validate.
+func NewTime(hour, minute int) Time {
+	if hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return Time{raw: fmt.Sprintf("%02d:%02d", hour, minute)}
+	}
+	return Time{hour: hour, minute: minute, valid: true}
+}
+
+// ParseTime parses a time with the canonical layout or one of the layouts
+// accepted by the current formats, dropping any seconds and keeping any UTC
+// offset written in s. On failure the returned time keeps s, so it is
+// reported by Validate.
+func ParseTime(s string) (Time, error) {
+	f := CurrentFormats()
+	t, zone, err := f.parse(s, TimeLayout, f.TimeLayouts)
+	if err != nil {
+		return Time{raw: s}, fmt.Errorf("invalid time format: %w", err)
+	}
+	parsed := NewTime(t.Hour(), t.Minute())
+	parsed.zone = zone
+	return parsed, nil
+}
+
+// MustParseTime parses a time like ParseTime, panicking if it is invalid
+func MustParseTime(s string) Time {
+	t, err := ParseTime(s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Hour returns the hour of the time, from 0 to 23
+func (t Time) Hour() int { return t.hour }
+
+// Minute returns the minute of the time
+func (t Time) Minute() int { return t.minute }
+
+// Minutes returns the number of minutes since midnight
+func (t Time) Minutes() int { return t.hour*60 + t.minute }
+
+// Zone returns the UTC offset written in the parsed value, such as Z or
+// -06:00, or an empty string when it had none
+func (t Time) Zone() string { return t.zone }
+
+// IsZero reports whether the time is unset
+func (t Time) IsZero() bool {
+	return !t.valid && t.raw == ""
+}
+
+// String returns the time as HH:MM, or as given when it is invalid
+func (t Time) String() string {
+	if !t.valid {
+		return t.raw
+	}
+	return fmt.Sprintf("%02d:%02d", t.hour, t.minute)
+}
+
+// Validate checks that the time was parsed
+func (t Time) Validate() error {
+	if t.valid {
+		return nil
+	}
+	if _, err := time.Parse(TimeLayout, t.raw); err != nil {
+		return fmt.Errorf("invalid time format: %w", err)
+	}
+	return errors.New("invalid time format")
+}
+
+// MarshalJSON writes the time as an HH:MM string
+func (t Time) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+// UnmarshalJSON parses a time string with the current formats, keeping
+// invalid values for Validate to report
+func (t *Time) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*t, _ = ParseTime(s)
+	return nil
+}
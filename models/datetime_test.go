@@ -0,0 +1,237 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// useFormats sets the date and time formats for the duration of a test
+func useFormats(t *testing.T, f Formats) {
+	t.Helper()
+
+	previous := CurrentFormats()
+	if err := SetFormats(f); err != nil {
+		t.Fatalf("Failed to set formats: %v", err)
+	}
+	t.Cleanup(func() { formats.Store(&previous) })
+}
+
+func TestParseDate(t *testing.T) {
+	partner := Formats{DateLayouts: []string{"01/02/2006", "RFC3339"}}
+	lenient := Formats{DateLayouts: []string{"01/02/2006"}, Lenient: true}
+
+	tests := []struct {
+		name     string
+		formats  Formats
+		input    string
+		expected string // Empty when the date is invalid
+	}{
+		{"Canonical", Formats{}, "2022-01-02", "2022-01-02"},
+		{"Canonical only by default", Formats{}, "01/02/2022", ""},
+		{"Out of range", Formats{}, "2022-13-01", ""},
+		{"Extra layout", partner, "01/02/2022", "2022-01-02"},
+		{"Named layout", partner, "2022-01-02T23:30:00-05:00", "2022-01-02"},
+		{"Strict rejects unpadded", partner, "1/2/2022", ""},
+		{"Strict rejects spaces", partner, " 2022-01-02", ""},
+		{"Lenient accepts unpadded", lenient, "1/2/2022", "2022-01-02"},
+		{"Lenient accepts unpadded canonical", lenient, "2022-1-2", "2022-01-02"},
+		{"Lenient trims spaces", lenient, " 01/02/2022 ", "2022-01-02"},
+		{"Lenient still validates", lenient, "2/30/2022", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			useFormats(t, tc.formats)
+
+			date, err := ParseDate(tc.input)
+			if tc.expected == "" {
+				if err == nil {
+					t.Fatalf("Expected error, got date %s", date)
+				}
+				if date.String() != tc.input || date.Validate() == nil {
+					t.Errorf("Expected invalid date %q to be kept for Validate, got %q", tc.input, date)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if date.String() != tc.expected {
+				t.Errorf("Expected date %s, got %s", tc.expected, date)
+			}
+			if err := date.Validate(); err != nil {
+				t.Errorf("Expected valid date, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	partner := Formats{TimeLayouts: []string{"15:04:05", "Kitchen", "RFC3339"}}
+	lenient := Formats{TimeLayouts: []string{"Kitchen"}, Lenient: true}
+
+	tests := []struct {
+		name     string
+		formats  Formats
+		input    string
+		expected string // Empty when the time is invalid
+	}{
+		{"Canonical", Formats{}, "13:01", "13:01"},
+		{"Canonical only by default", Formats{}, "1:01PM", ""},
+		{"Out of range", Formats{}, "25:00", ""},
+		{"Seconds are dropped", partner, "13:01:59", "13:01"},
+		{"Kitchen", partner, "1:01PM", "13:01"},
+		{"RFC 3339", partner, "2022-01-02T13:01:00Z", "13:01"},
+		{"Strict rejects a spaced meridiem", partner, "1:01 PM", ""},
+		{"Lenient accepts a spaced meridiem", lenient, "1:05 PM", "13:05"},
+		{"Lenient accepts a dotted meridiem", lenient, "1:05 p.m.", "13:05"},
+		{"Lenient accepts midnight", lenient, "12:30am", "00:30"},
+		{"Lenient accepts an unpadded hour", lenient, "9:05", "09:05"},
+		{"Lenient still validates", lenient, "13:05 PM", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			useFormats(t, tc.formats)
+
+			parsed, err := ParseTime(tc.input)
+			if tc.expected == "" {
+				if err == nil {
+					t.Fatalf("Expected error, got time %s", parsed)
+				}
+				if parsed.Validate() == nil {
+					t.Errorf("Expected invalid time %q to be reported by Validate", tc.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if parsed.String() != tc.expected {
+				t.Errorf("Expected time %s, got %s", tc.expected, parsed)
+			}
+		})
+	}
+}
+
+func TestParsedZone(t *testing.T) {
+	useFormats(t, Formats{DateLayouts: []string{"RFC3339", "01/02/2006 MST"}, TimeLayouts: []string{"RFC3339", "15:04 -0700"}})
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"Canonical", "2022-01-02", ""},
+		{"UTC", "2022-01-02T13:01:00Z", "Z"},
+		{"Negative offset", "2022-01-02T13:01:00-05:00", "-05:00"},
+		{"Half-hour offset", "2022-01-02T13:01:00+05:30", "+05:30"},
+		{"Zone abbreviation", "01/02/2022 EST", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			date, err := ParseDate(tc.input)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if date.Zone() != tc.expected {
+				t.Errorf("Expected date zone %q, got %q", tc.expected, date.Zone())
+			}
+		})
+	}
+
+	parsed, err := ParseTime("13:01 -0600")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if parsed.String() != "13:01" || parsed.Zone() != "-06:00" {
+		t.Errorf("Expected 13:01 at -06:00, got %s at %q", parsed, parsed.Zone())
+	}
+}
+
+func TestSetFormats(t *testing.T) {
+	tests := []struct {
+		name    string
+		formats Formats
+		valid   bool
+	}{
+		{"Full date and time layouts", Formats{DateLayouts: []string{"02.01.2006", "DateOnly"}, TimeLayouts: []string{"3:04 PM", "TimeOnly"}}, true},
+		{"Date layout without a year", Formats{DateLayouts: []string{"01/02"}}, false},
+		{"Date layout without a day", Formats{DateLayouts: []string{"January 2006"}}, false},
+		{"Time layout without minutes", Formats{TimeLayouts: []string{"15h"}}, false},
+		{"Time layout without a meridiem", Formats{TimeLayouts: []string{"3:04"}}, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			previous := CurrentFormats()
+			t.Cleanup(func() { formats.Store(&previous) })
+
+			err := SetFormats(tc.formats)
+			if tc.valid && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if !tc.valid && err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestFormatsAreProcessWide(t *testing.T) {
+	useFormats(t, Formats{DateLayouts: []string{"01/02/2006"}})
+
+	// Formats set in one goroutine apply to parsing in every other
+	parsed := make(chan Receipt)
+	go func() {
+		var receipt Receipt
+		json.Unmarshal([]byte(`{"purchaseDate": "01/02/2022"}`), &receipt)
+		parsed <- receipt
+	}()
+	if receipt := <-parsed; receipt.PurchaseDate.Validate() != nil {
+		t.Errorf("Expected the date to be parsed with the process formats, got %q", receipt.PurchaseDate)
+	}
+
+	if err := SetFormats(Formats{}); err != nil {
+		t.Fatalf("Failed to set formats: %v", err)
+	}
+	if _, err := ParseDate("01/02/2022"); err == nil {
+		t.Error("Expected the replaced formats to reject the date, got nil")
+	}
+}
+
+func TestDateTimeJSON(t *testing.T) {
+	useFormats(t, Formats{DateLayouts: []string{"01/02/2006"}, TimeLayouts: []string{"Kitchen"}})
+
+	var receipt Receipt
+	if err := json.Unmarshal([]byte(`{"purchaseDate": "01/02/2022", "purchaseTime": "2:33PM"}`), &receipt); err != nil {
+		t.Fatalf("Failed to unmarshal receipt: %v", err)
+	}
+	if receipt.PurchaseDate.Day() != 2 || receipt.PurchaseTime.Minutes() != 14*60+33 {
+		t.Errorf("Expected 2022-01-02 14:33, got %s %s", receipt.PurchaseDate, receipt.PurchaseTime)
+	}
+
+	// Values are written in the canonical form
+	data, err := json.Marshal(struct {
+		Date Date `json:"date"`
+		Time Time `json:"time"`
+	}{receipt.PurchaseDate, receipt.PurchaseTime})
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	if string(data) != `{"date":"2022-01-02","time":"14:33"}` {
+		t.Errorf("Expected canonical JSON, got %s", data)
+	}
+
+	// Invalid values are kept for validation rather than failing decoding
+	if err := json.Unmarshal([]byte(`{"purchaseDate": "2022/01/02"}`), &receipt); err != nil {
+		t.Fatalf("Expected invalid date to decode, got %v", err)
+	}
+	if err := receipt.PurchaseDate.Validate(); err == nil {
+		t.Error("Expected invalid date to fail validation")
+	}
+	if err := json.Unmarshal([]byte(`{"purchaseDate": 20220102}`), &receipt); err == nil {
+		t.Error("Expected error for a date that is not a string")
+	}
+}
@@ -3,33 +3,11 @@ package models
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
-	"time"
 )
 
-// Date represents a date in YYYY-MM-DD format
-type Date string
-
-// Validate checks if the date is in the correct format
-func (d Date) Validate() error {
-	if _, err := time.Parse("2006-01-02", string(d)); err != nil {
-		return fmt.Errorf("invalid date format: %w", err)
-	}
-	return nil
-}
-
-// Time represents a time in HH:MM format
-type Time string
-
-// Validate checks if the time is in the correct format
-func (t Time) Validate() error {
-	if _, err := time.Parse("15:04", string(t)); err != nil {
-		return fmt.Errorf("invalid time format: %w", err)
-	}
-	return nil
-}
-
 // Price represents a price value that can be parsed from a string
 type Price float64
 
@@ -40,64 +18,160 @@ func (p *Price) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
-	val, err := strconv.ParseFloat(str, 64)
+	val, err := ParsePrice(str)
 	if err != nil {
-		return fmt.Errorf("invalid price format: %w", err)
+		return err
 	}
-	*p = Price(val)
+	*p = val
 	return nil
 }
 
+// ParsePrice parses a decimal price string such as "6.49"
+func ParsePrice(s string) (Price, error) {
+	val, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid price format: %w", err)
+	}
+	return Price(val), nil
+}
+
+// Cents returns the price in whole cents, rounding away float error
+func (p Price) Cents() int64 {
+	return int64(math.Round(float64(p) * 100))
+}
+
 // MarshalJSON custom marshaler for Price
 func (p Price) MarshalJSON() ([]byte, error) {
-	return json.Marshal(fmt.Sprintf("%.2f", float64(p)))
+	return json.Marshal(p.String())
+}
+
+// String formats a price with two decimals, or with up to four when it is in
+// a currency with finer minor units
+func (p Price) String() string {
+	for decimals := 2; decimals <= 4; decimals++ {
+		s := strconv.FormatFloat(float64(p), 'f', decimals, 64)
+		if v, _ := strconv.ParseFloat(s, 64); v == float64(p) {
+			return s
+		}
+	}
+	return strconv.FormatFloat(float64(p), 'f', 2, 64)
 }
 
 // Receipt represents a receipt submitted for processing
 type Receipt struct {
 	Retailer     string `json:"retailer"`
-	PurchaseDate Date   `json:"purchaseDate"` // YYYY-MM-DD
-	PurchaseTime Time   `json:"purchaseTime"` // HH:MM
+	PurchaseDate Date   `json:"purchaseDate"`        // Parsed from the accepted formats, written as YYYY-MM-DD
+	PurchaseTime Time   `json:"purchaseTime"`        // Parsed from the accepted formats, written as HH:MM
+	TimeZone     string `json:"timeZone,omitempty"`  // IANA zone or UTC offset of the date and time; empty uses any offset in them, else store local time
+	RefundOf     string `json:"refundOf,omitempty"`  // ID of the receipt refunded; refunds have negative amounts
+	Currency     string `json:"currency,omitempty"`  // ISO 4217 code of the amounts; empty means the base currency
+	AccountID    string `json:"accountId,omitempty"` // Loyalty account the receipt earns points into
+	Tenant       string `json:"tenant,omitempty"`    // Tenant the receipt belongs to, used to scope event streams
 	Items        []Item `json:"items"`
-	Total        Price  `json:"total"` // Price type handles parsing
+	Subtotal     Price  `json:"subtotal,omitempty"` // Sum of the item prices, before receipt discounts
+	Tax          Price  `json:"tax,omitempty"`
+	Tip          Price  `json:"tip,omitempty"`
+	Discounts    Price  `json:"discounts,omitempty"` // Taken off the whole receipt, such as coupons
+	Total        Price  `json:"total"`               // Price type handles parsing
 }
 
-// Validate performs validation on the receipt and all its fields
+// Validate performs validation on the receipt and all its fields, returning
+// the first problem found
 func (r *Receipt) Validate() error {
+	if errs := r.ValidateAll(); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// ValidateAll performs validation on the receipt and all its fields, returning
+// every problem found in field order
+func (r *Receipt) ValidateAll() []error {
+	var errs []error
+
 	// Check required fields
 	if strings.TrimSpace(r.Retailer) == "" {
-		return fmt.Errorf("retailer is required")
+		errs = append(errs, fmt.Errorf("retailer is required"))
 	}
 
 	// Validate purchase date
 	if err := r.PurchaseDate.Validate(); err != nil {
-		return err
+		errs = append(errs, err)
 	}
 
 	// Validate purchase time
 	if err := r.PurchaseTime.Validate(); err != nil {
-		return err
+		errs = append(errs, err)
+	}
+
+	// Validate the optional time zone against any offsets in the date and time
+	if err := r.validateZone(); err != nil {
+		errs = append(errs, err)
+	}
+
+	// Validate the optional currency and the precision of the amounts in it
+	if r.Currency != "" {
+		if currency, err := LookupCurrency(r.Currency); err != nil {
+			errs = append(errs, err)
+		} else {
+			errs = append(errs, r.validateAmounts(currency)...)
+		}
 	}
 
 	// Require at least one item
 	if len(r.Items) == 0 {
-		return fmt.Errorf("at least one item is required")
+		errs = append(errs, fmt.Errorf("at least one item is required"))
 	}
 
-	// Validate each item
+	// Validate each item. Only refunds may have negative prices.
 	for i, item := range r.Items {
 		if err := item.Validate(); err != nil {
-			return fmt.Errorf("item %d: %w", i+1, err)
+			errs = append(errs, fmt.Errorf("item %d: %w", i+1, err))
+		} else if !r.IsRefund() && item.Price < 0 {
+			errs = append(errs, fmt.Errorf("item %d: price must not be negative, got %.2f", i+1, float64(item.Price)))
+		} else if r.IsRefund() && item.Price > 0 {
+			errs = append(errs, fmt.Errorf("item %d: price of a refunded item must not be positive, got %.2f", i+1, float64(item.Price)))
 		}
 	}
 
-	return nil
+	// Validate the sign of the total
+	if !r.IsRefund() && r.Total < 0 {
+		errs = append(errs, fmt.Errorf("total must not be negative, got %.2f", float64(r.Total)))
+	} else if r.IsRefund() && r.Total >= 0 {
+		errs = append(errs, fmt.Errorf("total of a refund must be negative, got %.2f", float64(r.Total)))
+	}
+
+	// Validate the optional amounts reconciled against the total, which are
+	// reversed on refunds like the items
+	for _, amount := range []struct {
+		name  string
+		value Price
+	}{{"subtotal", r.Subtotal}, {"tax", r.Tax}, {"tip", r.Tip}, {"discounts", r.Discounts}} {
+		if !r.IsRefund() && amount.value < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative, got %.2f", amount.name, float64(amount.value)))
+		} else if r.IsRefund() && amount.value > 0 {
+			errs = append(errs, fmt.Errorf("%s of a refund must not be positive, got %.2f", amount.name, float64(amount.value)))
+		}
+	}
+
+	return errs
 }
 
-// Item represents an individual item on a receipt
+// ItemPriceTolerance is how far an item price may be from its quantity times
+// its unit price less its discount, allowing for rounding
+const ItemPriceTolerance = 0.01
+
+// Item represents an individual item on a receipt. Every field but the
+// description and price is optional and omitted when zero.
 type Item struct {
-	ShortDescription string `json:"shortDescription"`
-	Price            Price  `json:"price"` // Price type handles parsing
+	ShortDescription string  `json:"shortDescription"`
+	Price            Price   `json:"price"`               // Line total, after any discount
+	Quantity         float64 `json:"quantity,omitempty"`  // Units or weight sold
+	UnitPrice        Price   `json:"unitPrice,omitempty"` // Price of one unit before any discount
+	Discount         Price   `json:"discount,omitempty"`  // Amount taken off the line
+	SKU              string  `json:"sku,omitempty"`       // Retailer stock keeping unit
+	UPC              string  `json:"upc,omitempty"`       // UPC-A or EAN-13 barcode
+	Category         string  `json:"category,omitempty"`
 }
 
 // Validate checks if the item is valid
@@ -105,10 +179,66 @@ func (i *Item) Validate() error {
 	if strings.TrimSpace(i.ShortDescription) == "" {
 		return fmt.Errorf("short description is required")
 	}
+	if i.Quantity < 0 {
+		return fmt.Errorf("quantity must not be negative, got %g", i.Quantity)
+	}
+	if i.UnitPrice < 0 {
+		return fmt.Errorf("unit price must not be negative, got %.2f", float64(i.UnitPrice))
+	}
+	if i.Discount < 0 {
+		return fmt.Errorf("discount must not be negative, got %.2f", float64(i.Discount))
+	}
+	if i.Quantity > 0 && i.UnitPrice > 0 {
+		// Refunded items have negative prices for positive quantities
+		expected := i.Quantity*float64(i.UnitPrice) - float64(i.Discount)
+		if math.Abs(expected-math.Abs(float64(i.Price))) > ItemPriceTolerance+1e-9 {
+			return fmt.Errorf("price %.2f does not match quantity %g at unit price %.2f less discount %.2f",
+				float64(i.Price), i.Quantity, float64(i.UnitPrice), float64(i.Discount))
+		}
+	}
+	if i.UPC != "" && !validUPC(i.UPC) {
+		return fmt.Errorf("invalid upc %q, expected 12 or 13 digits with a valid check digit", i.UPC)
+	}
 
 	return nil
 }
 
+// Units returns the number of units of the item: its quantity when that is a
+// whole number, and 1 for items without a quantity or sold by weight
+func (i *Item) Units() int {
+	if i.Quantity >= 1 && i.Quantity == math.Trunc(i.Quantity) {
+		return int(i.Quantity)
+	}
+	return 1
+}
+
+// validUPC checks the length and check digit of a UPC-A or EAN-13 code
+func validUPC(code string) bool {
+	if len(code) != 12 && len(code) != 13 {
+		return false
+	}
+	sum := 0
+	for i := range code {
+		d := code[len(code)-1-i]
+		if d < '0' || d > '9' {
+			return false
+		}
+		// From the right, the check digit and every other digit have weight
+		// 1, and the digits between them weight 3
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += int(d-'0') * weight
+	}
+	return sum%10 == 0
+}
+
+// IsRefund reports whether the receipt refunds an earlier receipt
+func (r Receipt) IsRefund() bool {
+	return r.RefundOf != ""
+}
+
 // ReceiptResponse is returned when processing a receipt
 type ReceiptResponse struct {
 	ID string `json:"id"`
@@ -118,3 +248,17 @@ type ReceiptResponse struct {
 type PointsResponse struct {
 	Points int `json:"points"`
 }
+
+// RuleResult records the points a single rule awarded to a receipt
+type RuleResult struct {
+	Rule   string `json:"rule"`
+	Points int    `json:"points"`
+}
+
+// PointsBreakdown is the total points for a receipt along with the result of every rule
+type PointsBreakdown struct {
+	Total          int             `json:"total"`
+	Rules          []RuleResult    `json:"rules"`
+	Reconciliation *Reconciliation `json:"reconciliation,omitempty"` // Set when the total did not reconcile
+	Conversion     *Conversion     `json:"conversion,omitempty"`     // Set when the receipt names its currency
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 )
 
@@ -9,8 +10,8 @@ func TestReceiptJSON(t *testing.T) {
 	// Test marshaling and unmarshaling Receipt
 	receipt := Receipt{
 		Retailer:     "Target",
-		PurchaseDate: Date("2022-01-01"),
-		PurchaseTime: Time("13:01"),
+		PurchaseDate: MustParseDate("2022-01-01"),
+		PurchaseTime: MustParseTime("13:01"),
 		Items: []Item{
 			{ShortDescription: "Item 1", Price: 5.99},
 			{ShortDescription: "Item 2", Price: 10.00},
@@ -98,4 +99,99 @@ func TestPointsResponseJSON(t *testing.T) {
 	if unmarshaledResponse.Points != response.Points {
 		t.Errorf("Expected points %d, got %d", response.Points, unmarshaledResponse.Points)
 	}
-}
\ No newline at end of file
+}
+
+func TestReceiptValidateAll(t *testing.T) {
+	receipt := Receipt{
+		Retailer:     " ",
+		PurchaseTime: MustParseTime("13:01"),
+		Items: []Item{
+			{ShortDescription: "Item 1", Price: 5.99},
+			{ShortDescription: "", Price: 10.00},
+		},
+		Total: 15.99,
+	}
+
+	receipt.PurchaseDate, _ = ParseDate("2022-13-01")
+
+	errs := receipt.ValidateAll()
+	expected := []string{"retailer is required", "invalid date format", "item 2: short description is required"}
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d errors, got %d: %v", len(expected), len(errs), errs)
+	}
+	for i, prefix := range expected {
+		if !strings.HasPrefix(errs[i].Error(), prefix) {
+			t.Errorf("Expected error %d to start with %q, got %q", i, prefix, errs[i].Error())
+		}
+	}
+
+	// Validate reports the first problem only
+	if err := receipt.Validate(); err == nil || err.Error() != "retailer is required" {
+		t.Errorf("Expected first error 'retailer is required', got %v", err)
+	}
+
+	receipt.Retailer = "Target"
+	receipt.PurchaseDate = MustParseDate("2022-01-01")
+	receipt.Items[1].ShortDescription = "Item 2"
+	if errs := receipt.ValidateAll(); len(errs) != 0 {
+		t.Errorf("Expected no errors, got %v", errs)
+	}
+}
+
+func TestItemValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		item  Item
+		error string // Expected error prefix, empty when valid
+	}{
+		{"Description and price only", Item{ShortDescription: "Milk", Price: 1.50}, ""},
+		{"Quantity matches price", Item{ShortDescription: "Milk", Price: 4.50, Quantity: 3, UnitPrice: 1.50}, ""},
+		{"Discount is taken off", Item{ShortDescription: "Milk", Price: 4.00, Quantity: 3, UnitPrice: 1.50, Discount: 0.50}, ""},
+		{"Rounded weight", Item{ShortDescription: "Apples", Price: 4.49, Quantity: 1.5, UnitPrice: 2.99}, ""},
+		{"Quantity without unit price", Item{ShortDescription: "Milk", Price: 4.50, Quantity: 3}, ""},
+		{"Price off by more than a cent", Item{ShortDescription: "Milk", Price: 4.52, Quantity: 3, UnitPrice: 1.50}, "price 4.52 does not match"},
+		{"Negative quantity", Item{ShortDescription: "Milk", Price: 1.50, Quantity: -1}, "quantity must not be negative"},
+		{"Negative discount", Item{ShortDescription: "Milk", Price: 1.50, Discount: -1}, "discount must not be negative"},
+		{"UPC-A", Item{ShortDescription: "Soda", Price: 1.00, UPC: "036000291452"}, ""},
+		{"EAN-13", Item{ShortDescription: "Pens", Price: 1.00, UPC: "4006381333931"}, ""},
+		{"Bad check digit", Item{ShortDescription: "Soda", Price: 1.00, UPC: "036000291453"}, "invalid upc"},
+		{"Letters in UPC", Item{ShortDescription: "Soda", Price: 1.00, UPC: "03600029145A"}, "invalid upc"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.item.Validate()
+			if tc.error == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tc.error) {
+				t.Errorf("Expected error starting with %q, got %v", tc.error, err)
+			}
+		})
+	}
+}
+
+func TestItemJSONCompatibility(t *testing.T) {
+	// Items without details keep the original shape
+	data, err := json.Marshal(Item{ShortDescription: "Gum", Price: 1.00})
+	if err != nil {
+		t.Fatalf("Failed to marshal item: %v", err)
+	}
+	if string(data) != `{"shortDescription":"Gum","price":"1.00"}` {
+		t.Errorf("Expected only description and price, got %s", data)
+	}
+
+	var item Item
+	if err := json.Unmarshal([]byte(`{"shortDescription":"Milk","price":"4.00","quantity":3,"unitPrice":"1.50","discount":"0.50","sku":"MLK-1","category":"Dairy"}`), &item); err != nil {
+		t.Fatalf("Failed to unmarshal item: %v", err)
+	}
+	if item.Quantity != 3 || item.UnitPrice != 1.50 || item.Discount != 0.50 || item.SKU != "MLK-1" || item.Category != "Dairy" {
+		t.Errorf("Expected every detail to be read, got %+v", item)
+	}
+	if item.Units() != 3 {
+		t.Errorf("Expected 3 units, got %d", item.Units())
+	}
+}
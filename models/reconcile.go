@@ -0,0 +1,63 @@
+package models
+
+import (
+	"fmt"
+	"math"
+)
+
+// Reconciliation records how a receipt total failed to add up, for fraud review
+type Reconciliation struct {
+	Expected   Price    `json:"expected"`   // Item sum less discounts plus tax and tip
+	Difference Price    `json:"difference"` // Total less the expected total
+	Problems   []string `json:"problems"`
+}
+
+// Reconcile checks that the item prices, less discounts, plus tax and tip add
+// up to the total, and that the subtotal, when given, matches the item sum.
+// Amounts may differ by up to tolerance to allow for rounding, and sums are
+// rounded to the minor unit of the receipt's currency. It returns nil when
+// the receipt reconciles.
+func (r Receipt) Reconcile(tolerance float64) *Reconciliation {
+	c := r.amountCurrency()
+
+	var sum float64
+	for _, item := range r.Items {
+		sum += float64(item.Price)
+	}
+	itemSum := c.Round(sum)
+	expected := c.Round(float64(itemSum) - float64(r.Discounts) + float64(r.Tax) + float64(r.Tip))
+	difference := c.Round(float64(r.Total) - float64(expected))
+
+	var problems []string
+	if r.Subtotal != 0 && exceeds(float64(r.Subtotal)-float64(itemSum), tolerance) {
+		problems = append(problems, fmt.Sprintf("subtotal %s does not match item sum %s",
+			c.Format(r.Subtotal), c.Format(itemSum)))
+	}
+	if exceeds(float64(difference), tolerance) {
+		problems = append(problems, fmt.Sprintf("total %s does not match items %s less discounts %s plus tax %s and tip %s",
+			c.Format(r.Total), c.Format(itemSum), c.Format(r.Discounts), c.Format(r.Tax), c.Format(r.Tip)))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return &Reconciliation{
+		Expected:   expected,
+		Difference: difference,
+		Problems:   problems,
+	}
+}
+
+// amountCurrency returns the currency of the receipt's amounts. Receipts
+// without a known currency are taken to be in one with cents.
+func (r Receipt) amountCurrency() Currency {
+	if c, err := LookupCurrency(r.Currency); err == nil {
+		return c
+	}
+	return Currency{Code: r.Currency, MinorUnits: 2}
+}
+
+// exceeds reports whether difference is outside tolerance, allowing for float
+// error in amounts that differ by exactly the tolerance
+func exceeds(difference, tolerance float64) bool {
+	return math.Abs(difference) > tolerance+1e-9
+}
@@ -0,0 +1,84 @@
+package models
+
+import "testing"
+
+func TestReconcile(t *testing.T) {
+	items := []Item{
+		{ShortDescription: "Milk", Price: 3.99},
+		{ShortDescription: "Bread", Price: 2.51},
+	}
+
+	tests := []struct {
+		name     string
+		receipt  Receipt
+		problems int
+	}{
+		{"Items only", Receipt{Items: items, Total: 6.50}, 0},
+		{"Tax, tip and discounts", Receipt{Items: items, Tax: 0.52, Tip: 1.00, Discounts: 0.50, Total: 7.52}, 0},
+		{"Matching subtotal", Receipt{Items: items, Subtotal: 6.50, Tax: 0.52, Total: 7.02}, 0},
+		{"Taxed refund", Receipt{RefundOf: "id", Items: []Item{{ShortDescription: "Milk", Price: -3.99}}, Subtotal: -3.99, Tax: -0.32, Discounts: -0.50, Total: -3.81}, 0},
+		{"Within tolerance", Receipt{Items: items, Total: 6.51}, 0},
+		{"Total above items", Receipt{Items: items, Total: 100.00}, 1},
+		{"Total below items", Receipt{Items: items, Total: 6.00}, 1},
+		{"Missing tax", Receipt{Items: items, Total: 7.02}, 1},
+		{"Subtotal not matching items", Receipt{Items: items, Subtotal: 7.50, Tax: 0.52, Total: 7.02}, 1},
+		{"Subtotal and total not matching", Receipt{Items: items, Subtotal: 7.50, Total: 8.00}, 2},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result := tc.receipt.Reconcile(0.01)
+			if tc.problems == 0 {
+				if result != nil {
+					t.Errorf("Expected receipt to reconcile, got %+v", result)
+				}
+				return
+			}
+			if result == nil {
+				t.Fatal("Expected receipt not to reconcile, got nil")
+			}
+			if len(result.Problems) != tc.problems {
+				t.Errorf("Expected %d problems, got %v", tc.problems, result.Problems)
+			}
+		})
+	}
+
+	result := Receipt{Items: items, Tax: 0.52, Total: 100.00}.Reconcile(0.01)
+	if result == nil || result.Expected != 7.02 || result.Difference != 92.98 {
+		t.Errorf("Expected 7.02 expected and 92.98 difference, got %+v", result)
+	}
+}
+
+func TestReconcileMinorUnits(t *testing.T) {
+	tests := []struct {
+		name       string
+		receipt    Receipt
+		tolerance  float64
+		difference Price // Zero when the receipt reconciles
+		problem    string
+	}{
+		{"Whole yen", Receipt{Currency: "JPY", Items: []Item{{ShortDescription: "Onigiri", Price: 150}, {ShortDescription: "Tea", Price: 130}}, Tax: 28, Total: 308}, 0.5, 0, ""},
+		{"Yen off by one", Receipt{Currency: "JPY", Items: []Item{{ShortDescription: "Onigiri", Price: 150}}, Total: 151}, 0.5, 1,
+			"total 151 does not match items 150 less discounts 0 plus tax 0 and tip 0"},
+		{"Dinar off by a fils", Receipt{Currency: "KWD", Items: []Item{{ShortDescription: "Tea", Price: 1.004}, {ShortDescription: "Milk", Price: 1.004}}, Total: 2.012}, 0.001, 0.004,
+			"total 2.012 does not match items 2.008 less discounts 0.000 plus tax 0.000 and tip 0.000"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result := tc.receipt.Reconcile(tc.tolerance)
+			if tc.difference == 0 {
+				if result != nil {
+					t.Errorf("Expected receipt to reconcile, got %+v", result)
+				}
+				return
+			}
+			if result == nil {
+				t.Fatal("Expected receipt not to reconcile, got nil")
+			}
+			if result.Difference != tc.difference || len(result.Problems) != 1 || result.Problems[0] != tc.problem {
+				t.Errorf("Expected difference %v and problem %q, got %+v", tc.difference, tc.problem, result)
+			}
+		})
+	}
+}
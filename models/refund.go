@@ -0,0 +1,43 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// LedgerKind is the kind of change a points ledger entry records
+type LedgerKind string
+
+const (
+	LedgerEarn     LedgerKind = "earn"     // Points awarded to a receipt
+	LedgerClawback LedgerKind = "clawback" // Points taken back by a refund
+	LedgerAdjust   LedgerKind = "adjust"   // Points added or removed by hand, such as goodwill
+	LedgerRedeem   LedgerKind = "redeem"   // Points spent by an account holder
+	LedgerExpire   LedgerKind = "expire"   // Points that lapsed unspent
+)
+
+// LedgerEntry is a change to the points held by a receipt
+type LedgerEntry struct {
+	ReceiptID string     `json:"receiptId"` // Receipt whose points changed
+	Kind      LedgerKind `json:"kind"`
+	Points    int        `json:"points"`             // Negative for clawbacks
+	RefundID  string     `json:"refundId,omitempty"` // Refund that clawed the points back
+	At        time.Time  `json:"at"`
+}
+
+// LedgerResponse is returned when querying the points ledger of a receipt
+type LedgerResponse struct {
+	Points  int           `json:"points"` // Points held after clawbacks
+	Entries []LedgerEntry `json:"entries"`
+}
+
+// ClawbackPoints returns the points due back from a receipt awarded points
+// for total once refunded has been refunded in all. Points are clawed back in
+// proportion to the amount refunded, so refunding the whole total claws back
+// every point.
+func ClawbackPoints(points int, total, refunded Price) int {
+	if total.Cents() <= 0 || refunded.Cents() >= total.Cents() {
+		return points
+	}
+	return int(math.Round(float64(points) * float64(refunded.Cents()) / float64(total.Cents())))
+}
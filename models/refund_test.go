@@ -0,0 +1,83 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRefundValidation(t *testing.T) {
+	valid := func() Receipt {
+		return Receipt{
+			Retailer:     "Target",
+			PurchaseDate: MustParseDate("2022-01-01"),
+			PurchaseTime: MustParseTime("13:01"),
+			Items:        []Item{{ShortDescription: "Pepsi - 12-oz", Price: 1.25}},
+			Total:        1.25,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(*Receipt)
+		expected string // Prefix of the error, empty when valid
+	}{
+		{"Purchase", func(r *Receipt) {}, ""},
+		{"Purchase with a negative item", func(r *Receipt) { r.Items[0].Price = -1.25 }, "item 1: price must not be negative"},
+		{"Purchase with a negative total", func(r *Receipt) { r.Total = -1.25 }, "total must not be negative"},
+		{"Refund", func(r *Receipt) { r.RefundOf, r.Items[0].Price, r.Total = "id", -1.25, -1.25 }, ""},
+		{"Refund with a quantity", func(r *Receipt) {
+			r.RefundOf, r.Total = "id", -2.50
+			r.Items[0] = Item{ShortDescription: "Pepsi", Price: -2.50, Quantity: 2, UnitPrice: 1.25}
+		}, ""},
+		{"Taxed refund", func(r *Receipt) {
+			r.RefundOf, r.Items[0].Price, r.Subtotal, r.Tax, r.Tip, r.Discounts, r.Total = "id", -1.25, -1.25, -0.10, -0.20, -0.05, -1.50
+		}, ""},
+		{"Refund with a positive tax", func(r *Receipt) {
+			r.RefundOf, r.Items[0].Price, r.Tax, r.Total = "id", -1.25, 0.10, -1.15
+		}, "tax of a refund must not be positive"},
+		{"Refund with a positive item", func(r *Receipt) { r.RefundOf, r.Total = "id", -1.25 }, "item 1: price of a refunded item must not be positive"},
+		{"Refund with a positive total", func(r *Receipt) { r.RefundOf, r.Items[0].Price = "id", -1.25 }, "total of a refund must be negative"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			receipt := valid()
+			tc.modify(&receipt)
+
+			err := receipt.Validate()
+			if tc.expected == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tc.expected) {
+				t.Errorf("Expected error starting with %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestClawbackPoints(t *testing.T) {
+	tests := []struct {
+		name     string
+		points   int
+		total    Price
+		refunded Price
+		expected int
+	}{
+		{"Nothing refunded", 100, 40.00, 0, 0},
+		{"Quarter refunded", 100, 40.00, 10.00, 25},
+		{"Rounded", 101, 40.00, 10.00, 25},
+		{"Everything refunded", 101, 40.00, 40.00, 101},
+		{"Free receipt", 10, 0, 0, 10},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ClawbackPoints(tc.points, tc.total, tc.refunded); got != tc.expected {
+				t.Errorf("Expected %d points clawed back, got %d", tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// offsetPattern matches UTC offsets such as "+05:30", "-0700" or "UTC-5"
+var offsetPattern = regexp.MustCompile(`^(?i:UTC|GMT)?([+-])(\d{1,2})(?::?(\d{2}))?$`)
+
+// zones caches loaded locations by name, since loading reads the zone database
+var zones sync.Map
+
+// LoadZone returns the location of an IANA time zone name, such as
+// "America/Chicago", or a UTC offset, such as "Z", "+05:30" or "UTC-7"
+func LoadZone(name string) (*time.Location, error) {
+	if loc, ok := zones.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+
+	var loc *time.Location
+	switch upper := strings.ToUpper(name); {
+	case upper == "Z" || upper == "UTC" || upper == "GMT":
+		loc = time.UTC
+	case offsetPattern.MatchString(name):
+		m := offsetPattern.FindStringSubmatch(name)
+		hours, _ := strconv.Atoi(m[2])
+		minutes, _ := strconv.Atoi(m[3])
+		if hours > 14 || minutes > 59 {
+			return nil, fmt.Errorf("invalid time zone %q: offset out of range", name)
+		}
+		offset := hours*3600 + minutes*60
+		if m[1] == "-" {
+			offset = -offset
+		}
+		loc = time.FixedZone(name, offset)
+	case name == "" || name == "Local":
+		// The zone of the server is not a zone of the receipt
+		return nil, fmt.Errorf("invalid time zone %q", name)
+	default:
+		var err error
+		if loc, err = time.LoadLocation(name); err != nil {
+			return nil, fmt.Errorf("invalid time zone %q: %w", name, err)
+		}
+	}
+	zones.Store(name, loc)
+	return loc, nil
+}
+
+// Zone returns the time zone of the purchase date and time: TimeZone when it
+// is set, or else the UTC offset written in the purchase time or date, such
+// as the Z of an RFC3339 timestamp. An empty zone means store local time.
+func (r Receipt) Zone() string {
+	switch {
+	case r.TimeZone != "":
+		return r.TimeZone
+	case r.PurchaseTime.Zone() != "":
+		return r.PurchaseTime.Zone()
+	default:
+		return r.PurchaseDate.Zone()
+	}
+}
+
+// validateZone checks the time zone, and that the UTC offsets written in the
+// purchase date and time agree with it at the time of purchase
+func (r Receipt) validateZone() error {
+	zone := r.Zone()
+	if zone == "" {
+		return nil
+	}
+	loc, err := LoadZone(zone)
+	if err != nil {
+		return err
+	}
+	if r.PurchaseDate.Validate() != nil || r.PurchaseTime.Validate() != nil {
+		return nil
+	}
+
+	_, want := r.at(loc).Zone()
+	for _, offset := range []string{r.PurchaseDate.Zone(), r.PurchaseTime.Zone()} {
+		if offset == "" {
+			continue
+		}
+		written, err := LoadZone(offset)
+		if err != nil {
+			return err
+		}
+		if _, got := r.at(written).Zone(); got != want {
+			return fmt.Errorf("invalid time zone: offset %s of the purchase date and time conflicts with time zone %s", offset, zone)
+		}
+	}
+	return nil
+}
+
+// at returns the purchase date and time as an instant in loc
+func (r Receipt) at(loc *time.Location) time.Time {
+	return time.Date(r.PurchaseDate.Year(), r.PurchaseDate.Month(), r.PurchaseDate.Day(),
+		r.PurchaseTime.Hour(), r.PurchaseTime.Minute(), 0, 0, loc)
+}
+
+// In returns the receipt with its purchase date and time converted from its
+// zone to loc. Receipts without a valid zone, date and time are returned
+// unchanged. Conversions follow the daylight saving time rules of both zones
+// on the purchase date.
+func (r Receipt) In(loc *time.Location) Receipt {
+	if r.Zone() == "" || r.PurchaseDate.Validate() != nil || r.PurchaseTime.Validate() != nil {
+		return r
+	}
+	from, err := LoadZone(r.Zone())
+	if err != nil {
+		return r
+	}
+
+	t := r.at(from).In(loc)
+	r.PurchaseDate = NewDate(t.Date())
+	r.PurchaseTime = NewTime(t.Hour(), t.Minute())
+	r.TimeZone = loc.String()
+	return r
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadZone(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset int // Offset in seconds on 2024-01-15
+		valid  bool
+	}{
+		{"America/Chicago", -6 * 3600, true},
+		{"Europe/Berlin", 3600, true},
+		{"UTC", 0, true},
+		{"Z", 0, true},
+		{"+05:30", 5*3600 + 30*60, true},
+		{"-0700", -7 * 3600, true},
+		{"UTC-5", -5 * 3600, true},
+		{"+15:00", 0, false},
+		{"Mars/Olympus_Mons", 0, false},
+		{"Local", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			loc, err := LoadZone(tc.name)
+			if !tc.valid {
+				if err == nil {
+					t.Errorf("Expected error for zone %q, got nil", tc.name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			_, offset := time.Date(2024, time.January, 15, 12, 0, 0, 0, loc).Zone()
+			if offset != tc.offset {
+				t.Errorf("Expected offset %d, got %d", tc.offset, offset)
+			}
+		})
+	}
+}
+
+func TestReceiptIn(t *testing.T) {
+	newYork, err := LoadZone("America/New_York")
+	if err != nil {
+		t.Fatalf("Failed to load zone: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		date     string
+		time     string
+		zone     string
+		expected string // Local date and time in New York
+	}{
+		{"Standard time", "2024-01-15", "19:30", "UTC", "2024-01-15 14:30"},
+		{"Daylight saving time", "2024-07-15", "19:30", "UTC", "2024-07-15 15:30"},
+		{"Before spring forward", "2024-03-10", "06:30", "UTC", "2024-03-10 01:30"},
+		{"After spring forward", "2024-03-10", "07:30", "UTC", "2024-03-10 03:30"},
+		{"Before fall back", "2024-11-03", "05:30", "UTC", "2024-11-03 01:30"},
+		{"After fall back", "2024-11-03", "06:30", "UTC", "2024-11-03 01:30"},
+		{"Previous day", "2024-03-10", "04:30", "UTC", "2024-03-09 23:30"},
+		{"Offset", "2024-07-15", "21:30", "+02:00", "2024-07-15 15:30"},
+		{"No zone", "2024-07-15", "19:30", "", "2024-07-15 19:30"},
+		{"Invalid zone", "2024-07-15", "19:30", "Nowhere", "2024-07-15 19:30"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			receipt := Receipt{
+				PurchaseDate: MustParseDate(tc.date),
+				PurchaseTime: MustParseTime(tc.time),
+				TimeZone:     tc.zone,
+			}
+			local := receipt.In(newYork)
+			if got := local.PurchaseDate.String() + " " + local.PurchaseTime.String(); got != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestReceiptZone(t *testing.T) {
+	useFormats(t, Formats{DateLayouts: []string{"RFC3339"}, TimeLayouts: []string{"RFC3339"}})
+
+	tests := []struct {
+		name     string
+		date     string
+		time     string
+		zone     string
+		expected string // Empty when the offset conflicts with the zone
+	}{
+		{"Offset of the timestamp", "2024-07-15T19:30:00Z", "2024-07-15T19:30:00Z", "", "Z"},
+		{"Offset of the time alone", "2024-07-15", "2024-07-15T19:30:00+02:00", "", "+02:00"},
+		{"Explicit zone", "2024-07-15", "19:30", "America/Chicago", "America/Chicago"},
+		{"Matching offset", "2024-07-15T14:30:00-05:00", "2024-07-15T14:30:00-05:00", "America/Chicago", "America/Chicago"},
+		{"Matching offset in standard time", "2024-01-15T14:30:00-06:00", "2024-01-15T14:30:00-06:00", "America/Chicago", "America/Chicago"},
+		{"Offset conflicting with the zone", "2024-07-15T19:30:00Z", "2024-07-15T19:30:00Z", "America/Chicago", ""},
+		{"Date and time offsets conflicting", "2024-07-15T19:30:00Z", "2024-07-15T19:30:00+02:00", "", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			receipt := Receipt{
+				Retailer:     "Target",
+				PurchaseDate: MustParseDate(tc.date),
+				PurchaseTime: MustParseTime(tc.time),
+				TimeZone:     tc.zone,
+				Items:        []Item{{ShortDescription: "Gum", Price: 1}},
+				Total:        1,
+			}
+
+			err := receipt.Validate()
+			if tc.expected == "" {
+				if err == nil || !strings.HasPrefix(err.Error(), "invalid time zone") {
+					t.Errorf("Expected an invalid time zone, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if receipt.Zone() != tc.expected {
+				t.Errorf("Expected zone %q, got %q", tc.expected, receipt.Zone())
+			}
+		})
+	}
+}
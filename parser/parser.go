@@ -0,0 +1,434 @@
+// Package parser extracts receipts from the text of printed receipts, such
+// as the dumps produced by store kiosks. It recognizes the common layout of
+// a retailer name at the top, a purchase date and time, one item per line
+// with its price at the end, and a total, and reports how confident it is
+// along with the lines it could not interpret.
+package parser
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marcelorm/receipt-processor/models"
+)
+
+// Fields reported as missing when they cannot be found
+const (
+	FieldRetailer     = "retailer"
+	FieldPurchaseDate = "purchaseDate"
+	FieldPurchaseTime = "purchaseTime"
+	FieldItems        = "items"
+	FieldTotal        = "total"
+)
+
+// Line is a line of the receipt text
+type Line struct {
+	Number int    `json:"line"` // 1-based line number
+	Text   string `json:"text"`
+}
+
+// Result is a receipt extracted from text
+type Result struct {
+	Receipt    models.Receipt `json:"receipt"`
+	Confidence float64        `json:"confidence"`         // From 0 to 1
+	Missing    []string       `json:"missing,omitempty"`  // Fields that could not be found
+	Unparsed   []Line         `json:"unparsed,omitempty"` // Lines that were not understood
+}
+
+// Complete reports whether every field of the receipt was found
+func (r Result) Complete() bool {
+	return len(r.Missing) == 0
+}
+
+var (
+	// amountPattern matches a line ending in an amount, optionally followed
+	// by a tax flag such as "T" or "N"
+	amountPattern = regexp.MustCompile(`^(.*?)(?:^|\s)(-?\$?-?\d{1,3}(?:,\d{3})+\.\d{2}|-?\$?-?\d+\.\d{2})(-?)(?:\s+[A-Z]{1,2})?$`)
+
+	// quantityPattern matches a quantity and unit price such as "2 @ 1.25"
+	quantityPattern = regexp.MustCompile(`(?i)^(\d+)\s*(?:@|x)\s*\$?(\d+\.\d{2})(?:\s*(?:ea|each))?\s*`)
+
+	// separatorPattern matches rules drawn between sections
+	separatorPattern = regexp.MustCompile(`^[\s\-=*_#~.+|]+$`)
+
+	totalPattern    = regexp.MustCompile(`(?i)^(?:grand\s+)?total(?:\s+(?:due|amount|sale))?:?$|^(?:balance|amount)\s+due:?$`)
+	subtotalPattern = regexp.MustCompile(`(?i)^sub[\s-]?total:?$`)
+	taxPattern      = regexp.MustCompile(`(?i)^(?:(?:sales|estimated)\s+)?tax\b`)
+	tipPattern      = regexp.MustCompile(`(?i)^(?:tip|gratuity)\b`)
+
+	// summaryPattern matches the payment and savings lines following the items
+	summaryPattern = regexp.MustCompile(`(?i)^(?:change|cash|credit|debit|visa|mastercard|mc|amex|american\s+express|discover|tender|payment|paid|savings|you\s+saved|total\s+\w+|card|ebt|gift\s+card|rounding)\b`)
+
+	// labelPattern matches "label: value" lines such as "Cashier: Sam"
+	labelPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z .#]*:\s*\S`)
+
+	letterPattern = regexp.MustCompile(`[A-Za-z].*[A-Za-z]`)
+)
+
+// parser holds the state of parsing one receipt
+type parser struct {
+	result      Result
+	subtotal    *float64
+	discounts   float64 // Sum of the negative lines, such as coupons
+	tax         float64
+	tip         float64
+	hasTotal    bool
+	inItems     bool   // An item or the purchase date has been seen
+	afterTotal  bool   // The total has been seen, so only payment lines follow
+	pending     []Line // Description lines waiting for the line with their price
+	lastItem    bool   // The previous line was an item
+	lastIndent  int    // Indentation of the previous item line
+	interpreted int    // Non-blank lines that were understood
+}
+
+// Parse extracts a receipt from text. It never fails: fields it cannot find
+// are listed in Missing, and lines it cannot interpret in Unparsed.
+func Parse(text string) Result {
+	p := &parser{}
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i, raw := range lines {
+		p.line(Line{Number: i + 1, Text: strings.TrimRight(raw, " \t\r")})
+	}
+	p.flushPending()
+	p.finish()
+	return p.result
+}
+
+// line interprets one line of the receipt
+func (p *parser) line(line Line) {
+	text := strings.TrimSpace(line.Text)
+	indent := len(line.Text) - len(strings.TrimLeft(line.Text, " \t"))
+	wasItem := p.lastItem
+	p.lastItem = false
+
+	if text == "" || separatorPattern.MatchString(text) {
+		p.flushPending()
+		if text != "" {
+			p.interpreted++
+		}
+		return
+	}
+
+	if p.dateTime(text) {
+		p.flushPending()
+		p.inItems = true
+		p.interpreted++
+		return
+	}
+
+	if m := amountPattern.FindStringSubmatch(text); m != nil {
+		description := strings.TrimSpace(m[1])
+		amount, ok := parseAmount(m[2], m[3] == "-")
+		if ok {
+			p.amount(line, description, amount, indent)
+			return
+		}
+	}
+
+	switch {
+	case p.result.Receipt.Retailer == "" && !p.inItems && letterPattern.MatchString(text):
+		p.result.Receipt.Retailer = retailerName(text)
+		p.interpreted++
+	case wasItem && indent > p.lastIndent && len(p.pending) == 0 && !labelPattern.MatchString(text):
+		// An indented line under an item continues its description
+		items := p.result.Receipt.Items
+		items[len(items)-1].ShortDescription += " " + text
+		p.lastItem = true
+		p.interpreted++
+	case p.inItems && !p.afterTotal && letterPattern.MatchString(text) && !labelPattern.MatchString(text):
+		// A description printed above the line with its price
+		p.pending = append(p.pending, line)
+	default:
+		p.result.Unparsed = append(p.result.Unparsed, line)
+	}
+}
+
+// dateTime records the purchase date and time on a line, reporting whether
+// the line held either
+func (p *parser) dateTime(text string) bool {
+	found := false
+	if p.result.Receipt.PurchaseDate.IsZero() {
+		if date, rest, ok := findDate(text); ok {
+			p.result.Receipt.PurchaseDate = date
+			text = rest
+			found = true
+		}
+	}
+	if p.result.Receipt.PurchaseTime.IsZero() {
+		if t, ok := findTime(text); ok {
+			p.result.Receipt.PurchaseTime = t
+			found = true
+		}
+	}
+	return found
+}
+
+// amount interprets a line ending in an amount
+func (p *parser) amount(line Line, description string, amount float64, indent int) {
+	switch {
+	case totalPattern.MatchString(description):
+		p.flushPending()
+		if !p.hasTotal {
+			p.result.Receipt.Total = models.Price(amount)
+			p.hasTotal = true
+		}
+		p.afterTotal = true
+		p.interpreted++
+		return
+	case subtotalPattern.MatchString(description):
+		p.flushPending()
+		p.subtotal = &amount
+		p.interpreted++
+		return
+	case p.afterTotal || summaryPattern.MatchString(description):
+		p.flushPending()
+		p.interpreted++
+		return
+	case taxPattern.MatchString(description):
+		p.flushPending()
+		p.tax += amount
+		p.interpreted++
+		return
+	case tipPattern.MatchString(description):
+		p.flushPending()
+		p.tip += amount
+		p.interpreted++
+		return
+	case amount < 0:
+		p.flushPending()
+		p.discounts += amount
+		p.interpreted++
+		return
+	}
+
+	// A quantity and unit price adding up to the price are kept on the item
+	var quantity float64
+	var unitPrice models.Price
+	if m := quantityPattern.FindStringSubmatch(description); m != nil {
+		q, _ := strconv.ParseFloat(m[1], 64)
+		u, _ := models.ParsePrice(m[2])
+		if q > 0 && math.Abs(q*float64(u)-amount) <= models.ItemPriceTolerance {
+			quantity, unitPrice = q, u
+		}
+		description = strings.TrimSpace(description[len(m[0]):])
+	}
+	var parts []string
+	for _, pending := range p.pending {
+		parts = append(parts, strings.TrimSpace(pending.Text))
+	}
+	if description != "" {
+		parts = append(parts, description)
+	}
+	if len(parts) == 0 || !letterPattern.MatchString(strings.Join(parts, " ")) {
+		p.flushPending()
+		p.result.Unparsed = append(p.result.Unparsed, line)
+		return
+	}
+
+	p.interpreted += len(p.pending) + 1
+	p.pending = nil
+	p.result.Receipt.Items = append(p.result.Receipt.Items, models.Item{
+		ShortDescription: strings.Join(parts, " "),
+		Price:            models.Price(amount),
+		Quantity:         quantity,
+		UnitPrice:        unitPrice,
+	})
+	p.inItems = true
+	p.lastItem = true
+	p.lastIndent = indent
+}
+
+// flushPending reports description lines that were never followed by a price
+func (p *parser) flushPending() {
+	p.result.Unparsed = append(p.result.Unparsed, p.pending...)
+	p.pending = nil
+}
+
+// finish lists the missing fields and scores the confidence of the result
+func (p *parser) finish() {
+	r := &p.result
+	found := map[string]bool{
+		FieldRetailer:     r.Receipt.Retailer != "",
+		FieldPurchaseDate: !r.Receipt.PurchaseDate.IsZero(),
+		FieldPurchaseTime: !r.Receipt.PurchaseTime.IsZero(),
+		FieldItems:        len(r.Receipt.Items) > 0,
+		FieldTotal:        p.hasTotal,
+	}
+	confidence := 0.0
+	for _, field := range []string{FieldRetailer, FieldPurchaseDate, FieldPurchaseTime, FieldItems, FieldTotal} {
+		if found[field] {
+			confidence += 0.15
+		} else {
+			r.Missing = append(r.Missing, field)
+		}
+	}
+
+	// Items adding up to the subtotal or total are strong evidence that
+	// every item was found
+	sum := p.discounts
+	for _, item := range r.Receipt.Items {
+		sum += float64(item.Price)
+	}
+	if len(r.Receipt.Items) > 0 && ((p.subtotal != nil && cents(sum) == cents(*p.subtotal)) ||
+		(p.hasTotal && cents(sum) == cents(float64(r.Receipt.Total)))) {
+		confidence += 0.15
+	}
+	p.amounts(sum)
+
+	if total := p.interpreted + len(r.Unparsed); total > 0 {
+		confidence += 0.10 * float64(p.interpreted) / float64(total)
+	}
+	r.Confidence = math.Round(confidence*100) / 100
+}
+
+// amounts records the subtotal, tax, tip and discounts so the total can be
+// reconciled. sum is the item prices less discounts. A subtotal printed after
+// the discounts is recorded before them, as receipts carry it.
+func (p *parser) amounts(sum float64) {
+	r := &p.result.Receipt
+	if p.subtotal != nil {
+		r.Subtotal = models.Price(*p.subtotal)
+		if p.discounts != 0 && cents(sum) == cents(*p.subtotal) {
+			r.Subtotal = models.Price(math.Round((sum-p.discounts)*100) / 100)
+		}
+	}
+	r.Discounts = models.Price(-p.discounts)
+	r.Tax = models.Price(p.tax)
+	r.Tip = models.Price(p.tip)
+}
+
+// parseAmount parses an amount such as "$1,234.50", "-1.00" or "1.00-"
+func parseAmount(s string, trailingMinus bool) (float64, bool) {
+	negative := trailingMinus || strings.Contains(s, "-")
+	s = strings.NewReplacer("$", "", ",", "", "-", "").Replace(s)
+	amount, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	if negative {
+		amount = -amount
+	}
+	return amount, true
+}
+
+// cents rounds an amount to whole cents for comparison
+func cents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// retailerName cleans up the line naming the retailer
+func retailerName(text string) string {
+	for _, prefix := range []string{"welcome to ", "thank you for shopping at "} {
+		if len(text) > len(prefix) && strings.EqualFold(text[:len(prefix)], prefix) {
+			text = text[len(prefix):]
+		}
+	}
+	return strings.Join(strings.Fields(text), " ")
+}
+
+var (
+	months = "jan(?:uary)?|feb(?:ruary)?|mar(?:ch)?|apr(?:il)?|may|june?|july?|aug(?:ust)?|sep(?:t(?:ember)?)?|oct(?:ober)?|nov(?:ember)?|dec(?:ember)?"
+
+	isoDatePattern   = regexp.MustCompile(`\b(\d{4})-(\d{2})-(\d{2})(?:[T ]|\b)`)
+	usDatePattern    = regexp.MustCompile(`\b(\d{1,2})[/-](\d{1,2})[/-](\d{4}|\d{2})\b`)
+	monthDatePattern = regexp.MustCompile(`(?i)\b(` + months + `)\.?\s+(\d{1,2}),?\s+(\d{4})\b`)
+	dayMonthPattern  = regexp.MustCompile(`(?i)\b(\d{1,2})\s+(` + months + `)\.?,?\s+(\d{4})\b`)
+
+	timePattern = regexp.MustCompile(`(?i)(?:^|[^\d:.])(\d{1,2}):(\d{2})(?::(\d{2}))?(?:\.\d+)?(?:\s*([ap])\.?\s?m\.?\b)?`)
+)
+
+// ParseDate finds a date in s, such as "2022-01-02", "01/02/2022" or
+// "Jan 2, 2022", and returns it as YYYY-MM-DD
+func ParseDate(s string) (models.Date, bool) {
+	date, _, ok := findDate(s)
+	return date, ok
+}
+
+// ParseTime finds a 24 or 12-hour time in s, such as "13:01" or "1:01 PM",
+// and returns it as HH:MM
+func ParseTime(s string) (models.Time, bool) {
+	return findTime(s)
+}
+
+// findDate finds a date on a line and returns it as YYYY-MM-DD along with
+// the rest of the line
+func findDate(text string) (models.Date, string, bool) {
+	type layout struct {
+		pattern            *regexp.Regexp
+		year, month, day   int
+		monthName, twoYear bool
+	}
+	layouts := []layout{
+		{pattern: isoDatePattern, year: 1, month: 2, day: 3},
+		{pattern: usDatePattern, year: 3, month: 1, day: 2, twoYear: true},
+		{pattern: monthDatePattern, year: 3, month: 1, day: 2, monthName: true},
+		{pattern: dayMonthPattern, year: 3, month: 2, day: 1, monthName: true},
+	}
+
+	for _, l := range layouts {
+		loc := l.pattern.FindStringSubmatchIndex(text)
+		if loc == nil {
+			continue
+		}
+		group := func(i int) string {
+			return text[loc[2*i]:loc[2*i+1]]
+		}
+
+		year, _ := strconv.Atoi(group(l.year))
+		if l.twoYear && len(group(l.year)) == 2 {
+			year += 2000
+		}
+		day, _ := strconv.Atoi(group(l.day))
+		var month int
+		if l.monthName {
+			t, err := time.Parse("Jan", strings.ToUpper(group(l.month)[:1])+strings.ToLower(group(l.month)[1:3]))
+			if err != nil {
+				continue
+			}
+			month = int(t.Month())
+		} else {
+			month, _ = strconv.Atoi(group(l.month))
+		}
+
+		date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+		if date.Year() != year || int(date.Month()) != month || date.Day() != day {
+			continue
+		}
+		rest := text[:loc[0]] + " " + text[loc[1]:]
+		return models.NewDate(date.Date()), rest, true
+	}
+	return models.Date{}, text, false
+}
+
+// findTime finds a 24 or 12-hour time on a line and returns it as HH:MM
+func findTime(text string) (models.Time, bool) {
+	m := timePattern.FindStringSubmatch(text)
+	if m == nil {
+		return models.Time{}, false
+	}
+	hour, _ := strconv.Atoi(m[1])
+	minute, _ := strconv.Atoi(m[2])
+	if minute > 59 {
+		return models.Time{}, false
+	}
+	switch strings.ToLower(m[4]) {
+	case "a":
+		if hour < 1 || hour > 12 {
+			return models.Time{}, false
+		}
+		hour %= 12
+	case "p":
+		if hour < 1 || hour > 12 {
+			return models.Time{}, false
+		}
+		hour = hour%12 + 12
+	default:
+		if hour > 23 {
+			return models.Time{}, false
+		}
+	}
+	return models.NewTime(hour, minute), true
+}
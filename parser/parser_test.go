@@ -0,0 +1,135 @@
+package parser
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// update rewrites the golden files with the current output of the parser
+var update = flag.Bool("update", false, "update golden files")
+
+// TestParseGolden parses every receipt in testdata and compares the result
+// with its .golden file
+func TestParseGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.txt"))
+	if err != nil {
+		t.Fatalf("Failed to list testdata: %v", err)
+	}
+	if len(files) == 0 {
+		t.Fatal("Expected receipts in testdata")
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".txt")
+		t.Run(name, func(t *testing.T) {
+			text, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("Failed to read receipt: %v", err)
+			}
+			got, err := json.MarshalIndent(Parse(string(text)), "", "  ")
+			if err != nil {
+				t.Fatalf("Failed to marshal result: %v", err)
+			}
+			got = append(got, '\n')
+
+			golden := strings.TrimSuffix(file, ".txt") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatalf("Failed to update golden file: %v", err)
+				}
+			}
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("Failed to read golden file: %v", err)
+			}
+			if string(got) != string(expected) {
+				t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+			}
+		})
+	}
+}
+
+func TestFindDate(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"2022-01-02", "2022-01-02"},
+		{"2022-03-20T14:33:00Z", "2022-03-20"},
+		{"01/01/2022 1:01 PM", "2022-01-01"},
+		{"3/20/22", "2022-03-20"},
+		{"03-20-2022", "2022-03-20"},
+		{"Mar 20, 2022", "2022-03-20"},
+		{"September 5 2022", "2022-09-05"},
+		{"20 March 2022", "2022-03-20"},
+		{"13/01/2022", ""},
+		{"02/30/2022", ""},
+		{"Store 1234", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.text, func(t *testing.T) {
+			date, _, _ := findDate(tc.text)
+			if date.String() != tc.expected {
+				t.Errorf("Expected date %q, got %q", tc.expected, date)
+			}
+		})
+	}
+}
+
+func TestFindTime(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"13:01", "13:01"},
+		{"08:13:22", "08:13"},
+		{"1:01 PM", "13:01"},
+		{"2:33 p.m.", "14:33"},
+		{"12:05 AM", "00:05"},
+		{"12:30pm", "12:30"},
+		{"2022-03-20T14:33:00Z", "14:33"},
+		{"24:00", ""},
+		{"13:01 PM", ""},
+		{"12:60", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.text, func(t *testing.T) {
+			got, _ := findTime(tc.text)
+			if got.String() != tc.expected {
+				t.Errorf("Expected time %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+// TestParseReconciles checks that the complete receipts in testdata add up,
+// so that reconciling parsed receipts does not flag them
+func TestParseReconciles(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.txt"))
+	if err != nil {
+		t.Fatalf("Failed to list testdata: %v", err)
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".txt")
+		t.Run(name, func(t *testing.T) {
+			text, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("Failed to read receipt: %v", err)
+			}
+			result := Parse(string(text))
+			if !result.Complete() {
+				t.Skip("incomplete receipt")
+			}
+			if r := result.Receipt.Reconcile(0.01); r != nil {
+				t.Errorf("Expected the receipt to reconcile, got %v", r.Problems)
+			}
+		})
+	}
+}
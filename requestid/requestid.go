@@ -0,0 +1,84 @@
+package requestid
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/google/uuid"
+)
+
+// Header is the HTTP header carrying the request ID
+const Header = "X-Request-ID"
+
+// maxLength bounds the size of client-supplied request IDs
+const maxLength = 128
+
+// contextKey is the private type for the request ID context key
+type contextKey struct{}
+
+// New generates a new random request ID
+func New() string {
+	return uuid.New().String()
+}
+
+// Valid reports whether a client-supplied request ID can be accepted as is.
+// IDs must be non-empty, at most 128 characters and printable ASCII.
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// NewContext returns a copy of ctx carrying the request ID
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID stored in ctx, or an empty string
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// logHandler adds the request ID from the context to every record
+type logHandler struct {
+	next slog.Handler
+}
+
+// NewLogHandler wraps next so that records logged with a context carrying a
+// request ID include a request_id attribute
+func NewLogHandler(next slog.Handler) slog.Handler {
+	return &logHandler{next: next}
+}
+
+// Enabled reports whether the wrapped handler handles records at the given level
+func (h *logHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle adds the request ID to the record before passing it on
+func (h *logHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := FromContext(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.next.Handle(ctx, record)
+}
+
+// WithAttrs returns a handler whose records include the given attributes
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &logHandler{next: h.next.WithAttrs(attrs)}
+}
+
+// WithGroup returns a handler that nests subsequent attributes under name
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	return &logHandler{next: h.next.WithGroup(name)}
+}
@@ -0,0 +1,64 @@
+package requestid
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		name     string
+		id       string
+		expected bool
+	}{
+		{"UUID", "a9f2e68d-f6fc-4b87-9122-56ff11f06981", true},
+		{"Opaque token", "req_01HXYZ", true},
+		{"Empty", "", false},
+		{"Contains space", "abc def", false},
+		{"Contains newline", "abc\ndef", false},
+		{"Too long", strings.Repeat("a", 129), false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Valid(tc.id); got != tc.expected {
+				t.Errorf("Expected Valid(%q) to be %v, got %v", tc.id, tc.expected, got)
+			}
+		})
+	}
+
+	if !Valid(New()) {
+		t.Error("Expected generated IDs to be valid")
+	}
+}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	if id := FromContext(ctx); id != "" {
+		t.Errorf("Expected empty request ID, got %s", id)
+	}
+
+	ctx = NewContext(ctx, "req-1")
+	if id := FromContext(ctx); id != "req-1" {
+		t.Errorf("Expected request ID req-1, got %s", id)
+	}
+}
+
+func TestLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewLogHandler(slog.NewTextHandler(&buf, nil)))
+
+	logger.InfoContext(NewContext(context.Background(), "req-42"), "message")
+	if !strings.Contains(buf.String(), "request_id=req-42") {
+		t.Errorf("Expected log to contain the request ID, got %s", buf.String())
+	}
+
+	buf.Reset()
+	logger.With("component", "test").InfoContext(context.Background(), "message")
+	if strings.Contains(buf.String(), "request_id") {
+		t.Errorf("Expected no request ID without one in the context, got %s", buf.String())
+	}
+}
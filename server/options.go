@@ -0,0 +1,230 @@
+package server
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/marcelorm/receipt-processor/email"
+	"github.com/marcelorm/receipt-processor/events"
+	"github.com/marcelorm/receipt-processor/ingest"
+	"github.com/marcelorm/receipt-processor/metrics"
+	"github.com/marcelorm/receipt-processor/services"
+	"github.com/marcelorm/receipt-processor/services/rules"
+	"github.com/marcelorm/receipt-processor/storage"
+	"github.com/marcelorm/receipt-processor/webhooks"
+)
+
+// DefaultBodyLimit is the request body limit used when none is configured
+const DefaultBodyLimit = 1024 * 1024
+
+// options collects the settings applied by Option functions
+type options struct {
+	store      storage.ReceiptStorage
+	ruleSet    rules.RuleSet
+	zones      *services.StoreZones
+	rates      *services.ExchangeRates
+	reconcile  []services.CalculatorOption
+	logger     *slog.Logger
+	metrics    *metrics.Metrics
+	middleware []func(http.Handler) http.Handler
+	bodyLimit  int64
+	addr       string
+	listeners  []net.Listener
+
+	grpcShared    bool
+	grpcAddr      string
+	grpcListeners []net.Listener
+
+	webhooks *webhooks.Dispatcher
+
+	bus          *events.Bus
+	heartbeat    time.Duration
+	sinks        []events.Sink
+	eventBacklog int
+
+	consumerSource  ingest.Source
+	consumerOpts    []ingest.Option
+	consumerBacklog int
+
+	emailTemplates []email.Template
+}
+
+// Option configures a Server
+type Option func(*options)
+
+// WithStorage stores receipts in store instead of a new in-memory store
+func WithStorage(store storage.ReceiptStorage) Option {
+	return func(o *options) {
+		o.store = store
+	}
+}
+
+// WithRuleSet scores receipts with ruleSet instead of the default rules
+func WithRuleSet(ruleSet rules.RuleSet) Option {
+	return func(o *options) {
+		o.ruleSet = ruleSet
+	}
+}
+
+// WithStoreZones scores receipts in the local time of their stores
+func WithStoreZones(zones *services.StoreZones) Option {
+	return func(o *options) {
+		o.zones = zones
+	}
+}
+
+// WithExchangeRates converts receipts in other currencies into the base
+// currency of rates before scoring them
+func WithExchangeRates(rates *services.ExchangeRates) Option {
+	return func(o *options) {
+		o.rates = rates
+	}
+}
+
+// WithReconciliation checks receipt totals against their items, tax, tip and
+// discounts, flagging or rejecting receipts that differ by more than tolerance
+func WithReconciliation(tolerance float64, policy services.ReconcilePolicy) Option {
+	return func(o *options) {
+		o.reconcile = []services.CalculatorOption{services.WithReconciliation(tolerance, policy)}
+	}
+}
+
+// WithLogger logs requests, scoring and lifecycle events through logger
+// instead of the default logger
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithMetrics records metrics into m, so an embedding binary can expose them
+// alongside its own, instead of creating a new registry
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(o *options) {
+		o.metrics = m
+	}
+}
+
+// WithMiddleware wraps the server's handler with the given middleware. The
+// first middleware is the outermost.
+func WithMiddleware(middleware ...func(http.Handler) http.Handler) Option {
+	return func(o *options) {
+		o.middleware = append(o.middleware, middleware...)
+	}
+}
+
+// WithBodyLimit rejects receipt requests with a body larger than limit bytes
+func WithBodyLimit(limit int64) Option {
+	return func(o *options) {
+		o.bodyLimit = limit
+	}
+}
+
+// WithAddr sets the TCP address Start listens on when no listeners are given
+func WithAddr(addr string) Option {
+	return func(o *options) {
+		o.addr = addr
+	}
+}
+
+// WithListener serves on an existing listener. It may be given several times
+// to serve on multiple listeners.
+func WithListener(l net.Listener) Option {
+	return func(o *options) {
+		o.listeners = append(o.listeners, l)
+	}
+}
+
+// WithGRPC also serves the gRPC API on the HTTP listeners, routing each
+// connection by protocol
+func WithGRPC() Option {
+	return func(o *options) {
+		o.grpcShared = true
+	}
+}
+
+// WithGRPCAddr serves the gRPC API on its own TCP address instead of the
+// HTTP listeners
+func WithGRPCAddr(addr string) Option {
+	return func(o *options) {
+		o.grpcAddr = addr
+	}
+}
+
+// WithGRPCListener serves the gRPC API on an existing listener instead of the
+// HTTP listeners. It may be given several times.
+func WithGRPCListener(l net.Listener) Option {
+	return func(o *options) {
+		o.grpcListeners = append(o.grpcListeners, l)
+	}
+}
+
+// WithWebhooks delivers the domain events of stored receipts to webhook
+// subscribers, serves the subscription endpoints under /webhooks, and runs
+// dispatcher until Shutdown
+func WithWebhooks(dispatcher *webhooks.Dispatcher) Option {
+	return func(o *options) {
+		o.webhooks = dispatcher
+	}
+}
+
+// WithEventBus publishes scoring activity on bus instead of a new bus, so an
+// embedding binary can subscribe to it
+func WithEventBus(bus *events.Bus) Option {
+	return func(o *options) {
+		o.bus = bus
+	}
+}
+
+// WithEventHeartbeat sends a heartbeat on idle /events streams every interval
+func WithEventHeartbeat(interval time.Duration) Option {
+	return func(o *options) {
+		o.heartbeat = interval
+	}
+}
+
+// WithEventSinks also delivers the domain events recorded by the store to
+// sinks, after the event bus and webhooks. It may be given several times.
+func WithEventSinks(sinks ...events.Sink) Option {
+	return func(o *options) {
+		o.sinks = append(o.sinks, sinks...)
+	}
+}
+
+// WithConsumer also ingests receipts from source between Start and Shutdown,
+// scoring them with the server's rules and storing them in its store. opts
+// are applied after the server's calculator, metrics and logger. The server
+// closes source on Shutdown.
+func WithConsumer(source ingest.Source, opts ...ingest.Option) Option {
+	return func(o *options) {
+		o.consumerSource = source
+		o.consumerOpts = opts
+	}
+}
+
+// WithEventBacklogLimit reports the server unready while more than limit
+// events are waiting to be delivered. Zero, the default, disables the check.
+func WithEventBacklogLimit(limit int) Option {
+	return func(o *options) {
+		o.eventBacklog = limit
+	}
+}
+
+// WithConsumerBacklogLimit reports the server unready while more than limit
+// receipts are waiting in the WithConsumer source, if it implements
+// ingest.Backlogger. Zero, the default, disables the check.
+func WithConsumerBacklogLimit(limit int) Option {
+	return func(o *options) {
+		o.consumerBacklog = limit
+	}
+}
+
+// WithEmailTemplates reads emailed receipts from the senders of templates
+// with them, before trying the built-in templates
+func WithEmailTemplates(templates ...email.Template) Option {
+	return func(o *options) {
+		o.emailTemplates = append(o.emailTemplates, templates...)
+	}
+}
@@ -0,0 +1,519 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/marcelorm/receipt-processor/api"
+	"github.com/marcelorm/receipt-processor/email"
+	"github.com/marcelorm/receipt-processor/events"
+	"github.com/marcelorm/receipt-processor/graphqlapi"
+	"github.com/marcelorm/receipt-processor/grpcapi"
+	"github.com/marcelorm/receipt-processor/health"
+	"github.com/marcelorm/receipt-processor/ingest"
+	"github.com/marcelorm/receipt-processor/metrics"
+	"github.com/marcelorm/receipt-processor/services"
+	"github.com/marcelorm/receipt-processor/services/rules"
+	"github.com/marcelorm/receipt-processor/storage"
+	"github.com/marcelorm/receipt-processor/tracing"
+	"github.com/marcelorm/receipt-processor/webhooks"
+	"github.com/soheilhy/cmux"
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+)
+
+// idempotencyTTL is how long responses to requests with an idempotency key are replayed
+const idempotencyTTL = 24 * time.Hour
+
+// Server is an embeddable receipt processor. It implements http.Handler so it
+// can be mounted in another server, and can also serve on its own listeners
+// with Start and Shutdown.
+type Server struct {
+	handler    http.Handler
+	store      storage.ReceiptStorage
+	ruleSet    rules.RuleSet
+	calculator *services.Calculator
+	metrics    *metrics.Metrics
+	checker    *health.Checker
+	logger     *slog.Logger
+	addr       string
+	listeners  []net.Listener
+	httpServer *http.Server
+
+	grpcServer    *grpc.Server
+	grpcHealth    *grpchealth.Server
+	grpcShared    bool
+	grpcAddr      string
+	grpcListeners []net.Listener
+	muxes         []cmux.CMux
+
+	webhooks    *webhooks.Dispatcher
+	bus         *events.Bus
+	eventStream *api.EventStreamHandler
+	dispatcher  *events.Dispatcher // Nil when the store has no event outbox
+
+	consumer       *ingest.Consumer // Nil unless WithConsumer is given
+	consumerSource ingest.Source
+	stopConsumer   context.CancelFunc
+
+	mu      sync.Mutex
+	started bool
+	serving sync.WaitGroup
+}
+
+// New creates a server configured by opts. Unset options default to an
+// in-memory store, the standard rules, the default logger, a new metrics
+// registry, a new event bus, a 1MB body limit and the address :8080. The gRPC API is served
+// only when WithGRPC, WithGRPCAddr or WithGRPCListener is given.
+//
+// When the store implements events.Outbox, the domain events it records are
+// delivered to the event bus, webhooks and any WithEventSinks sinks from New
+// until Shutdown, so a server mounted with ServeHTTP delivers them too. A
+// WithConsumer source is only consumed between Start and Shutdown.
+func New(opts ...Option) (*Server, error) {
+	o := options{
+		bodyLimit: DefaultBodyLimit,
+		addr:      ":8080",
+		heartbeat: api.DefaultHeartbeat,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.bodyLimit <= 0 {
+		return nil, fmt.Errorf("body limit must be positive, got %d", o.bodyLimit)
+	}
+	if o.store == nil {
+		o.store = storage.NewMemoryStorage()
+	}
+	if o.ruleSet == nil {
+		o.ruleSet = rules.GetAllRules()
+	}
+	if o.logger == nil {
+		o.logger = slog.Default()
+	}
+	if o.metrics == nil {
+		o.metrics = metrics.New()
+	}
+	if o.bus == nil {
+		o.bus = events.NewBus()
+	}
+	if o.heartbeat <= 0 {
+		return nil, fmt.Errorf("event heartbeat must be positive, got %s", o.heartbeat)
+	}
+
+	sinks := []events.Sink{events.BusSink(o.bus)}
+	if o.webhooks != nil {
+		sinks = append(sinks, o.webhooks)
+	}
+	sinks = append(sinks, o.sinks...)
+
+	s := &Server{
+		store:     o.metrics.InstrumentStorage(context.Background(), tracing.InstrumentStorage(o.store)),
+		ruleSet:   o.ruleSet,
+		metrics:   o.metrics,
+		checker:   health.NewChecker(),
+		logger:    o.logger,
+		addr:      o.addr,
+		listeners: o.listeners,
+
+		grpcShared:    o.grpcShared,
+		grpcAddr:      o.grpcAddr,
+		grpcListeners: o.grpcListeners,
+
+		webhooks:    o.webhooks,
+		bus:         o.bus,
+		eventStream: api.NewEventStreamHandler(o.bus, o.heartbeat, o.logger),
+	}
+	s.calculator = services.NewCalculator(s.ruleSet, s.logger,
+		append([]services.CalculatorOption{
+			services.WithStoreZones(o.zones),
+			services.WithExchangeRates(o.rates),
+		}, o.reconcile...)...)
+	if s.grpcShared && (s.grpcAddr != "" || len(s.grpcListeners) > 0) {
+		return nil, errors.New("gRPC cannot be served both on the HTTP listeners and on its own")
+	}
+
+	router, err := s.router(o.bodyLimit, o.emailTemplates)
+	if err != nil {
+		return nil, err
+	}
+	var handler http.Handler = router
+	for i := len(o.middleware) - 1; i >= 0; i-- {
+		handler = o.middleware[i](handler)
+	}
+	s.handler = handler
+	s.httpServer = &http.Server{Handler: handler}
+	s.grpcServer, s.grpcHealth = grpcapi.NewServer(grpcapi.NewReceiptService(s.store,
+		grpcapi.WithCalculator(s.calculator),
+		grpcapi.WithMetrics(s.metrics),
+		grpcapi.WithLogger(s.logger)))
+
+	if o.consumerSource != nil {
+		s.consumerSource = o.consumerSource
+		s.consumer = ingest.NewConsumer(o.consumerSource, s.store, append([]ingest.Option{
+			ingest.WithCalculator(s.calculator),
+			ingest.WithMetrics(s.metrics),
+			ingest.WithLogger(s.logger),
+		}, o.consumerOpts...)...)
+	}
+
+	// Events are read from the undecorated store, which records them
+	// atomically with each receipt
+	if outbox, ok := o.store.(events.Outbox); ok {
+		s.dispatcher = events.NewDispatcher(outbox, sinks, events.WithLogger(s.logger))
+		s.dispatcher.Start()
+		s.metrics.WatchEventOutbox(func() (int, int, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			return s.dispatcher.Backlog(ctx)
+		})
+	} else {
+		s.logger.Warn("Storage has no event outbox; live events and webhooks are disabled")
+	}
+	if s.webhooks != nil {
+		s.webhooks.Start()
+	}
+	s.registerChecks(o.eventBacklog, o.consumerBacklog)
+
+	return s, nil
+}
+
+// router builds the gin engine serving every endpoint
+func (s *Server) router(bodyLimit int64, emailTemplates []email.Template) (*gin.Engine, error) {
+	handler := api.NewReceiptHandler(s.store,
+		api.WithCalculator(s.calculator),
+		api.WithMetrics(s.metrics),
+		api.WithLogger(s.logger),
+		api.WithMaxLineSize(bodyLimit),
+		api.WithMaxImportSize(bodyLimit),
+		api.WithEmailExtractor(email.NewExtractor(email.WithTemplates(emailTemplates...))))
+	graphqlHandler, err := graphqlapi.NewHandler(s.store,
+		graphqlapi.WithCalculator(s.calculator),
+		graphqlapi.WithMetrics(s.metrics),
+		graphqlapi.WithLogger(s.logger),
+		graphqlapi.WithBodyLimit(bodyLimit))
+	if err != nil {
+		return nil, fmt.Errorf("building GraphQL schema: %w", err)
+	}
+
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.Use(api.RequestIDMiddleware())
+	router.Use(api.TracingMiddleware())
+	router.Use(api.LoggerMiddleware(s.logger))
+	router.Use(api.MetricsMiddleware(s.metrics))
+
+	receipts := router.Group("/receipts")
+	receipts.Use(api.IdempotencyMiddleware(api.NewIdempotencyCache(idempotencyTTL), bodyLimit))
+	receipts.Use(api.JSONValidationMiddleware(bodyLimit))
+	receipts.POST("/process", handler.ProcessReceipt)
+	receipts.GET("/:id/points", handler.GetPoints)
+	receipts.GET("/:id/ledger", handler.GetLedger)
+	receipts.POST("/import", handler.ImportReceipts)
+	receipts.POST("/email", handler.ProcessEmail)
+	receipts.GET("/export.csv", handler.ExportReceipts)
+
+	// Streamed uploads are limited per line rather than per body, and their
+	// responses are too large to replay for idempotency keys
+	router.POST("/receipts/stream", handler.StreamReceipts)
+
+	// Loyalty accounts and their points ledgers. Ledger entries, such as
+	// redemptions, are safe to retry with an idempotency key.
+	accountHandler := api.NewAccountHandler(s.store)
+	accounts := router.Group("/accounts")
+	accounts.Use(api.IdempotencyMiddleware(api.NewIdempotencyCache(idempotencyTTL), bodyLimit))
+	accounts.POST("", accountHandler.CreateAccount)
+	accounts.GET("/:id/balance", accountHandler.GetBalance)
+	accounts.GET("/:id/history", accountHandler.GetHistory)
+	accounts.POST("/:id/entries", accountHandler.PostEntry)
+
+	// Live scoring activity as Server-Sent Events
+	router.GET("/events", s.eventStream.StreamEvents)
+
+	if s.webhooks != nil {
+		hooks := api.NewWebhookHandler(s.webhooks)
+		router.POST("/webhooks", hooks.CreateWebhook)
+		router.GET("/webhooks", hooks.ListWebhooks)
+		router.GET("/webhooks/dead-letters", hooks.ListDeadLetters)
+		router.GET("/webhooks/:id", hooks.GetWebhook)
+		router.DELETE("/webhooks/:id", hooks.DeleteWebhook)
+		router.GET("/webhooks/:id/deliveries", hooks.ListDeliveries)
+	}
+
+	// GraphQL queries over GET and POST, mutations over POST only
+	router.GET("/graphql", gin.WrapH(graphqlHandler))
+	router.POST("/graphql", gin.WrapH(graphqlHandler))
+
+	// Health check endpoints
+	router.GET("/livez", gin.WrapH(health.LivenessHandler()))
+	router.GET("/readyz", gin.WrapH(s.checker.ReadinessHandler()))
+	router.GET("/health", gin.WrapH(s.checker.ReadinessHandler()))
+
+	// Expose metrics in the Prometheus text format
+	router.GET("/metrics", gin.WrapH(s.metrics.Handler()))
+
+	return router, nil
+}
+
+// registerChecks registers the built-in readiness checks. Backlog limits of
+// zero disable the backlog checks.
+func (s *Server) registerChecks(eventBacklog, consumerBacklog int) {
+	s.checker.Register("storage", 0, func(ctx context.Context) error {
+		_, err := s.store.Count(ctx)
+		return err
+	})
+	s.checker.Register("rules", 0, func(ctx context.Context) error {
+		if len(s.ruleSet) == 0 {
+			return errors.New("no point rules loaded")
+		}
+		return nil
+	})
+	if s.dispatcher != nil && eventBacklog > 0 {
+		s.checker.Register("events", 0, func(ctx context.Context) error {
+			pending, _, err := s.dispatcher.Backlog(ctx)
+			if err != nil {
+				return err
+			}
+			if pending > eventBacklog {
+				return fmt.Errorf("%d events waiting to be delivered, more than the limit of %d", pending, eventBacklog)
+			}
+			return nil
+		})
+	}
+	if source, ok := s.consumerSource.(ingest.Backlogger); ok && consumerBacklog > 0 {
+		s.checker.Register("consumer", 0, func(ctx context.Context) error {
+			backlog, err := source.Backlog(ctx)
+			if err != nil {
+				return err
+			}
+			if backlog > consumerBacklog {
+				return fmt.Errorf("%d queued receipts waiting, more than the limit of %d", backlog, consumerBacklog)
+			}
+			return nil
+		})
+	}
+}
+
+// ServeHTTP serves a request, so the server can be mounted in another mux
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// Handler returns the server's HTTP handler, including any middleware
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// Health returns the readiness checker, so callers can register their own checks
+func (s *Server) Health() *health.Checker {
+	return s.checker
+}
+
+// GRPCServer returns the gRPC server, so callers can register their own services
+// before calling Start
+func (s *Server) GRPCServer() *grpc.Server {
+	return s.grpcServer
+}
+
+// Metrics returns the metrics recorded by the server
+func (s *Server) Metrics() *metrics.Metrics {
+	return s.metrics
+}
+
+// EventBus returns the bus scoring activity is published on, so callers can
+// subscribe to it
+func (s *Server) EventBus() *events.Bus {
+	return s.bus
+}
+
+// Start begins serving on the configured listeners, or on a new listener for
+// the configured address when none were given. It returns once every
+// listener is accepting connections.
+func (s *Server) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return errors.New("server already started")
+	}
+
+	if len(s.listeners) == 0 {
+		l, err := net.Listen("tcp", s.addr)
+		if err != nil {
+			return fmt.Errorf("listening on %s: %w", s.addr, err)
+		}
+		s.listeners = []net.Listener{l}
+	}
+	if s.grpcAddr != "" && len(s.grpcListeners) == 0 {
+		l, err := net.Listen("tcp", s.grpcAddr)
+		if err != nil {
+			for _, l := range s.listeners {
+				l.Close()
+			}
+			return fmt.Errorf("listening on %s: %w", s.grpcAddr, err)
+		}
+		s.grpcListeners = []net.Listener{l}
+	}
+	s.started = true
+
+	for _, l := range s.listeners {
+		if !s.grpcShared {
+			s.serveHTTP(l)
+			continue
+		}
+
+		// Route HTTP/2 connections carrying gRPC to the gRPC server and
+		// everything else to the HTTP server
+		m := cmux.New(l)
+		grpcListener := m.MatchWithWriters(cmux.HTTP2MatchHeaderFieldSendSettings("content-type", "application/grpc"))
+		httpListener := m.Match(cmux.Any())
+		s.serveHTTP(httpListener)
+		s.serveGRPC(grpcListener)
+		s.muxes = append(s.muxes, m)
+
+		s.serving.Add(1)
+		go func() {
+			defer s.serving.Done()
+			// Serve returns once the listener is closed during shutdown
+			_ = m.Serve()
+		}()
+	}
+	for _, l := range s.grpcListeners {
+		s.serveGRPC(l)
+	}
+	if s.consumer != nil {
+		s.consume()
+	}
+	return nil
+}
+
+// consume runs the queue consumer in the background until Shutdown
+func (s *Server) consume() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopConsumer = cancel
+	s.serving.Add(1)
+	go func() {
+		defer s.serving.Done()
+		s.consumer.Run(ctx)
+	}()
+}
+
+// serveHTTP serves the HTTP API on l in the background
+func (s *Server) serveHTTP(l net.Listener) {
+	s.logger.Info("Starting server", "addr", l.Addr().String())
+	s.serving.Add(1)
+	go func() {
+		defer s.serving.Done()
+		if err := s.httpServer.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("Server stopped unexpectedly", "addr", l.Addr().String(), "error", err)
+		}
+	}()
+}
+
+// serveGRPC serves the gRPC API on l in the background
+func (s *Server) serveGRPC(l net.Listener) {
+	s.logger.Info("Starting gRPC server", "addr", l.Addr().String())
+	s.serving.Add(1)
+	go func() {
+		defer s.serving.Done()
+		if err := s.grpcServer.Serve(l); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			s.logger.Error("gRPC server stopped unexpectedly", "addr", l.Addr().String(), "error", err)
+		}
+	}()
+}
+
+// Addrs returns the addresses the server is listening on
+func (s *Server) Addrs() []net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return listenerAddrs(s.listeners)
+}
+
+// GRPCAddrs returns the addresses the gRPC API is served on when it has its
+// own listeners
+func (s *Server) GRPCAddrs() []net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return listenerAddrs(s.grpcListeners)
+}
+
+// listenerAddrs returns the addresses of listeners
+func listenerAddrs(listeners []net.Listener) []net.Addr {
+	addrs := make([]net.Addr, len(listeners))
+	for i, l := range listeners {
+		addrs[i] = l.Addr()
+	}
+	return addrs
+}
+
+// Shutdown marks the server unready and gracefully stops serving, waiting for
+// in-flight requests until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	// Report unready so load balancers stop routing new requests
+	s.checker.Shutdown()
+	s.grpcHealth.Shutdown()
+
+	// End event streams, which would otherwise stay open until clients leave
+	s.eventStream.Close()
+
+	// Stop receiving queued receipts; those being processed are settled
+	// before serving.Wait returns
+	s.mu.Lock()
+	if s.stopConsumer != nil {
+		s.stopConsumer()
+	}
+	s.mu.Unlock()
+
+	grpcStopped := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(grpcStopped)
+	}()
+
+	err := s.httpServer.Shutdown(ctx)
+
+	select {
+	case <-grpcStopped:
+	case <-ctx.Done():
+		s.grpcServer.Stop()
+		<-grpcStopped
+	}
+
+	s.mu.Lock()
+	for _, m := range s.muxes {
+		m.Close()
+	}
+	s.mu.Unlock()
+
+	s.serving.Wait()
+
+	if s.consumerSource != nil {
+		if closeErr := s.consumerSource.Close(); closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("closing consumer source: %w", closeErr))
+		}
+	}
+
+	// Stop delivering events, then webhooks; undelivered events stay in
+	// their outboxes
+	if s.dispatcher != nil {
+		if stopErr := s.dispatcher.Stop(ctx); stopErr != nil {
+			err = errors.Join(err, fmt.Errorf("stopping event delivery: %w", stopErr))
+		}
+	}
+	if s.webhooks != nil {
+		if stopErr := s.webhooks.Stop(ctx); stopErr != nil {
+			err = errors.Join(err, fmt.Errorf("stopping webhook delivery: %w", stopErr))
+		}
+	}
+	return err
+}
@@ -0,0 +1,728 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/marcelorm/receipt-processor/email"
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/events"
+	"github.com/marcelorm/receipt-processor/health"
+	"github.com/marcelorm/receipt-processor/ingest"
+	"github.com/marcelorm/receipt-processor/models"
+	receiptsv1 "github.com/marcelorm/receipt-processor/proto/receipts/v1"
+	"github.com/marcelorm/receipt-processor/requestid"
+	"github.com/marcelorm/receipt-processor/services"
+	"github.com/marcelorm/receipt-processor/services/rules"
+	"github.com/marcelorm/receipt-processor/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func init() {
+	// Configure minimal logging for tests
+	handler := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError, // Only log errors during tests
+	})
+	slog.SetDefault(slog.New(handler))
+
+	// Set Gin to test mode
+	gin.SetMode(gin.TestMode)
+}
+
+// targetReceipt is the Target example receipt, worth 28 points
+var targetReceipt = map[string]any{
+	"retailer":     "Target",
+	"purchaseDate": "2022-01-01",
+	"purchaseTime": "13:01",
+	"items": []map[string]any{
+		{"shortDescription": "Mountain Dew 12PK", "price": "6.49"},
+		{"shortDescription": "Emils Cheese Pizza", "price": "12.25"},
+		{"shortDescription": "Knorr Creamy Chicken", "price": "1.26"},
+		{"shortDescription": "Doritos Nacho Cheese", "price": "3.35"},
+		{"shortDescription": "   Klarbrunn 12-PK 12 FL OZ  ", "price": "12.00"},
+	},
+	"total": "35.35",
+}
+
+// process posts a receipt to h and returns the response
+func process(t *testing.T, h http.Handler, receipt any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	reqBody, err := json.Marshal(receipt)
+	if err != nil {
+		t.Fatalf("Failed to marshal receipt: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/receipts/process", bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	return resp
+}
+
+// points fetches the points for a receipt ID from h
+func points(t *testing.T, h http.Handler, id string) int {
+	t.Helper()
+
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/receipts/"+id+"/points", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, resp.Code, resp.Body.String())
+	}
+
+	var pointsResp models.PointsResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &pointsResp); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	return pointsResp.Points
+}
+
+func TestNewDefaults(t *testing.T) {
+	srv, err := New()
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	resp := process(t, srv, targetReceipt)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, resp.Code, resp.Body.String())
+	}
+
+	var receiptResp models.ReceiptResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &receiptResp); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if got := points(t, srv, receiptResp.ID); got != 28 {
+		t.Errorf("Expected 28 points, got %d", got)
+	}
+}
+
+func TestWithStorage(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	srv, err := New(WithStorage(store))
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	if resp := process(t, srv, targetReceipt); resp.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, resp.Code)
+	}
+
+	count, err := store.Count(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to count receipts: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected the receipt to be saved in the given store, got %d receipts", count)
+	}
+}
+
+func TestWithEventSinks(t *testing.T) {
+	received := make(chan events.Envelope, 1)
+	sink := events.NewSink("test", func(ctx context.Context, envelope events.Envelope) error {
+		received <- envelope
+		return nil
+	})
+	store := storage.NewMemoryStorage()
+	srv, err := New(WithStorage(store), WithEventSinks(sink))
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer srv.Shutdown(context.Background())
+
+	resp := process(t, srv, targetReceipt)
+	var receiptResp models.ReceiptResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &receiptResp); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	select {
+	case envelope := <-received:
+		if envelope.Type != events.TypeReceiptProcessed || envelope.AggregateID != receiptResp.ID {
+			t.Errorf("Expected a receipt.processed event for %s, got %+v", receiptResp.ID, envelope)
+		}
+		// The request ID is kept with the event for asynchronous sinks
+		if id := resp.Header().Get(requestid.Header); id == "" || envelope.RequestID != id {
+			t.Errorf("Expected the event to carry request ID %q, got %q", id, envelope.RequestID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the event")
+	}
+
+	// The event is acknowledged once every sink has handled it
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pending, _ := store.PendingEvents(context.Background(), 0)
+		if len(pending) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected no pending events, got %d", len(pending))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBacklogReadiness(t *testing.T) {
+	release := make(chan struct{})
+	sink := events.NewSink("blocked", func(ctx context.Context, envelope events.Envelope) error {
+		<-release
+		return nil
+	})
+
+	dir := t.TempDir()
+	for _, name := range []string{"a.json", "b.json"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(`{}`), 0o600); err != nil {
+			t.Fatalf("Failed to write receipt: %v", err)
+		}
+	}
+	source, err := ingest.OpenSpool(dir)
+	if err != nil {
+		t.Fatalf("Failed to open spool: %v", err)
+	}
+
+	srv, err := New(WithEventSinks(sink), WithEventBacklogLimit(1),
+		WithConsumer(source), WithConsumerBacklogLimit(1))
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer srv.Shutdown(context.Background())
+
+	readiness := func() health.Report {
+		resp := httptest.NewRecorder()
+		srv.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var report health.Report
+		if err := json.Unmarshal(resp.Body.Bytes(), &report); err != nil {
+			t.Fatalf("Failed to unmarshal readiness report: %v", err)
+		}
+		return report
+	}
+
+	// The spool is not consumed before Start, so its two files exceed the limit
+	process(t, srv, targetReceipt)
+	process(t, srv, targetReceipt)
+	report := readiness()
+	if report.Status != health.StatusUnavailable {
+		t.Errorf("Expected status %s with backlogs over the limits, got %s", health.StatusUnavailable, report.Status)
+	}
+	for _, name := range []string{"events", "consumer"} {
+		if report.Checks[name].Status != health.StatusUnavailable {
+			t.Errorf("Expected the %s check to fail, got %+v", name, report.Checks[name])
+		}
+	}
+
+	// Delivering the events clears their backlog
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for readiness().Checks["events"].Status != health.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the event backlog to clear")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWithConsumer(t *testing.T) {
+	dir := t.TempDir()
+	data, err := json.Marshal(targetReceipt)
+	if err != nil {
+		t.Fatalf("Failed to marshal receipt: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "receipt.json"), data, 0o600); err != nil {
+		t.Fatalf("Failed to write receipt: %v", err)
+	}
+	source, err := ingest.OpenSpool(dir, ingest.WithSpoolPollInterval(time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to open spool: %v", err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	store := storage.NewMemoryStorage()
+	srv, err := New(WithListener(l), WithStorage(store), WithConsumer(source, ingest.WithWorkers(1)))
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	// Queued receipts are only consumed once the server starts
+	time.Sleep(10 * time.Millisecond)
+	if count, _ := store.Count(context.Background()); count != 0 {
+		t.Fatalf("Expected no receipts before Start, got %d", count)
+	}
+
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for count, _ := store.Count(context.Background()); count != 1; count, _ = store.Count(context.Background()) {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the queued receipt to be stored")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Failed to shut down: %v", err)
+	}
+	resp := httptest.NewRecorder()
+	srv.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	want := `receipt_processor_consumed_messages_total{outcome="acked",source="spool"} 1`
+	if !strings.Contains(resp.Body.String(), want) {
+		t.Errorf("Expected the queued receipt to be recorded in the server's metrics as %s", want)
+	}
+}
+
+func TestWithRuleSet(t *testing.T) {
+	srv, err := New(WithRuleSet(rules.RuleSet{rules.RetailerNameRule()}))
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	resp := process(t, srv, targetReceipt)
+	var receiptResp models.ReceiptResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &receiptResp); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	// Only the retailer name rule applies: 6 points for "Target"
+	if got := points(t, srv, receiptResp.ID); got != 6 {
+		t.Errorf("Expected 6 points, got %d", got)
+	}
+}
+
+func TestWithStoreZones(t *testing.T) {
+	zones, err := services.NewStoreZones("", map[string]string{"Target": "America/Chicago"})
+	if err != nil {
+		t.Fatalf("Failed to create store zones: %v", err)
+	}
+	srv, err := New(WithRuleSet(rules.RuleSet{rules.AfternoonTimeRule()}), WithStoreZones(zones))
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	// 20:30 UTC is 15:30 in Chicago in July
+	receipt := maps.Clone(targetReceipt)
+	receipt["purchaseDate"] = "2022-07-01"
+	receipt["purchaseTime"] = "20:30"
+	receipt["timeZone"] = "UTC"
+	resp := process(t, srv, receipt)
+	var receiptResp models.ReceiptResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &receiptResp); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if got := points(t, srv, receiptResp.ID); got != 10 {
+		t.Errorf("Expected 10 points for an afternoon purchase in store local time, got %d", got)
+	}
+}
+
+func TestWithReconciliation(t *testing.T) {
+	srv, err := New(WithReconciliation(0.01, services.ReconcileReject))
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	// The Target example adds up, so it is still accepted
+	if resp := process(t, srv, targetReceipt); resp.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusOK, resp.Code, resp.Body.String())
+	}
+
+	receipt := maps.Clone(targetReceipt)
+	receipt["total"] = "100.00"
+	resp := process(t, srv, receipt)
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusBadRequest, resp.Code, resp.Body.String())
+	}
+	var apiErr rperrors.APIError
+	if err := json.Unmarshal(resp.Body.Bytes(), &apiErr); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if apiErr.Code != rperrors.ErrInvalidTotal {
+		t.Errorf("Expected error code %s, got %s", rperrors.ErrInvalidTotal, apiErr.Code)
+	}
+}
+
+func TestWithExchangeRates(t *testing.T) {
+	rates, err := services.NewExchangeRates("test", "USD", map[string]float64{"GBP": 2})
+	if err != nil {
+		t.Fatalf("Failed to create exchange rates: %v", err)
+	}
+	srv, err := New(WithExchangeRates(rates))
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	// 12.50 GBP is 25.00 USD, a round dollar amount
+	receipt := map[string]any{
+		"retailer":     "A",
+		"purchaseDate": "2022-01-02",
+		"purchaseTime": "13:00",
+		"items":        []map[string]any{{"shortDescription": "Gum", "price": "12.50"}},
+		"total":        "12.50",
+		"currency":     "GBP",
+	}
+	resp := process(t, srv, receipt)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, resp.Code, resp.Body.String())
+	}
+	var receiptResp models.ReceiptResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &receiptResp); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if got := points(t, srv, receiptResp.ID); got != 81 {
+		t.Errorf("Expected 81 points, got %d", got)
+	}
+
+	// A known currency without a rate is rejected
+	receipt["currency"] = "JPY"
+	receipt["items"] = []map[string]any{{"shortDescription": "Gum", "price": "1250"}}
+	receipt["total"] = "1250"
+	resp = process(t, srv, receipt)
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusBadRequest, resp.Code, resp.Body.String())
+	}
+	var apiErr rperrors.APIError
+	if err := json.Unmarshal(resp.Body.Bytes(), &apiErr); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if apiErr.Code != rperrors.ErrInvalidCurrency {
+		t.Errorf("Expected error code %s, got %s", rperrors.ErrInvalidCurrency, apiErr.Code)
+	}
+}
+
+func TestWithEmailTemplates(t *testing.T) {
+	shop := email.Template{
+		Retailer: "Corner Shop",
+		Senders:  []string{"shop.example"},
+		Date:     regexp.MustCompile(`^Date: (?P<date>\S+) (?P<time>\S+)$`),
+		Item:     regexp.MustCompile(`^(?P<description>.+) (?P<price>\d+\.\d{2})$`),
+		Total:    regexp.MustCompile(`^Total (?P<total>\d+\.\d{2})$`),
+	}
+	srv, err := New(WithEmailTemplates(shop))
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	body := "From: <receipts@shop.example>\n\nDate: 2022-01-01 13:01\nGum 1.00\nTotal 1.00\n"
+	req := httptest.NewRequest(http.MethodPost, "/receipts/email", strings.NewReader(body))
+	req.Header.Set("Content-Type", "message/rfc822")
+	resp := httptest.NewRecorder()
+	srv.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"template":"Corner Shop"`) {
+		t.Errorf("Expected the receipt to be read with the custom template, got %d: %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestWithBodyLimit(t *testing.T) {
+	srv, err := New(WithBodyLimit(64))
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	if resp := process(t, srv, targetReceipt); resp.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status code %d, got %d", http.StatusRequestEntityTooLarge, resp.Code)
+	}
+
+	if _, err := New(WithBodyLimit(0)); err == nil {
+		t.Error("Expected error for a zero body limit, got nil")
+	}
+}
+
+func TestWithMiddlewareAndLogger(t *testing.T) {
+	var order []string
+	middleware := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	var logs bytes.Buffer
+	srv, err := New(
+		WithMiddleware(middleware("outer"), middleware("inner")),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	resp := httptest.NewRecorder()
+	srv.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/livez", nil))
+
+	if strings.Join(order, ",") != "outer,inner" {
+		t.Errorf("Expected middleware to run outer then inner, got %v", order)
+	}
+	if !strings.Contains(logs.String(), "Request processed") {
+		t.Errorf("Expected requests to be logged through the given logger, got %q", logs.String())
+	}
+}
+
+func TestStartShutdown(t *testing.T) {
+	l1, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	l2, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	srv, err := New(WithListener(l1), WithListener(l2))
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	if err := srv.Start(); err == nil {
+		t.Error("Expected error when starting twice, got nil")
+	}
+
+	// Both listeners serve the same handler
+	for _, addr := range srv.Addrs() {
+		resp, err := http.Get("http://" + addr.String() + "/readyz")
+		if err != nil {
+			t.Fatalf("Failed to reach %s: %v", addr, err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected status code %d from %s, got %d", http.StatusOK, addr, resp.StatusCode)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Failed to shut down: %v", err)
+	}
+
+	// Readiness reports unavailable once shutdown has begun
+	resp := httptest.NewRecorder()
+	srv.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d after shutdown, got %d", http.StatusServiceUnavailable, resp.Code)
+	}
+
+	if _, err := http.Get("http://" + srv.Addrs()[0].String() + "/livez"); err == nil {
+		t.Error("Expected listener to be closed after shutdown")
+	}
+}
+
+func TestShutdownEndsEventStreams(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	srv, err := New(WithListener(l))
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get("http://" + l.Addr().String() + "/events")
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Processed receipts are delivered to the stream in the background
+	if w := process(t, srv, targetReceipt); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	stream := bufio.NewReader(resp.Body)
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Expected the Target receipt in the stream, got %v", err)
+		}
+		if strings.Contains(line, `"retailer":"Target","points":28`) {
+			break
+		}
+	}
+
+	// Shutdown does not wait for the client to disconnect
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Failed to shut down: %v", err)
+	}
+
+	if _, err := io.ReadAll(stream); err != nil {
+		t.Errorf("Expected the stream to end cleanly, got %v", err)
+	}
+	if srv.EventBus().Subscribers() != 0 {
+		t.Errorf("Expected no event subscribers, got %d", srv.EventBus().Subscribers())
+	}
+}
+
+// grpcClient dials the gRPC API at addr
+func grpcClient(t *testing.T, addr net.Addr) *grpc.ClientConn {
+	t.Helper()
+
+	conn, err := grpc.NewClient(addr.String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial %s: %v", addr, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// protoReceipt is the Target example receipt as a gRPC request
+func protoReceipt() *receiptsv1.ProcessReceiptRequest {
+	return &receiptsv1.ProcessReceiptRequest{Receipt: &receiptsv1.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items: []*receiptsv1.Item{
+			{ShortDescription: "Mountain Dew 12PK", Price: "6.49"},
+			{ShortDescription: "Emils Cheese Pizza", Price: "12.25"},
+			{ShortDescription: "Knorr Creamy Chicken", Price: "1.26"},
+			{ShortDescription: "Doritos Nacho Cheese", Price: "3.35"},
+			{ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: "12.00"},
+		},
+		Total: "35.35",
+	}}
+}
+
+func TestGRPC(t *testing.T) {
+	tests := []struct {
+		name string
+		opts func(http, grpc net.Listener) []Option
+	}{
+		{"Shared port", func(http, _ net.Listener) []Option {
+			return []Option{WithListener(http), WithGRPC()}
+		}},
+		{"Separate port", func(http, grpc net.Listener) []Option {
+			return []Option{WithListener(http), WithGRPCListener(grpc)}
+		}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			httpListener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("Failed to listen: %v", err)
+			}
+			grpcListener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("Failed to listen: %v", err)
+			}
+			defer grpcListener.Close()
+
+			srv, err := New(tc.opts(httpListener, grpcListener)...)
+			if err != nil {
+				t.Fatalf("Failed to create server: %v", err)
+			}
+			if err := srv.Start(); err != nil {
+				t.Fatalf("Failed to start server: %v", err)
+			}
+
+			grpcAddr := srv.Addrs()[0]
+			if addrs := srv.GRPCAddrs(); len(addrs) > 0 {
+				grpcAddr = addrs[0]
+			}
+			conn := grpcClient(t, grpcAddr)
+
+			// A receipt processed over gRPC is visible over HTTP
+			resp, err := receiptsv1.NewReceiptServiceClient(conn).ProcessReceipt(context.Background(), protoReceipt())
+			if err != nil {
+				t.Fatalf("ProcessReceipt failed: %v", err)
+			}
+			httpResp, err := http.Get("http://" + srv.Addrs()[0].String() + "/receipts/" + resp.GetId() + "/points")
+			if err != nil {
+				t.Fatalf("Failed to get points over HTTP: %v", err)
+			}
+			var pointsResp models.PointsResponse
+			if err := json.NewDecoder(httpResp.Body).Decode(&pointsResp); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			httpResp.Body.Close()
+			if pointsResp.Points != 28 {
+				t.Errorf("Expected 28 points over HTTP, got %d", pointsResp.Points)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			if err := srv.Shutdown(ctx); err != nil {
+				t.Fatalf("Failed to shut down: %v", err)
+			}
+			if _, err := receiptsv1.NewReceiptServiceClient(conn).GetPoints(context.Background(), &receiptsv1.GetPointsRequest{Id: resp.GetId()}); status.Code(err) != codes.Unavailable {
+				t.Errorf("Expected gRPC calls to fail after shutdown, got %v", err)
+			}
+		})
+	}
+
+	t.Run("Conflicting options", func(t *testing.T) {
+		if _, err := New(WithGRPC(), WithGRPCAddr(":0")); err == nil {
+			t.Error("Expected error for gRPC on both shared and separate listeners, got nil")
+		}
+	})
+}
+
+func TestGRPCHealthDuringShutdown(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	srv, err := New(WithGRPCListener(l), WithAddr("127.0.0.1:0"))
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+
+	healthClient := healthpb.NewHealthClient(grpcClient(t, srv.GRPCAddrs()[0]))
+	resp, err := healthClient.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil || resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("Expected SERVING before shutdown, got %v, %v", resp, err)
+	}
+
+	// Watch the health status to observe the change while connections drain
+	stream, err := healthClient.Watch(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Failed to watch health: %v", err)
+	}
+	if first, err := stream.Recv(); err != nil || first.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("Expected SERVING, got %v, %v", first, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	go srv.Shutdown(ctx)
+
+	next, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Failed to receive health update: %v", err)
+	}
+	if next.GetStatus() != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("Expected NOT_SERVING during shutdown, got %s", next.GetStatus())
+	}
+}
@@ -3,55 +3,210 @@ package services
 import (
 	"context"
 	"log/slog"
+	"strings"
 
 	rperrors "github.com/marcelorm/receipt-processor/errors"
 	"github.com/marcelorm/receipt-processor/models"
 	"github.com/marcelorm/receipt-processor/services/rules"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// tracer creates the spans recorded while calculating points
+var tracer = otel.Tracer("github.com/marcelorm/receipt-processor/services")
+
+// Calculator scores receipts against a fixed set of rules
+type Calculator struct {
+	rules  rules.RuleSet
+	logger *slog.Logger
+	zones  *StoreZones
+	rates  *ExchangeRates
+
+	reconcile bool            // Check totals against items, tax, tip and discounts
+	tolerance float64         // Largest difference accepted when reconciling
+	policy    ReconcilePolicy // What happens to receipts that do not reconcile
+}
+
+// ReconcilePolicy decides what happens to receipts whose total does not
+// reconcile with their items, tax, tip and discounts
+type ReconcilePolicy string
+
+const (
+	ReconcileWarn   ReconcilePolicy = "warn"   // Score the receipt and record the failure for review
+	ReconcileReject ReconcilePolicy = "reject" // Reject the receipt with ErrInvalidTotal
+)
+
+// CalculatorOption configures a Calculator
+type CalculatorOption func(*Calculator)
+
+// WithStoreZones applies the rules to purchase dates and times in the local
+// time of each store
+func WithStoreZones(zones *StoreZones) CalculatorOption {
+	return func(c *Calculator) {
+		c.zones = zones
+	}
+}
+
+// WithExchangeRates converts receipts in other currencies into the base
+// currency of rates before applying the rules
+func WithExchangeRates(rates *ExchangeRates) CalculatorOption {
+	return func(c *Calculator) {
+		c.rates = rates
+	}
+}
+
+// WithReconciliation checks that receipt totals add up to their items, less
+// discounts, plus tax and tip, to within tolerance. Failures are recorded on
+// the breakdown, or rejected, according to policy.
+func WithReconciliation(tolerance float64, policy ReconcilePolicy) CalculatorOption {
+	return func(c *Calculator) {
+		c.reconcile = true
+		c.tolerance = tolerance
+		c.policy = policy
+	}
+}
+
+// NewCalculator creates a calculator applying ruleSet in order. A nil logger
+// uses the default logger.
+func NewCalculator(ruleSet rules.RuleSet, logger *slog.Logger, opts ...CalculatorOption) *Calculator {
+	c := &Calculator{
+		rules:  ruleSet,
+		logger: logger,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Rules returns the rules applied by the calculator
+func (c *Calculator) Rules() rules.RuleSet {
+	return c.rules
+}
+
 // CalculatePoints calculates the total points for a receipt according to the rules
 func CalculatePoints(ctx context.Context, receipt models.Receipt) (int, error) {
+	breakdown, err := CalculateBreakdown(ctx, receipt)
+	if err != nil {
+		return 0, err
+	}
+	return breakdown.Total, nil
+}
+
+// CalculateBreakdown applies every rule to the receipt and returns the points
+// awarded by each rule along with the total
+func CalculateBreakdown(ctx context.Context, receipt models.Receipt) (models.PointsBreakdown, error) {
+	return NewCalculator(rules.GetAllRules(), nil).Breakdown(ctx, receipt)
+}
+
+// Points calculates the total points for a receipt
+func (c *Calculator) Points(ctx context.Context, receipt models.Receipt) (int, error) {
+	breakdown, err := c.Breakdown(ctx, receipt)
+	if err != nil {
+		return 0, err
+	}
+	return breakdown.Total, nil
+}
+
+// Breakdown applies every rule to the receipt and returns the points awarded
+// by each rule along with the total
+func (c *Calculator) Breakdown(ctx context.Context, receipt models.Receipt) (models.PointsBreakdown, error) {
+	logger := c.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	ctx, span := tracer.Start(ctx, "CalculatePoints", trace.WithAttributes(
+		attribute.String("receipt.retailer", receipt.Retailer),
+		attribute.Int("receipt.items", len(receipt.Items)),
+	))
+	defer span.End()
+
 	// Check if context is canceled before proceeding
 	select {
 	case <-ctx.Done():
-		return 0, rperrors.Wrap(rperrors.ErrContextCancelled, ctx.Err(), "context cancelled during point calculation")
+		span.SetStatus(codes.Error, "context cancelled")
+		return models.PointsBreakdown{}, rperrors.Wrap(rperrors.ErrContextCancelled, ctx.Err(), "context cancelled during point calculation")
 	default:
 		// Continue with normal operation
 	}
 
-	slog.InfoContext(ctx, "Calculating points for receipt",
+	// Totals that do not add up are rejected or flagged for review
+	var reconciliation *models.Reconciliation
+	if c.reconcile {
+		if reconciliation = receipt.Reconcile(c.tolerance); reconciliation != nil {
+			problems := strings.Join(reconciliation.Problems, "; ")
+			if c.policy == ReconcileReject {
+				span.SetStatus(codes.Error, "total does not reconcile")
+				return models.PointsBreakdown{}, rperrors.New(rperrors.ErrInvalidTotal, problems)
+			}
+			logger.WarnContext(ctx, "Receipt total does not reconcile",
+				"retailer", receipt.Retailer,
+				"total", float64(receipt.Total),
+				"expected", float64(reconciliation.Expected),
+				"problems", problems)
+		}
+	}
+
+	// Rules express thresholds in the base currency
+	receipt, conversion, err := c.rates.Convert(receipt)
+	if err != nil {
+		span.SetStatus(codes.Error, "unknown currency")
+		return models.PointsBreakdown{}, err
+	}
+
+	// Refunds earn no points; the points of the original receipt are clawed
+	// back when the refund is stored
+	if receipt.IsRefund() {
+		return models.PointsBreakdown{Rules: []models.RuleResult{}, Reconciliation: reconciliation, Conversion: conversion}, nil
+	}
+
+	// Rules see the purchase date and time in store local time
+	receipt = c.zones.Local(receipt)
+
+	logger.InfoContext(ctx, "Calculating points for receipt",
 		"retailer", receipt.Retailer,
 		"date", receipt.PurchaseDate,
 		"time", receipt.PurchaseTime,
 		"items_count", len(receipt.Items))
 
-	// Get all rules
-	pointRules := rules.GetAllRules()
-
 	// Apply all rules and sum the points
-	totalPoints := 0
-	for i, rule := range pointRules {
+	breakdown := models.PointsBreakdown{
+		Rules:          make([]models.RuleResult, 0, len(c.rules)),
+		Reconciliation: reconciliation,
+		Conversion:     conversion,
+	}
+	for i, rule := range c.rules {
 		// Check if context is canceled before each rule evaluation
 		select {
 		case <-ctx.Done():
-			return 0, rperrors.Wrap(rperrors.ErrContextCancelled, ctx.Err(), "context cancelled during rule evaluation")
+			span.SetStatus(codes.Error, "context cancelled")
+			return models.PointsBreakdown{}, rperrors.Wrap(rperrors.ErrContextCancelled, ctx.Err(), "context cancelled during rule evaluation")
 		default:
 			// Continue with normal operation
 		}
 
-		points := rule.Apply(ctx, receipt)
+		ruleCtx, ruleSpan := tracer.Start(ctx, "PointRule "+rule.Name)
+		points := rule.Apply(ruleCtx, receipt)
+		ruleSpan.SetAttributes(attribute.Int("rule.points", points))
+		ruleSpan.End()
+
+		breakdown.Rules = append(breakdown.Rules, models.RuleResult{Rule: rule.Name, Points: points})
 		if points > 0 {
 			logMsg := rule.FormatLogMessage(points, receipt)
 			if logMsg != "" {
-				slog.InfoContext(ctx, logMsg, "rule_number", i+1, "points", points)
+				logger.InfoContext(ctx, logMsg, "rule_number", i+1, "points", points)
 			}
-			totalPoints += points
+			breakdown.Total += points
 		}
 	}
 
-	slog.InfoContext(ctx, "Total points calculated",
+	logger.InfoContext(ctx, "Total points calculated",
 		"retailer", receipt.Retailer,
-		"total_points", totalPoints)
+		"total_points", breakdown.Total)
+	span.SetAttributes(attribute.Int("receipt.points", breakdown.Total))
 
-	return totalPoints, nil
+	return breakdown, nil
 }
@@ -4,9 +4,15 @@ import (
 	"context"
 	"io"
 	"log/slog"
+	"strings"
 	"testing"
 
+	rperrors "github.com/marcelorm/receipt-processor/errors"
 	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/services/rules"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 // BenchmarkCalculatePoints measures the performance of the point calculation
@@ -21,8 +27,8 @@ func BenchmarkCalculatePoints(b *testing.B) {
 	// Create a sample receipt for benchmarking
 	receipt := models.Receipt{
 		Retailer:     "Target",
-		PurchaseDate: models.Date("2022-01-01"),
-		PurchaseTime: models.Time("13:01"),
+		PurchaseDate: models.MustParseDate("2022-01-01"),
+		PurchaseTime: models.MustParseTime("13:01"),
 		Items: []models.Item{
 			{ShortDescription: "Mountain Dew 12PK", Price: 6.49},
 			{ShortDescription: "Emils Cheese Pizza", Price: 12.25},
@@ -54,8 +60,8 @@ func TestCalculatePoints(t *testing.T) {
 			name: "Target receipt example",
 			receipt: models.Receipt{
 				Retailer:     "Target",
-				PurchaseDate: models.Date("2022-01-01"),
-				PurchaseTime: models.Time("13:01"),
+				PurchaseDate: models.MustParseDate("2022-01-01"),
+				PurchaseTime: models.MustParseTime("13:01"),
 				Items: []models.Item{
 					{ShortDescription: "Mountain Dew 12PK", Price: 6.49},
 					{ShortDescription: "Emils Cheese Pizza", Price: 12.25},
@@ -71,8 +77,8 @@ func TestCalculatePoints(t *testing.T) {
 			name: "M&M Corner Market receipt example",
 			receipt: models.Receipt{
 				Retailer:     "M&M Corner Market",
-				PurchaseDate: models.Date("2022-03-20"),
-				PurchaseTime: models.Time("14:33"),
+				PurchaseDate: models.MustParseDate("2022-03-20"),
+				PurchaseTime: models.MustParseTime("14:33"),
 				Items: []models.Item{
 					{ShortDescription: "Gatorade", Price: 2.25},
 					{ShortDescription: "Gatorade", Price: 2.25},
@@ -88,8 +94,8 @@ func TestCalculatePoints(t *testing.T) {
 			name: "Empty receipt with zero",
 			receipt: models.Receipt{
 				Retailer:     "",
-				PurchaseDate: models.Date("2022-01-01"),
-				PurchaseTime: models.Time("12:00"),
+				PurchaseDate: models.MustParseDate("2022-01-01"),
+				PurchaseTime: models.MustParseTime("12:00"),
 				Items:        []models.Item{},
 				Total:        0.00,
 			},
@@ -99,8 +105,8 @@ func TestCalculatePoints(t *testing.T) {
 			name: "Receipt with odd number of items",
 			receipt: models.Receipt{
 				Retailer:     "ABC",
-				PurchaseDate: models.Date("2022-02-02"),
-				PurchaseTime: models.Time("12:00"),
+				PurchaseDate: models.MustParseDate("2022-02-02"),
+				PurchaseTime: models.MustParseTime("12:00"),
 				Items: []models.Item{
 					{ShortDescription: "Item 1", Price: 1.00},
 					{ShortDescription: "Item 2", Price: 2.00},
@@ -114,8 +120,8 @@ func TestCalculatePoints(t *testing.T) {
 			name: "Receipt with purchase time between 14:00 and 16:00",
 			receipt: models.Receipt{
 				Retailer:     "XYZ",
-				PurchaseDate: models.Date("2022-02-01"),
-				PurchaseTime: models.Time("15:30"),
+				PurchaseDate: models.MustParseDate("2022-02-01"),
+				PurchaseTime: models.MustParseTime("15:30"),
 				Items: []models.Item{
 					{ShortDescription: "Item", Price: 1.00},
 				},
@@ -149,8 +155,8 @@ func TestCalculatePoints(t *testing.T) {
 
 		receipt := models.Receipt{
 			Retailer:     "Test",
-			PurchaseDate: models.Date("2022-01-01"),
-			PurchaseTime: models.Time("12:00"),
+			PurchaseDate: models.MustParseDate("2022-01-01"),
+			PurchaseTime: models.MustParseTime("12:00"),
 			Items:        []models.Item{{ShortDescription: "Item", Price: 1.00}},
 			Total:        1.00,
 		}
@@ -161,3 +167,132 @@ func TestCalculatePoints(t *testing.T) {
 		}
 	})
 }
+
+func TestCalculateBreakdown(t *testing.T) {
+	receipt := models.Receipt{
+		Retailer:     "M&M Corner Market",
+		PurchaseDate: models.MustParseDate("2022-03-20"),
+		PurchaseTime: models.MustParseTime("14:33"),
+		Items: []models.Item{
+			{ShortDescription: "Gatorade", Price: 2.25},
+			{ShortDescription: "Gatorade", Price: 2.25},
+			{ShortDescription: "Gatorade", Price: 2.25},
+			{ShortDescription: "Gatorade", Price: 2.25},
+		},
+		Total: 9.00,
+	}
+
+	breakdown, err := CalculateBreakdown(context.Background(), receipt)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if breakdown.Total != 109 {
+		t.Errorf("Expected 109 total points, got %d", breakdown.Total)
+	}
+
+	expected := map[string]int{
+		"RetailerNameRule":          14,
+		"RoundDollarRule":           50,
+		"QuarterMultipleRule":       25,
+		"ItemPairsRule":             10,
+		"ItemDescriptionLengthRule": 0,
+		"OddDayRule":                0,
+		"AfternoonTimeRule":         10,
+	}
+	if len(breakdown.Rules) != len(expected) {
+		t.Fatalf("Expected %d rule results, got %d", len(expected), len(breakdown.Rules))
+	}
+	for _, result := range breakdown.Rules {
+		if result.Points != expected[result.Rule] {
+			t.Errorf("Expected %d points for %s, got %d", expected[result.Rule], result.Rule, result.Points)
+		}
+	}
+}
+
+func TestCalculatePointsSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+
+	receipt := models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: models.MustParseDate("2022-01-01"),
+		PurchaseTime: models.MustParseTime("13:01"),
+		Items:        []models.Item{{ShortDescription: "Item", Price: 1.00}},
+		Total:        1.00,
+	}
+
+	if _, err := CalculatePoints(context.Background(), receipt); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	var parent tracetest.SpanStub
+	children := 0
+	for _, span := range spans {
+		if span.Name == "CalculatePoints" {
+			parent = span
+		}
+	}
+	if parent.Name == "" {
+		t.Fatal("Expected a CalculatePoints span")
+	}
+	for _, span := range spans {
+		if strings.HasPrefix(span.Name, "PointRule ") {
+			if span.Parent.SpanID() != parent.SpanContext.SpanID() {
+				t.Errorf("Expected %s to be a child of CalculatePoints", span.Name)
+			}
+			children++
+		}
+	}
+	if children != len(rules.GetAllRules()) {
+		t.Errorf("Expected %d rule spans, got %d", len(rules.GetAllRules()), children)
+	}
+}
+
+func TestCalculatorReconciliation(t *testing.T) {
+	receipt := models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: models.MustParseDate("2022-01-01"),
+		PurchaseTime: models.MustParseTime("13:01"),
+		Items:        []models.Item{{ShortDescription: "Gum", Price: 0.01}},
+		Total:        100.00,
+	}
+	reconciled := receipt
+	reconciled.Items = []models.Item{{ShortDescription: "Groceries", Price: 92.50}}
+	reconciled.Tax, reconciled.Tip, reconciled.Discounts = 8.50, 4.00, 5.00
+
+	tests := []struct {
+		name     string
+		receipt  models.Receipt
+		policy   ReconcilePolicy
+		flagged  bool
+		rejected bool
+	}{
+		{"Reconciled", reconciled, ReconcileReject, false, false},
+		{"Warn", receipt, ReconcileWarn, true, false},
+		{"Reject", receipt, ReconcileReject, false, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calculator := NewCalculator(rules.GetAllRules(), nil, WithReconciliation(0.01, tc.policy))
+			breakdown, err := calculator.Breakdown(context.Background(), tc.receipt)
+			if tc.rejected {
+				if !rperrors.IsCode(err, rperrors.ErrInvalidTotal) {
+					t.Errorf("Expected error code %s, got %v", rperrors.ErrInvalidTotal, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if (breakdown.Reconciliation != nil) != tc.flagged {
+				t.Errorf("Expected flagged %v, got %+v", tc.flagged, breakdown.Reconciliation)
+			}
+			if breakdown.Total == 0 {
+				t.Error("Expected points to be awarded")
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/metrics"
+	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/storage"
+)
+
+// Processor validates, scores and stores receipts. Every transport hands its
+// decoded receipts to a Processor so they all go through the same pipeline.
+type Processor struct {
+	calculator *Calculator
+	store      storage.ReceiptStorage
+	metrics    *metrics.Metrics
+	logger     *slog.Logger
+}
+
+// NewProcessor creates a processor scoring receipts with calculator and saving
+// them in store. m may be nil when metrics are not collected.
+func NewProcessor(calculator *Calculator, store storage.ReceiptStorage, m *metrics.Metrics, logger *slog.Logger) *Processor {
+	return &Processor{
+		calculator: calculator,
+		store:      store,
+		metrics:    m,
+		logger:     logger,
+	}
+}
+
+// Process validates, scores and stores a receipt and returns its ID and
+// points breakdown. Rejected receipts are counted as validation failures, so
+// callers only count the failures they detect before calling Process.
+func (p *Processor) Process(ctx context.Context, receipt models.Receipt) (string, models.PointsBreakdown, error) {
+	id, breakdown, err := p.process(ctx, receipt)
+	if err != nil {
+		return "", models.PointsBreakdown{}, err
+	}
+
+	p.metrics.ObserveReceipt(breakdown)
+
+	p.logger.InfoContext(ctx, "Receipt processed successfully",
+		"id", id,
+		"points", breakdown.Total,
+		"retailer", receipt.Retailer)
+
+	return id, breakdown, nil
+}
+
+// process runs the pipeline, counting rejected receipts and wrapping
+// unexpected failures with the code of the step that failed
+func (p *Processor) process(ctx context.Context, receipt models.Receipt) (string, models.PointsBreakdown, error) {
+	if err := ValidateReceipt(receipt); err != nil {
+		return "", models.PointsBreakdown{}, p.reject(err)
+	}
+
+	breakdown, err := p.calculator.Breakdown(ctx, receipt)
+	if err != nil {
+		if Rejected(err) {
+			return "", models.PointsBreakdown{}, p.reject(err)
+		}
+		if rperrors.IsCode(err, rperrors.ErrContextCancelled) {
+			return "", models.PointsBreakdown{}, err
+		}
+		return "", models.PointsBreakdown{}, rperrors.Wrap(rperrors.ErrCalculationFailed, err,
+			"error calculating points for receipt")
+	}
+
+	id, err := p.store.SaveReceipt(ctx, receipt, breakdown)
+	if err != nil {
+		if storage.Rejected(err) {
+			return "", models.PointsBreakdown{}, p.reject(err)
+		}
+		if rperrors.IsCode(err, rperrors.ErrContextCancelled) {
+			return "", models.PointsBreakdown{}, err
+		}
+		return "", models.PointsBreakdown{}, rperrors.Wrap(rperrors.ErrStorageFailure, err,
+			"unable to save receipt points")
+	}
+
+	return id, breakdown, nil
+}
+
+// reject counts a rejected receipt as a validation failure and returns err
+func (p *Processor) reject(err error) error {
+	p.metrics.ObserveValidationFailure(string(rperrors.GetCode(err)))
+	return err
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/metrics"
+	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/services/rules"
+	"github.com/marcelorm/receipt-processor/storage"
+)
+
+// failingStore fails every save with an unexpected error
+type failingStore struct {
+	storage.ReceiptStorage
+}
+
+func (failingStore) SaveReceipt(context.Context, models.Receipt, models.PointsBreakdown) (string, error) {
+	return "", errors.New("disk full")
+}
+
+func TestProcessor(t *testing.T) {
+	valid := func() models.Receipt {
+		return models.Receipt{
+			Retailer:     "Target",
+			PurchaseDate: models.MustParseDate("2022-01-01"),
+			PurchaseTime: models.MustParseTime("13:01"),
+			Items:        []models.Item{{ShortDescription: "Pepsi - 12-oz", Price: 1.25}},
+			Total:        1.25,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(*models.Receipt)
+		store    storage.ReceiptStorage
+		expected rperrors.ErrorCode
+		counted  bool
+	}{
+		{"Valid receipt", func(r *models.Receipt) {}, nil, "", false},
+		{"Invalid receipt", func(r *models.Receipt) { r.Retailer = "" }, nil, rperrors.ErrInvalidRetailer, true},
+		{"Total not reconciled", func(r *models.Receipt) { r.Total = 5 }, nil, rperrors.ErrInvalidTotal, true},
+		{"Refund of unknown receipt", func(r *models.Receipt) {
+			r.RefundOf = "missing"
+			r.Items[0].Price = -1.25
+			r.Total = -1.25
+		}, nil, rperrors.ErrInvalidRefund, true},
+		{"Storage failure", func(r *models.Receipt) {}, failingStore{}, rperrors.ErrStorageFailure, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			store := tc.store
+			if store == nil {
+				store = storage.NewMemoryStorage()
+			}
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			calculator := NewCalculator(rules.GetAllRules(), logger, WithReconciliation(0.01, ReconcileReject))
+			m := metrics.New()
+			processor := NewProcessor(calculator, store, m, logger)
+
+			receipt := valid()
+			tc.modify(&receipt)
+			id, breakdown, err := processor.Process(context.Background(), receipt)
+
+			if code := rperrors.GetCode(err); code != tc.expected {
+				t.Errorf("Expected error code %q, got %q (%v)", tc.expected, code, err)
+			}
+			if tc.expected == "" {
+				if id == "" {
+					t.Errorf("Expected a receipt ID, got none")
+				}
+				if points, _ := store.GetPoints(context.Background(), id); points != breakdown.Total {
+					t.Errorf("Expected %d stored points, got %d", breakdown.Total, points)
+				}
+			}
+
+			failure := `receipt_processor_validation_failures_total{code="` + string(tc.expected) + `"} 1`
+			if counted := strings.Contains(scrape(t, m), failure); counted != tc.counted {
+				t.Errorf("Expected rejection counted to be %v, got %v", tc.counted, counted)
+			}
+		})
+	}
+}
+
+// scrape returns the metrics exposed by m
+func scrape(t *testing.T, m *metrics.Metrics) string {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	return recorder.Body.String()
+}
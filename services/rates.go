@@ -0,0 +1,147 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/models"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultBaseCurrency is the base currency when no exchange rates are configured
+const DefaultBaseCurrency = "USD"
+
+// ExchangeRates is a versioned table of exchange rates into the base
+// currency the rules are expressed in. It is loaded from a YAML or JSON file,
+// for example:
+//
+//	version: 2024-06-01
+//	base: USD
+//	rates:
+//	  CAD: 0.73
+//	  MXN: 0.055
+type ExchangeRates struct {
+	Version string             `yaml:"version"` // Identifies the table, recorded with every conversion
+	Base    string             `yaml:"base"`    // ISO 4217 code of the base currency
+	Rates   map[string]float64 `yaml:"rates"`   // Units of the base currency per unit of each currency
+
+	base models.Currency
+}
+
+// NewExchangeRates creates a table converting the given currencies into base
+func NewExchangeRates(version, base string, rates map[string]float64) (*ExchangeRates, error) {
+	x := &ExchangeRates{Version: version, Base: base, Rates: rates}
+	if err := x.init(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// LoadExchangeRates reads an exchange-rate table file
+func LoadExchangeRates(path string) (*ExchangeRates, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading exchange rates: %w", err)
+	}
+
+	var x ExchangeRates
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&x); err != nil {
+		return nil, fmt.Errorf("parsing exchange rates %s: %w", path, err)
+	}
+	if err := x.init(); err != nil {
+		return nil, fmt.Errorf("exchange rates %s: %w", path, err)
+	}
+	return &x, nil
+}
+
+// init checks the table and resolves its base currency
+func (x *ExchangeRates) init() error {
+	if x.Version == "" {
+		return fmt.Errorf("version is required")
+	}
+	base, err := models.LookupCurrency(x.Base)
+	if err != nil {
+		return fmt.Errorf("base: %w", err)
+	}
+	x.base = base
+
+	codes := make([]string, 0, len(x.Rates))
+	for code := range x.Rates {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+	for _, code := range codes {
+		if _, err := models.LookupCurrency(code); err != nil {
+			return fmt.Errorf("rates: %w", err)
+		}
+		if rate := x.Rates[code]; rate <= 0 {
+			return fmt.Errorf("rates: %s must be positive, got %g", code, rate)
+		}
+	}
+	return nil
+}
+
+// Rate returns the units of the base currency per unit of currency
+func (x *ExchangeRates) Rate(currency string) (float64, error) {
+	if currency == x.Base {
+		return 1, nil
+	}
+	rate, ok := x.Rates[currency]
+	if !ok {
+		return 0, rperrors.New(rperrors.ErrInvalidCurrency,
+			fmt.Sprintf("no exchange rate from %s to %s in rates %s", currency, x.Base, x.Version))
+	}
+	return rate, nil
+}
+
+// Convert returns the receipt with its amounts in the base currency, rounded
+// to its minor unit, along with the conversion used. Receipts without a
+// currency are taken to be in the base currency already and are returned
+// unchanged. When x is nil, only receipts in DefaultBaseCurrency are
+// accepted, and they are returned unchanged.
+func (x *ExchangeRates) Convert(receipt models.Receipt) (models.Receipt, *models.Conversion, error) {
+	if receipt.Currency == "" {
+		return receipt, nil, nil
+	}
+	if x == nil {
+		if receipt.Currency != DefaultBaseCurrency {
+			return receipt, nil, rperrors.New(rperrors.ErrInvalidCurrency,
+				fmt.Sprintf("no exchange rates from %s to %s are configured", receipt.Currency, DefaultBaseCurrency))
+		}
+		return receipt, nil, nil
+	}
+	rate, err := x.Rate(receipt.Currency)
+	if err != nil {
+		return receipt, nil, err
+	}
+
+	convert := func(p models.Price) models.Price {
+		return x.base.Round(float64(p) * rate)
+	}
+	conversion := &models.Conversion{
+		Currency:     receipt.Currency,
+		Base:         x.Base,
+		Rate:         rate,
+		RatesVersion: x.Version,
+	}
+	items := make([]models.Item, len(receipt.Items))
+	for i, item := range receipt.Items {
+		item.Price = convert(item.Price)
+		item.UnitPrice = convert(item.UnitPrice)
+		item.Discount = convert(item.Discount)
+		items[i] = item
+	}
+	receipt.Items = items
+	receipt.Subtotal = convert(receipt.Subtotal)
+	receipt.Tax = convert(receipt.Tax)
+	receipt.Tip = convert(receipt.Tip)
+	receipt.Discounts = convert(receipt.Discounts)
+	receipt.Total = convert(receipt.Total)
+	receipt.Currency = x.Base
+	return receipt, conversion, nil
+}
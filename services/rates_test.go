@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/services/rules"
+)
+
+func TestLoadExchangeRates(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+
+	rates, err := LoadExchangeRates(write("rates.yaml", "version: 2024-06-01\nbase: USD\nrates:\n  CAD: 0.73\n  JPY: 0.0064\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if rates.Version != "2024-06-01" || rates.Base != "USD" {
+		t.Errorf("Expected version 2024-06-01 based on USD, got %s based on %s", rates.Version, rates.Base)
+	}
+	if rate, err := rates.Rate("CAD"); err != nil || rate != 0.73 {
+		t.Errorf("Expected CAD rate 0.73, got %g (%v)", rate, err)
+	}
+
+	if _, err := LoadExchangeRates(write("rates.json", `{"version": "1", "base": "EUR", "rates": {"GBP": 1.17}}`)); err != nil {
+		t.Errorf("Expected a JSON table to load, got %v", err)
+	}
+
+	invalid := map[string]string{
+		"missing version":  "base: USD\nrates: {CAD: 0.73}\n",
+		"unknown base":     "version: 1\nbase: XYZ\n",
+		"unknown currency": "version: 1\nbase: USD\nrates: {XYZ: 1}\n",
+		"zero rate":        "version: 1\nbase: USD\nrates: {CAD: 0}\n",
+		"unknown field":    "version: 1\nbase: USD\nrate: {CAD: 0.73}\n",
+	}
+	for name, content := range invalid {
+		if _, err := LoadExchangeRates(write("invalid.yaml", content)); err == nil {
+			t.Errorf("Expected error for a table with a %s, got nil", name)
+		}
+	}
+	if _, err := LoadExchangeRates(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("Expected error for a missing file, got nil")
+	}
+}
+
+func TestExchangeRatesConvert(t *testing.T) {
+	rates, err := NewExchangeRates("test", "USD", map[string]float64{"JPY": 0.0064})
+	if err != nil {
+		t.Fatalf("Failed to create exchange rates: %v", err)
+	}
+
+	receipt := models.Receipt{
+		Currency: "JPY",
+		Items:    []models.Item{{ShortDescription: "Gum", Price: 1500, Quantity: 2, UnitPrice: 750}},
+		Tax:      150,
+		Total:    1650,
+	}
+	converted, conversion, err := rates.Convert(receipt)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if converted.Currency != "USD" || converted.Items[0].Price != 9.60 || converted.Items[0].UnitPrice != 4.80 ||
+		converted.Tax != 0.96 || converted.Total != 10.56 {
+		t.Errorf("Expected amounts in USD, got %+v", converted)
+	}
+	if receipt.Items[0].Price != 1500 {
+		t.Errorf("Expected the original receipt to be unchanged, got %+v", receipt.Items[0])
+	}
+	expected := models.Conversion{Currency: "JPY", Base: "USD", Rate: 0.0064, RatesVersion: "test"}
+	if conversion == nil || *conversion != expected {
+		t.Errorf("Expected conversion %+v, got %+v", expected, conversion)
+	}
+
+	// The base currency converts at 1, and receipts without one are unchanged
+	if _, conversion, err := rates.Convert(models.Receipt{Currency: "USD", Total: 1}); err != nil || conversion == nil || conversion.Rate != 1 {
+		t.Errorf("Expected a conversion at rate 1, got %+v (%v)", conversion, err)
+	}
+	if _, conversion, err := rates.Convert(models.Receipt{Total: 1}); err != nil || conversion != nil {
+		t.Errorf("Expected no conversion, got %+v (%v)", conversion, err)
+	}
+
+	_, _, err = rates.Convert(models.Receipt{Currency: "EUR", Total: 1})
+	if !rperrors.IsCode(err, rperrors.ErrInvalidCurrency) {
+		t.Errorf("Expected error code %s, got %v", rperrors.ErrInvalidCurrency, err)
+	}
+
+	// Without a table only the default base currency is accepted
+	var none *ExchangeRates
+	if _, conversion, err := none.Convert(models.Receipt{Currency: "USD", Total: 1}); err != nil || conversion != nil {
+		t.Errorf("Expected no conversion, got %+v (%v)", conversion, err)
+	}
+	_, _, err = none.Convert(models.Receipt{Currency: "EUR", Total: 1})
+	if !rperrors.IsCode(err, rperrors.ErrInvalidCurrency) {
+		t.Errorf("Expected error code %s without rates, got %v", rperrors.ErrInvalidCurrency, err)
+	}
+}
+
+func TestCalculatorExchangeRates(t *testing.T) {
+	rates, err := NewExchangeRates("test", "USD", map[string]float64{"GBP": 2})
+	if err != nil {
+		t.Fatalf("Failed to create exchange rates: %v", err)
+	}
+	calculator := NewCalculator(rules.RuleSet{rules.RoundDollarRule()},
+		slog.New(slog.NewTextHandler(io.Discard, nil)), WithExchangeRates(rates))
+
+	// 12.50 GBP is a round 25.00 USD
+	breakdown, err := calculator.Breakdown(context.Background(), models.Receipt{
+		Retailer: "Target",
+		Currency: "GBP",
+		Items:    []models.Item{{ShortDescription: "Gum", Price: 12.50}},
+		Total:    12.50,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if breakdown.Total != 50 {
+		t.Errorf("Expected 50 points, got %d", breakdown.Total)
+	}
+	if breakdown.Conversion == nil || breakdown.Conversion.Rate != 2 {
+		t.Errorf("Expected the conversion to be recorded, got %+v", breakdown.Conversion)
+	}
+}
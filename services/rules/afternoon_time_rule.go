@@ -3,7 +3,6 @@ package rules
 import (
 	"context"
 	"fmt"
-	"time"
 
 	"github.com/marcelorm/receipt-processor/models"
 )
@@ -22,20 +21,18 @@ func AfternoonTimeRule() PointRule {
 				return ""
 			}
 			return fmt.Sprintf("Rule 7: Added 10 points for purchase time %s being between 14:00 and 16:00",
-				string(r.PurchaseTime))
+				r.PurchaseTime)
 		},
 	}
 }
 
 // calculateAfternoonTimePoints calculates points for afternoon purchase time
 func calculateAfternoonTimePoints(r models.Receipt) int {
-	purchaseTime, err := time.Parse("15:04", string(r.PurchaseTime))
-	if err != nil {
+	if r.PurchaseTime.Validate() != nil {
 		return 0
 	}
 
-	hour, minute := purchaseTime.Hour(), purchaseTime.Minute()
-	timeInMinutes := hour*60 + minute
+	timeInMinutes := r.PurchaseTime.Minutes()
 	startTimeInMinutes, endTimeInMinutes := 14*60, 16*60
 
 	if timeInMinutes <= startTimeInMinutes || timeInMinutes >= endTimeInMinutes {
@@ -0,0 +1,82 @@
+package rules
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config selects the rules applied to receipts. It is loaded from a YAML or
+// JSON rule config file, for example:
+//
+//	disabled:
+//	  - OddDayRule
+//	  - AfternoonTimeRule
+//	countQuantities: true
+type Config struct {
+	Enabled         []string `yaml:"enabled"`         // Rules to apply, in order; empty means all rules
+	Disabled        []string `yaml:"disabled"`        // Rules to leave out
+	CountQuantities bool     `yaml:"countQuantities"` // Count item pairs by the quantity of each item
+}
+
+// LoadConfig reads a rule config file
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("reading rule config: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("parsing rule config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// RuleSet returns the rules selected by the config, in the order given by
+// Enabled or in the default order when Enabled is empty
+func (c Config) RuleSet() (RuleSet, error) {
+	all := GetAllRules()
+	if c.CountQuantities {
+		for i, rule := range all {
+			if rule.Name == "ItemPairsRule" {
+				all[i] = ItemPairsByQuantityRule()
+			}
+		}
+	}
+	byName := make(map[string]PointRule, len(all))
+	for _, rule := range all {
+		byName[rule.Name] = rule
+	}
+
+	for _, name := range append(slices.Clone(c.Enabled), c.Disabled...) {
+		if _, ok := byName[name]; !ok {
+			return nil, fmt.Errorf("unknown rule %q, expected one of %v", name, all.Names())
+		}
+	}
+
+	selected := all
+	if len(c.Enabled) > 0 {
+		selected = make(RuleSet, 0, len(c.Enabled))
+		for _, name := range c.Enabled {
+			selected = append(selected, byName[name])
+		}
+	}
+
+	ruleSet := make(RuleSet, 0, len(selected))
+	for _, rule := range selected {
+		if !slices.Contains(c.Disabled, rule.Name) {
+			ruleSet = append(ruleSet, rule)
+		}
+	}
+	if len(ruleSet) == 0 {
+		return nil, fmt.Errorf("rule config disables every rule")
+	}
+	return ruleSet, nil
+}
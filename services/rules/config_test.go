@@ -0,0 +1,129 @@
+package rules
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/marcelorm/receipt-processor/models"
+)
+
+func TestConfigRuleSet(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		expected []string
+		wantErr  bool
+	}{
+		{"Empty config applies all rules", Config{}, GetAllRules().Names(), false},
+		{
+			"Enabled rules in the given order",
+			Config{Enabled: []string{"OddDayRule", "RetailerNameRule"}},
+			[]string{"OddDayRule", "RetailerNameRule"},
+			false,
+		},
+		{
+			"Disabled rules are left out",
+			Config{Disabled: []string{"OddDayRule", "AfternoonTimeRule"}},
+			[]string{"RetailerNameRule", "RoundDollarRule", "QuarterMultipleRule", "ItemPairsRule", "ItemDescriptionLengthRule"},
+			false,
+		},
+		{
+			"Disabled wins over enabled",
+			Config{Enabled: []string{"OddDayRule", "RetailerNameRule"}, Disabled: []string{"OddDayRule"}},
+			[]string{"RetailerNameRule"},
+			false,
+		},
+		{"Unknown enabled rule", Config{Enabled: []string{"BogusRule"}}, nil, true},
+		{"Unknown disabled rule", Config{Disabled: []string{"BogusRule"}}, nil, true},
+		{"Every rule disabled", Config{Enabled: []string{"OddDayRule"}, Disabled: []string{"OddDayRule"}}, nil, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ruleSet, err := tc.config.RuleSet()
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got rules %v", ruleSet.Names())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !slices.Equal(ruleSet.Names(), tc.expected) {
+				t.Errorf("Expected rules %v, got %v", tc.expected, ruleSet.Names())
+			}
+		})
+	}
+}
+
+func TestConfigCountQuantities(t *testing.T) {
+	receipt := models.Receipt{Items: []models.Item{{ShortDescription: "Milk", Price: 4.50, Quantity: 3, UnitPrice: 1.50}}}
+
+	for _, tc := range []struct {
+		config   Config
+		expected int
+	}{
+		{Config{}, 0},
+		{Config{CountQuantities: true}, 5},
+		{Config{Enabled: []string{"ItemPairsRule"}, CountQuantities: true}, 5},
+	} {
+		ruleSet, err := tc.config.RuleSet()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for _, rule := range ruleSet {
+			if rule.Name != "ItemPairsRule" {
+				continue
+			}
+			if points := rule.Apply(context.Background(), receipt); points != tc.expected {
+				t.Errorf("Expected %d points with %+v, got %d", tc.expected, tc.config, points)
+			}
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "rules.yaml")
+	if err := os.WriteFile(path, []byte("disabled:\n  - OddDayRule\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if !slices.Equal(cfg.Disabled, []string{"OddDayRule"}) {
+		t.Errorf("Expected disabled [OddDayRule], got %v", cfg.Disabled)
+	}
+
+	// JSON is accepted as well
+	path = filepath.Join(dir, "rules.json")
+	if err := os.WriteFile(path, []byte(`{"enabled": ["RetailerNameRule"]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if !slices.Equal(cfg.Enabled, []string{"RetailerNameRule"}) {
+		t.Errorf("Expected enabled [RetailerNameRule], got %v", cfg.Enabled)
+	}
+
+	// Unknown keys are rejected rather than ignored
+	path = filepath.Join(dir, "typo.yaml")
+	if err := os.WriteFile(path, []byte("disable:\n  - OddDayRule\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("Expected error for unknown key, got nil")
+	}
+
+	if _, err := LoadConfig(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("Expected error for missing file, got nil")
+	}
+}
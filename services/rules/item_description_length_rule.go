@@ -33,7 +33,8 @@ func calculateItemDescriptionPoints(r models.Receipt) int {
 	totalPoints := 0
 	for _, item := range r.Items {
 		trimmedDesc := strings.TrimSpace(item.ShortDescription)
-		if len(trimmedDesc) > 0 && len(trimmedDesc)%3 == 0 {
+		// Free and refunded items earn nothing, rather than negative points
+		if item.Price > 0 && len(trimmedDesc) > 0 && len(trimmedDesc)%3 == 0 {
 			price := float64(item.Price)
 			itemPoints := int(math.Ceil(price * 0.2))
 			totalPoints += itemPoints
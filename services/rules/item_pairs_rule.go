@@ -10,15 +10,35 @@ import (
 // ItemPairsRule returns the rule for calculating points based on item pairs
 // Rule 4: 5 points for every two items
 func ItemPairsRule() PointRule {
+	return itemPairsRule("5 points for every two items", func(r models.Receipt) int {
+		return len(r.Items)
+	})
+}
+
+// ItemPairsByQuantityRule returns the item pairs rule counting the units of
+// each item, so "3 x Milk" counts as three items. Items sold by weight
+// count as one.
+func ItemPairsByQuantityRule() PointRule {
+	return itemPairsRule("5 points for every two units sold", func(r models.Receipt) int {
+		units := 0
+		for _, item := range r.Items {
+			units += item.Units()
+		}
+		return units
+	})
+}
+
+// itemPairsRule awards 5 points for every two items counted by count
+func itemPairsRule(description string, count func(models.Receipt) int) PointRule {
 	return PointRule{
 		Name:        "ItemPairsRule",
-		Description: "5 points for every two items",
+		Description: description,
 		Apply: func(ctx context.Context, r models.Receipt) int {
-			return (len(r.Items) / 2) * 5
+			return (count(r) / 2) * 5
 		},
 		FormatLogMessage: func(points int, r models.Receipt) string {
-			return fmt.Sprintf("Rule 4: Added %d points for %d pairs of items (%d items total)", 
-				points, len(r.Items)/2, len(r.Items))
+			return fmt.Sprintf("Rule 4: Added %d points for %d pairs of items (%d items total)",
+				points, count(r)/2, count(r))
 		},
 	}
-}
\ No newline at end of file
+}
@@ -3,7 +3,6 @@ package rules
 import (
 	"context"
 	"fmt"
-	"time"
 
 	"github.com/marcelorm/receipt-processor/models"
 )
@@ -15,8 +14,7 @@ func OddDayRule() PointRule {
 		Name:        "OddDayRule",
 		Description: "6 points if purchase day is odd",
 		Apply: func(ctx context.Context, r models.Receipt) int {
-			purchaseDate, err := time.Parse("2006-01-02", string(r.PurchaseDate))
-			if err != nil || purchaseDate.Day()%2 == 0 {
+			if r.PurchaseDate.Validate() != nil || r.PurchaseDate.Day()%2 == 0 {
 				return 0
 			}
 			return 6
@@ -25,8 +23,7 @@ func OddDayRule() PointRule {
 			if points == 0 {
 				return ""
 			}
-			purchaseDate, _ := time.Parse("2006-01-02", string(r.PurchaseDate))
-			return fmt.Sprintf("Rule 6: Added 6 points for purchase day %d being odd", purchaseDate.Day())
+			return fmt.Sprintf("Rule 6: Added 6 points for purchase day %d being odd", r.PurchaseDate.Day())
 		},
 	}
 }
\ No newline at end of file
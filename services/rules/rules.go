@@ -14,9 +14,21 @@ type PointRule struct {
 	FormatLogMessage func(int, models.Receipt) string         // Function to generate log message
 }
 
+// RuleSet is an ordered list of rules applied to every receipt
+type RuleSet []PointRule
+
+// Names returns the names of the rules in the set, in order
+func (rs RuleSet) Names() []string {
+	names := make([]string, len(rs))
+	for i, rule := range rs {
+		names[i] = rule.Name
+	}
+	return names
+}
+
 // GetAllRules returns all the point calculation rules in order
-func GetAllRules() []PointRule {
-	return []PointRule{
+func GetAllRules() RuleSet {
+	return RuleSet{
 		RetailerNameRule(),
 		RoundDollarRule(),
 		QuarterMultipleRule(),
@@ -119,6 +119,41 @@ func TestItemPairsRule(t *testing.T) {
 	}
 }
 
+func TestItemPairsByQuantityRule(t *testing.T) {
+	ctx := context.Background()
+	rule := ItemPairsByQuantityRule()
+
+	tests := []struct {
+		name       string
+		quantities []float64
+		expected   int
+	}{
+		{"Items without quantities", []float64{0, 0}, 5},
+		{"Three of one item", []float64{3}, 5},
+		{"Quantities add up", []float64{3, 1}, 10},
+		{"Weighed items count once", []float64{1.5, 0.75}, 5},
+		{"Mixed", []float64{2, 0, 2.5}, 10},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var items []models.Item
+			for _, quantity := range tc.quantities {
+				items = append(items, models.Item{ShortDescription: "Item", Price: 1.00, Quantity: quantity})
+			}
+
+			receipt := models.Receipt{Items: items}
+			if points := rule.Apply(ctx, receipt); points != tc.expected {
+				t.Errorf("Expected %d points, got %d", tc.expected, points)
+			}
+			// The default rule counts lines regardless of quantity
+			if points := ItemPairsRule().Apply(ctx, receipt); points != len(items)/2*5 {
+				t.Errorf("Expected %d points counting lines, got %d", len(items)/2*5, points)
+			}
+		})
+	}
+}
+
 func TestItemDescriptionLengthRule(t *testing.T) {
 	ctx := context.Background()
 	rule := ItemDescriptionLengthRule()
@@ -159,6 +194,12 @@ func TestItemDescriptionLengthRule(t *testing.T) {
 			[]float64{5.00, 1.00},
 			1, // ceil(5.00 * 0.2) = 1
 		},
+		{
+			"Negative and free items earn nothing",
+			[]string{"123", "456", "789"},
+			[]float64{-5.00, 0, 5.00},
+			1,
+		},
 	}
 
 	for _, tc := range tests {
@@ -197,7 +238,8 @@ func TestOddDayRule(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			receipt := models.Receipt{PurchaseDate: models.Date(tc.date)}
+			date, _ := models.ParseDate(tc.date)
+			receipt := models.Receipt{PurchaseDate: date}
 			points := rule.Apply(ctx, receipt)
 			if points != tc.expected {
 				t.Errorf("Expected %d points, got %d", tc.expected, points)
@@ -225,7 +267,8 @@ func TestAfternoonTimeRule(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			receipt := models.Receipt{PurchaseTime: models.Time(tc.time)}
+			purchaseTime, _ := models.ParseTime(tc.time)
+			receipt := models.Receipt{PurchaseTime: purchaseTime}
 			points := rule.Apply(ctx, receipt)
 			if points != tc.expected {
 				t.Errorf("Expected %d points, got %d", tc.expected, points)
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"strings"
+
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/models"
+)
+
+// ValidateReceipt validates a receipt and returns an AppError whose code
+// identifies the first problem found, or nil when the receipt is valid
+func ValidateReceipt(receipt models.Receipt) error {
+	err := receipt.Validate()
+	if err == nil {
+		return nil
+	}
+	return rperrors.Wrap(ValidationCode(err), err, err.Error())
+}
+
+// ValidationCode maps an error returned by models.Receipt.Validate to the
+// matching error code
+func ValidationCode(err error) rperrors.ErrorCode {
+	msg := err.Error()
+	switch {
+	case msg == "retailer is required":
+		return rperrors.ErrInvalidRetailer
+	case msg == "at least one item is required":
+		return rperrors.ErrMissingItems
+	case strings.HasPrefix(msg, "invalid date format"):
+		return rperrors.ErrInvalidPurchaseDate
+	case strings.HasPrefix(msg, "invalid time format"):
+		return rperrors.ErrInvalidPurchaseTime
+	case strings.HasPrefix(msg, "invalid time zone"):
+		return rperrors.ErrInvalidTimeZone
+	case strings.HasPrefix(msg, "invalid currency"):
+		return rperrors.ErrInvalidCurrency
+	case strings.HasPrefix(msg, "total "), strings.HasPrefix(msg, "subtotal "), strings.HasPrefix(msg, "tax "),
+		strings.HasPrefix(msg, "tip "), strings.HasPrefix(msg, "discounts "):
+		return rperrors.ErrInvalidTotal
+	case strings.HasPrefix(msg, "item ") && strings.HasSuffix(msg, "short description is required"):
+		return rperrors.ErrInvalidItemDescription
+	case strings.HasPrefix(msg, "item ") && strings.Contains(msg, ": price "):
+		return rperrors.ErrInvalidItemPrice
+	case strings.HasPrefix(msg, "item "):
+		return rperrors.ErrInvalidItemData
+	}
+	return rperrors.ErrInvalidReceiptData
+}
+
+// Rejected reports whether a Breakdown error rejects the receipt itself, as
+// a total that does not reconcile or a currency without an exchange rate
+// does, rather than reporting a failure to score it
+func Rejected(err error) bool {
+	return rperrors.IsCode(err, rperrors.ErrInvalidTotal) || rperrors.IsCode(err, rperrors.ErrInvalidCurrency)
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"testing"
+
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/models"
+)
+
+func TestValidateReceipt(t *testing.T) {
+	valid := func() models.Receipt {
+		return models.Receipt{
+			Retailer:     "Target",
+			PurchaseDate: models.MustParseDate("2022-01-01"),
+			PurchaseTime: models.MustParseTime("13:01"),
+			Items:        []models.Item{{ShortDescription: "Pepsi - 12-oz", Price: 1.25}},
+			Total:        1.25,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(*models.Receipt)
+		expected rperrors.ErrorCode
+	}{
+		{"Valid receipt", func(r *models.Receipt) {}, ""},
+		{"Missing retailer", func(r *models.Receipt) { r.Retailer = "" }, rperrors.ErrInvalidRetailer},
+		{"Invalid date", func(r *models.Receipt) { r.PurchaseDate, _ = models.ParseDate("2022-13-01") }, rperrors.ErrInvalidPurchaseDate},
+		{"Invalid time", func(r *models.Receipt) { r.PurchaseTime, _ = models.ParseTime("25:00") }, rperrors.ErrInvalidPurchaseTime},
+		{"Valid time zone", func(r *models.Receipt) { r.TimeZone = "America/Chicago" }, ""},
+		{"Invalid time zone", func(r *models.Receipt) { r.TimeZone = "Central" }, rperrors.ErrInvalidTimeZone},
+		{"Known currency", func(r *models.Receipt) { r.Currency = "EUR" }, ""},
+		{"Unknown currency", func(r *models.Receipt) { r.Currency = "XYZ" }, rperrors.ErrInvalidCurrency},
+		{"Too many decimals for the currency", func(r *models.Receipt) { r.Currency = "JPY" }, rperrors.ErrInvalidItemPrice},
+		{"No items", func(r *models.Receipt) { r.Items = nil }, rperrors.ErrMissingItems},
+		{"Item without description", func(r *models.Receipt) { r.Items[0].ShortDescription = " " }, rperrors.ErrInvalidItemDescription},
+		{"Item price not matching quantity", func(r *models.Receipt) { r.Items[0].Quantity, r.Items[0].UnitPrice = 2, 1.25 }, rperrors.ErrInvalidItemPrice},
+		{"Invalid item UPC", func(r *models.Receipt) { r.Items[0].UPC = "12345" }, rperrors.ErrInvalidItemData},
+		{"Negative tax", func(r *models.Receipt) { r.Tax = -1 }, rperrors.ErrInvalidTotal},
+		{"Negative item price", func(r *models.Receipt) { r.Items[0].Price = -1.25 }, rperrors.ErrInvalidItemPrice},
+		{"Negative total", func(r *models.Receipt) { r.Total = -1.25 }, rperrors.ErrInvalidTotal},
+		{"Refund", func(r *models.Receipt) { r.RefundOf, r.Items[0].Price, r.Total = "id", -1.25, -1.25 }, ""},
+		{"Negative discounts", func(r *models.Receipt) { r.Discounts = -0.5 }, rperrors.ErrInvalidTotal},
+		{"Taxed refund", func(r *models.Receipt) { r.RefundOf, r.Items[0].Price, r.Tax, r.Total = "id", -1.25, -0.10, -1.35 }, ""},
+		{"Refund with a positive tip", func(r *models.Receipt) { r.RefundOf, r.Items[0].Price, r.Tip, r.Total = "id", -1.25, 1, -0.25 }, rperrors.ErrInvalidTotal},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			receipt := valid()
+			tc.modify(&receipt)
+
+			err := ValidateReceipt(receipt)
+			if tc.expected == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if !rperrors.IsCode(err, tc.expected) {
+				t.Errorf("Expected error code %s, got %v", tc.expected, err)
+			}
+		})
+	}
+}
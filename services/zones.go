@@ -0,0 +1,68 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/marcelorm/receipt-processor/models"
+)
+
+// StoreZones holds the time zone of each store, so rules are evaluated in
+// the local time of the store a receipt comes from
+type StoreZones struct {
+	fallback *time.Location            // Zone of stores not listed, or nil
+	stores   map[string]*time.Location // Zones by normalized retailer name
+}
+
+// NewStoreZones creates store zones from IANA zone names or UTC offsets,
+// keyed by retailer name. The default zone applies to retailers not listed;
+// when it is empty their receipts are scored in their own time zone.
+func NewStoreZones(defaultZone string, stores map[string]string) (*StoreZones, error) {
+	z := &StoreZones{stores: make(map[string]*time.Location, len(stores))}
+	if defaultZone != "" {
+		loc, err := models.LoadZone(defaultZone)
+		if err != nil {
+			return nil, fmt.Errorf("default zone: %w", err)
+		}
+		z.fallback = loc
+	}
+	for retailer, zone := range stores {
+		loc, err := models.LoadZone(zone)
+		if err != nil {
+			return nil, fmt.Errorf("store %q: %w", retailer, err)
+		}
+		z.stores[storeKey(retailer)] = loc
+	}
+	return z, nil
+}
+
+// Location returns the time zone of a retailer's stores
+func (z *StoreZones) Location(retailer string) (*time.Location, bool) {
+	if z == nil {
+		return nil, false
+	}
+	if loc, ok := z.stores[storeKey(retailer)]; ok {
+		return loc, true
+	}
+	return z.fallback, z.fallback != nil
+}
+
+// Local returns the receipt with its purchase date and time in the local
+// time of its store. Receipts without a zone are already in store local
+// time, and receipts from stores without a zone keep their own.
+func (z *StoreZones) Local(receipt models.Receipt) models.Receipt {
+	if receipt.Zone() == "" {
+		return receipt
+	}
+	loc, ok := z.Location(receipt.Retailer)
+	if !ok {
+		return receipt
+	}
+	return receipt.In(loc)
+}
+
+// storeKey normalizes a retailer name, matching names case-insensitively
+func storeKey(retailer string) string {
+	return strings.ToLower(strings.TrimSpace(retailer))
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/services/rules"
+)
+
+func TestNewStoreZones(t *testing.T) {
+	if _, err := NewStoreZones("", map[string]string{"Target": "Central"}); err == nil {
+		t.Error("Expected error for an unknown store zone, got nil")
+	}
+	if _, err := NewStoreZones("Eastern", nil); err == nil {
+		t.Error("Expected error for an unknown default zone, got nil")
+	}
+
+	zones, err := NewStoreZones("America/New_York", map[string]string{" target ": "America/Chicago"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for retailer, expected := range map[string]string{"Target": "America/Chicago", "Walgreens": "America/New_York"} {
+		if loc, ok := zones.Location(retailer); !ok || loc.String() != expected {
+			t.Errorf("Expected zone %s for %s, got %v", expected, retailer, loc)
+		}
+	}
+}
+
+func TestStoreLocalRules(t *testing.T) {
+	zones, err := NewStoreZones("", map[string]string{"Target": "America/Chicago"})
+	if err != nil {
+		t.Fatalf("Failed to create store zones: %v", err)
+	}
+	calculator := NewCalculator(rules.RuleSet{rules.OddDayRule(), rules.AfternoonTimeRule()},
+		slog.New(slog.NewTextHandler(io.Discard, nil)), WithStoreZones(zones))
+
+	tests := []struct {
+		name     string
+		retailer string
+		date     string
+		time     string
+		zone     string
+		expected int
+	}{
+		{"Store local time without a zone", "Target", "2024-07-16", "15:00", "", 10},
+		{"UTC in daylight saving time", "Target", "2024-07-16", "20:00", "UTC", 10},
+		{"UTC in standard time", "Target", "2024-01-16", "21:30", "UTC", 10},
+		{"UTC after the afternoon window", "Target", "2024-07-16", "21:30", "UTC", 0},
+		{"UTC on the previous odd day", "Target", "2024-03-10", "03:00", "UTC", 6},
+		{"Offset", "Target", "2024-07-16", "16:00", "-07:00", 0},
+		{"Store without a zone", "Walgreens", "2024-07-16", "15:00", "UTC", 10},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			receipt := models.Receipt{
+				Retailer:     tc.retailer,
+				PurchaseDate: models.MustParseDate(tc.date),
+				PurchaseTime: models.MustParseTime(tc.time),
+				TimeZone:     tc.zone,
+			}
+			points, err := calculator.Points(context.Background(), receipt)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if points != tc.expected {
+				t.Errorf("Expected %d points, got %d", tc.expected, points)
+			}
+		})
+	}
+}
+
+func TestStoreLocalRulesTimestamps(t *testing.T) {
+	// A partner sending RFC 3339 timestamps in UTC
+	previous := models.CurrentFormats()
+	if err := models.SetFormats(models.Formats{DateLayouts: []string{"RFC3339"}, TimeLayouts: []string{"RFC3339"}}); err != nil {
+		t.Fatalf("Failed to set formats: %v", err)
+	}
+	t.Cleanup(func() { models.SetFormats(previous) })
+
+	zones, err := NewStoreZones("", map[string]string{"Target": "America/Chicago"})
+	if err != nil {
+		t.Fatalf("Failed to create store zones: %v", err)
+	}
+	calculator := NewCalculator(rules.RuleSet{rules.AfternoonTimeRule()},
+		slog.New(slog.NewTextHandler(io.Discard, nil)), WithStoreZones(zones))
+
+	tests := []struct {
+		name      string
+		timestamp string
+		expected  int
+	}{
+		{"In the afternoon window in Chicago", "2024-07-16T20:30:00Z", 10},
+		{"Afternoon in UTC but morning in Chicago", "2024-07-16T15:00:00Z", 0},
+		{"Offset of the store", "2024-07-16T15:30:00-05:00", 10},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			receipt := models.Receipt{
+				Retailer:     "Target",
+				PurchaseDate: models.MustParseDate(tc.timestamp),
+				PurchaseTime: models.MustParseTime(tc.timestamp),
+			}
+			points, err := calculator.Points(context.Background(), receipt)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if points != tc.expected {
+				t.Errorf("Expected %d points, got %d", tc.expected, points)
+			}
+		})
+	}
+}
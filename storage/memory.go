@@ -3,69 +3,491 @@ package storage
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/events"
+	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/requestid"
 )
 
-// ReceiptStorage defines the interface for storing and retrieving receipt points
+// ReceiptStorage defines the interface for storing and retrieving scored receipts
 type ReceiptStorage interface {
-	// SaveReceipt saves the points for a receipt and returns the generated ID
-	SaveReceipt(ctx context.Context, points int) (string, error)
+	// SaveReceipt saves a scored receipt and returns the generated ID.
+	// Refunds are checked against their original receipt, whose points are
+	// clawed back in proportion to the amount refunded. Receipts linked to a
+	// loyalty account post their points to the account ledger along with
+	// being stored.
+	SaveReceipt(ctx context.Context, receipt models.Receipt, breakdown models.PointsBreakdown) (string, error)
 
-	// GetPoints retrieves the points for a receipt by ID
+	// GetPoints retrieves the points held by a receipt by ID, after clawbacks
 	GetPoints(ctx context.Context, id string) (int, error)
 
+	// Ledger returns the points ledger entries of a receipt by ID, oldest first
+	Ledger(ctx context.Context, id string) ([]models.LedgerEntry, error)
+
+	// GetReceipt retrieves a stored receipt by ID
+	GetReceipt(ctx context.Context, id string) (Record, error)
+
+	// ListReceipts returns the stored receipts matching filter, oldest first
+	ListReceipts(ctx context.Context, filter Filter) ([]Record, error)
+
 	// Count returns the number of receipts in the store (for testing)
 	Count(ctx context.Context) (int, error)
+
+	// CreateAccount opens a loyalty account and returns it with its generated ID
+	CreateAccount(ctx context.Context, name string) (models.Account, error)
+
+	// GetAccount retrieves a loyalty account, along with its balance, by ID
+	GetAccount(ctx context.Context, id string) (models.Account, error)
+
+	// PostEntry posts an adjustment, redemption or expiry to a loyalty account
+	PostEntry(ctx context.Context, accountID string, entry models.EntryRequest) (models.Posting, error)
+
+	// AccountHistory returns the ledger postings of a loyalty account by ID,
+	// oldest first
+	AccountHistory(ctx context.Context, id string) ([]models.Posting, error)
+}
+
+// Rejected reports whether a SaveReceipt error rejects the receipt itself, as
+// a refund that does not match its original or an unknown account does,
+// rather than reporting a failure to store it
+func Rejected(err error) bool {
+	return rperrors.IsCode(err, rperrors.ErrInvalidRefund) || rperrors.IsCode(err, rperrors.ErrInvalidAccount)
 }
 
-// MemoryStore provides thread-safe in-memory storage for receipt points
+// Record is a stored receipt along with the points it was awarded
+type Record struct {
+	ID          string
+	Receipt     models.Receipt
+	Breakdown   models.PointsBreakdown
+	Points      int          // Points held: those awarded less those clawed back by refunds
+	Refunded    models.Price // Amount refunded by later refunds
+	ProcessedAt time.Time
+}
+
+// Filter selects the receipts returned by ListReceipts
+type Filter struct {
+	Retailer string // Case-insensitive retailer name; empty matches every retailer
+	Offset   int    // Number of matching receipts to skip
+	Limit    int    // Maximum number of receipts to return; 0 means no limit
+}
+
+// Matches reports whether record is selected by the filter, ignoring Offset and Limit
+func (f Filter) Matches(record Record) bool {
+	return f.Retailer == "" || strings.EqualFold(strings.TrimSpace(record.Receipt.Retailer), strings.TrimSpace(f.Retailer))
+}
+
+// MemoryStore provides thread-safe in-memory storage for scored receipts
 type MemoryStore struct {
-	points map[string]int
-	mutex  sync.RWMutex
+	records  map[string]Record
+	order    []string                        // IDs in the order they were saved
+	ledger   map[string][]models.LedgerEntry // Points ledger entries by receipt ID
+	accounts map[string]models.Account       // Loyalty accounts by ID
+	postings map[string][]models.Posting     // Account ledger postings by loyalty account ID
+	outbox   []events.Envelope               // Unacknowledged domain events, oldest first
+	parked   []events.Envelope               // Events parked after failing delivery, in the order they were parked
+	mutex    sync.RWMutex
 }
 
-// Verify MemoryStore implements ReceiptStorage interface
-var _ ReceiptStorage = (*MemoryStore)(nil)
+// Verify MemoryStore implements ReceiptStorage and events.Outbox interfaces
+var (
+	_ ReceiptStorage = (*MemoryStore)(nil)
+	_ events.Outbox  = (*MemoryStore)(nil)
+)
 
-// NewMemoryStorage creates a new in-memory receipt store
+// NewMemoryStorage creates a new in-memory receipt store, holding the system
+// accounts of the points ledger
 func NewMemoryStorage() *MemoryStore {
-	return &MemoryStore{
-		points: make(map[string]int),
+	s := &MemoryStore{
+		records:  make(map[string]Record),
+		ledger:   make(map[string][]models.LedgerEntry),
+		accounts: make(map[string]models.Account),
+		postings: make(map[string][]models.Posting),
 	}
+	now := time.Now().UTC()
+	for _, id := range models.SystemAccounts {
+		s.accounts[id] = models.Account{ID: id, CreatedAt: now}
+	}
+	return s
 }
 
-// SaveReceipt saves the points for a receipt and returns the generated ID
-func (s *MemoryStore) SaveReceipt(ctx context.Context, points int) (string, error) {
+// SaveReceipt saves a scored receipt and returns the generated ID. A
+// receipt.processed event is recorded in the outbox along with the receipt,
+// so either both are stored or neither is. Receipts earn their points in the
+// points ledger, and in the ledger of their loyalty account, and refunds claw
+// points back from their original receipt.
+func (s *MemoryStore) SaveReceipt(ctx context.Context, receipt models.Receipt, breakdown models.PointsBreakdown) (string, error) {
 	if ctx.Err() != nil {
 		return "", rperrors.Wrap(rperrors.ErrContextCancelled, ctx.Err(), "context canceled before saving receipt")
 	}
 
+	record := Record{
+		ID:          uuid.New().String(),
+		Receipt:     receipt,
+		Breakdown:   breakdown,
+		Points:      breakdown.Total,
+		ProcessedAt: time.Now().UTC(),
+	}
+	envelope, err := events.NewEnvelope(events.ReceiptProcessed{
+		ReceiptID:   record.ID,
+		Retailer:    receipt.Retailer,
+		Tenant:      receipt.Tenant,
+		Points:      breakdown.Total,
+		Rules:       breakdown.Rules,
+		ProcessedAt: record.ProcessedAt,
+	})
+	if err != nil {
+		return "", rperrors.Wrap(rperrors.ErrStorageFailure, err, "failed to record receipt event")
+	}
+	envelope.RequestID = requestid.FromContext(ctx)
+
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	id := uuid.New().String()
-	s.points[id] = points
-	return id, nil
+	if _, exists := s.accounts[receipt.AccountID]; receipt.AccountID != "" && (!exists || models.IsSystemAccount(receipt.AccountID)) {
+		return "", rperrors.New(rperrors.ErrInvalidAccount,
+			fmt.Sprintf("loyalty account %s not found", receipt.AccountID))
+	}
+	if receipt.IsRefund() {
+		if err := s.settleRefund(record); err != nil {
+			return "", err
+		}
+	} else {
+		if receipt.AccountID != "" && record.Points > 0 {
+			if _, err := s.post(models.Posting{
+				Kind:      models.LedgerEarn,
+				Debit:     models.AccountIssued,
+				Credit:    receipt.AccountID,
+				Points:    record.Points,
+				ReceiptID: record.ID,
+				At:        record.ProcessedAt,
+			}); err != nil {
+				return "", err
+			}
+		}
+		s.ledger[record.ID] = append(s.ledger[record.ID], models.LedgerEntry{
+			ReceiptID: record.ID,
+			Kind:      models.LedgerEarn,
+			Points:    record.Points,
+			At:        record.ProcessedAt,
+		})
+	}
+	s.records[record.ID] = record
+	s.order = append(s.order, record.ID)
+	s.outbox = append(s.outbox, envelope)
+	return record.ID, nil
+}
+
+// settleRefund checks that a refund is in the currency of its original
+// receipt and does not take its refunds past the original total, then claws
+// back the original's points in proportion to the amount refunded. The caller
+// must hold the write lock.
+func (s *MemoryStore) settleRefund(refund Record) error {
+	original, exists := s.records[refund.Receipt.RefundOf]
+	if !exists {
+		return rperrors.New(rperrors.ErrInvalidRefund,
+			fmt.Sprintf("original receipt %s not found", refund.Receipt.RefundOf))
+	}
+	if original.Receipt.IsRefund() {
+		return rperrors.New(rperrors.ErrInvalidRefund,
+			fmt.Sprintf("receipt %s is a refund and cannot be refunded", original.ID))
+	}
+	if refund.Receipt.AccountID != "" && refund.Receipt.AccountID != original.Receipt.AccountID {
+		return rperrors.New(rperrors.ErrInvalidRefund,
+			fmt.Sprintf("refund account %s does not match the account of receipt %s", refund.Receipt.AccountID, original.ID))
+	}
+	if refund.Receipt.Currency != original.Receipt.Currency {
+		return rperrors.New(rperrors.ErrInvalidRefund,
+			fmt.Sprintf("refund currency %q does not match the original currency %q", refund.Receipt.Currency, original.Receipt.Currency))
+	}
+	refunded := original.Refunded - refund.Receipt.Total
+	if refunded.Cents() > original.Receipt.Total.Cents() {
+		return rperrors.New(rperrors.ErrInvalidRefund,
+			fmt.Sprintf("refunds of %.2f would exceed the original total %.2f", float64(refunded), float64(original.Receipt.Total)))
+	}
+
+	// Clawbacks so far are deducted, so rounding never takes back more than
+	// the points awarded
+	clawedBack := original.Breakdown.Total - original.Points
+	clawback := models.ClawbackPoints(original.Breakdown.Total, original.Receipt.Total, refunded) - clawedBack
+
+	// Clawbacks may take an account below zero when the points were spent
+	if account := original.Receipt.AccountID; account != "" && clawback > 0 {
+		if _, err := s.post(models.Posting{
+			Kind:      models.LedgerClawback,
+			Debit:     account,
+			Credit:    models.AccountIssued,
+			Points:    clawback,
+			ReceiptID: original.ID,
+			Note:      "refund " + refund.ID,
+			At:        refund.ProcessedAt,
+		}); err != nil {
+			return err
+		}
+	}
+
+	original.Refunded = refunded
+	original.Points -= clawback
+	s.records[original.ID] = original
+	s.ledger[original.ID] = append(s.ledger[original.ID], models.LedgerEntry{
+		ReceiptID: original.ID,
+		Kind:      models.LedgerClawback,
+		Points:    -clawback,
+		RefundID:  refund.ID,
+		At:        refund.ProcessedAt,
+	})
+	return nil
+}
+
+// post records a posting in the ledgers of both accounts it moves points
+// between, updating their balances. Nothing is recorded when either account
+// is unknown. The caller must hold the write lock.
+func (s *MemoryStore) post(posting models.Posting) (models.Posting, error) {
+	for _, id := range []string{posting.Debit, posting.Credit} {
+		if _, exists := s.accounts[id]; !exists {
+			return models.Posting{}, rperrors.New(rperrors.ErrStorageFailure,
+				fmt.Sprintf("cannot post %s points to unknown account %s", posting.Kind, id))
+		}
+	}
+
+	posting.ID = uuid.New().String()
+	for _, id := range []string{posting.Debit, posting.Credit} {
+		account := s.accounts[id]
+		account.Balance += posting.Amount(id)
+		s.accounts[id] = account
+		s.postings[id] = append(s.postings[id], posting)
+	}
+	return posting, nil
+}
+
+// CreateAccount opens a loyalty account and returns it with its generated ID
+func (s *MemoryStore) CreateAccount(ctx context.Context, name string) (models.Account, error) {
+	if ctx.Err() != nil {
+		return models.Account{}, rperrors.Wrap(rperrors.ErrContextCancelled, ctx.Err(), "context canceled before creating account")
+	}
+
+	account := models.Account{
+		ID:        uuid.New().String(),
+		Name:      strings.TrimSpace(name),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.accounts[account.ID] = account
+	return account, nil
+}
+
+// GetAccount retrieves a loyalty account, along with its balance, by ID
+func (s *MemoryStore) GetAccount(ctx context.Context, id string) (models.Account, error) {
+	if ctx.Err() != nil {
+		return models.Account{}, rperrors.Wrap(rperrors.ErrContextCancelled, ctx.Err(), "context canceled before reading account")
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	account, exists := s.accounts[id]
+	if !exists {
+		return models.Account{}, rperrors.New(rperrors.ErrAccountNotFound, fmt.Sprintf("loyalty account with ID %s not found", id))
+	}
+	return account, nil
+}
+
+// PostEntry posts an adjustment, redemption or expiry to a loyalty account.
+// A receipt named by the entry must belong to the account, and entries taking
+// points from the account may not take more than its balance.
+func (s *MemoryStore) PostEntry(ctx context.Context, accountID string, entry models.EntryRequest) (models.Posting, error) {
+	if ctx.Err() != nil {
+		return models.Posting{}, rperrors.Wrap(rperrors.ErrContextCancelled, ctx.Err(), "context canceled before posting entry")
+	}
+	if err := entry.Validate(); err != nil {
+		return models.Posting{}, rperrors.Wrap(rperrors.ErrInvalidLedgerEntry, err, err.Error())
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	account, exists := s.accounts[accountID]
+	if !exists {
+		return models.Posting{}, rperrors.New(rperrors.ErrAccountNotFound, fmt.Sprintf("loyalty account with ID %s not found", accountID))
+	}
+	if models.IsSystemAccount(accountID) {
+		return models.Posting{}, rperrors.New(rperrors.ErrInvalidLedgerEntry,
+			fmt.Sprintf("entries cannot be posted to system account %s", accountID))
+	}
+	if entry.ReceiptID != "" {
+		if record, exists := s.records[entry.ReceiptID]; !exists || record.Receipt.AccountID != accountID {
+			return models.Posting{}, rperrors.New(rperrors.ErrInvalidLedgerEntry,
+				fmt.Sprintf("receipt %s does not belong to account %s", entry.ReceiptID, accountID))
+		}
+	}
+	posting := entry.Posting(accountID)
+	posting.At = time.Now().UTC()
+	if amount := posting.Amount(accountID); amount < 0 && account.Balance+amount < 0 {
+		return models.Posting{}, rperrors.New(rperrors.ErrInvalidLedgerEntry,
+			fmt.Sprintf("cannot take %d points from a balance of %d", -amount, account.Balance))
+	}
+	return s.post(posting)
+}
+
+// AccountHistory returns the ledger postings of a loyalty account by ID,
+// oldest first
+func (s *MemoryStore) AccountHistory(ctx context.Context, id string) ([]models.Posting, error) {
+	if ctx.Err() != nil {
+		return nil, rperrors.Wrap(rperrors.ErrContextCancelled, ctx.Err(), "context canceled before reading account history")
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if _, exists := s.accounts[id]; !exists {
+		return nil, rperrors.New(rperrors.ErrAccountNotFound, fmt.Sprintf("loyalty account with ID %s not found", id))
+	}
+	return append([]models.Posting{}, s.postings[id]...), nil
 }
 
-// GetPoints retrieves the points for a receipt by ID
+// GetPoints retrieves the points held by a receipt by ID, after clawbacks
 func (s *MemoryStore) GetPoints(ctx context.Context, id string) (int, error) {
+	record, err := s.GetReceipt(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	return record.Points, nil
+}
+
+// Ledger returns the points ledger entries of a receipt by ID, oldest first.
+// Refunds have no entries of their own; their clawbacks are entries of the
+// original receipt.
+func (s *MemoryStore) Ledger(ctx context.Context, id string) ([]models.LedgerEntry, error) {
 	if ctx.Err() != nil {
-		return 0, rperrors.Wrap(rperrors.ErrContextCancelled, ctx.Err(), "context canceled before retrieving points")
+		return nil, rperrors.Wrap(rperrors.ErrContextCancelled, ctx.Err(), "context canceled before reading ledger")
 	}
 
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	points, exists := s.points[id]
+	if _, exists := s.records[id]; !exists {
+		return nil, rperrors.New(rperrors.ErrReceiptNotFound, fmt.Sprintf("receipt with ID %s not found", id))
+	}
+	return append([]models.LedgerEntry{}, s.ledger[id]...), nil
+}
+
+// GetReceipt retrieves a stored receipt by ID
+func (s *MemoryStore) GetReceipt(ctx context.Context, id string) (Record, error) {
+	if ctx.Err() != nil {
+		return Record{}, rperrors.Wrap(rperrors.ErrContextCancelled, ctx.Err(), "context canceled before retrieving receipt")
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	record, exists := s.records[id]
 	if !exists {
-		return 0, rperrors.New(rperrors.ErrReceiptNotFound, fmt.Sprintf("receipt with ID %s not found", id))
+		return Record{}, rperrors.New(rperrors.ErrReceiptNotFound, fmt.Sprintf("receipt with ID %s not found", id))
 	}
-	return points, nil
+	return record, nil
+}
+
+// ListReceipts returns the stored receipts matching filter, oldest first
+func (s *MemoryStore) ListReceipts(ctx context.Context, filter Filter) ([]Record, error) {
+	if ctx.Err() != nil {
+		return nil, rperrors.Wrap(rperrors.ErrContextCancelled, ctx.Err(), "context canceled before listing receipts")
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var records []Record
+	skipped := 0
+	for _, id := range s.order {
+		record := s.records[id]
+		if !filter.Matches(record) {
+			continue
+		}
+		if skipped < filter.Offset {
+			skipped++
+			continue
+		}
+		records = append(records, record)
+		if filter.Limit > 0 && len(records) == filter.Limit {
+			break
+		}
+	}
+	return records, nil
+}
+
+// PendingEvents returns up to limit unacknowledged events, oldest first
+func (s *MemoryStore) PendingEvents(ctx context.Context, limit int) ([]events.Envelope, error) {
+	if ctx.Err() != nil {
+		return nil, rperrors.Wrap(rperrors.ErrContextCancelled, ctx.Err(), "context canceled before reading events")
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	n := len(s.outbox)
+	if limit > 0 {
+		n = min(n, limit)
+	}
+	return append([]events.Envelope(nil), s.outbox[:n]...), nil
+}
+
+// AckEvent removes a delivered event from the outbox. Acknowledging an
+// unknown event is not an error, so redelivered events can be acknowledged
+// again.
+func (s *MemoryStore) AckEvent(ctx context.Context, id string) error {
+	if ctx.Err() != nil {
+		return rperrors.Wrap(rperrors.ErrContextCancelled, ctx.Err(), "context canceled before acknowledging event")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, envelope := range s.outbox {
+		if envelope.ID == id {
+			s.outbox = append(s.outbox[:i], s.outbox[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// ParkEvent moves an event out of the pending events after it failed
+// delivery too many times. Parking an unknown event is not an error.
+func (s *MemoryStore) ParkEvent(ctx context.Context, id string) error {
+	if ctx.Err() != nil {
+		return rperrors.Wrap(rperrors.ErrContextCancelled, ctx.Err(), "context canceled before parking event")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, envelope := range s.outbox {
+		if envelope.ID == id {
+			s.outbox = append(s.outbox[:i], s.outbox[i+1:]...)
+			s.parked = append(s.parked, envelope)
+			break
+		}
+	}
+	return nil
+}
+
+// ParkedEvents returns the parked events in the order they were parked
+func (s *MemoryStore) ParkedEvents(ctx context.Context) ([]events.Envelope, error) {
+	if ctx.Err() != nil {
+		return nil, rperrors.Wrap(rperrors.ErrContextCancelled, ctx.Err(), "context canceled before reading parked events")
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return append([]events.Envelope(nil), s.parked...), nil
 }
 
 // Count returns the number of receipts in the store (for testing)
@@ -86,7 +508,7 @@ func (s *MemoryStore) Count(ctx context.Context) (int, error) {
 		s.mutex.RLock()
 		defer s.mutex.RUnlock()
 
-		ch <- result{count: len(s.points)}
+		ch <- result{count: len(s.records)}
 	}()
 
 	// Wait for either the operation to complete or the context to timeout
@@ -4,13 +4,18 @@ import (
 	"context"
 	"sync"
 	"testing"
+
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+	"github.com/marcelorm/receipt-processor/events"
+	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/requestid"
 )
 
 func TestSaveReceipt(t *testing.T) {
 	store := NewMemoryStorage()
 	ctx := context.Background()
 	
-	id, err := store.SaveReceipt(ctx, 100)
+	id, err := store.SaveReceipt(ctx, models.Receipt{}, models.PointsBreakdown{Total: 100})
 	if err != nil {
 		t.Fatalf("Failed to save receipt: %v", err)
 	}
@@ -40,7 +45,7 @@ func TestGetPoints(t *testing.T) {
 	}
 	
 	// Test retrieving valid ID
-	id, err := store.SaveReceipt(ctx, 50)
+	id, err := store.SaveReceipt(ctx, models.Receipt{}, models.PointsBreakdown{Total: 50})
 	if err != nil {
 		t.Fatalf("Failed to save receipt: %v", err)
 	}
@@ -71,7 +76,7 @@ func TestConcurrentAccess(t *testing.T) {
 	for i := 0; i < count; i++ {
 		go func(i int) {
 			defer wg.Done()
-			id, err := store.SaveReceipt(ctx, i)
+			id, err := store.SaveReceipt(ctx, models.Receipt{}, models.PointsBreakdown{Total: i})
 			if err != nil {
 				errChan <- err
 				return
@@ -113,7 +118,7 @@ func TestContextCancellation(t *testing.T) {
 	cancel()
 	
 	// Test saving with canceled context
-	_, err := store.SaveReceipt(ctx, 100)
+	_, err := store.SaveReceipt(ctx, models.Receipt{}, models.PointsBreakdown{Total: 100})
 	if err == nil {
 		t.Error("Expected error when saving with canceled context, got nil")
 	}
@@ -139,7 +144,396 @@ func TestNewMemoryStorage(t *testing.T) {
 		return // Avoid nil pointer dereference
 	}
 	
-	if store.points == nil {
-		t.Error("Expected points map to be initialized")
+	if store.records == nil {
+		t.Error("Expected records map to be initialized")
+	}
+}
+
+func TestGetReceipt(t *testing.T) {
+	store := NewMemoryStorage()
+	ctx := context.Background()
+
+	receipt := models.Receipt{Retailer: "Target", PurchaseDate: models.MustParseDate("2022-01-01")}
+	breakdown := models.PointsBreakdown{Total: 28, Rules: []models.RuleResult{{Rule: "RetailerNameRule", Points: 6}}}
+	id, err := store.SaveReceipt(ctx, receipt, breakdown)
+	if err != nil {
+		t.Fatalf("Failed to save receipt: %v", err)
+	}
+
+	record, err := store.GetReceipt(ctx, id)
+	if err != nil {
+		t.Fatalf("Failed to retrieve receipt: %v", err)
+	}
+	if record.ID != id || record.Receipt.Retailer != "Target" || record.Breakdown.Total != 28 {
+		t.Errorf("Expected the saved receipt, got %+v", record)
+	}
+	if record.ProcessedAt.IsZero() {
+		t.Error("Expected ProcessedAt to be set")
+	}
+
+	if _, err := store.GetReceipt(ctx, "non-existent-id"); err == nil {
+		t.Error("Expected error for non-existent ID, got nil")
+	}
+}
+
+func TestListReceipts(t *testing.T) {
+	store := NewMemoryStorage()
+	ctx := context.Background()
+
+	retailers := []string{"Target", "Walmart", "target", "M&M Corner Market", "TARGET"}
+	for i, retailer := range retailers {
+		if _, err := store.SaveReceipt(ctx, models.Receipt{Retailer: retailer}, models.PointsBreakdown{Total: i}); err != nil {
+			t.Fatalf("Failed to save receipt: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		expected []int // Points of the expected records, in order
+	}{
+		{"All receipts", Filter{}, []int{0, 1, 2, 3, 4}},
+		{"Retailer is case-insensitive", Filter{Retailer: "Target"}, []int{0, 2, 4}},
+		{"Offset and limit", Filter{Offset: 1, Limit: 2}, []int{1, 2}},
+		{"Filtered page", Filter{Retailer: "target", Offset: 1, Limit: 1}, []int{2}},
+		{"Offset past the end", Filter{Offset: 10}, nil},
+		{"Unknown retailer", Filter{Retailer: "Costco"}, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			records, err := store.ListReceipts(ctx, tc.filter)
+			if err != nil {
+				t.Fatalf("Failed to list receipts: %v", err)
+			}
+			if len(records) != len(tc.expected) {
+				t.Fatalf("Expected %d records, got %d", len(tc.expected), len(records))
+			}
+			for i, record := range records {
+				if record.Breakdown.Total != tc.expected[i] {
+					t.Errorf("Expected record %d to have %d points, got %d", i, tc.expected[i], record.Breakdown.Total)
+				}
+			}
+		})
+	}
+}
+func TestOutbox(t *testing.T) {
+	store := NewMemoryStorage()
+	ctx := requestid.NewContext(context.Background(), "req-1")
+
+	var ids []string
+	for _, retailer := range []string{"Target", "Walmart", "Costco"} {
+		id, err := store.SaveReceipt(ctx, models.Receipt{Retailer: retailer}, models.PointsBreakdown{Total: 6})
+		if err != nil {
+			t.Fatalf("Failed to save receipt: %v", err)
+		}
+		ids = append(ids, id)
 	}
-}
\ No newline at end of file
+
+	// Every saved receipt records a receipt.processed event, in order
+	pending, err := store.PendingEvents(ctx, 0)
+	if err != nil {
+		t.Fatalf("Failed to read events: %v", err)
+	}
+	if len(pending) != len(ids) {
+		t.Fatalf("Expected %d events, got %d", len(ids), len(pending))
+	}
+	for i, envelope := range pending {
+		if envelope.Type != events.TypeReceiptProcessed || envelope.AggregateID != ids[i] || envelope.RequestID != "req-1" {
+			t.Errorf("Expected a receipt.processed event for %s from request req-1, got %+v", ids[i], envelope)
+		}
+	}
+	event, err := pending[0].Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode event: %v", err)
+	}
+	if processed := event.(events.ReceiptProcessed); processed.Retailer != "Target" || processed.Points != 6 {
+		t.Errorf("Unexpected event %+v", processed)
+	}
+
+	if limited, _ := store.PendingEvents(ctx, 2); len(limited) != 2 {
+		t.Errorf("Expected 2 events with a limit, got %d", len(limited))
+	}
+
+	// Acknowledged events are removed; acknowledging again is harmless
+	for _, envelope := range pending[:2] {
+		if err := store.AckEvent(ctx, envelope.ID); err != nil {
+			t.Fatalf("Failed to acknowledge event: %v", err)
+		}
+	}
+	if err := store.AckEvent(ctx, pending[0].ID); err != nil {
+		t.Errorf("Expected acknowledging twice to succeed, got %v", err)
+	}
+	remaining, _ := store.PendingEvents(ctx, 0)
+	if len(remaining) != 1 || remaining[0].ID != pending[2].ID {
+		t.Errorf("Expected only the last event to remain, got %+v", remaining)
+	}
+
+	// Parked events leave the pending events but are kept
+	if err := store.ParkEvent(ctx, pending[2].ID); err != nil {
+		t.Fatalf("Failed to park event: %v", err)
+	}
+	if remaining, _ := store.PendingEvents(ctx, 0); len(remaining) != 0 {
+		t.Errorf("Expected no pending events, got %+v", remaining)
+	}
+	parked, err := store.ParkedEvents(ctx)
+	if err != nil {
+		t.Fatalf("Failed to read parked events: %v", err)
+	}
+	if len(parked) != 1 || parked[0].ID != pending[2].ID {
+		t.Errorf("Expected the last event to be parked, got %+v", parked)
+	}
+}
+
+func TestRefunds(t *testing.T) {
+	store := NewMemoryStorage()
+	ctx := context.Background()
+
+	original, err := store.SaveReceipt(ctx, models.Receipt{Retailer: "Target", Total: 40.00}, models.PointsBreakdown{Total: 101})
+	if err != nil {
+		t.Fatalf("Failed to save receipt: %v", err)
+	}
+	refund := func(total models.Price) (string, error) {
+		return store.SaveReceipt(ctx, models.Receipt{Retailer: "Target", RefundOf: original, Total: total}, models.PointsBreakdown{})
+	}
+
+	// Each partial refund claws back its share, rounded, of the points
+	tests := []struct {
+		total    models.Price
+		expected int // Points held by the original afterwards
+	}{
+		{-10.00, 76},
+		{-10.00, 50},
+		{-20.00, 0},
+	}
+	var refunds []string
+	for _, tc := range tests {
+		id, err := refund(tc.total)
+		if err != nil {
+			t.Fatalf("Failed to refund %.2f: %v", float64(tc.total), err)
+		}
+		refunds = append(refunds, id)
+		points, err := store.GetPoints(ctx, original)
+		if err != nil {
+			t.Fatalf("Failed to retrieve points: %v", err)
+		}
+		if points != tc.expected {
+			t.Errorf("Expected %d points after refunding %.2f, got %d", tc.expected, float64(tc.total), points)
+		}
+	}
+
+	entries, err := store.Ledger(ctx, original)
+	if err != nil {
+		t.Fatalf("Failed to read ledger: %v", err)
+	}
+	expected := []models.LedgerEntry{
+		{ReceiptID: original, Kind: models.LedgerEarn, Points: 101},
+		{ReceiptID: original, Kind: models.LedgerClawback, Points: -25, RefundID: refunds[0]},
+		{ReceiptID: original, Kind: models.LedgerClawback, Points: -26, RefundID: refunds[1]},
+		{ReceiptID: original, Kind: models.LedgerClawback, Points: -50, RefundID: refunds[2]},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d ledger entries, got %+v", len(expected), entries)
+	}
+	for i, entry := range entries {
+		entry.At = expected[i].At
+		if entry != expected[i] {
+			t.Errorf("Expected ledger entry %+v, got %+v", expected[i], entry)
+		}
+	}
+
+	// Nothing is left to refund, refunds cannot themselves be refunded, and
+	// refunds are in the currency of their original
+	for name, receipt := range map[string]models.Receipt{
+		"Exceeding the original": {RefundOf: original, Total: -0.01},
+		"Unknown original":       {RefundOf: "non-existent-id", Total: -1.00},
+		"Refunding a refund":     {RefundOf: refunds[0], Total: -1.00},
+		"In another currency":    {RefundOf: original, Total: -0.01, Currency: "EUR"},
+	} {
+		if _, err := store.SaveReceipt(ctx, receipt, models.PointsBreakdown{}); !rperrors.IsCode(err, rperrors.ErrInvalidRefund) {
+			t.Errorf("%s: expected error code %s, got %v", name, rperrors.ErrInvalidRefund, err)
+		}
+	}
+	if count, _ := store.Count(ctx); count != 4 {
+		t.Errorf("Expected rejected refunds not to be stored, got %d receipts", count)
+	}
+}
+
+func TestAccounts(t *testing.T) {
+	store := NewMemoryStorage()
+	ctx := context.Background()
+
+	account, err := store.CreateAccount(ctx, " Jane ")
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	if account.ID == "" || account.Name != "Jane" || account.Balance != 0 {
+		t.Errorf("Expected a new empty account named Jane, got %+v", account)
+	}
+
+	// Receipts for unknown accounts are rejected without being stored
+	_, err = store.SaveReceipt(ctx, models.Receipt{Retailer: "Target", AccountID: "non-existent-id", Total: 1.00}, models.PointsBreakdown{Total: 10})
+	if !rperrors.IsCode(err, rperrors.ErrInvalidAccount) {
+		t.Errorf("Expected error code %s, got %v", rperrors.ErrInvalidAccount, err)
+	}
+	if count, _ := store.Count(ctx); count != 0 {
+		t.Errorf("Expected no stored receipts, got %d", count)
+	}
+
+	receipt, err := store.SaveReceipt(ctx, models.Receipt{Retailer: "Target", AccountID: account.ID, Total: 40.00}, models.PointsBreakdown{Total: 100})
+	if err != nil {
+		t.Fatalf("Failed to save receipt: %v", err)
+	}
+	other, err := store.SaveReceipt(ctx, models.Receipt{Retailer: "Target", Total: 1.00}, models.PointsBreakdown{Total: 10})
+	if err != nil {
+		t.Fatalf("Failed to save receipt: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		entry    models.EntryRequest
+		code     rperrors.ErrorCode // Empty when the entry is posted
+		expected int                // Balance afterwards
+	}{
+		{"Redeem", models.EntryRequest{Kind: models.LedgerRedeem, Points: 30, ReceiptID: receipt}, "", 70},
+		{"Goodwill", models.EntryRequest{Kind: models.LedgerAdjust, Points: 5, Note: "late delivery"}, "", 75},
+		{"Correction", models.EntryRequest{Kind: models.LedgerAdjust, Points: -10}, "", 65},
+		{"Expire", models.EntryRequest{Kind: models.LedgerExpire, Points: 15}, "", 50},
+		{"Redeem more than the balance", models.EntryRequest{Kind: models.LedgerRedeem, Points: 51}, rperrors.ErrInvalidLedgerEntry, 50},
+		{"Earn by hand", models.EntryRequest{Kind: models.LedgerEarn, Points: 10}, rperrors.ErrInvalidLedgerEntry, 50},
+		{"Receipt of another account", models.EntryRequest{Kind: models.LedgerRedeem, Points: 1, ReceiptID: other}, rperrors.ErrInvalidLedgerEntry, 50},
+	}
+	for _, tc := range tests {
+		_, err := store.PostEntry(ctx, account.ID, tc.entry)
+		if tc.code == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		} else if tc.code != "" && !rperrors.IsCode(err, tc.code) {
+			t.Errorf("%s: expected error code %s, got %v", tc.name, tc.code, err)
+		}
+		if account, _ := store.GetAccount(ctx, account.ID); account.Balance != tc.expected {
+			t.Errorf("%s: expected a balance of %d, got %d", tc.name, tc.expected, account.Balance)
+		}
+	}
+
+	// Refunding half the receipt claws back 50 of its 100 points, leaving
+	// nothing as the rest were spent
+	if _, err := store.SaveReceipt(ctx, models.Receipt{Retailer: "Target", RefundOf: receipt, Total: -20.00}, models.PointsBreakdown{}); err != nil {
+		t.Fatalf("Failed to save refund: %v", err)
+	}
+
+	history, err := store.AccountHistory(ctx, account.ID)
+	if err != nil {
+		t.Fatalf("Failed to retrieve history: %v", err)
+	}
+	kinds := []models.LedgerKind{models.LedgerEarn, models.LedgerRedeem, models.LedgerAdjust, models.LedgerAdjust, models.LedgerExpire, models.LedgerClawback}
+	if len(history) != len(kinds) {
+		t.Fatalf("Expected %d postings, got %+v", len(kinds), history)
+	}
+	balance := 0
+	for i, posting := range history {
+		if posting.Kind != kinds[i] || posting.Points <= 0 || posting.Debit == posting.Credit {
+			t.Errorf("Expected posting %d to move points of kind %s, got %+v", i+1, kinds[i], posting)
+		}
+		balance += posting.Amount(account.ID)
+	}
+	if account, _ := store.GetAccount(ctx, account.ID); balance != 0 || account.Balance != 0 {
+		t.Errorf("Expected the postings and the balance to come to 0, got %d and %d", balance, account.Balance)
+	}
+
+	for _, err := range []error{
+		func() error { _, err := store.GetAccount(ctx, "non-existent-id"); return err }(),
+		func() error { _, err := store.AccountHistory(ctx, "non-existent-id"); return err }(),
+		func() error {
+			_, err := store.PostEntry(ctx, "non-existent-id", models.EntryRequest{Kind: models.LedgerAdjust, Points: 1})
+			return err
+		}(),
+	} {
+		if !rperrors.IsCode(err, rperrors.ErrAccountNotFound) {
+			t.Errorf("Expected error code %s, got %v", rperrors.ErrAccountNotFound, err)
+		}
+	}
+}
+
+func TestLedgerBalances(t *testing.T) {
+	store := NewMemoryStorage()
+	ctx := context.Background()
+
+	for _, id := range models.SystemAccounts {
+		if account, err := store.GetAccount(ctx, id); err != nil || account.Balance != 0 {
+			t.Errorf("Expected an empty system account %s, got %+v (%v)", id, account, err)
+		}
+	}
+
+	jane, _ := store.CreateAccount(ctx, "Jane")
+	john, _ := store.CreateAccount(ctx, "John")
+	receipt, err := store.SaveReceipt(ctx, models.Receipt{Retailer: "Target", AccountID: jane.ID, Total: 40.00}, models.PointsBreakdown{Total: 100})
+	if err != nil {
+		t.Fatalf("Failed to save receipt: %v", err)
+	}
+	if _, err := store.SaveReceipt(ctx, models.Receipt{Retailer: "Target", AccountID: john.ID, Total: 1.00}, models.PointsBreakdown{Total: 60}); err != nil {
+		t.Fatalf("Failed to save receipt: %v", err)
+	}
+	if _, err := store.SaveReceipt(ctx, models.Receipt{Retailer: "Target", AccountID: john.ID, Total: 1.00}, models.PointsBreakdown{}); err != nil {
+		t.Fatalf("Failed to save receipt: %v", err)
+	}
+	if _, err := store.SaveReceipt(ctx, models.Receipt{Retailer: "Target", RefundOf: receipt, Total: -10.00}, models.PointsBreakdown{}); err != nil {
+		t.Fatalf("Failed to save refund: %v", err)
+	}
+	for _, entry := range []models.EntryRequest{
+		{Kind: models.LedgerRedeem, Points: 30},
+		{Kind: models.LedgerExpire, Points: 5},
+		{Kind: models.LedgerAdjust, Points: -10},
+	} {
+		if _, err := store.PostEntry(ctx, jane.ID, entry); err != nil {
+			t.Fatalf("Failed to post %s: %v", entry.Kind, err)
+		}
+	}
+
+	// Receipts earning nothing post nothing
+	if history, _ := store.AccountHistory(ctx, john.ID); len(history) != 1 {
+		t.Errorf("Expected only the earn posting of 60 points, got %+v", history)
+	}
+
+	expected := map[string]int{
+		jane.ID:                100 - 25 - 30 - 5 - 10,
+		john.ID:                60,
+		models.AccountIssued:   -100 + 25 - 60 + 10,
+		models.AccountRedeemed: 30,
+		models.AccountExpired:  5,
+	}
+	sum := 0
+	for id, balance := range expected {
+		account, err := store.GetAccount(ctx, id)
+		if err != nil {
+			t.Fatalf("Failed to get account %s: %v", id, err)
+		}
+		if account.Balance != balance {
+			t.Errorf("Expected account %s to hold %d points, got %d", id, balance, account.Balance)
+		}
+		sum += account.Balance
+	}
+	if sum != 0 {
+		t.Errorf("Expected the balances of all accounts to sum to 0, got %d", sum)
+	}
+
+	// System accounts are not loyalty accounts
+	_, err = store.SaveReceipt(ctx, models.Receipt{Retailer: "Target", AccountID: models.AccountIssued, Total: 1.00}, models.PointsBreakdown{Total: 10})
+	if !rperrors.IsCode(err, rperrors.ErrInvalidAccount) {
+		t.Errorf("Expected error code %s, got %v", rperrors.ErrInvalidAccount, err)
+	}
+	_, err = store.PostEntry(ctx, models.AccountRedeemed, models.EntryRequest{Kind: models.LedgerAdjust, Points: 10})
+	if !rperrors.IsCode(err, rperrors.ErrInvalidLedgerEntry) {
+		t.Errorf("Expected error code %s, got %v", rperrors.ErrInvalidLedgerEntry, err)
+	}
+
+	// Postings to unknown accounts are refused without moving any points
+	store.mutex.Lock()
+	_, err = store.post(models.Posting{Kind: models.LedgerEarn, Debit: models.AccountIssued, Credit: "non-existent-id", Points: 1})
+	store.mutex.Unlock()
+	if !rperrors.IsCode(err, rperrors.ErrStorageFailure) {
+		t.Errorf("Expected error code %s, got %v", rperrors.ErrStorageFailure, err)
+	}
+	if account, _ := store.GetAccount(ctx, models.AccountIssued); account.Balance != expected[models.AccountIssued] {
+		t.Errorf("Expected the issued balance to be unchanged, got %d", account.Balance)
+	}
+}
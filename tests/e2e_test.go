@@ -1,21 +1,25 @@
 package tests
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
+	"maps"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/marcelorm/receipt-processor/api"
 	"github.com/marcelorm/receipt-processor/models"
-	"github.com/marcelorm/receipt-processor/storage"
+	"github.com/marcelorm/receipt-processor/server"
+	"github.com/marcelorm/receipt-processor/webhooks"
 )
 
 func init() {
@@ -30,28 +34,16 @@ func init() {
 }
 
 // setupTestServer creates a test server with all routes configured
-func setupTestServer() *httptest.Server {
-	router := gin.New()
-	router.Use(gin.Recovery())
-	
-	// Add JSON validation middleware
-	router.Use(api.JSONValidationMiddleware(1024 * 1024))
-
-	store := storage.NewMemoryStorage()
-	handler := api.NewReceiptHandler(store)
-
-	router.POST("/receipts/process", handler.ProcessReceipt)
-	router.GET("/receipts/:id/points", handler.GetPoints)
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "ok"})
-	})
-
-	server := httptest.NewServer(router)
-	return server
+func setupTestServer(t *testing.T) *httptest.Server {
+	srv, err := server.New()
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	return httptest.NewServer(srv)
 }
 
 func TestE2ETargetReceipt(t *testing.T) {
-	server := setupTestServer()
+	server := setupTestServer(t)
 	defer server.Close()
 
 	// Target receipt example - use map for e2e test to bypass custom type validations
@@ -83,7 +75,7 @@ func TestE2ETargetReceipt(t *testing.T) {
 }
 
 func TestE2EMAndMCornerMarketReceipt(t *testing.T) {
-	server := setupTestServer()
+	server := setupTestServer(t)
 	defer server.Close()
 
 	// M&M Corner Market receipt example
@@ -114,7 +106,7 @@ func TestE2EMAndMCornerMarketReceipt(t *testing.T) {
 }
 
 func TestE2ERoundDollarAmount(t *testing.T) {
-	server := setupTestServer()
+	server := setupTestServer(t)
 	defer server.Close()
 
 	// Receipt with round dollar amount
@@ -142,7 +134,7 @@ func TestE2ERoundDollarAmount(t *testing.T) {
 }
 
 func TestE2EPurchaseTimeBonus(t *testing.T) {
-	server := setupTestServer()
+	server := setupTestServer(t)
 	defer server.Close()
 
 	// Receipt with purchase time between 14:00 and 16:00
@@ -169,7 +161,7 @@ func TestE2EPurchaseTimeBonus(t *testing.T) {
 }
 
 func TestE2EOddDayBonus(t *testing.T) {
-	server := setupTestServer()
+	server := setupTestServer(t)
 	defer server.Close()
 
 	// Receipt with odd purchase day
@@ -195,8 +187,185 @@ func TestE2EOddDayBonus(t *testing.T) {
 	}
 }
 
+func TestE2EPartnerDateTimeFormats(t *testing.T) {
+	previous := models.CurrentFormats()
+	if err := models.SetFormats(models.Formats{
+		DateLayouts: []string{"01/02/2006"},
+		TimeLayouts: []string{"Kitchen"},
+		Lenient:     true,
+	}); err != nil {
+		t.Fatalf("Failed to set formats: %v", err)
+	}
+	defer models.SetFormats(previous)
+
+	server := setupTestServer(t)
+	defer server.Close()
+
+	// M&M Corner Market example with the date and time as a partner sends them
+	receipt := map[string]any{
+		"retailer":     "M&M Corner Market",
+		"purchaseDate": "3/20/2022",
+		"purchaseTime": "2:33 p.m.",
+		"items": []map[string]any{
+			{"shortDescription": "Gatorade", "price": "2.25"},
+			{"shortDescription": "Gatorade", "price": "2.25"},
+			{"shortDescription": "Gatorade", "price": "2.25"},
+			{"shortDescription": "Gatorade", "price": "2.25"},
+		},
+		"total": "9.00",
+	}
+
+	// The odd day and afternoon rules apply to the parsed values
+	receiptID := processReceipt(t, server.URL, receipt)
+	if points := getPoints(t, server.URL, receiptID); points != 109 {
+		t.Errorf("Expected 109 points, got %d", points)
+	}
+}
+
+func TestE2ERefund(t *testing.T) {
+	server := setupTestServer(t)
+	defer server.Close()
+
+	// M&M Corner Market example, worth 109 points
+	gatorade := map[string]any{"shortDescription": "Gatorade", "price": "2.25"}
+	originalID := processReceipt(t, server.URL, map[string]any{
+		"retailer":     "M&M Corner Market",
+		"purchaseDate": "2022-03-20",
+		"purchaseTime": "14:33",
+		"items":        []map[string]any{gatorade, gatorade, gatorade, gatorade},
+		"total":        "9.00",
+	})
+
+	// Returning one of the four bottles claws back a quarter of the points
+	refund := map[string]any{
+		"retailer":     "M&M Corner Market",
+		"purchaseDate": "2022-03-21",
+		"purchaseTime": "10:00",
+		"refundOf":     originalID,
+		"items":        []map[string]any{{"shortDescription": "Gatorade", "price": "-2.25"}},
+		"total":        "-2.25",
+	}
+	refundID := processReceipt(t, server.URL, refund)
+	if points := getPoints(t, server.URL, originalID); points != 82 {
+		t.Errorf("Expected 82 points left after the refund, got %d", points)
+	}
+	if points := getPoints(t, server.URL, refundID); points != 0 {
+		t.Errorf("Expected a refund to hold no points, got %d", points)
+	}
+
+	resp, err := http.Get(fmt.Sprintf("%s/receipts/%s/ledger", server.URL, originalID))
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	var ledger models.LedgerResponse
+	err = json.NewDecoder(resp.Body).Decode(&ledger)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Failed to decode ledger: %v", err)
+	}
+	if ledger.Points != 82 || len(ledger.Entries) != 2 || ledger.Entries[1].RefundID != refundID || ledger.Entries[1].Points != -27 {
+		t.Errorf("Expected earn and clawback entries totalling 82 points, got %+v", ledger)
+	}
+
+	// Refunds may not exceed the original, and purchases may not be negative
+	refund["items"] = []map[string]any{{"shortDescription": "Gatorade", "price": "-9.00"}}
+	refund["total"] = "-9.00"
+	purchase := maps.Clone(refund)
+	delete(purchase, "refundOf")
+	for name, receipt := range map[string]map[string]any{"Excessive refund": refund, "Negative purchase": purchase} {
+		reqBody, err := json.Marshal(receipt)
+		if err != nil {
+			t.Fatalf("Failed to marshal receipt: %v", err)
+		}
+		resp, err := http.Post(fmt.Sprintf("%s/receipts/process", server.URL), "application/json", bytes.NewBuffer(reqBody))
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, got %d", name, http.StatusBadRequest, resp.StatusCode)
+		}
+	}
+}
+
+func TestE2ELoyaltyAccount(t *testing.T) {
+	server := setupTestServer(t)
+	defer server.Close()
+
+	// postJSON posts body to path and decodes the response into v
+	postJSON := func(path string, body any, v any) int {
+		t.Helper()
+		reqBody, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("Failed to marshal request: %v", err)
+		}
+		resp, err := http.Post(server.URL+path, "application/json", bytes.NewBuffer(reqBody))
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		defer resp.Body.Close()
+		if v != nil {
+			if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+		}
+		return resp.StatusCode
+	}
+
+	var account models.Account
+	if status := postJSON("/accounts", models.AccountRequest{Name: "Jane"}, &account); status != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d", http.StatusCreated, status)
+	}
+
+	// The Target example earns 28 points into the account
+	processReceipt(t, server.URL, map[string]any{
+		"retailer":     "Target",
+		"purchaseDate": "2022-01-01",
+		"purchaseTime": "13:01",
+		"accountId":    account.ID,
+		"items": []map[string]any{
+			{"shortDescription": "Mountain Dew 12PK", "price": "6.49"},
+			{"shortDescription": "Emils Cheese Pizza", "price": "12.25"},
+			{"shortDescription": "Knorr Creamy Chicken", "price": "1.26"},
+			{"shortDescription": "Doritos Nacho Cheese", "price": "3.35"},
+			{"shortDescription": "   Klarbrunn 12-PK 12 FL OZ  ", "price": "12.00"},
+		},
+		"total": "35.35",
+	})
+	if status := postJSON("/accounts/"+account.ID+"/entries", models.EntryRequest{Kind: models.LedgerRedeem, Points: 25}, nil); status != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d", http.StatusCreated, status)
+	}
+
+	resp, err := http.Get(fmt.Sprintf("%s/accounts/%s/history", server.URL, account.ID))
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	var history models.HistoryResponse
+	err = json.NewDecoder(resp.Body).Decode(&history)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Failed to decode history: %v", err)
+	}
+	if history.Points != 3 || len(history.Entries) != 2 || history.Entries[0].Points != 28 || history.Entries[1].Points != 25 {
+		t.Errorf("Expected 28 points earned and 25 redeemed, got %+v", history)
+	}
+
+	// Receipts for unknown accounts are rejected
+	receipt := map[string]any{
+		"retailer":     "Target",
+		"purchaseDate": "2022-01-01",
+		"purchaseTime": "13:01",
+		"accountId":    "non-existent-id",
+		"items":        []map[string]any{{"shortDescription": "Gum", "price": "1.00"}},
+		"total":        "1.00",
+	}
+	if status := postJSON("/receipts/process", receipt, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, status)
+	}
+}
+
 func TestE2EInvalidReceipt(t *testing.T) {
-	server := setupTestServer()
+	server := setupTestServer(t)
 	defer server.Close()
 
 	// Empty receipt (invalid)
@@ -234,7 +403,7 @@ func TestE2EInvalidReceipt(t *testing.T) {
 }
 
 func TestE2EInvalidReceiptID(t *testing.T) {
-	server := setupTestServer()
+	server := setupTestServer(t)
 	defer server.Close()
 
 	// Get points for non-existent receipt ID
@@ -254,7 +423,464 @@ func TestE2EInvalidReceiptID(t *testing.T) {
 	}
 }
 
+func TestE2EGraphQL(t *testing.T) {
+	server := setupTestServer(t)
+	defer server.Close()
+
+	// Receipts processed over REST are visible to GraphQL
+	receiptID := processReceipt(t, server.URL, map[string]any{
+		"retailer":     "Target",
+		"purchaseDate": "2022-01-01",
+		"purchaseTime": "13:01",
+		"items": []map[string]any{
+			{"shortDescription": "Mountain Dew 12PK", "price": "6.49"},
+		},
+		"total": "6.49",
+	})
+
+	reqBody, err := json.Marshal(map[string]any{
+		"query":     `query($id: ID!) { receipt(id: $id) { retailer points breakdown { rule points } } stats { receipts } }`,
+		"variables": map[string]any{"id": receiptID},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+
+	resp, err := http.Post(server.URL+"/graphql", "application/json", bytes.NewBuffer(reqBody))
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			t.Logf("Warning: failed to close response body: %v", err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	var response struct {
+		Data struct {
+			Receipt struct {
+				Retailer  string `json:"retailer"`
+				Points    int    `json:"points"`
+				Breakdown []struct {
+					Rule   string `json:"rule"`
+					Points int    `json:"points"`
+				} `json:"breakdown"`
+			} `json:"receipt"`
+			Stats struct {
+				Receipts int `json:"receipts"`
+			} `json:"stats"`
+		} `json:"data"`
+		Errors []map[string]any `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Errors) > 0 {
+		t.Fatalf("Expected no errors, got %v", response.Errors)
+	}
+
+	// 6 points for the retailer name, 6 for the odd day
+	receipt := response.Data.Receipt
+	if receipt.Retailer != "Target" || receipt.Points != 12 || len(receipt.Breakdown) != 7 {
+		t.Errorf("Expected the Target receipt worth 12 points with 7 rule results, got %+v", receipt)
+	}
+	if response.Data.Stats.Receipts != 1 {
+		t.Errorf("Expected 1 receipt in the stats, got %d", response.Data.Stats.Receipts)
+	}
+}
+
+func TestE2EStreamReceipts(t *testing.T) {
+	server := setupTestServer(t)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The body is written line by line so that each result must arrive
+	// before the rest of the body has been sent
+	body, writer := io.Pipe()
+	req, err := http.NewRequestWithContext(ctx, "POST", server.URL+"/receipts/stream", body)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	receipt := `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01",` +
+		`"items":[{"shortDescription":"Mountain Dew 12PK","price":"6.49"}],"total":"6.49"}` + "\n"
+	go func() {
+		_, _ = io.WriteString(writer, receipt)
+	}()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			t.Logf("Warning: failed to close response body: %v", err)
+		}
+	}()
+
+	results := bufio.NewScanner(resp.Body)
+	readResult := func() map[string]any {
+		if !results.Scan() {
+			t.Fatalf("Expected a result, got %v", results.Err())
+		}
+		var result map[string]any
+		if err := json.Unmarshal(results.Bytes(), &result); err != nil {
+			t.Fatalf("Failed to decode result: %v", err)
+		}
+		return result
+	}
+
+	first := readResult()
+	if first["id"] == nil || first["line"] != float64(1) {
+		t.Errorf("Expected line 1 to be processed, got %v", first)
+	}
+	receiptID, _ := first["id"].(string)
+	if points := getPoints(t, server.URL, receiptID); points != 12 {
+		t.Errorf("Expected 12 points, got %d", points)
+	}
+
+	go func() {
+		_, _ = io.WriteString(writer, "{}\n")
+		writer.Close()
+	}()
+	second := readResult()
+	if second["error"] == nil || second["line"] != float64(2) {
+		t.Errorf("Expected line 2 to fail, got %v", second)
+	}
+	if results.Scan() {
+		t.Errorf("Expected no more results, got %s", results.Text())
+	}
+}
+
+func TestE2ETextReceipt(t *testing.T) {
+	server := setupTestServer(t)
+	defer server.Close()
+
+	body := "M&M Corner Market\n" +
+		"Mar 20, 2022  2:33 PM\n" +
+		"Gatorade     2.25\n" +
+		"Gatorade     2.25\n" +
+		"Gatorade     2.25\n" +
+		"Gatorade     2.25\n" +
+		"TOTAL        9.00\n"
+	resp, err := http.Post(server.URL+"/receipts/process", "text/plain", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	var result struct {
+		ID         string  `json:"id"`
+		Confidence float64 `json:"confidence"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || result.ID == "" || result.Confidence != 1 {
+		t.Fatalf("Expected the receipt to be parsed with full confidence, got status %d and %+v", resp.StatusCode, result)
+	}
+	if points := getPoints(t, server.URL, result.ID); points != 109 {
+		t.Errorf("Expected 109 points, got %d", points)
+	}
+}
+
+func TestE2EEmailReceipt(t *testing.T) {
+	server := setupTestServer(t)
+	defer server.Close()
+
+	body, err := os.ReadFile("../email/testdata/forwarded.eml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	resp, err := http.Post(server.URL+"/receipts/email", "message/rfc822", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	var result struct {
+		ID       string `json:"id"`
+		Template string `json:"template"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || result.Template != "Target" {
+		t.Fatalf("Expected the forwarded receipt to be read with the Target template, got status %d and %+v", resp.StatusCode, result)
+	}
+	// Target: 6, odd day: 6, item pairs: 5, "Emils Cheese Pizza": 3
+	if points := getPoints(t, server.URL, result.ID); points != 20 {
+		t.Errorf("Expected 20 points, got %d", points)
+	}
+}
+
+func TestE2ECSVImportExport(t *testing.T) {
+	server := setupTestServer(t)
+	defer server.Close()
+
+	body := "Receipt No,retailer,purchaseDate,purchaseTime,total,shortDescription,price\n" +
+		"A-1,M&M Corner Market,2022-03-20,14:33,9.00,Gatorade,2.25\n" +
+		"A-1,,,,,Gatorade,2.25\n" +
+		"A-1,,,,,Gatorade,2.25\n" +
+		"A-1,,,,,Gatorade,2.25\n"
+	resp, err := http.Post(server.URL+"/receipts/import?columns[receipt]=Receipt%20No", "text/csv", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	var result struct {
+		Imported int `json:"imported"`
+		Receipts []struct {
+			ID string `json:"id"`
+		} `json:"receipts"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || result.Imported != 1 {
+		t.Fatalf("Expected the receipt to be imported, got status %d and %+v", resp.StatusCode, result)
+	}
+	imported := result.Receipts[0].ID
+	if points := getPoints(t, server.URL, imported); points != 109 {
+		t.Errorf("Expected 109 points, got %d", points)
+	}
+
+	// Receipts processed as JSON are exported too
+	processed := processReceipt(t, server.URL, map[string]any{
+		"retailer":     "Target",
+		"purchaseDate": "2022-01-01",
+		"purchaseTime": "13:01",
+		"items":        []map[string]any{{"shortDescription": "Mountain Dew 12PK", "price": "6.49"}},
+		"total":        "6.49",
+	})
+
+	resp, err = http.Get(server.URL + "/receipts/export.csv")
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	export, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Failed to read export: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(export)), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("Expected a header and 5 item rows, got %d lines: %s", len(lines), export)
+	}
+	if !strings.HasPrefix(lines[1], imported+",M&M Corner Market,") || !strings.HasPrefix(lines[5], processed+",Target,") {
+		t.Errorf("Expected both receipts in the export, got %s", export)
+	}
+}
+
 // Helper function to process a receipt and return the ID
+func TestE2EWebhooks(t *testing.T) {
+	// Local subscriber that verifies and records every event it receives
+	received := make(chan webhooks.Event, 1)
+	var secret string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := webhooks.Verify(secret, r.Header, body, time.Minute); err != nil {
+			t.Errorf("Expected a valid signature, got %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var event webhooks.Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Errorf("Failed to decode event: %v", err)
+		}
+		received <- event
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	dispatcher := webhooks.NewDispatcher(webhooks.NewMemoryOutbox(), webhooks.NewRegistry(webhooks.AllowPrivateURLs()),
+		webhooks.WithPollInterval(10*time.Millisecond))
+
+	srv, err := server.New(server.WithWebhooks(dispatcher))
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer srv.Shutdown(context.Background())
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	// Register the subscriber
+	reqBody, _ := json.Marshal(map[string]any{
+		"url":    receiver.URL,
+		"events": []string{"receipt.processed"},
+	})
+	resp, err := http.Post(ts.URL+"/webhooks", "application/json", bytes.NewBuffer(reqBody))
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	var subscription struct {
+		ID     string `json:"id"`
+		Secret string `json:"secret"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&subscription)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || err != nil {
+		t.Fatalf("Expected status code %d, got %d (%v)", http.StatusCreated, resp.StatusCode, err)
+	}
+	secret = subscription.Secret
+
+	receiptID := processReceipt(t, ts.URL, map[string]any{
+		"retailer":     "Target",
+		"purchaseDate": "2022-01-01",
+		"purchaseTime": "13:01",
+		"items": []map[string]any{
+			{"shortDescription": "Mountain Dew 12PK", "price": "6.49"},
+		},
+		"total": "6.49",
+	})
+
+	select {
+	case event := <-received:
+		var data webhooks.ReceiptData
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			t.Fatalf("Failed to decode event data: %v", err)
+		}
+		if event.Type != webhooks.EventReceiptProcessed || data.ID != receiptID || data.Points != 12 {
+			t.Errorf("Expected a receipt.processed event for %s worth 12 points, got %s %+v", receiptID, event.Type, data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the webhook")
+	}
+
+	// The delivery is logged once the subscriber has responded
+	var deliveries []webhooks.Delivery
+	deadline := time.Now().Add(5 * time.Second)
+	for len(deliveries) == 0 || deliveries[0].Status != webhooks.DeliverySucceeded {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected a successful delivery, got %+v", deliveries)
+		}
+		resp, err := http.Get(ts.URL + "/webhooks/" + subscription.ID + "/deliveries")
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		deliveries = nil
+		err = json.NewDecoder(resp.Body).Decode(&deliveries)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Failed to decode deliveries: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestE2EEvents(t *testing.T) {
+	server := setupTestServer(t)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events?retailer=target")
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	receiptID := processReceipt(t, server.URL, map[string]any{
+		"retailer":     "Target",
+		"purchaseDate": "2022-01-01",
+		"purchaseTime": "13:01",
+		"items": []map[string]any{
+			{"shortDescription": "Mountain Dew 12PK", "price": "6.49"},
+		},
+		"total": "6.49",
+	})
+
+	// Skip the retry field and read the first event
+	scanner := bufio.NewScanner(resp.Body)
+	var id, data string
+	for data == "" && scanner.Scan() {
+		line := scanner.Text()
+		if value, ok := strings.CutPrefix(line, "id: "); ok {
+			id = value
+		}
+		if value, ok := strings.CutPrefix(line, "data: "); ok {
+			data = value
+		}
+	}
+	if id == "" || data == "" {
+		t.Fatalf("Expected an event with an ID, got id %q data %q (%v)", id, data, scanner.Err())
+	}
+
+	var event struct {
+		ID       string `json:"id"`
+		Retailer string `json:"retailer"`
+		Points   int    `json:"points"`
+		Rules    []struct {
+			Rule   string `json:"rule"`
+			Points int    `json:"points"`
+		} `json:"rules"`
+	}
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		t.Fatalf("Failed to decode event: %v", err)
+	}
+	// 6 points for the retailer name, 6 for the odd day
+	if event.ID != receiptID || event.Points != 12 || len(event.Rules) != 2 {
+		t.Errorf("Expected receipt %s worth 12 points from 2 rules, got %+v", receiptID, event)
+	}
+}
+
+func TestE2EEventsTenant(t *testing.T) {
+	server := setupTestServer(t)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events?tenant=acme")
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	receipt := map[string]any{
+		"retailer":     "Target",
+		"purchaseDate": "2022-01-01",
+		"purchaseTime": "13:01",
+		"items": []map[string]any{
+			{"shortDescription": "Mountain Dew 12PK", "price": "6.49"},
+		},
+		"total": "6.49",
+	}
+	processReceipt(t, server.URL, receipt)
+	receipt["tenant"] = "globex"
+	processReceipt(t, server.URL, receipt)
+	receipt["tenant"] = "acme"
+	receiptID := processReceipt(t, server.URL, receipt)
+
+	// The first event on the stream is the acme receipt
+	scanner := bufio.NewScanner(resp.Body)
+	var data string
+	for data == "" && scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			data = value
+		}
+	}
+	var event struct {
+		ID     string `json:"id"`
+		Tenant string `json:"tenant"`
+	}
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		t.Fatalf("Failed to decode event %q: %v", data, err)
+	}
+	if event.ID != receiptID || event.Tenant != "acme" {
+		t.Errorf("Expected the acme receipt %s, got %+v", receiptID, event)
+	}
+}
+
 func processReceipt(t *testing.T, serverURL string, receipt any) string {
 	// Create a context
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -0,0 +1,156 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/storage"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// storageTracerName is the instrumentation scope of storage spans
+const storageTracerName = "github.com/marcelorm/receipt-processor/storage"
+
+// tracedStorage decorates a ReceiptStorage with a span per operation
+type tracedStorage struct {
+	next   storage.ReceiptStorage
+	tracer trace.Tracer
+}
+
+// Verify tracedStorage implements ReceiptStorage interface
+var _ storage.ReceiptStorage = (*tracedStorage)(nil)
+
+// InstrumentStorage wraps store so that every call is recorded as a span
+func InstrumentStorage(store storage.ReceiptStorage) storage.ReceiptStorage {
+	return &tracedStorage{next: store, tracer: otel.Tracer(storageTracerName)}
+}
+
+// SaveReceipt saves a scored receipt and returns the generated ID
+func (s *tracedStorage) SaveReceipt(ctx context.Context, receipt models.Receipt, breakdown models.PointsBreakdown) (string, error) {
+	ctx, span := s.tracer.Start(ctx, "ReceiptStorage.SaveReceipt",
+		trace.WithAttributes(attribute.Int("receipt.points", breakdown.Total)))
+	defer span.End()
+
+	id, err := s.next.SaveReceipt(ctx, receipt, breakdown)
+	recordError(span, err)
+	span.SetAttributes(attribute.String("receipt.id", id))
+	return id, err
+}
+
+// GetPoints retrieves the points for a receipt by ID
+func (s *tracedStorage) GetPoints(ctx context.Context, id string) (int, error) {
+	ctx, span := s.tracer.Start(ctx, "ReceiptStorage.GetPoints",
+		trace.WithAttributes(attribute.String("receipt.id", id)))
+	defer span.End()
+
+	points, err := s.next.GetPoints(ctx, id)
+	recordError(span, err)
+	return points, err
+}
+
+// Ledger returns the points ledger entries of a receipt by ID
+func (s *tracedStorage) Ledger(ctx context.Context, id string) ([]models.LedgerEntry, error) {
+	ctx, span := s.tracer.Start(ctx, "ReceiptStorage.Ledger",
+		trace.WithAttributes(attribute.String("receipt.id", id)))
+	defer span.End()
+
+	entries, err := s.next.Ledger(ctx, id)
+	recordError(span, err)
+	return entries, err
+}
+
+// GetReceipt retrieves a stored receipt by ID
+func (s *tracedStorage) GetReceipt(ctx context.Context, id string) (storage.Record, error) {
+	ctx, span := s.tracer.Start(ctx, "ReceiptStorage.GetReceipt",
+		trace.WithAttributes(attribute.String("receipt.id", id)))
+	defer span.End()
+
+	record, err := s.next.GetReceipt(ctx, id)
+	recordError(span, err)
+	return record, err
+}
+
+// ListReceipts returns the stored receipts matching filter
+func (s *tracedStorage) ListReceipts(ctx context.Context, filter storage.Filter) ([]storage.Record, error) {
+	ctx, span := s.tracer.Start(ctx, "ReceiptStorage.ListReceipts",
+		trace.WithAttributes(
+			attribute.String("filter.retailer", filter.Retailer),
+			attribute.Int("filter.offset", filter.Offset),
+			attribute.Int("filter.limit", filter.Limit),
+		))
+	defer span.End()
+
+	records, err := s.next.ListReceipts(ctx, filter)
+	recordError(span, err)
+	span.SetAttributes(attribute.Int("receipts.count", len(records)))
+	return records, err
+}
+
+// Count returns the number of receipts in the store
+func (s *tracedStorage) Count(ctx context.Context) (int, error) {
+	ctx, span := s.tracer.Start(ctx, "ReceiptStorage.Count")
+	defer span.End()
+
+	count, err := s.next.Count(ctx)
+	recordError(span, err)
+	return count, err
+}
+
+// CreateAccount opens a loyalty account
+func (s *tracedStorage) CreateAccount(ctx context.Context, name string) (models.Account, error) {
+	ctx, span := s.tracer.Start(ctx, "ReceiptStorage.CreateAccount")
+	defer span.End()
+
+	account, err := s.next.CreateAccount(ctx, name)
+	recordError(span, err)
+	span.SetAttributes(attribute.String("account.id", account.ID))
+	return account, err
+}
+
+// GetAccount retrieves a loyalty account by ID
+func (s *tracedStorage) GetAccount(ctx context.Context, id string) (models.Account, error) {
+	ctx, span := s.tracer.Start(ctx, "ReceiptStorage.GetAccount",
+		trace.WithAttributes(attribute.String("account.id", id)))
+	defer span.End()
+
+	account, err := s.next.GetAccount(ctx, id)
+	recordError(span, err)
+	return account, err
+}
+
+// PostEntry posts an entry to a loyalty account
+func (s *tracedStorage) PostEntry(ctx context.Context, accountID string, entry models.EntryRequest) (models.Posting, error) {
+	ctx, span := s.tracer.Start(ctx, "ReceiptStorage.PostEntry",
+		trace.WithAttributes(
+			attribute.String("account.id", accountID),
+			attribute.String("entry.kind", string(entry.Kind)),
+			attribute.Int("entry.points", entry.Points),
+		))
+	defer span.End()
+
+	posting, err := s.next.PostEntry(ctx, accountID, entry)
+	recordError(span, err)
+	return posting, err
+}
+
+// AccountHistory returns the ledger postings of a loyalty account by ID
+func (s *tracedStorage) AccountHistory(ctx context.Context, id string) ([]models.Posting, error) {
+	ctx, span := s.tracer.Start(ctx, "ReceiptStorage.AccountHistory",
+		trace.WithAttributes(attribute.String("account.id", id)))
+	defer span.End()
+
+	postings, err := s.next.AccountHistory(ctx, id)
+	recordError(span, err)
+	return postings, err
+}
+
+// recordError marks the span as failed when err is non-nil
+func recordError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
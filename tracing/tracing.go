@@ -0,0 +1,172 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Exporter names understood by Setup
+const (
+	ExporterNone   = "none"   // Spans are propagated and logged but not exported
+	ExporterStdout = "stdout" // Spans are written to stdout as JSON
+	ExporterFile   = "file"   // Spans are appended to a file as JSON
+	ExporterOTLP   = "otlp"   // Spans are sent to a collector using OTLP over HTTP
+)
+
+// Config describes how spans are sampled and where they are exported
+type Config struct {
+	ServiceName  string            // Reported as the service.name resource attribute
+	Exporter     string            // Name of a registered exporter
+	FilePath     string            // Output file for the file exporter
+	OTLPEndpoint string            // Collector URL for the OTLP exporter, e.g. http://localhost:4318
+	OTLPHeaders  map[string]string // Extra headers sent with every OTLP export
+	SampleRatio  float64           // Fraction of new traces to sample, between 0 and 1
+}
+
+// ExporterFactory creates a span exporter from the tracing configuration
+type ExporterFactory func(ctx context.Context, cfg Config) (sdktrace.SpanExporter, error)
+
+var (
+	exportersMu sync.RWMutex
+	exporters   = map[string]ExporterFactory{
+		ExporterStdout: newStdoutExporter,
+		ExporterFile:   newFileExporter,
+		ExporterOTLP:   newOTLPExporter,
+	}
+)
+
+// RegisterExporter makes an exporter available under the given name, so that
+// binaries embedding the service can plug in their own span exporters
+func RegisterExporter(name string, factory ExporterFactory) {
+	exportersMu.Lock()
+	defer exportersMu.Unlock()
+	exporters[name] = factory
+}
+
+// Exporters returns the names of all registered exporters
+func Exporters() []string {
+	exportersMu.RLock()
+	defer exportersMu.RUnlock()
+
+	names := []string{ExporterNone}
+	for name := range exporters {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// Setup installs the W3C trace context propagator and, unless the exporter is
+// "none", a global tracer provider exporting spans through the configured
+// exporter. The returned function flushes and stops the provider.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if cfg.Exporter == "" || cfg.Exporter == ExporterNone {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exportersMu.RLock()
+	factory, ok := exporters[cfg.Exporter]
+	exportersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+
+	exporter, err := factory(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("creating %s trace exporter: %w", cfg.Exporter, err)
+	}
+
+	provider := NewProvider(cfg, sdktrace.WithBatcher(exporter))
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// NewProvider creates a tracer provider for the service using the sampling
+// settings from cfg and any additional provider options
+func NewProvider(cfg Config, opts ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = "receipt-processor"
+	}
+
+	ratio := cfg.SampleRatio
+	if ratio <= 0 || ratio > 1 {
+		ratio = 1
+	}
+
+	opts = append([]sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	}, opts...)
+
+	return sdktrace.NewTracerProvider(opts...)
+}
+
+// newStdoutExporter writes spans to stdout
+func newStdoutExporter(_ context.Context, _ Config) (sdktrace.SpanExporter, error) {
+	return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+}
+
+// newFileExporter appends spans to the configured file
+func newFileExporter(_ context.Context, cfg Config) (sdktrace.SpanExporter, error) {
+	if cfg.FilePath == "" {
+		return nil, fmt.Errorf("a file path is required for the file exporter")
+	}
+
+	f, err := os.OpenFile(cfg.FilePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &fileExporter{SpanExporter: exporter, file: f}, nil
+}
+
+// fileExporter closes the underlying file when the exporter shuts down
+type fileExporter struct {
+	sdktrace.SpanExporter
+	file *os.File
+}
+
+// Shutdown stops the exporter and closes the output file
+func (e *fileExporter) Shutdown(ctx context.Context) error {
+	err := e.SpanExporter.Shutdown(ctx)
+	if cerr := e.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// newOTLPExporter sends spans to a collector using OTLP over HTTP. Without an
+// explicit endpoint the standard OTEL_EXPORTER_OTLP_* variables are honoured.
+func newOTLPExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, error) {
+	var opts []otlptracehttp.Option
+	if cfg.OTLPEndpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpointURL(cfg.OTLPEndpoint))
+	}
+	if len(cfg.OTLPHeaders) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(cfg.OTLPHeaders))
+	}
+	return otlptracehttp.New(ctx, opts...)
+}
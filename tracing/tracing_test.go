@@ -0,0 +1,197 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/marcelorm/receipt-processor/models"
+	"github.com/marcelorm/receipt-processor/storage"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// collector is a minimal stand-in for an OTLP/HTTP collector
+type collector struct {
+	mu    sync.Mutex
+	spans []string
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/traces" {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req coltracepb.ExportTraceServiceRequest
+	if err := proto.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, span := range ss.Spans {
+				c.spans = append(c.spans, span.Name)
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	resp, _ := proto.Marshal(&coltracepb.ExportTraceServiceResponse{})
+	_, _ = w.Write(resp)
+}
+
+func TestOTLPExporter(t *testing.T) {
+	stand := &collector{}
+	server := httptest.NewServer(stand)
+	defer server.Close()
+
+	ctx := context.Background()
+	exporter, err := newOTLPExporter(ctx, Config{OTLPEndpoint: server.URL})
+	if err != nil {
+		t.Fatalf("Failed to create exporter: %v", err)
+	}
+
+	provider := NewProvider(Config{}, sdktrace.WithSyncer(exporter))
+	_, span := provider.Tracer("test").Start(ctx, "test-span")
+	span.End()
+
+	if err := provider.Shutdown(ctx); err != nil {
+		t.Fatalf("Failed to shut down provider: %v", err)
+	}
+
+	stand.mu.Lock()
+	defer stand.mu.Unlock()
+	if len(stand.spans) != 1 || stand.spans[0] != "test-span" {
+		t.Errorf("Expected collector to receive [test-span], got %v", stand.spans)
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.json")
+
+	ctx := context.Background()
+	exporter, err := newFileExporter(ctx, Config{FilePath: path})
+	if err != nil {
+		t.Fatalf("Failed to create exporter: %v", err)
+	}
+
+	provider := NewProvider(Config{}, sdktrace.WithSyncer(exporter))
+	_, span := provider.Tracer("test").Start(ctx, "file-span")
+	span.End()
+
+	if err := provider.Shutdown(ctx); err != nil {
+		t.Fatalf("Failed to shut down provider: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read span file: %v", err)
+	}
+	if !strings.Contains(string(data), `"Name":"file-span"`) {
+		t.Errorf("Expected span file to contain file-span, got %s", data)
+	}
+
+	// A path is required
+	if _, err := newFileExporter(ctx, Config{}); err == nil {
+		t.Error("Expected error for file exporter without a path, got nil")
+	}
+}
+
+func TestSetupUnknownExporter(t *testing.T) {
+	if _, err := Setup(context.Background(), Config{Exporter: "carrier-pigeon"}); err == nil {
+		t.Error("Expected error for unknown exporter, got nil")
+	}
+}
+
+func TestRegisterExporter(t *testing.T) {
+	RegisterExporter("memory", func(context.Context, Config) (sdktrace.SpanExporter, error) {
+		return tracetest.NewInMemoryExporter(), nil
+	})
+
+	found := false
+	for _, name := range Exporters() {
+		if name == "memory" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected registered exporter in %v", Exporters())
+	}
+}
+
+func TestLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewLogHandler(slog.NewTextHandler(&buf, nil)))
+
+	provider := NewProvider(Config{})
+	ctx, span := provider.Tracer("test").Start(context.Background(), "log-span")
+	defer span.End()
+
+	logger.InfoContext(ctx, "traced message")
+	sc := span.SpanContext()
+	if !strings.Contains(buf.String(), "trace_id="+sc.TraceID().String()) {
+		t.Errorf("Expected log to contain trace ID, got %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "span_id="+sc.SpanID().String()) {
+		t.Errorf("Expected log to contain span ID, got %s", buf.String())
+	}
+
+	// Records without a span are passed through untouched
+	buf.Reset()
+	logger.InfoContext(context.Background(), "untraced message")
+	if strings.Contains(buf.String(), "trace_id") {
+		t.Errorf("Expected no trace ID without a span, got %s", buf.String())
+	}
+}
+
+func TestInstrumentStorage(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := NewProvider(Config{}, sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+
+	ctx := context.Background()
+	store := InstrumentStorage(storage.NewMemoryStorage())
+
+	id, err := store.SaveReceipt(ctx, models.Receipt{Retailer: "Target"}, models.PointsBreakdown{Total: 10})
+	if err != nil {
+		t.Fatalf("Failed to save receipt: %v", err)
+	}
+	if _, err := store.GetPoints(ctx, id); err != nil {
+		t.Fatalf("Failed to retrieve points: %v", err)
+	}
+	if _, err := store.GetPoints(ctx, "non-existent-id"); err == nil {
+		t.Fatal("Expected error for non-existent ID, got nil")
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 spans, got %d", len(spans))
+	}
+	if spans[0].Name != "ReceiptStorage.SaveReceipt" || spans[1].Name != "ReceiptStorage.GetPoints" {
+		t.Errorf("Unexpected span names %s, %s", spans[0].Name, spans[1].Name)
+	}
+	if len(spans[2].Events) == 0 {
+		t.Error("Expected the failed lookup to record an error event")
+	}
+}
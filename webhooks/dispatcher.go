@@ -0,0 +1,636 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Defaults used when the corresponding option is not given
+const (
+	DefaultMaxAttempts    = 8
+	DefaultInitialBackoff = time.Second
+	DefaultMaxBackoff     = 5 * time.Minute
+	DefaultPollInterval   = time.Second
+	DefaultTimeout        = 10 * time.Second
+	DefaultLogSize        = 1000
+	DefaultMaxInFlight    = 100
+)
+
+// userAgent identifies webhook requests
+const userAgent = "receipt-processor-webhooks/1.0"
+
+// DeliveryStatus is the state of a delivery to one subscription
+type DeliveryStatus string
+
+// Delivery states
+const (
+	DeliveryPending   DeliveryStatus = "pending"   // Not yet delivered; more attempts will be made
+	DeliverySucceeded DeliveryStatus = "succeeded" // The subscriber accepted the event
+	DeliveryFailed    DeliveryStatus = "failed"    // Every attempt failed; the delivery is dead-lettered
+	DeliveryCancelled DeliveryStatus = "cancelled" // The subscription was deleted before delivery
+)
+
+// Attempt is a single request made for a delivery
+type Attempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"statusCode,omitempty"` // Response status, if a response was received
+	Error      string    `json:"error,omitempty"`      // Why the attempt failed
+	DurationMs int64     `json:"durationMs"`           // Time taken to respond
+}
+
+// Delivery is the log entry of an event delivered to one subscription
+type Delivery struct {
+	ID             string         `json:"id"`
+	EventID        string         `json:"eventId"`
+	EventType      EventType      `json:"eventType"`
+	SubscriptionID string         `json:"subscriptionId"`
+	URL            string         `json:"url"`
+	Status         DeliveryStatus `json:"status"`
+	Attempts       []Attempt      `json:"attempts"`
+	NextAttemptAt  *time.Time     `json:"nextAttemptAt,omitempty"`
+	CreatedAt      time.Time      `json:"createdAt"`
+	UpdatedAt      time.Time      `json:"updatedAt"`
+}
+
+// clone returns a copy that does not share attempts with d
+func (d *Delivery) clone() Delivery {
+	c := *d
+	c.Attempts = slices.Clone(d.Attempts)
+	return c
+}
+
+// Dispatcher delivers the events in an outbox to the subscriptions in a
+// registry. Each event is delivered to every matching subscription
+// concurrently and removed from the outbox once each delivery has succeeded
+// or been dead-lettered. Events still in the outbox when the dispatcher
+// stops are delivered again after a restart, so subscribers may receive an
+// event more than once and should deduplicate on its ID. The delivery log
+// and dead letters are saved in the outbox too, and pending deliveries
+// resume with the attempts already made.
+type Dispatcher struct {
+	outbox         Outbox
+	registry       *Registry
+	client         *http.Client
+	logger         *slog.Logger
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	pollInterval   time.Duration
+	timeout        time.Duration
+	logSize        int
+	maxInFlight    int
+
+	mu          sync.Mutex
+	deliveries  []*Delivery // Delivery log, oldest first
+	deadLetters []*Delivery // Failed deliveries, oldest first
+	inFlight    map[string]bool
+	started     bool
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wake    chan struct{}
+	running sync.WaitGroup
+}
+
+// DispatcherOption configures a Dispatcher
+type DispatcherOption func(*Dispatcher)
+
+// WithHTTPClient sends webhook requests with client instead of a default
+// client. The default client refuses to connect to internal addresses unless
+// the registry allows them; client does not.
+func WithHTTPClient(client *http.Client) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.client = client
+	}
+}
+
+// WithLogger logs through the given logger instead of the default logger
+func WithLogger(logger *slog.Logger) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.logger = logger
+	}
+}
+
+// WithMaxAttempts dead-letters a delivery after n failed attempts
+func WithMaxAttempts(n int) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.maxAttempts = n
+	}
+}
+
+// WithBackoff waits initial after the first failed attempt, doubling the
+// wait after every further failure up to max
+func WithBackoff(initial, max time.Duration) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.initialBackoff = initial
+		d.maxBackoff = max
+	}
+}
+
+// WithPollInterval checks the outbox for events added by other processes
+// every interval
+func WithPollInterval(interval time.Duration) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.pollInterval = interval
+	}
+}
+
+// WithTimeout limits how long a subscriber may take to respond
+func WithTimeout(timeout time.Duration) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.timeout = timeout
+	}
+}
+
+// WithLogSize keeps the n most recent deliveries and dead letters
+func WithLogSize(n int) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.logSize = n
+	}
+}
+
+// WithMaxInFlight delivers at most n events at once. Later events wait in
+// the outbox until a delivery finishes.
+func WithMaxInFlight(n int) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.maxInFlight = n
+	}
+}
+
+// NewDispatcher creates a dispatcher delivering the events in outbox to the
+// subscriptions in registry. Delivery begins when Start is called.
+func NewDispatcher(outbox Outbox, registry *Registry, opts ...DispatcherOption) *Dispatcher {
+	d := &Dispatcher{
+		outbox:         outbox,
+		registry:       registry,
+		logger:         slog.Default(),
+		maxAttempts:    DefaultMaxAttempts,
+		initialBackoff: DefaultInitialBackoff,
+		maxBackoff:     DefaultMaxBackoff,
+		pollInterval:   DefaultPollInterval,
+		timeout:        DefaultTimeout,
+		logSize:        DefaultLogSize,
+		maxInFlight:    DefaultMaxInFlight,
+		inFlight:       make(map[string]bool),
+		wake:           make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	d.maxInFlight = max(d.maxInFlight, 1)
+	if d.client == nil {
+		d.client = &http.Client{Transport: d.transport()}
+	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	d.restore()
+	return d
+}
+
+// transport returns an HTTP transport that refuses to connect to internal
+// addresses unless the registry allows them, so a subscription whose host
+// name resolves to one is not delivered to either
+func (d *Dispatcher) transport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !d.registry.allowPrivate && internalAddr(addrPort.Addr()) {
+				return fmt.Errorf("refusing to connect to internal address %s", addrPort.Addr())
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+// restore loads the delivery log and dead letters saved in the outbox
+func (d *Dispatcher) restore() {
+	deliveries, err := d.outbox.Deliveries(d.ctx)
+	if err != nil {
+		d.logger.Error("Failed to read webhook delivery log", "error", err)
+		return
+	}
+	var deadLetters []*Delivery
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		d.deliveries = append(d.deliveries, delivery)
+		if delivery.Status == DeliveryFailed {
+			deadLetters = append(deadLetters, delivery)
+		}
+	}
+	// Deliveries are dead-lettered in the order they finished
+	slices.SortStableFunc(deadLetters, func(a, b *Delivery) int { return a.UpdatedAt.Compare(b.UpdatedAt) })
+	d.deadLetters = deadLetters
+	if d.logSize > 0 {
+		d.deliveries = d.deliveries[max(0, len(d.deliveries)-d.logSize):]
+		d.deadLetters = d.deadLetters[max(0, len(d.deadLetters)-d.logSize):]
+	}
+}
+
+// Registry returns the subscriptions the dispatcher delivers to
+func (d *Dispatcher) Registry() *Registry {
+	return d.registry
+}
+
+// Start begins delivering events in the background
+func (d *Dispatcher) Start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.started {
+		return
+	}
+	d.started = true
+	d.running.Add(1)
+	go d.run()
+}
+
+// Stop stops delivering events, waiting for in-flight requests until ctx is
+// done. Deliveries that have not finished are resumed by the next
+// dispatcher reading the same outbox.
+func (d *Dispatcher) Stop(ctx context.Context) error {
+	d.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		d.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Notify wakes the dispatcher to deliver newly added events without waiting
+// for the next poll
+func (d *Dispatcher) Notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Deliveries returns the logged deliveries to the subscription with the
+// given ID, newest first
+func (d *Dispatcher) Deliveries(subscriptionID string) []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var deliveries []Delivery
+	for i := len(d.deliveries) - 1; i >= 0; i-- {
+		if d.deliveries[i].SubscriptionID == subscriptionID {
+			deliveries = append(deliveries, d.deliveries[i].clone())
+		}
+	}
+	return deliveries
+}
+
+// DeadLetters returns the deliveries that failed every attempt, newest first
+func (d *Dispatcher) DeadLetters() []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	deliveries := make([]Delivery, 0, len(d.deadLetters))
+	for i := len(d.deadLetters) - 1; i >= 0; i-- {
+		deliveries = append(deliveries, d.deadLetters[i].clone())
+	}
+	return deliveries
+}
+
+// run polls the outbox until the dispatcher is stopped
+func (d *Dispatcher) run() {
+	defer d.running.Done()
+
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+	for {
+		d.poll()
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-d.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll starts delivering the pending events that are not already in flight,
+// oldest first, while fewer than the maximum are in flight
+func (d *Dispatcher) poll() {
+	d.mu.Lock()
+	full := len(d.inFlight) >= d.maxInFlight
+	d.mu.Unlock()
+	if full {
+		return
+	}
+
+	// The events in flight are the oldest pending, so reading the maximum
+	// in flight finds every event that may start
+	events, err := d.outbox.Pending(d.ctx, d.maxInFlight)
+	if err != nil {
+		d.logger.Error("Failed to read webhook outbox", "error", err)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, event := range events {
+		if len(d.inFlight) >= d.maxInFlight {
+			break
+		}
+		if d.inFlight[event.ID] {
+			continue
+		}
+		d.inFlight[event.ID] = true
+		d.running.Add(1)
+		go d.dispatch(event)
+	}
+}
+
+// dispatch delivers event to every matching subscription and acknowledges it
+// once all deliveries are finished
+func (d *Dispatcher) dispatch(event Event) {
+	defer d.running.Done()
+	defer func() {
+		d.mu.Lock()
+		delete(d.inFlight, event.ID)
+		d.mu.Unlock()
+		// Start the next waiting event
+		d.Notify()
+	}()
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		d.logger.Error("Failed to encode webhook event", "event_id", event.ID, "error", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	finished := true
+	var finishedMu sync.Mutex
+	for _, sub := range d.registry.Matching(event.Type) {
+		// Subscriptions only receive events raised after they were created
+		if sub.CreatedAt.After(event.CreatedAt) {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !d.deliver(event, sub, body) {
+				finishedMu.Lock()
+				finished = false
+				finishedMu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if !finished {
+		return
+	}
+	if err := d.outbox.Ack(context.WithoutCancel(d.ctx), event.ID); err != nil {
+		d.logger.Error("Failed to acknowledge webhook event", "event_id", event.ID, "error", err)
+	}
+}
+
+// deliver sends event to sub until it succeeds, fails every attempt or the
+// subscription is deleted. It reports false when the dispatcher stopped
+// before the delivery finished.
+func (d *Dispatcher) deliver(event Event, sub Subscription, body []byte) bool {
+	delivery := d.logDelivery(event, sub)
+
+	// A resumed delivery waits out the backoff scheduled before the restart
+	if next := delivery.NextAttemptAt; next != nil {
+		select {
+		case <-d.ctx.Done():
+			return false
+		case <-time.After(time.Until(*next)):
+		}
+	}
+
+	for attempt := len(delivery.Attempts) + 1; ; attempt++ {
+		if _, err := d.registry.Get(sub.ID); err != nil {
+			d.finish(delivery, DeliveryCancelled)
+			return true
+		}
+
+		start := time.Now()
+		status, err := d.send(event, sub, delivery.ID, body)
+		result := Attempt{At: start.UTC(), StatusCode: status, DurationMs: time.Since(start).Milliseconds()}
+		if err != nil {
+			if d.ctx.Err() != nil {
+				// Interrupted by Stop; the event stays in the outbox
+				return false
+			}
+			result.Error = err.Error()
+		}
+		d.recordAttempt(delivery, result)
+
+		if err == nil {
+			d.finish(delivery, DeliverySucceeded)
+			return true
+		}
+		if attempt >= d.maxAttempts {
+			d.finish(delivery, DeliveryFailed)
+			d.logger.Warn("Webhook delivery failed",
+				"delivery_id", delivery.ID,
+				"event_id", event.ID,
+				"subscription_id", sub.ID,
+				"attempts", attempt,
+				"error", err)
+			return true
+		}
+
+		wait := d.backoff(attempt)
+		d.scheduleRetry(delivery, time.Now().Add(wait))
+		select {
+		case <-d.ctx.Done():
+			return false
+		case <-time.After(wait):
+		}
+	}
+}
+
+// send makes a single signed request for a delivery and returns the
+// response status
+func (d *Dispatcher) send(event Event, sub Subscription, deliveryID string, body []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(d.ctx, d.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(HeaderEventID, event.ID)
+	req.Header.Set(HeaderEventType, string(event.Type))
+	req.Header.Set(HeaderDelivery, deliveryID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, now, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain a little of the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the wait before the attempt after attempt, doubling from
+// the initial backoff up to the maximum with jitter so that retries to a
+// recovering subscriber are spread out
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	wait := d.initialBackoff
+	for i := 1; i < attempt && wait < d.maxBackoff; i++ {
+		wait *= 2
+	}
+	wait = min(wait, d.maxBackoff)
+	if wait < 2 {
+		return wait
+	}
+	return wait/2 + rand.N(wait/2)
+}
+
+// logDelivery returns the pending delivery of event to sub restored from
+// the outbox, or adds a new pending delivery to the log
+func (d *Dispatcher) logDelivery(event Event, sub Subscription) *Delivery {
+	d.mu.Lock()
+	for _, delivery := range d.deliveries {
+		if delivery.Status == DeliveryPending && delivery.EventID == event.ID && delivery.SubscriptionID == sub.ID {
+			d.mu.Unlock()
+			return delivery
+		}
+	}
+	d.mu.Unlock()
+
+	now := time.Now().UTC()
+	delivery := &Delivery{
+		ID:             uuid.New().String(),
+		EventID:        event.ID,
+		EventType:      event.Type,
+		SubscriptionID: sub.ID,
+		URL:            sub.URL,
+		Status:         DeliveryPending,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+
+	d.mu.Lock()
+	var dropped []*Delivery
+	d.deliveries, dropped = appendBounded(d.deliveries, delivery, d.logSize)
+	saved, forgotten := delivery.clone(), d.forgotten(dropped)
+	d.mu.Unlock()
+
+	d.save(saved, forgotten)
+	return delivery
+}
+
+// recordAttempt adds an attempt to a delivery
+func (d *Dispatcher) recordAttempt(delivery *Delivery, attempt Attempt) {
+	d.mu.Lock()
+	delivery.Attempts = append(delivery.Attempts, attempt)
+	delivery.UpdatedAt = time.Now().UTC()
+	saved := delivery.clone()
+	d.mu.Unlock()
+
+	d.save(saved, nil)
+}
+
+// scheduleRetry records when a delivery will next be attempted
+func (d *Dispatcher) scheduleRetry(delivery *Delivery, at time.Time) {
+	d.mu.Lock()
+	at = at.UTC()
+	delivery.NextAttemptAt = &at
+	saved := delivery.clone()
+	d.mu.Unlock()
+
+	d.save(saved, nil)
+}
+
+// finish marks a delivery as finished with status, dead-lettering it when
+// it failed
+func (d *Dispatcher) finish(delivery *Delivery, status DeliveryStatus) {
+	d.mu.Lock()
+	delivery.Status = status
+	delivery.NextAttemptAt = nil
+	delivery.UpdatedAt = time.Now().UTC()
+	var dropped []*Delivery
+	if status == DeliveryFailed {
+		d.deadLetters, dropped = appendBounded(d.deadLetters, delivery, d.logSize)
+	}
+	saved, forgotten := delivery.clone(), d.forgotten(dropped)
+	d.mu.Unlock()
+
+	d.save(saved, forgotten)
+}
+
+// forgotten returns the IDs of the dropped deliveries that are neither in
+// the delivery log nor dead-lettered. The caller must hold d.mu.
+func (d *Dispatcher) forgotten(dropped []*Delivery) []string {
+	var ids []string
+	for _, delivery := range dropped {
+		if !slices.Contains(d.deliveries, delivery) && !slices.Contains(d.deadLetters, delivery) {
+			ids = append(ids, delivery.ID)
+		}
+	}
+	return ids
+}
+
+// save records the state of a delivery in the outbox and removes the
+// deliveries with the forgotten IDs. Failures are logged; the in-memory log
+// stays correct until the next restart.
+func (d *Dispatcher) save(delivery Delivery, forgotten []string) {
+	ctx := context.WithoutCancel(d.ctx)
+	if err := d.outbox.SaveDelivery(ctx, delivery); err != nil {
+		d.logger.Error("Failed to save webhook delivery", "delivery_id", delivery.ID, "error", err)
+	}
+	for _, id := range forgotten {
+		if err := d.outbox.DropDelivery(ctx, id); err != nil {
+			d.logger.Error("Failed to drop webhook delivery", "delivery_id", id, "error", err)
+		}
+	}
+}
+
+// appendBounded appends delivery, dropping the oldest entries beyond size.
+// It returns the dropped entries.
+func appendBounded(deliveries []*Delivery, delivery *Delivery, size int) ([]*Delivery, []*Delivery) {
+	deliveries = append(deliveries, delivery)
+	if size <= 0 || len(deliveries) <= size {
+		return deliveries, nil
+	}
+	n := len(deliveries) - size
+	dropped := slices.Clone(deliveries[:n])
+	return slices.Delete(deliveries, 0, n), dropped
+}
@@ -0,0 +1,505 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marcelorm/receipt-processor/events"
+	"github.com/marcelorm/receipt-processor/models"
+)
+
+// receiver is a local webhook endpoint that records the requests it accepts
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+	failures int // Number of requests to fail before accepting
+}
+
+// newReceiver starts a receiver that fails the first failures requests
+func newReceiver(t *testing.T, failures int) *receiver {
+	r := &receiver{failures: failures}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.requests = append(r.requests, req)
+		r.bodies = append(r.bodies, body)
+		if len(r.requests) <= r.failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// count returns the number of requests received
+func (r *receiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+// newTestDispatcher starts a dispatcher with short backoffs that is stopped
+// when the test ends
+func newTestDispatcher(t *testing.T, outbox Outbox, registry *Registry, opts ...DispatcherOption) *Dispatcher {
+	opts = append([]DispatcherOption{
+		WithBackoff(time.Millisecond, 5*time.Millisecond),
+		WithPollInterval(10 * time.Millisecond),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	}, opts...)
+	d := NewDispatcher(outbox, registry, opts...)
+	d.Start()
+	t.Cleanup(func() {
+		_ = d.Stop(context.Background())
+	})
+	return d
+}
+
+// waitFor polls condition until it holds or the test times out
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// pending returns the number of events left in outbox
+func pending(t *testing.T, outbox Outbox) int {
+	t.Helper()
+	events, err := outbox.Pending(context.Background(), 100)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return len(events)
+}
+
+func TestDispatcherDeliversSignedEvents(t *testing.T) {
+	recv := newReceiver(t, 0)
+	registry := NewRegistry(AllowPrivateURLs())
+	sub, err := registry.Create(recv.URL, []EventType{EventReceiptProcessed}, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Subscribed to other events only, so it must not be called
+	other := newReceiver(t, 0)
+	if _, err := registry.Create(other.URL, []EventType{EventReceiptDeleted}, ""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	outbox := NewMemoryOutbox()
+	d := newTestDispatcher(t, outbox, registry)
+	envelope, err := events.NewEnvelope(events.ReceiptProcessed{
+		ReceiptID: "r1",
+		Retailer:  "Target",
+		Points:    6,
+		Rules:     []models.RuleResult{{Rule: "retailer_name", Points: 6}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := d.Handle(context.Background(), envelope); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	waitFor(t, "the event to be acknowledged", func() bool { return pending(t, outbox) == 0 })
+
+	if recv.count() != 1 {
+		t.Fatalf("Expected 1 request, got %d", recv.count())
+	}
+	if other.count() != 0 {
+		t.Errorf("Expected no requests to the unsubscribed receiver, got %d", other.count())
+	}
+
+	req, body := recv.requests[0], recv.bodies[0]
+	if err := Verify(sub.Secret, req.Header, body, time.Minute); err != nil {
+		t.Errorf("Expected a valid signature, got %v", err)
+	}
+	if req.Header.Get(HeaderEventType) != string(EventReceiptProcessed) {
+		t.Errorf("Expected event header %s, got %s", EventReceiptProcessed, req.Header.Get(HeaderEventType))
+	}
+
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		t.Fatalf("Failed to decode event: %v", err)
+	}
+	if event.ID != envelope.ID || event.ID != req.Header.Get(HeaderEventID) {
+		t.Errorf("Expected event ID %s to match the domain event %s and header %s", event.ID, envelope.ID, req.Header.Get(HeaderEventID))
+	}
+	var data ReceiptData
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		t.Fatalf("Failed to decode event data: %v", err)
+	}
+	if data.ID != "r1" || data.Retailer != "Target" || data.Points != 6 || len(data.Rules) != 1 {
+		t.Errorf("Unexpected event data %+v", data)
+	}
+
+	deliveries := d.Deliveries(sub.ID)
+	if len(deliveries) != 1 {
+		t.Fatalf("Expected 1 logged delivery, got %d", len(deliveries))
+	}
+	if deliveries[0].Status != DeliverySucceeded || len(deliveries[0].Attempts) != 1 {
+		t.Errorf("Expected one successful attempt, got %+v", deliveries[0])
+	}
+}
+
+func TestDispatcherDeduplicatesEvents(t *testing.T) {
+	recv := newReceiver(t, 0)
+	registry := NewRegistry(AllowPrivateURLs())
+	sub, err := registry.Create(recv.URL, []EventType{EventReceiptProcessed}, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	outbox := NewMemoryOutbox()
+	d := NewDispatcher(outbox, registry,
+		WithPollInterval(10*time.Millisecond),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	envelope, err := events.NewEnvelope(events.ReceiptProcessed{ReceiptID: "r1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// An event handled again while pending is added once
+	for i := 0; i < 2; i++ {
+		if err := d.Handle(context.Background(), envelope); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if pending(t, outbox) != 1 {
+		t.Fatalf("Expected 1 pending event, got %d", pending(t, outbox))
+	}
+
+	d.Start()
+	t.Cleanup(func() { _ = d.Stop(context.Background()) })
+	waitFor(t, "the event to be acknowledged", func() bool { return pending(t, outbox) == 0 })
+
+	// An event handled again after it was delivered is not delivered again
+	if err := d.Handle(context.Background(), envelope); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if pending(t, outbox) != 0 {
+		t.Errorf("Expected no pending events, got %d", pending(t, outbox))
+	}
+	if recv.count() != 1 || len(d.Deliveries(sub.ID)) != 1 {
+		t.Errorf("Expected 1 delivery, got %d requests and %d deliveries", recv.count(), len(d.Deliveries(sub.ID)))
+	}
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	tests := []struct {
+		name        string
+		failures    int
+		maxAttempts int
+		status      DeliveryStatus
+		deadLetters int
+	}{
+		{"Succeeds after retries", 2, 4, DeliverySucceeded, 0},
+		{"Dead-lettered after max attempts", 10, 3, DeliveryFailed, 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			recv := newReceiver(t, tc.failures)
+			registry := NewRegistry(AllowPrivateURLs())
+			sub, err := registry.Create(recv.URL, []EventType{EventReceiptProcessed}, "")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			outbox := NewMemoryOutbox()
+			d := newTestDispatcher(t, outbox, registry, WithMaxAttempts(tc.maxAttempts))
+			event, _ := NewReceiptEvent(EventReceiptProcessed, events.ReceiptProcessed{ReceiptID: "r1"})
+			if err := outbox.Add(context.Background(), event); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			d.Notify()
+
+			waitFor(t, "the event to be acknowledged", func() bool { return pending(t, outbox) == 0 })
+
+			deliveries := d.Deliveries(sub.ID)
+			if len(deliveries) != 1 {
+				t.Fatalf("Expected 1 logged delivery, got %d", len(deliveries))
+			}
+			delivery := deliveries[0]
+			if delivery.Status != tc.status {
+				t.Errorf("Expected status %s, got %s", tc.status, delivery.Status)
+			}
+			wantAttempts := min(tc.failures+1, tc.maxAttempts)
+			if len(delivery.Attempts) != wantAttempts {
+				t.Errorf("Expected %d attempts, got %d", wantAttempts, len(delivery.Attempts))
+			}
+			if delivery.Attempts[0].StatusCode != http.StatusServiceUnavailable || delivery.Attempts[0].Error == "" {
+				t.Errorf("Expected the first attempt to record the failure, got %+v", delivery.Attempts[0])
+			}
+			if len(d.DeadLetters()) != tc.deadLetters {
+				t.Errorf("Expected %d dead letters, got %d", tc.deadLetters, len(d.DeadLetters()))
+			}
+		})
+	}
+}
+
+func TestDispatcherCancelsDeletedSubscriptions(t *testing.T) {
+	recv := newReceiver(t, 1000)
+	registry := NewRegistry(AllowPrivateURLs())
+	sub, err := registry.Create(recv.URL, []EventType{EventReceiptProcessed}, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	outbox := NewMemoryOutbox()
+	d := newTestDispatcher(t, outbox, registry, WithMaxAttempts(1000))
+	event, _ := NewReceiptEvent(EventReceiptProcessed, events.ReceiptProcessed{ReceiptID: "r1"})
+	_ = outbox.Add(context.Background(), event)
+	d.Notify()
+
+	waitFor(t, "a failed attempt", func() bool { return recv.count() > 0 })
+	if err := registry.Delete(sub.ID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitFor(t, "the event to be acknowledged", func() bool { return pending(t, outbox) == 0 })
+
+	deliveries := d.Deliveries(sub.ID)
+	if len(deliveries) != 1 || deliveries[0].Status != DeliveryCancelled {
+		t.Errorf("Expected a cancelled delivery, got %+v", deliveries)
+	}
+	if len(d.DeadLetters()) != 0 {
+		t.Errorf("Expected no dead letters, got %d", len(d.DeadLetters()))
+	}
+}
+
+func TestDispatcherRefusesInternalAddresses(t *testing.T) {
+	recv := newReceiver(t, 0)
+	path := filepath.Join(t.TempDir(), "subscriptions.json")
+	saved, err := OpenFileRegistry(path, AllowPrivateURLs())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sub, err := saved.Create(recv.URL, []EventType{EventReceiptProcessed}, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Subscriptions saved before internal addresses were refused are not
+	// delivered to either
+	registry, err := OpenFileRegistry(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	outbox := NewMemoryOutbox()
+	d := newTestDispatcher(t, outbox, registry, WithMaxAttempts(1))
+	event, _ := NewReceiptEvent(EventReceiptProcessed, events.ReceiptProcessed{ReceiptID: "r1"})
+	_ = outbox.Add(context.Background(), event)
+	d.Notify()
+
+	waitFor(t, "the delivery to be dead-lettered", func() bool { return len(d.DeadLetters()) == 1 })
+	if recv.count() != 0 {
+		t.Errorf("Expected no requests to the internal receiver, got %d", recv.count())
+	}
+	deliveries := d.Deliveries(sub.ID)
+	if len(deliveries) != 1 || !strings.Contains(deliveries[0].Attempts[0].Error, "refusing to connect to internal address") {
+		t.Errorf("Expected the connection to be refused, got %+v", deliveries)
+	}
+}
+
+func TestDispatcherStopKeepsUnfinishedEvents(t *testing.T) {
+	recv := newReceiver(t, 1000)
+	registry := NewRegistry(AllowPrivateURLs())
+	if _, err := registry.Create(recv.URL, []EventType{EventReceiptProcessed}, ""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	outbox := NewMemoryOutbox()
+	d := newTestDispatcher(t, outbox, registry, WithMaxAttempts(1000))
+	event, _ := NewReceiptEvent(EventReceiptProcessed, events.ReceiptProcessed{ReceiptID: "r1"})
+	_ = outbox.Add(context.Background(), event)
+	d.Notify()
+
+	waitFor(t, "a failed attempt", func() bool { return recv.count() > 0 })
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := d.Stop(ctx); err != nil {
+		t.Fatalf("Unexpected error stopping: %v", err)
+	}
+
+	if pending(t, outbox) != 1 {
+		t.Errorf("Expected the unfinished event to stay in the outbox, got %d pending", pending(t, outbox))
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := NewDispatcher(NewMemoryOutbox(), NewRegistry(), WithBackoff(time.Second, 10*time.Second))
+
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{1, 500 * time.Millisecond, time.Second},
+		{2, time.Second, 2 * time.Second},
+		{3, 2 * time.Second, 4 * time.Second},
+		{10, 5 * time.Second, 10 * time.Second},
+	}
+
+	for _, tc := range tests {
+		for i := 0; i < 20; i++ {
+			if wait := d.backoff(tc.attempt); wait < tc.min || wait > tc.max {
+				t.Errorf("Expected backoff for attempt %d between %s and %s, got %s", tc.attempt, tc.min, tc.max, wait)
+			}
+		}
+	}
+}
+
+func TestDispatcherRestoresDeliveryLog(t *testing.T) {
+	recv := newReceiver(t, 1000)
+	registry := NewRegistry(AllowPrivateURLs())
+	sub, err := registry.Create(recv.URL, []EventType{EventReceiptProcessed}, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	quiet := WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// Stop while the delivery is still being retried
+	outbox, err := OpenFileOutbox(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	d := newTestDispatcher(t, outbox, registry, WithMaxAttempts(1000))
+	event, _ := NewReceiptEvent(EventReceiptProcessed, events.ReceiptProcessed{ReceiptID: "r1"})
+	_ = outbox.Add(context.Background(), event)
+	d.Notify()
+	waitFor(t, "a failed attempt", func() bool { return len(d.Deliveries(sub.ID)) == 1 && len(d.Deliveries(sub.ID)[0].Attempts) > 0 })
+	if err := d.Stop(context.Background()); err != nil {
+		t.Fatalf("Unexpected error stopping: %v", err)
+	}
+	outbox.Close()
+
+	// The pending delivery is restored with its attempts and resumed until
+	// it is dead-lettered
+	outbox, err = OpenFileOutbox(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	restored := NewDispatcher(outbox, registry, quiet).Deliveries(sub.ID)
+	if len(restored) != 1 || restored[0].Status != DeliveryPending || len(restored[0].Attempts) == 0 {
+		t.Fatalf("Expected the pending delivery to be restored, got %+v", restored)
+	}
+	maxAttempts := len(restored[0].Attempts) + 2
+	d = newTestDispatcher(t, outbox, registry, WithMaxAttempts(maxAttempts))
+	waitFor(t, "the event to be acknowledged", func() bool { return pending(t, outbox) == 0 })
+	if err := d.Stop(context.Background()); err != nil {
+		t.Fatalf("Unexpected error stopping: %v", err)
+	}
+	outbox.Close()
+
+	deliveries := d.Deliveries(sub.ID)
+	if len(deliveries) != 1 || deliveries[0].ID != restored[0].ID {
+		t.Fatalf("Expected delivery %s to be resumed, got %+v", restored[0].ID, deliveries)
+	}
+	if deliveries[0].Status != DeliveryFailed || len(deliveries[0].Attempts) != maxAttempts {
+		t.Errorf("Expected a failed delivery after %d attempts, got %+v", maxAttempts, deliveries[0])
+	}
+
+	// Dead letters survive another restart
+	outbox, err = OpenFileOutbox(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer outbox.Close()
+	deadLetters := NewDispatcher(outbox, registry, quiet).DeadLetters()
+	if len(deadLetters) != 1 || deadLetters[0].ID != restored[0].ID || len(deadLetters[0].Attempts) != maxAttempts {
+		t.Errorf("Expected delivery %s to be dead-lettered after a restart, got %+v", restored[0].ID, deadLetters)
+	}
+}
+
+func TestDispatcherMaxInFlight(t *testing.T) {
+	var mu sync.Mutex
+	active, peak := 0, 0
+	release := make(chan struct{})
+	recv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		active++
+		peak = max(peak, active)
+		mu.Unlock()
+		<-release
+		mu.Lock()
+		active--
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(recv.Close)
+	var once sync.Once
+	unblock := func() { once.Do(func() { close(release) }) }
+	t.Cleanup(unblock)
+	registry := NewRegistry(AllowPrivateURLs())
+	if _, err := registry.Create(recv.URL, []EventType{EventReceiptProcessed}, ""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	outbox := NewMemoryOutbox()
+	for i := 0; i < 5; i++ {
+		event, _ := NewReceiptEvent(EventReceiptProcessed, events.ReceiptProcessed{ReceiptID: fmt.Sprintf("r%d", i)})
+		_ = outbox.Add(context.Background(), event)
+	}
+	newTestDispatcher(t, outbox, registry, WithMaxInFlight(2))
+
+	waitFor(t, "two requests", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return active >= 2
+	})
+	// Give the dispatcher time to start more deliveries than it may
+	time.Sleep(50 * time.Millisecond)
+	unblock()
+	waitFor(t, "every event to be acknowledged", func() bool { return pending(t, outbox) == 0 })
+
+	mu.Lock()
+	defer mu.Unlock()
+	if peak != 2 {
+		t.Errorf("Expected at most 2 requests at once, got %d", peak)
+	}
+}
+
+func TestDispatcherLogSize(t *testing.T) {
+	recv := newReceiver(t, 0)
+	registry := NewRegistry(AllowPrivateURLs())
+	sub, err := registry.Create(recv.URL, []EventType{EventReceiptProcessed}, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	outbox := NewMemoryOutbox()
+	d := newTestDispatcher(t, outbox, registry, WithLogSize(2))
+	for _, id := range []string{"r1", "r2", "r3"} {
+		event, _ := NewReceiptEvent(EventReceiptProcessed, events.ReceiptProcessed{ReceiptID: id})
+		_ = outbox.Add(context.Background(), event)
+		d.Notify()
+		waitFor(t, "the event to be acknowledged", func() bool { return pending(t, outbox) == 0 })
+	}
+
+	if len(d.Deliveries(sub.ID)) != 2 {
+		t.Errorf("Expected 2 logged deliveries, got %d", len(d.Deliveries(sub.ID)))
+	}
+	// Deliveries dropped from the log are dropped from the outbox too
+	saved, _ := outbox.Deliveries(context.Background())
+	if len(saved) != 2 {
+		t.Errorf("Expected 2 saved deliveries, got %d", len(saved))
+	}
+}
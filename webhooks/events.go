@@ -0,0 +1,78 @@
+// Package webhooks delivers receipt events to subscriber URLs. The
+// Dispatcher is an events.Sink: domain events handed to it are written to its
+// outbox and delivered in the background, with signed requests, retries with
+// exponential backoff and a dead-letter list, so that slow or failing
+// subscribers never affect the request path or other sinks.
+package webhooks
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/marcelorm/receipt-processor/events"
+	"github.com/marcelorm/receipt-processor/models"
+)
+
+// EventType identifies the kind of change an event describes
+type EventType string
+
+// Event types that can be subscribed to
+const (
+	EventReceiptProcessed EventType = "receipt.processed" // A receipt was scored and stored
+	EventReceiptRescored  EventType = "receipt.rescored"  // A stored receipt was scored again
+	EventReceiptDeleted   EventType = "receipt.deleted"   // A stored receipt was deleted
+)
+
+// EventTypes lists every event type in the order they are documented
+var EventTypes = []EventType{EventReceiptProcessed, EventReceiptRescored, EventReceiptDeleted}
+
+// Valid reports whether t is a known event type
+func (t EventType) Valid() bool {
+	for _, known := range EventTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is a single change delivered to subscribers. It is also the JSON
+// body of every webhook request.
+type Event struct {
+	ID        string          `json:"id"`        // Unique event ID, stable across retries
+	Type      EventType       `json:"type"`      // Kind of change
+	CreatedAt time.Time       `json:"createdAt"` // When the change happened
+	Data      json.RawMessage `json:"data"`      // Type-specific payload
+}
+
+// ReceiptData is the payload of receipt events
+type ReceiptData struct {
+	ID          string              `json:"id"`
+	Retailer    string              `json:"retailer"`
+	Tenant      string              `json:"tenant,omitempty"`
+	Points      int                 `json:"points"`
+	Rules       []models.RuleResult `json:"rules"`
+	ProcessedAt time.Time           `json:"processedAt"`
+}
+
+// NewReceiptEvent creates an event of type t describing a scored receipt
+func NewReceiptEvent(t EventType, processed events.ReceiptProcessed) (Event, error) {
+	data, err := json.Marshal(ReceiptData{
+		ID:          processed.ReceiptID,
+		Retailer:    processed.Retailer,
+		Tenant:      processed.Tenant,
+		Points:      processed.Points,
+		Rules:       processed.Rules,
+		ProcessedAt: processed.ProcessedAt,
+	})
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		ID:        uuid.New().String(),
+		Type:      t,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	}, nil
+}
@@ -0,0 +1,356 @@
+package webhooks
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// Outbox holds events until they have been delivered to every subscriber,
+// along with the log of those deliveries
+type Outbox interface {
+	// Add appends an event to the outbox, unless an event with the same ID
+	// is already pending
+	Add(ctx context.Context, event Event) error
+
+	// Pending returns up to limit undelivered events, oldest first
+	Pending(ctx context.Context, limit int) ([]Event, error)
+
+	// Ack removes a delivered event from the outbox
+	Ack(ctx context.Context, id string) error
+
+	// SaveDelivery records the current state of a delivery, replacing any
+	// earlier state with the same ID
+	SaveDelivery(ctx context.Context, delivery Delivery) error
+
+	// DropDelivery removes a delivery from the log
+	DropDelivery(ctx context.Context, id string) error
+
+	// Deliveries returns the logged deliveries in the order they were first
+	// saved
+	Deliveries(ctx context.Context) ([]Delivery, error)
+}
+
+// MemoryOutbox is an Outbox that does not survive restarts
+type MemoryOutbox struct {
+	events     []Event
+	deliveries []Delivery
+	mutex      sync.Mutex
+}
+
+// Verify MemoryOutbox implements Outbox interface
+var _ Outbox = (*MemoryOutbox)(nil)
+
+// NewMemoryOutbox creates an empty in-memory outbox
+func NewMemoryOutbox() *MemoryOutbox {
+	return &MemoryOutbox{}
+}
+
+// Add appends an event to the outbox, unless it is already pending
+func (o *MemoryOutbox) Add(ctx context.Context, event Event) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if hasEvent(o.events, event.ID) {
+		return nil
+	}
+	o.events = append(o.events, event)
+	return nil
+}
+
+// Pending returns up to limit undelivered events, oldest first
+func (o *MemoryOutbox) Pending(ctx context.Context, limit int) ([]Event, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	n := min(limit, len(o.events))
+	return append([]Event(nil), o.events[:n]...), nil
+}
+
+// Ack removes a delivered event from the outbox
+func (o *MemoryOutbox) Ack(ctx context.Context, id string) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.events = removeEvent(o.events, id)
+	return nil
+}
+
+// SaveDelivery records the current state of a delivery
+func (o *MemoryOutbox) SaveDelivery(ctx context.Context, delivery Delivery) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.deliveries = putDelivery(o.deliveries, delivery)
+	return nil
+}
+
+// DropDelivery removes a delivery from the log
+func (o *MemoryOutbox) DropDelivery(ctx context.Context, id string) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.deliveries = removeDelivery(o.deliveries, id)
+	return nil
+}
+
+// Deliveries returns the logged deliveries in the order they were first saved
+func (o *MemoryOutbox) Deliveries(ctx context.Context) ([]Delivery, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	return cloneDeliveries(o.deliveries), nil
+}
+
+// hasEvent reports whether events holds an event with the given ID
+func hasEvent(events []Event, id string) bool {
+	return slices.ContainsFunc(events, func(e Event) bool { return e.ID == id })
+}
+
+// removeEvent returns events without the event with the given ID
+func removeEvent(events []Event, id string) []Event {
+	for i, event := range events {
+		if event.ID == id {
+			return append(events[:i], events[i+1:]...)
+		}
+	}
+	return events
+}
+
+// putDelivery returns deliveries with delivery replacing the entry with the
+// same ID, or appended when there is none
+func putDelivery(deliveries []Delivery, delivery Delivery) []Delivery {
+	delivery.Attempts = slices.Clone(delivery.Attempts)
+	i := slices.IndexFunc(deliveries, func(d Delivery) bool { return d.ID == delivery.ID })
+	if i < 0 {
+		return append(deliveries, delivery)
+	}
+	deliveries[i] = delivery
+	return deliveries
+}
+
+// removeDelivery returns deliveries without the delivery with the given ID
+func removeDelivery(deliveries []Delivery, id string) []Delivery {
+	return slices.DeleteFunc(deliveries, func(d Delivery) bool { return d.ID == id })
+}
+
+// cloneDeliveries returns a copy of deliveries that shares no attempts
+func cloneDeliveries(deliveries []Delivery) []Delivery {
+	clones := make([]Delivery, len(deliveries))
+	for i := range deliveries {
+		clones[i] = deliveries[i].clone()
+	}
+	return clones
+}
+
+// fileEntry is a line of a file outbox. Each line adds an event,
+// acknowledges one added earlier, records the state of a delivery or drops
+// a delivery from the log.
+type fileEntry struct {
+	Event        *Event    `json:"event,omitempty"`
+	Ack          string    `json:"ack,omitempty"`
+	Delivery     *Delivery `json:"delivery,omitempty"`
+	DropDelivery string    `json:"dropDelivery,omitempty"`
+}
+
+// FileOutbox is an Outbox persisted to an append-only JSON lines file, so
+// that undelivered events are retried and the delivery log is kept after a
+// restart. Every change is synced to disk before it returns.
+type FileOutbox struct {
+	file       *os.File
+	events     []Event
+	deliveries []Delivery
+	mutex      sync.Mutex
+}
+
+// Verify FileOutbox implements Outbox interface
+var _ Outbox = (*FileOutbox)(nil)
+
+// OpenFileOutbox opens the outbox stored at path, creating it if needed. The
+// file is compacted on open so that it only holds pending events and the
+// latest state of each logged delivery.
+func OpenFileOutbox(path string) (*FileOutbox, error) {
+	events, deliveries, err := readOutbox(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rewrite the pending events and deliveries to a new file and swap it in
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("creating outbox: %w", err)
+	}
+	o := &FileOutbox{file: file}
+	for i := range events {
+		if err := o.write(fileEntry{Event: &events[i]}); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	for i := range deliveries {
+		if err := o.write(fileEntry{Delivery: &deliveries[i]}); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("replacing outbox: %w", err)
+	}
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	o.events = events
+	o.deliveries = deliveries
+	return o, nil
+}
+
+// readOutbox replays the entries of the outbox at path, returning the
+// events that were never acknowledged and the deliveries still logged
+func readOutbox(path string) ([]Event, []Delivery, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening outbox: %w", err)
+	}
+	defer file.Close()
+
+	var events []Event
+	var deliveries []Delivery
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		var entry fileEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A crash can leave a partially written last line
+			break
+		}
+		if entry.Event != nil {
+			events = append(events, *entry.Event)
+		} else if entry.Ack != "" {
+			events = removeEvent(events, entry.Ack)
+		} else if entry.Delivery != nil {
+			deliveries = putDelivery(deliveries, *entry.Delivery)
+		} else if entry.DropDelivery != "" {
+			deliveries = removeDelivery(deliveries, entry.DropDelivery)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("reading outbox: %w", err)
+	}
+	return events, deliveries, nil
+}
+
+// syncDir flushes a directory so that a rename within it is durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("opening outbox directory: %w", err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("syncing outbox directory: %w", err)
+	}
+	return nil
+}
+
+// Add appends an event to the outbox, unless it is already pending
+func (o *FileOutbox) Add(ctx context.Context, event Event) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if hasEvent(o.events, event.ID) {
+		return nil
+	}
+	if err := o.write(fileEntry{Event: &event}); err != nil {
+		return err
+	}
+	o.events = append(o.events, event)
+	return nil
+}
+
+// Pending returns up to limit undelivered events, oldest first
+func (o *FileOutbox) Pending(ctx context.Context, limit int) ([]Event, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	n := min(limit, len(o.events))
+	return append([]Event(nil), o.events[:n]...), nil
+}
+
+// Ack removes a delivered event from the outbox
+func (o *FileOutbox) Ack(ctx context.Context, id string) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if err := o.write(fileEntry{Ack: id}); err != nil {
+		return err
+	}
+	o.events = removeEvent(o.events, id)
+	return nil
+}
+
+// SaveDelivery records the current state of a delivery
+func (o *FileOutbox) SaveDelivery(ctx context.Context, delivery Delivery) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if err := o.write(fileEntry{Delivery: &delivery}); err != nil {
+		return err
+	}
+	o.deliveries = putDelivery(o.deliveries, delivery)
+	return nil
+}
+
+// DropDelivery removes a delivery from the log
+func (o *FileOutbox) DropDelivery(ctx context.Context, id string) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if err := o.write(fileEntry{DropDelivery: id}); err != nil {
+		return err
+	}
+	o.deliveries = removeDelivery(o.deliveries, id)
+	return nil
+}
+
+// Deliveries returns the logged deliveries in the order they were first saved
+func (o *FileOutbox) Deliveries(ctx context.Context) ([]Delivery, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	return cloneDeliveries(o.deliveries), nil
+}
+
+// Close closes the outbox file
+func (o *FileOutbox) Close() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	return o.file.Close()
+}
+
+// write appends entry to the file and syncs it
+func (o *FileOutbox) write(entry fileEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("encoding outbox entry: %w", err)
+	}
+	if _, err := o.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("writing outbox: %w", err)
+	}
+	if err := o.file.Sync(); err != nil {
+		return fmt.Errorf("syncing outbox: %w", err)
+	}
+	return nil
+}
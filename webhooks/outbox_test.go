@@ -0,0 +1,112 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileOutbox(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+
+	outbox, err := OpenFileOutbox(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Adding a pending event again is ignored
+	for _, id := range []string{"e1", "e2", "e3", "e3"} {
+		if err := outbox.Add(ctx, Event{ID: id, Type: EventReceiptProcessed, Data: []byte(`{}`)}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := outbox.Ack(ctx, "e2"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, delivery := range []Delivery{
+		{ID: "d1", EventID: "e1", Status: DeliveryPending},
+		{ID: "d2", EventID: "e2", Status: DeliverySucceeded},
+		{ID: "d1", EventID: "e1", Status: DeliveryFailed, Attempts: []Attempt{{StatusCode: 500}}},
+	} {
+		if err := outbox.SaveDelivery(ctx, delivery); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := outbox.DropDelivery(ctx, "d2"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	outbox.Close()
+
+	// A crash while appending leaves a partial line, which is ignored
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	f.WriteString(`{"event":{"id":"e4"`)
+	f.Close()
+
+	// Pending events survive reopening, in order
+	outbox, err = OpenFileOutbox(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer outbox.Close()
+
+	events, err := outbox.Pending(ctx, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(events) != 2 || events[0].ID != "e1" || events[1].ID != "e3" {
+		t.Fatalf("Expected events e1 and e3, got %+v", events)
+	}
+
+	events, _ = outbox.Pending(ctx, 1)
+	if len(events) != 1 || events[0].ID != "e1" {
+		t.Errorf("Expected the limit to return only e1, got %+v", events)
+	}
+
+	// Only the latest state of each logged delivery is kept
+	deliveries, err := outbox.Deliveries(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].ID != "d1" || deliveries[0].Status != DeliveryFailed || len(deliveries[0].Attempts) != 1 {
+		t.Errorf("Expected only the failed delivery d1, got %+v", deliveries)
+	}
+
+	// The file is compacted to the pending events and deliveries on open
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines != 3 {
+		t.Errorf("Expected 3 lines after compaction, got %d", lines)
+	}
+}
+
+func TestMemoryOutbox(t *testing.T) {
+	ctx := context.Background()
+	outbox := NewMemoryOutbox()
+	_ = outbox.Add(ctx, Event{ID: "e1"})
+	_ = outbox.Add(ctx, Event{ID: "e2"})
+	_ = outbox.Add(ctx, Event{ID: "e2"})
+	_ = outbox.Ack(ctx, "e1")
+	_ = outbox.Ack(ctx, "unknown")
+
+	events, _ := outbox.Pending(ctx, 10)
+	if len(events) != 1 || events[0].ID != "e2" {
+		t.Errorf("Expected only e2 to be pending, got %+v", events)
+	}
+
+	_ = outbox.SaveDelivery(ctx, Delivery{ID: "d1", Status: DeliveryPending})
+	_ = outbox.SaveDelivery(ctx, Delivery{ID: "d2", Status: DeliveryPending})
+	_ = outbox.SaveDelivery(ctx, Delivery{ID: "d1", Status: DeliverySucceeded})
+	_ = outbox.DropDelivery(ctx, "d2")
+
+	deliveries, _ := outbox.Deliveries(ctx)
+	if len(deliveries) != 1 || deliveries[0].ID != "d1" || deliveries[0].Status != DeliverySucceeded {
+		t.Errorf("Expected only the succeeded delivery d1, got %+v", deliveries)
+	}
+}
@@ -0,0 +1,75 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers sent with every webhook request
+const (
+	HeaderEventID   = "X-Webhook-ID"        // ID of the event, stable across retries
+	HeaderEventType = "X-Webhook-Event"     // Type of the event
+	HeaderDelivery  = "X-Webhook-Delivery"  // ID of the delivery to this subscription
+	HeaderTimestamp = "X-Webhook-Timestamp" // Unix time the request was signed
+	HeaderSignature = "X-Webhook-Signature" // sha256=<hex HMAC of "timestamp.body">
+)
+
+// signaturePrefix precedes the hex-encoded signature
+const signaturePrefix = "sha256="
+
+// Errors returned by Verify
+var (
+	ErrMissingSignature = errors.New("missing webhook signature")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrExpiredSignature = errors.New("webhook timestamp outside the allowed tolerance")
+)
+
+// Sign returns the signature header value for body sent at timestamp. The
+// timestamp is signed along with the body so that captured requests cannot
+// be replayed later.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature headers of a webhook request against body.
+// Requests signed more than tolerance before or after now are rejected; a
+// zero tolerance skips the check.
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration) error {
+	signature := header.Get(HeaderSignature)
+	rawTimestamp := header.Get(HeaderTimestamp)
+	if signature == "" || rawTimestamp == "" {
+		return ErrMissingSignature
+	}
+	seconds, err := strconv.ParseInt(rawTimestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	timestamp := time.Unix(seconds, 0)
+	if tolerance > 0 && absDuration(time.Since(timestamp)) > tolerance {
+		return ErrExpiredSignature
+	}
+
+	expected := Sign(secret, timestamp, body)
+	if !strings.HasPrefix(signature, signaturePrefix) || !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// absDuration returns the absolute value of d
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
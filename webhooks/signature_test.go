@@ -0,0 +1,47 @@
+package webhooks
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	secret := "whsec_0123456789abcdef"
+	body := []byte(`{"id":"e1"}`)
+	now := time.Now()
+
+	headers := func(signature string, timestamp time.Time) http.Header {
+		h := http.Header{}
+		if signature != "" {
+			h.Set(HeaderSignature, signature)
+		}
+		h.Set(HeaderTimestamp, strconv.FormatInt(timestamp.Unix(), 10))
+		return h
+	}
+
+	tests := []struct {
+		name   string
+		header http.Header
+		body   []byte
+		want   error
+	}{
+		{"Valid signature", headers(Sign(secret, now, body), now), body, nil},
+		{"Missing signature", headers("", now), body, ErrMissingSignature},
+		{"Tampered body", headers(Sign(secret, now, body), now), []byte(`{"id":"e2"}`), ErrInvalidSignature},
+		{"Wrong secret", headers(Sign("another-secret-value", now, body), now), body, ErrInvalidSignature},
+		{"Timestamp not signed", headers(Sign(secret, now, body), now.Add(-time.Second)), body, ErrInvalidSignature},
+		{"Expired timestamp", headers(Sign(secret, now.Add(-time.Hour), body), now.Add(-time.Hour)), body, ErrExpiredSignature},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Verify(secret, tc.header, tc.body, 5*time.Minute)
+			if !errors.Is(err, tc.want) {
+				t.Errorf("Expected %v, got %v", tc.want, err)
+			}
+		})
+	}
+}
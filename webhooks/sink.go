@@ -0,0 +1,56 @@
+package webhooks
+
+import (
+	"context"
+	"slices"
+
+	"github.com/marcelorm/receipt-processor/events"
+)
+
+// Verify Dispatcher implements events.Sink interface
+var _ events.Sink = (*Dispatcher)(nil)
+
+// Name implements events.Sink
+func (d *Dispatcher) Name() string {
+	return "webhooks"
+}
+
+// Handle adds the webhook event for a domain event to the outbox and wakes
+// the dispatcher. The webhook event keeps the domain event's ID, and a
+// domain event handled again while its webhook event is pending or in the
+// delivery log is not added twice. Domain events without a webhook event
+// type are ignored.
+func (d *Dispatcher) Handle(ctx context.Context, envelope events.Envelope) error {
+	domainEvent, err := envelope.Decode()
+	if err != nil {
+		return err
+	}
+	processed, ok := domainEvent.(events.ReceiptProcessed)
+	if !ok {
+		return nil
+	}
+
+	event, err := NewReceiptEvent(EventReceiptProcessed, processed)
+	if err != nil {
+		return err
+	}
+	event.ID = envelope.ID
+	event.CreatedAt = envelope.OccurredAt
+	if d.logged(event.ID) {
+		return nil
+	}
+	if err := d.outbox.Add(ctx, event); err != nil {
+		return err
+	}
+	d.Notify()
+	return nil
+}
+
+// logged reports whether deliveries of the event with the given ID are in
+// the delivery log
+func (d *Dispatcher) logged(eventID string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return slices.ContainsFunc(d.deliveries, func(delivery *Delivery) bool { return delivery.EventID == eventID })
+}
@@ -0,0 +1,239 @@
+package webhooks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+)
+
+// minSecretLength is the shortest signing secret a subscriber may choose
+const minSecretLength = 16
+
+// Subscription registers a URL to receive events of the given types
+type Subscription struct {
+	ID        string      `json:"id"`
+	URL       string      `json:"url"`
+	Events    []EventType `json:"events"`
+	Secret    string      `json:"secret"` // Key used to sign deliveries
+	CreatedAt time.Time   `json:"createdAt"`
+}
+
+// Subscribes reports whether the subscription receives events of type t
+func (s Subscription) Subscribes(t EventType) bool {
+	return slices.Contains(s.Events, t)
+}
+
+// Registry holds the webhook subscriptions. When created with
+// OpenFileRegistry every change is saved to a file.
+type Registry struct {
+	path          string
+	allowPrivate  bool // Accept URLs of internal addresses
+	subscriptions []Subscription
+	mutex         sync.RWMutex
+}
+
+// RegistryOption configures a Registry
+type RegistryOption func(*Registry)
+
+// AllowPrivateURLs accepts subscriptions to loopback, private, link-local
+// and other internal addresses. They are rejected by default so that
+// subscribers cannot make the server call services on its own network.
+func AllowPrivateURLs() RegistryOption {
+	return func(r *Registry) {
+		r.allowPrivate = true
+	}
+}
+
+// NewRegistry creates an empty in-memory registry
+func NewRegistry(opts ...RegistryOption) *Registry {
+	r := &Registry{}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// OpenFileRegistry loads the subscriptions saved at path, if any, and saves
+// every later change to it
+func OpenFileRegistry(path string, opts ...RegistryOption) (*Registry, error) {
+	r := &Registry{path: path}
+	for _, opt := range opts {
+		opt(r)
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading webhook subscriptions: %w", err)
+	}
+	if err := json.Unmarshal(data, &r.subscriptions); err != nil {
+		return nil, fmt.Errorf("decoding webhook subscriptions: %w", err)
+	}
+	return r, nil
+}
+
+// Create validates and registers a subscription. A random secret is
+// generated when secret is empty.
+func (r *Registry) Create(rawURL string, events []EventType, secret string) (Subscription, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Subscription{}, rperrors.New(rperrors.ErrInvalidWebhook, "url must be an absolute http or https URL")
+	}
+	if !r.allowPrivate && internalHost(u.Hostname()) {
+		return Subscription{}, rperrors.New(rperrors.ErrInvalidWebhook, "url must not point to a private or loopback address")
+	}
+	if len(events) == 0 {
+		return Subscription{}, rperrors.New(rperrors.ErrInvalidWebhook, "at least one event type is required")
+	}
+	var types []EventType
+	for _, t := range events {
+		if !t.Valid() {
+			return Subscription{}, rperrors.New(rperrors.ErrInvalidWebhook, fmt.Sprintf("unknown event type %q", t))
+		}
+		if !slices.Contains(types, t) {
+			types = append(types, t)
+		}
+	}
+	if secret == "" {
+		secret = generateSecret()
+	} else if len(secret) < minSecretLength {
+		return Subscription{}, rperrors.New(rperrors.ErrInvalidWebhook,
+			fmt.Sprintf("secret must be at least %d characters", minSecretLength))
+	}
+
+	sub := Subscription{
+		ID:        uuid.New().String(),
+		URL:       u.String(),
+		Events:    types,
+		Secret:    secret,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	subscriptions := append(slices.Clip(r.subscriptions), sub)
+	if err := r.save(subscriptions); err != nil {
+		return Subscription{}, rperrors.Wrap(rperrors.ErrStorageFailure, err, "unable to save webhook subscription")
+	}
+	r.subscriptions = subscriptions
+	return sub, nil
+}
+
+// Get returns the subscription with the given ID
+func (r *Registry) Get(id string) (Subscription, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, sub := range r.subscriptions {
+		if sub.ID == id {
+			return sub, nil
+		}
+	}
+	return Subscription{}, rperrors.New(rperrors.ErrWebhookNotFound, fmt.Sprintf("webhook subscription with ID %s not found", id))
+}
+
+// List returns every subscription, oldest first
+func (r *Registry) List() []Subscription {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return slices.Clone(r.subscriptions)
+}
+
+// Matching returns the subscriptions that receive events of type t
+func (r *Registry) Matching(t EventType) []Subscription {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var matching []Subscription
+	for _, sub := range r.subscriptions {
+		if sub.Subscribes(t) {
+			matching = append(matching, sub)
+		}
+	}
+	return matching
+}
+
+// Delete removes the subscription with the given ID
+func (r *Registry) Delete(id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	i := slices.IndexFunc(r.subscriptions, func(sub Subscription) bool { return sub.ID == id })
+	if i < 0 {
+		return rperrors.New(rperrors.ErrWebhookNotFound, fmt.Sprintf("webhook subscription with ID %s not found", id))
+	}
+	subscriptions := slices.Delete(slices.Clone(r.subscriptions), i, i+1)
+	if err := r.save(subscriptions); err != nil {
+		return rperrors.Wrap(rperrors.ErrStorageFailure, err, "unable to delete webhook subscription")
+	}
+	r.subscriptions = subscriptions
+	return nil
+}
+
+// save writes subscriptions to the registry file, if any, replacing it
+// atomically
+func (r *Registry) save(subscriptions []Subscription) error {
+	if r.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(subscriptions, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, r.path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(r.path))
+}
+
+// generateSecret returns a random signing secret
+func generateSecret() string {
+	b := make([]byte, 32)
+	// crypto/rand.Read never returns an error
+	_, _ = rand.Read(b)
+	return "whsec_" + hex.EncodeToString(b)
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, which cloud providers
+// also use for internal services
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// internalHost reports whether host names the local machine or is an
+// internal address. Other host names are checked when connecting, once they
+// are resolved.
+func internalHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	addr, err := netip.ParseAddr(host)
+	return err == nil && internalAddr(addr)
+}
+
+// internalAddr reports whether addr is a loopback, private, link-local
+// (including cloud metadata services), unspecified or multicast address
+func internalAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() ||
+		addr.IsUnspecified() || sharedAddressSpace.Contains(addr)
+}
@@ -0,0 +1,98 @@
+package webhooks
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	rperrors "github.com/marcelorm/receipt-processor/errors"
+)
+
+func TestRegistryCreate(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		events  []EventType
+		secret  string
+		private bool // Create with AllowPrivateURLs
+		valid   bool
+	}{
+		{"Valid subscription", "https://example.com/hooks", []EventType{EventReceiptProcessed}, "", false, true},
+		{"Custom secret", "http://localhost:9000/hooks", EventTypes, "a-long-enough-secret", true, true},
+		{"Relative URL", "/hooks", []EventType{EventReceiptProcessed}, "", false, false},
+		{"Unsupported scheme", "ftp://example.com/hooks", []EventType{EventReceiptProcessed}, "", false, false},
+		{"No events", "https://example.com/hooks", nil, "", false, false},
+		{"Unknown event", "https://example.com/hooks", []EventType{"receipt.updated"}, "", false, false},
+		{"Event not yet raised", "https://example.com/hooks", []EventType{EventReceiptProcessed, EventReceiptDeleted}, "", false, true},
+		{"Short secret", "https://example.com/hooks", []EventType{EventReceiptProcessed}, "short", false, false},
+		{"Public address", "https://93.184.216.34/hooks", []EventType{EventReceiptProcessed}, "", false, true},
+		{"Localhost", "http://localhost:9000/hooks", []EventType{EventReceiptProcessed}, "", false, false},
+		{"Loopback address", "http://127.0.0.1:9000/hooks", []EventType{EventReceiptProcessed}, "", false, false},
+		{"IPv6 loopback address", "http://[::1]:9000/hooks", []EventType{EventReceiptProcessed}, "", false, false},
+		{"IPv4-mapped loopback address", "http://[::ffff:127.0.0.1]/hooks", []EventType{EventReceiptProcessed}, "", false, false},
+		{"Private address", "http://10.0.0.5/hooks", []EventType{EventReceiptProcessed}, "", false, false},
+		{"Metadata service", "http://169.254.169.254/latest/meta-data", []EventType{EventReceiptProcessed}, "", false, false},
+		{"Unspecified address", "http://0.0.0.0/hooks", []EventType{EventReceiptProcessed}, "", false, false},
+		{"Allowed private address", "http://10.0.0.5/hooks", []EventType{EventReceiptProcessed}, "", true, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var opts []RegistryOption
+			if tc.private {
+				opts = append(opts, AllowPrivateURLs())
+			}
+			sub, err := NewRegistry(opts...).Create(tc.url, tc.events, tc.secret)
+			if !tc.valid {
+				if !rperrors.IsCode(err, rperrors.ErrInvalidWebhook) {
+					t.Errorf("Expected error code %s, got %v", rperrors.ErrInvalidWebhook, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tc.secret == "" && !strings.HasPrefix(sub.Secret, "whsec_") {
+				t.Errorf("Expected a generated secret, got %q", sub.Secret)
+			}
+			if tc.secret != "" && sub.Secret != tc.secret {
+				t.Errorf("Expected secret %q, got %q", tc.secret, sub.Secret)
+			}
+		})
+	}
+}
+
+func TestFileRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "subscriptions.json")
+	registry, err := OpenFileRegistry(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	kept, err := registry.Create("https://example.com/a", []EventType{EventReceiptProcessed}, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	deleted, err := registry.Create("https://example.com/b", []EventType{EventReceiptDeleted}, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := registry.Delete(deleted.ID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := registry.Delete(deleted.ID); !rperrors.IsCode(err, rperrors.ErrWebhookNotFound) {
+		t.Errorf("Expected error code %s, got %v", rperrors.ErrWebhookNotFound, err)
+	}
+
+	reopened, err := OpenFileRegistry(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	subs := reopened.List()
+	if len(subs) != 1 || subs[0].ID != kept.ID || subs[0].Secret != kept.Secret {
+		t.Errorf("Expected only subscription %s to be reloaded, got %+v", kept.ID, subs)
+	}
+	if len(reopened.Matching(EventReceiptProcessed)) != 1 || len(reopened.Matching(EventReceiptDeleted)) != 0 {
+		t.Error("Expected matching to follow the subscribed event types")
+	}
+}